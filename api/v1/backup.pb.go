@@ -9,6 +9,7 @@ package v1
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
@@ -23,7 +24,15 @@ const (
 )
 
 type ListBackupsRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// page_size is the maximum amount of backups returned, all backups are returned if not set
+	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// page_token continues a listing with the next_page_token of the previous response
+	PageToken string `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// from only lists backups taken at or after this point in time
+	From *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	// to only lists backups taken before this point in time
+	To            *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -58,9 +67,40 @@ func (*ListBackupsRequest) Descriptor() ([]byte, []int) {
 	return file_v1_backup_proto_rawDescGZIP(), []int{0}
 }
 
+func (x *ListBackupsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListBackupsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *ListBackupsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ListBackupsRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
 type BackupListResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Backups       []*Backup              `protobuf:"bytes,1,rep,name=backups,proto3" json:"backups,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// backups are sorted by date ascending across all pages, the pinned copies follow after all other backups
+	Backups []*Backup `protobuf:"bytes,1,rep,name=backups,proto3" json:"backups,omitempty"`
+	// next_page_token is set if there may be more backups to list, the last page can be empty
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -102,11 +142,22 @@ func (x *BackupListResponse) GetBackups() []*Backup {
 	return nil
 }
 
+func (x *BackupListResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
 type Backup struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Version       string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
-	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Name      string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Version   string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// manifest describes the backup, it is not set for backups taken by former versions
+	Manifest *BackupManifest `protobuf:"bytes,4,opt,name=manifest,proto3" json:"manifest,omitempty"`
+	// pinned is set for pinned copies of backups, which are never removed by the retention
+	Pinned        bool `protobuf:"varint,5,opt,name=pinned,proto3" json:"pinned,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -162,16 +213,157 @@ func (x *Backup) GetTimestamp() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *Backup) GetManifest() *BackupManifest {
+	if x != nil {
+		return x.Manifest
+	}
+	return nil
+}
+
+func (x *Backup) GetPinned() bool {
+	if x != nil {
+		return x.Pinned
+	}
+	return false
+}
+
+type BackupManifest struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	DatabaseType             string                 `protobuf:"bytes,1,opt,name=database_type,json=databaseType,proto3" json:"database_type,omitempty"`
+	DatabaseVersion          string                 `protobuf:"bytes,2,opt,name=database_version,json=databaseVersion,proto3" json:"database_version,omitempty"`
+	CompressionMethod        string                 `protobuf:"bytes,3,opt,name=compression_method,json=compressionMethod,proto3" json:"compression_method,omitempty"`
+	EncryptionKeyFingerprint string                 `protobuf:"bytes,4,opt,name=encryption_key_fingerprint,json=encryptionKeyFingerprint,proto3" json:"encryption_key_fingerprint,omitempty"`
+	UncompressedSize         int64                  `protobuf:"varint,5,opt,name=uncompressed_size,json=uncompressedSize,proto3" json:"uncompressed_size,omitempty"`
+	CompressedSize           int64                  `protobuf:"varint,6,opt,name=compressed_size,json=compressedSize,proto3" json:"compressed_size,omitempty"`
+	Sha256                   string                 `protobuf:"bytes,7,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	SidecarVersion           string                 `protobuf:"bytes,8,opt,name=sidecar_version,json=sidecarVersion,proto3" json:"sidecar_version,omitempty"`
+	Duration                 *durationpb.Duration   `protobuf:"bytes,9,opt,name=duration,proto3" json:"duration,omitempty"`
+	Pod                      string                 `protobuf:"bytes,10,opt,name=pod,proto3" json:"pod,omitempty"`
+	Namespace                string                 `protobuf:"bytes,11,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *BackupManifest) Reset() {
+	*x = BackupManifest{}
+	mi := &file_v1_backup_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BackupManifest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BackupManifest) ProtoMessage() {}
+
+func (x *BackupManifest) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_backup_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BackupManifest.ProtoReflect.Descriptor instead.
+func (*BackupManifest) Descriptor() ([]byte, []int) {
+	return file_v1_backup_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BackupManifest) GetDatabaseType() string {
+	if x != nil {
+		return x.DatabaseType
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetDatabaseVersion() string {
+	if x != nil {
+		return x.DatabaseVersion
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetCompressionMethod() string {
+	if x != nil {
+		return x.CompressionMethod
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetEncryptionKeyFingerprint() string {
+	if x != nil {
+		return x.EncryptionKeyFingerprint
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetUncompressedSize() int64 {
+	if x != nil {
+		return x.UncompressedSize
+	}
+	return 0
+}
+
+func (x *BackupManifest) GetCompressedSize() int64 {
+	if x != nil {
+		return x.CompressedSize
+	}
+	return 0
+}
+
+func (x *BackupManifest) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetSidecarVersion() string {
+	if x != nil {
+		return x.SidecarVersion
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *BackupManifest) GetPod() string {
+	if x != nil {
+		return x.Pod
+	}
+	return ""
+}
+
+func (x *BackupManifest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
 type RestoreBackupRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Version string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// recovery_target is the point up to which the log following the backup is replayed, only supported by postgres with wal archiving.
+	// if not set, the whole log is replayed for the latest backup and no log is replayed for an older backup.
+	RecoveryTarget *RecoveryTarget `protobuf:"bytes,2,opt,name=recovery_target,json=recoveryTarget,proto3" json:"recovery_target,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *RestoreBackupRequest) Reset() {
 	*x = RestoreBackupRequest{}
-	mi := &file_v1_backup_proto_msgTypes[3]
+	mi := &file_v1_backup_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -183,7 +375,7 @@ func (x *RestoreBackupRequest) String() string {
 func (*RestoreBackupRequest) ProtoMessage() {}
 
 func (x *RestoreBackupRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_backup_proto_msgTypes[3]
+	mi := &file_v1_backup_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -196,7 +388,7 @@ func (x *RestoreBackupRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RestoreBackupRequest.ProtoReflect.Descriptor instead.
 func (*RestoreBackupRequest) Descriptor() ([]byte, []int) {
-	return file_v1_backup_proto_rawDescGZIP(), []int{3}
+	return file_v1_backup_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *RestoreBackupRequest) GetVersion() string {
@@ -206,6 +398,76 @@ func (x *RestoreBackupRequest) GetVersion() string {
 	return ""
 }
 
+func (x *RestoreBackupRequest) GetRecoveryTarget() *RecoveryTarget {
+	if x != nil {
+		return x.RecoveryTarget
+	}
+	return nil
+}
+
+type RecoveryTarget struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// time is a timestamp like 2024-01-02 15:04:05+00
+	Time string `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// lsn is a log sequence number like 0/3000060
+	Lsn string `protobuf:"bytes,2,opt,name=lsn,proto3" json:"lsn,omitempty"`
+	// name is a restore point created with pg_create_restore_point()
+	Name          string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecoveryTarget) Reset() {
+	*x = RecoveryTarget{}
+	mi := &file_v1_backup_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecoveryTarget) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecoveryTarget) ProtoMessage() {}
+
+func (x *RecoveryTarget) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_backup_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecoveryTarget.ProtoReflect.Descriptor instead.
+func (*RecoveryTarget) Descriptor() ([]byte, []int) {
+	return file_v1_backup_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RecoveryTarget) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *RecoveryTarget) GetLsn() string {
+	if x != nil {
+		return x.Lsn
+	}
+	return ""
+}
+
+func (x *RecoveryTarget) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
 type RestoreBackupResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -214,7 +476,7 @@ type RestoreBackupResponse struct {
 
 func (x *RestoreBackupResponse) Reset() {
 	*x = RestoreBackupResponse{}
-	mi := &file_v1_backup_proto_msgTypes[4]
+	mi := &file_v1_backup_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -226,7 +488,7 @@ func (x *RestoreBackupResponse) String() string {
 func (*RestoreBackupResponse) ProtoMessage() {}
 
 func (x *RestoreBackupResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_backup_proto_msgTypes[4]
+	mi := &file_v1_backup_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -239,7 +501,7 @@ func (x *RestoreBackupResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RestoreBackupResponse.ProtoReflect.Descriptor instead.
 func (*RestoreBackupResponse) Descriptor() ([]byte, []int) {
-	return file_v1_backup_proto_rawDescGZIP(), []int{4}
+	return file_v1_backup_proto_rawDescGZIP(), []int{6}
 }
 
 type GetBackupByVersionRequest struct {
@@ -251,7 +513,7 @@ type GetBackupByVersionRequest struct {
 
 func (x *GetBackupByVersionRequest) Reset() {
 	*x = GetBackupByVersionRequest{}
-	mi := &file_v1_backup_proto_msgTypes[5]
+	mi := &file_v1_backup_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -263,7 +525,7 @@ func (x *GetBackupByVersionRequest) String() string {
 func (*GetBackupByVersionRequest) ProtoMessage() {}
 
 func (x *GetBackupByVersionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_backup_proto_msgTypes[5]
+	mi := &file_v1_backup_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -276,7 +538,7 @@ func (x *GetBackupByVersionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetBackupByVersionRequest.ProtoReflect.Descriptor instead.
 func (*GetBackupByVersionRequest) Descriptor() ([]byte, []int) {
-	return file_v1_backup_proto_rawDescGZIP(), []int{5}
+	return file_v1_backup_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *GetBackupByVersionRequest) GetVersion() string {
@@ -295,7 +557,7 @@ type GetBackupByVersionResponse struct {
 
 func (x *GetBackupByVersionResponse) Reset() {
 	*x = GetBackupByVersionResponse{}
-	mi := &file_v1_backup_proto_msgTypes[6]
+	mi := &file_v1_backup_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -307,7 +569,7 @@ func (x *GetBackupByVersionResponse) String() string {
 func (*GetBackupByVersionResponse) ProtoMessage() {}
 
 func (x *GetBackupByVersionResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_backup_proto_msgTypes[6]
+	mi := &file_v1_backup_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -320,7 +582,7 @@ func (x *GetBackupByVersionResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetBackupByVersionResponse.ProtoReflect.Descriptor instead.
 func (*GetBackupByVersionResponse) Descriptor() ([]byte, []int) {
-	return file_v1_backup_proto_rawDescGZIP(), []int{6}
+	return file_v1_backup_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *GetBackupByVersionResponse) GetBackup() *Backup {
@@ -330,31 +592,236 @@ func (x *GetBackupByVersionResponse) GetBackup() *Backup {
 	return nil
 }
 
+type DeleteBackupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBackupRequest) Reset() {
+	*x = DeleteBackupRequest{}
+	mi := &file_v1_backup_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBackupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBackupRequest) ProtoMessage() {}
+
+func (x *DeleteBackupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_backup_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBackupRequest.ProtoReflect.Descriptor instead.
+func (*DeleteBackupRequest) Descriptor() ([]byte, []int) {
+	return file_v1_backup_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DeleteBackupRequest) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+type DeleteBackupResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBackupResponse) Reset() {
+	*x = DeleteBackupResponse{}
+	mi := &file_v1_backup_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBackupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBackupResponse) ProtoMessage() {}
+
+func (x *DeleteBackupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_backup_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBackupResponse.ProtoReflect.Descriptor instead.
+func (*DeleteBackupResponse) Descriptor() ([]byte, []int) {
+	return file_v1_backup_proto_rawDescGZIP(), []int{10}
+}
+
+type PinBackupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PinBackupRequest) Reset() {
+	*x = PinBackupRequest{}
+	mi := &file_v1_backup_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PinBackupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PinBackupRequest) ProtoMessage() {}
+
+func (x *PinBackupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_backup_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PinBackupRequest.ProtoReflect.Descriptor instead.
+func (*PinBackupRequest) Descriptor() ([]byte, []int) {
+	return file_v1_backup_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PinBackupRequest) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+type PinBackupResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// backup is the pinned copy of the requested backup
+	Backup        *Backup `protobuf:"bytes,1,opt,name=backup,proto3" json:"backup,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PinBackupResponse) Reset() {
+	*x = PinBackupResponse{}
+	mi := &file_v1_backup_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PinBackupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PinBackupResponse) ProtoMessage() {}
+
+func (x *PinBackupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_backup_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PinBackupResponse.ProtoReflect.Descriptor instead.
+func (*PinBackupResponse) Descriptor() ([]byte, []int) {
+	return file_v1_backup_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *PinBackupResponse) GetBackup() *Backup {
+	if x != nil {
+		return x.Backup
+	}
+	return nil
+}
+
 var File_v1_backup_proto protoreflect.FileDescriptor
 
 const file_v1_backup_proto_rawDesc = "" +
 	"\n" +
-	"\x0fv1/backup.proto\x12\x02v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x14\n" +
-	"\x12ListBackupsRequest\":\n" +
+	"\x0fv1/backup.proto\x12\x02v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xac\x01\n" +
+	"\x12ListBackupsRequest\x12\x1b\n" +
+	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x12.\n" +
+	"\x04from\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\"b\n" +
 	"\x12BackupListResponse\x12$\n" +
 	"\abackups\x18\x01 \x03(\v2\n" +
-	".v1.BackupR\abackups\"p\n" +
+	".v1.BackupR\abackups\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xb8\x01\n" +
 	"\x06Backup\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
 	"\aversion\x18\x02 \x01(\tR\aversion\x128\n" +
-	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"0\n" +
+	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12.\n" +
+	"\bmanifest\x18\x04 \x01(\v2\x12.v1.BackupManifestR\bmanifest\x12\x16\n" +
+	"\x06pinned\x18\x05 \x01(\bR\x06pinned\"\xcb\x03\n" +
+	"\x0eBackupManifest\x12#\n" +
+	"\rdatabase_type\x18\x01 \x01(\tR\fdatabaseType\x12)\n" +
+	"\x10database_version\x18\x02 \x01(\tR\x0fdatabaseVersion\x12-\n" +
+	"\x12compression_method\x18\x03 \x01(\tR\x11compressionMethod\x12<\n" +
+	"\x1aencryption_key_fingerprint\x18\x04 \x01(\tR\x18encryptionKeyFingerprint\x12+\n" +
+	"\x11uncompressed_size\x18\x05 \x01(\x03R\x10uncompressedSize\x12'\n" +
+	"\x0fcompressed_size\x18\x06 \x01(\x03R\x0ecompressedSize\x12\x16\n" +
+	"\x06sha256\x18\a \x01(\tR\x06sha256\x12'\n" +
+	"\x0fsidecar_version\x18\b \x01(\tR\x0esidecarVersion\x125\n" +
+	"\bduration\x18\t \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x10\n" +
+	"\x03pod\x18\n" +
+	" \x01(\tR\x03pod\x12\x1c\n" +
+	"\tnamespace\x18\v \x01(\tR\tnamespace\"m\n" +
 	"\x14RestoreBackupRequest\x12\x18\n" +
-	"\aversion\x18\x01 \x01(\tR\aversion\"\x17\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12;\n" +
+	"\x0frecovery_target\x18\x02 \x01(\v2\x12.v1.RecoveryTargetR\x0erecoveryTarget\"J\n" +
+	"\x0eRecoveryTarget\x12\x12\n" +
+	"\x04time\x18\x01 \x01(\tR\x04time\x12\x10\n" +
+	"\x03lsn\x18\x02 \x01(\tR\x03lsn\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\"\x17\n" +
 	"\x15RestoreBackupResponse\"5\n" +
 	"\x19GetBackupByVersionRequest\x12\x18\n" +
 	"\aversion\x18\x01 \x01(\tR\aversion\"@\n" +
 	"\x1aGetBackupByVersionResponse\x12\"\n" +
 	"\x06backup\x18\x01 \x01(\v2\n" +
-	".v1.BackupR\x06backup2\xe9\x01\n" +
+	".v1.BackupR\x06backup\"/\n" +
+	"\x13DeleteBackupRequest\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\"\x16\n" +
+	"\x14DeleteBackupResponse\",\n" +
+	"\x10PinBackupRequest\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\"7\n" +
+	"\x11PinBackupResponse\x12\"\n" +
+	"\x06backup\x18\x01 \x01(\v2\n" +
+	".v1.BackupR\x06backup2\xe6\x02\n" +
 	"\rBackupService\x12=\n" +
 	"\vListBackups\x12\x16.v1.ListBackupsRequest\x1a\x16.v1.BackupListResponse\x12D\n" +
 	"\rRestoreBackup\x12\x18.v1.RestoreBackupRequest\x1a\x19.v1.RestoreBackupResponse\x12S\n" +
-	"\x12GetBackupByVersion\x12\x1d.v1.GetBackupByVersionRequest\x1a\x1e.v1.GetBackupByVersionResponseBg\n" +
+	"\x12GetBackupByVersion\x12\x1d.v1.GetBackupByVersionRequest\x1a\x1e.v1.GetBackupByVersionResponse\x12A\n" +
+	"\fDeleteBackup\x12\x17.v1.DeleteBackupRequest\x1a\x18.v1.DeleteBackupResponse\x128\n" +
+	"\tPinBackup\x12\x14.v1.PinBackupRequest\x1a\x15.v1.PinBackupResponseBg\n" +
 	"\x06com.v1B\vBackupProtoP\x01Z(github.com/metal-stack/droptailer/api/v1\xa2\x02\x03VXX\xaa\x02\x02V1\xca\x02\x02V1\xe2\x02\x0eV1\\GPBMetadata\xea\x02\x02V1b\x06proto3"
 
 var (
@@ -369,32 +836,49 @@ func file_v1_backup_proto_rawDescGZIP() []byte {
 	return file_v1_backup_proto_rawDescData
 }
 
-var file_v1_backup_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_v1_backup_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_v1_backup_proto_goTypes = []any{
 	(*ListBackupsRequest)(nil),         // 0: v1.ListBackupsRequest
 	(*BackupListResponse)(nil),         // 1: v1.BackupListResponse
 	(*Backup)(nil),                     // 2: v1.Backup
-	(*RestoreBackupRequest)(nil),       // 3: v1.RestoreBackupRequest
-	(*RestoreBackupResponse)(nil),      // 4: v1.RestoreBackupResponse
-	(*GetBackupByVersionRequest)(nil),  // 5: v1.GetBackupByVersionRequest
-	(*GetBackupByVersionResponse)(nil), // 6: v1.GetBackupByVersionResponse
-	(*timestamppb.Timestamp)(nil),      // 7: google.protobuf.Timestamp
+	(*BackupManifest)(nil),             // 3: v1.BackupManifest
+	(*RestoreBackupRequest)(nil),       // 4: v1.RestoreBackupRequest
+	(*RecoveryTarget)(nil),             // 5: v1.RecoveryTarget
+	(*RestoreBackupResponse)(nil),      // 6: v1.RestoreBackupResponse
+	(*GetBackupByVersionRequest)(nil),  // 7: v1.GetBackupByVersionRequest
+	(*GetBackupByVersionResponse)(nil), // 8: v1.GetBackupByVersionResponse
+	(*DeleteBackupRequest)(nil),        // 9: v1.DeleteBackupRequest
+	(*DeleteBackupResponse)(nil),       // 10: v1.DeleteBackupResponse
+	(*PinBackupRequest)(nil),           // 11: v1.PinBackupRequest
+	(*PinBackupResponse)(nil),          // 12: v1.PinBackupResponse
+	(*timestamppb.Timestamp)(nil),      // 13: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),        // 14: google.protobuf.Duration
 }
 var file_v1_backup_proto_depIdxs = []int32{
-	2, // 0: v1.BackupListResponse.backups:type_name -> v1.Backup
-	7, // 1: v1.Backup.timestamp:type_name -> google.protobuf.Timestamp
-	2, // 2: v1.GetBackupByVersionResponse.backup:type_name -> v1.Backup
-	0, // 3: v1.BackupService.ListBackups:input_type -> v1.ListBackupsRequest
-	3, // 4: v1.BackupService.RestoreBackup:input_type -> v1.RestoreBackupRequest
-	5, // 5: v1.BackupService.GetBackupByVersion:input_type -> v1.GetBackupByVersionRequest
-	1, // 6: v1.BackupService.ListBackups:output_type -> v1.BackupListResponse
-	4, // 7: v1.BackupService.RestoreBackup:output_type -> v1.RestoreBackupResponse
-	6, // 8: v1.BackupService.GetBackupByVersion:output_type -> v1.GetBackupByVersionResponse
-	6, // [6:9] is the sub-list for method output_type
-	3, // [3:6] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	13, // 0: v1.ListBackupsRequest.from:type_name -> google.protobuf.Timestamp
+	13, // 1: v1.ListBackupsRequest.to:type_name -> google.protobuf.Timestamp
+	2,  // 2: v1.BackupListResponse.backups:type_name -> v1.Backup
+	13, // 3: v1.Backup.timestamp:type_name -> google.protobuf.Timestamp
+	3,  // 4: v1.Backup.manifest:type_name -> v1.BackupManifest
+	14, // 5: v1.BackupManifest.duration:type_name -> google.protobuf.Duration
+	5,  // 6: v1.RestoreBackupRequest.recovery_target:type_name -> v1.RecoveryTarget
+	2,  // 7: v1.GetBackupByVersionResponse.backup:type_name -> v1.Backup
+	2,  // 8: v1.PinBackupResponse.backup:type_name -> v1.Backup
+	0,  // 9: v1.BackupService.ListBackups:input_type -> v1.ListBackupsRequest
+	4,  // 10: v1.BackupService.RestoreBackup:input_type -> v1.RestoreBackupRequest
+	7,  // 11: v1.BackupService.GetBackupByVersion:input_type -> v1.GetBackupByVersionRequest
+	9,  // 12: v1.BackupService.DeleteBackup:input_type -> v1.DeleteBackupRequest
+	11, // 13: v1.BackupService.PinBackup:input_type -> v1.PinBackupRequest
+	1,  // 14: v1.BackupService.ListBackups:output_type -> v1.BackupListResponse
+	6,  // 15: v1.BackupService.RestoreBackup:output_type -> v1.RestoreBackupResponse
+	8,  // 16: v1.BackupService.GetBackupByVersion:output_type -> v1.GetBackupByVersionResponse
+	10, // 17: v1.BackupService.DeleteBackup:output_type -> v1.DeleteBackupResponse
+	12, // 18: v1.BackupService.PinBackup:output_type -> v1.PinBackupResponse
+	14, // [14:19] is the sub-list for method output_type
+	9,  // [9:14] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_v1_backup_proto_init() }
@@ -408,7 +892,7 @@ func file_v1_backup_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v1_backup_proto_rawDesc), len(file_v1_backup_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
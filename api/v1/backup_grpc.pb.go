@@ -22,6 +22,8 @@ const (
 	BackupService_ListBackups_FullMethodName        = "/v1.BackupService/ListBackups"
 	BackupService_RestoreBackup_FullMethodName      = "/v1.BackupService/RestoreBackup"
 	BackupService_GetBackupByVersion_FullMethodName = "/v1.BackupService/GetBackupByVersion"
+	BackupService_DeleteBackup_FullMethodName       = "/v1.BackupService/DeleteBackup"
+	BackupService_PinBackup_FullMethodName          = "/v1.BackupService/PinBackup"
 )
 
 // BackupServiceClient is the client API for BackupService service.
@@ -31,6 +33,8 @@ type BackupServiceClient interface {
 	ListBackups(ctx context.Context, in *ListBackupsRequest, opts ...grpc.CallOption) (*BackupListResponse, error)
 	RestoreBackup(ctx context.Context, in *RestoreBackupRequest, opts ...grpc.CallOption) (*RestoreBackupResponse, error)
 	GetBackupByVersion(ctx context.Context, in *GetBackupByVersionRequest, opts ...grpc.CallOption) (*GetBackupByVersionResponse, error)
+	DeleteBackup(ctx context.Context, in *DeleteBackupRequest, opts ...grpc.CallOption) (*DeleteBackupResponse, error)
+	PinBackup(ctx context.Context, in *PinBackupRequest, opts ...grpc.CallOption) (*PinBackupResponse, error)
 }
 
 type backupServiceClient struct {
@@ -71,6 +75,26 @@ func (c *backupServiceClient) GetBackupByVersion(ctx context.Context, in *GetBac
 	return out, nil
 }
 
+func (c *backupServiceClient) DeleteBackup(ctx context.Context, in *DeleteBackupRequest, opts ...grpc.CallOption) (*DeleteBackupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteBackupResponse)
+	err := c.cc.Invoke(ctx, BackupService_DeleteBackup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *backupServiceClient) PinBackup(ctx context.Context, in *PinBackupRequest, opts ...grpc.CallOption) (*PinBackupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PinBackupResponse)
+	err := c.cc.Invoke(ctx, BackupService_PinBackup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BackupServiceServer is the server API for BackupService service.
 // All implementations should embed UnimplementedBackupServiceServer
 // for forward compatibility.
@@ -78,6 +102,8 @@ type BackupServiceServer interface {
 	ListBackups(context.Context, *ListBackupsRequest) (*BackupListResponse, error)
 	RestoreBackup(context.Context, *RestoreBackupRequest) (*RestoreBackupResponse, error)
 	GetBackupByVersion(context.Context, *GetBackupByVersionRequest) (*GetBackupByVersionResponse, error)
+	DeleteBackup(context.Context, *DeleteBackupRequest) (*DeleteBackupResponse, error)
+	PinBackup(context.Context, *PinBackupRequest) (*PinBackupResponse, error)
 }
 
 // UnimplementedBackupServiceServer should be embedded to have
@@ -96,6 +122,12 @@ func (UnimplementedBackupServiceServer) RestoreBackup(context.Context, *RestoreB
 func (UnimplementedBackupServiceServer) GetBackupByVersion(context.Context, *GetBackupByVersionRequest) (*GetBackupByVersionResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetBackupByVersion not implemented")
 }
+func (UnimplementedBackupServiceServer) DeleteBackup(context.Context, *DeleteBackupRequest) (*DeleteBackupResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteBackup not implemented")
+}
+func (UnimplementedBackupServiceServer) PinBackup(context.Context, *PinBackupRequest) (*PinBackupResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method PinBackup not implemented")
+}
 func (UnimplementedBackupServiceServer) testEmbeddedByValue() {}
 
 // UnsafeBackupServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -170,6 +202,42 @@ func _BackupService_GetBackupByVersion_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BackupService_DeleteBackup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupServiceServer).DeleteBackup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BackupService_DeleteBackup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupServiceServer).DeleteBackup(ctx, req.(*DeleteBackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BackupService_PinBackup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PinBackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupServiceServer).PinBackup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BackupService_PinBackup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupServiceServer).PinBackup(ctx, req.(*PinBackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BackupService_ServiceDesc is the grpc.ServiceDesc for BackupService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -189,6 +257,14 @@ var BackupService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetBackupByVersion",
 			Handler:    _BackupService_GetBackupByVersion_Handler,
 		},
+		{
+			MethodName: "DeleteBackup",
+			Handler:    _BackupService_DeleteBackup_Handler,
+		},
+		{
+			MethodName: "PinBackup",
+			Handler:    _BackupService_PinBackup_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "v1/backup.proto",
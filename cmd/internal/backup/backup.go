@@ -2,17 +2,25 @@ package backup
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"log/slog"
 	"os"
-	"path"
+	"path/filepath"
+	"time"
 
 	backuproviders "github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/compress"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/metrics"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+	"github.com/metal-stack/v"
 	cron "github.com/robfig/cron/v3"
 	"golang.org/x/sync/semaphore"
 )
@@ -20,35 +28,49 @@ import (
 type BackuperConfig struct {
 	Log            *slog.Logger
 	BackupSchedule string
+	DatabaseType   string
 	DatabaseProber database.DatabaseProber
 	BackupProvider backuproviders.BackupProvider
 	Metrics        *metrics.Metrics
 	Compressor     *compress.Compressor
 	Encrypter      *encryption.Encrypter
+	// PodName and PodNamespace identify the sidecar in the backup manifests
+	PodName      string
+	PodNamespace string
+	// UploadLimiter limits the bandwidth of the upload to the backup provider, nil does not limit it
+	UploadLimiter *throttle.Limiter
 }
 
 type Backuper struct {
 	log            *slog.Logger
 	backupSchedule string
+	dbType         string
 	db             database.DatabaseProber
 	bp             backuproviders.BackupProvider
 	metrics        *metrics.Metrics
 	comp           *compress.Compressor
 	sem            *semaphore.Weighted
 	encrypter      *encryption.Encrypter
+	podName        string
+	podNamespace   string
+	uploadLimiter  *throttle.Limiter
 }
 
 func New(config *BackuperConfig) *Backuper {
 	return &Backuper{
 		log:            config.Log,
 		backupSchedule: config.BackupSchedule,
+		dbType:         config.DatabaseType,
 		db:             config.DatabaseProber,
 		bp:             config.BackupProvider,
 		metrics:        config.Metrics,
 		comp:           config.Compressor,
 		// sem guards backups to be taken concurrently
-		sem:       semaphore.NewWeighted(1),
-		encrypter: config.Encrypter,
+		sem:           semaphore.NewWeighted(1),
+		encrypter:     config.Encrypter,
+		podName:       config.PodName,
+		podNamespace:  config.PodNamespace,
+		uploadLimiter: config.UploadLimiter,
 	}
 }
 
@@ -85,7 +107,13 @@ func (b *Backuper) CreateBackup(ctx context.Context) error {
 	}
 	defer b.sem.Release(1)
 
+	start := time.Now()
+
 	err := b.db.Backup(ctx)
+	if errors.Is(err, database.ErrSkipBackup) {
+		b.log.Info("not uploading a backup", "reason", err)
+		return nil
+	}
 	if err != nil {
 		b.metrics.CountError("create")
 		return fmt.Errorf("database backup failed: %w", err)
@@ -95,44 +123,42 @@ func (b *Backuper) CreateBackup(ctx context.Context) error {
 
 	backupArchiveName := b.bp.GetNextBackupName(ctx)
 
-	backupFilePath := path.Join(constants.BackupDir, backupArchiveName)
-	if err := os.RemoveAll(backupFilePath + b.comp.Extension()); err != nil {
-		b.metrics.CountError("delete_prior")
-		return fmt.Errorf("could not delete priorly uploaded backup: %w", err)
-	}
-
-	filename, err := b.comp.Compress(backupFilePath)
+	manifest, err := b.newManifest(ctx, start)
 	if err != nil {
-		b.metrics.CountError("compress")
-		return fmt.Errorf("unable to compress backup: %w", err)
+		b.metrics.CountError("create")
+		return err
 	}
 
-	b.log.Info("compressed backup")
+	// the archive is compressed, encrypted and uploaded as a stream such that no intermediate files are required
+	pr, pw := io.Pipe()
 
-	if b.encrypter != nil {
-		filename, err = b.encrypter.Encrypt(filename)
-		if err != nil {
-			b.metrics.CountError("encrypt")
-			return fmt.Errorf("error encrypting backup: %w", err)
-		}
-		b.log.Info("encrypted backup")
-	}
+	archiveErr := make(chan error, 1)
+	go func() {
+		err := b.writeArchive(pw)
+		_ = pw.CloseWithError(err)
+		archiveErr <- err
+	}()
 
-	file, err := os.Open(filename)
-	if err != nil {
-		b.metrics.CountError("open")
-		return fmt.Errorf("error opening backup file: %w", err)
-	}
+	b.log.Info("uploading backup", "name", backupArchiveName)
 
-	err = b.bp.UploadBackup(ctx, file)
-	if err != nil {
+	reader := &checksumReader{r: b.uploadLimiter.Reader(ctx, pr), hash: sha256.New(), start: start, manifest: manifest}
+	uploadErr := b.bp.UploadBackup(ctx, reader, manifest)
+	// unblocks the archive writer in case the provider stopped reading
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+
+	err = <-archiveErr
+	if err != nil && (uploadErr == nil || !errors.Is(err, io.ErrClosedPipe)) {
+		b.metrics.CountError("compress")
+		return fmt.Errorf("unable to compress backup: %w", err)
+	}
+	if uploadErr != nil {
 		b.metrics.CountError("upload")
-		return fmt.Errorf("error uploading backup: %w", err)
+		return fmt.Errorf("error uploading backup: %w", uploadErr)
 	}
 
 	b.log.Info("uploaded backup to backup provider bucket")
 
-	b.metrics.CountBackup(filename)
+	b.metrics.CountBackup(reader.n)
 
 	err = b.bp.CleanupBackups(ctx)
 	if err != nil {
@@ -144,3 +170,80 @@ func (b *Backuper) CreateBackup(ctx context.Context) error {
 
 	return nil
 }
+
+// newManifest describes the backup which is about to be uploaded, the checksum and the size of the archive are added during the upload
+func (b *Backuper) newManifest(ctx context.Context, start time.Time) (*backuproviders.Manifest, error) {
+	manifest := &backuproviders.Manifest{
+		DatabaseType:      b.dbType,
+		CompressionMethod: b.comp.Method(),
+		SidecarVersion:    v.V.String(),
+		Pod:               b.podName,
+		Namespace:         b.podNamespace,
+		Date:              start,
+	}
+
+	if b.encrypter != nil {
+		manifest.EncryptionKeyFingerprint = b.encrypter.Fingerprint()
+	}
+
+	if versioner, ok := b.db.(database.DatabaseVersioner); ok {
+		version, err := versioner.Version(ctx)
+		if err != nil {
+			// the manifest is informational, so the backup is still taken
+			b.log.Error("unable to determine database version", "error", err)
+		}
+		manifest.DatabaseVersion = version
+	}
+
+	err := filepath.Walk(constants.BackupDir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			manifest.UncompressedSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine backup size: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// writeArchive writes the compressed and optionally encrypted archive of the backup directory to w
+func (b *Backuper) writeArchive(w io.Writer) error {
+	if b.encrypter != nil {
+		var err error
+		w, err = b.encrypter.Encrypt(w)
+		if err != nil {
+			return fmt.Errorf("error encrypting backup: %w", err)
+		}
+	}
+
+	return b.comp.Compress(w, constants.BackupDir)
+}
+
+// checksumReader counts and hashes the bytes read from the underlying reader,
+// once the reader is exhausted the manifest is completed with the size and the checksum of the archive
+type checksumReader struct {
+	r        io.Reader
+	n        int64
+	hash     hash.Hash
+	start    time.Time
+	manifest *backuproviders.Manifest
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	_, _ = c.hash.Write(p[:n])
+
+	if errors.Is(err, io.EOF) {
+		c.manifest.CompressedSize = c.n
+		c.manifest.SHA256 = hex.EncodeToString(c.hash.Sum(nil))
+		c.manifest.Duration = time.Since(c.start)
+	}
+
+	return n, err
+}
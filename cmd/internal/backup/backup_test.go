@@ -0,0 +1,46 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/metrics"
+)
+
+type skippingProber struct{}
+
+func (skippingProber) Probe(context.Context) error { return nil }
+
+func (skippingProber) Backup(context.Context) error {
+	return fmt.Errorf("%w: this database is not primary", database.ErrSkipBackup)
+}
+
+func TestBackuper_CreateBackupSkipped(t *testing.T) {
+	ctx := context.Background()
+
+	bp, err := local.New(slog.Default(), &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+	require.NoError(t, bp.EnsureBackupBucket(ctx))
+
+	b := New(&BackuperConfig{
+		Log:            slog.Default(),
+		DatabaseType:   "mongodb",
+		DatabaseProber: skippingProber{},
+		BackupProvider: bp,
+		Metrics:        metrics.New(),
+	})
+
+	err = b.CreateBackup(ctx)
+	require.NoError(t, err)
+
+	versions, err := bp.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Empty(t, versions.List(), "a skipped backup must not be uploaded")
+}
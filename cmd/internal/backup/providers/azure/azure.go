@@ -0,0 +1,434 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	defaultBackupName = "db"
+)
+
+// BackupProviderAzure implements the backup provider interface for Azure Blob Storage
+type BackupProviderAzure struct {
+	log    *slog.Logger
+	c      *azblob.Client
+	config *BackupProviderConfigAzure
+	suffix string
+}
+
+// BackupProviderConfigAzure provides configuration for the BackupProviderAzure
+type BackupProviderConfigAzure struct {
+	ContainerName    string
+	AccountName      string
+	AccountKey       string
+	Endpoint         string
+	BackupName       string
+	ObjectPrefix     string
+	ObjectsToKeep    int64
+	ObjectDaysToKeep *int64
+	Suffix           string
+	// Retention is a tiered retention policy, if configured it replaces ObjectsToKeep and ObjectDaysToKeep
+	Retention common.Retention
+}
+
+func (c *BackupProviderConfigAzure) validate() error {
+	if c.ContainerName == "" {
+		return errors.New("azure container name must not be empty")
+	}
+	if c.AccountName == "" {
+		return errors.New("azure storage account name must not be empty")
+	}
+	if c.AccountKey == "" {
+		return errors.New("azure storage account key must not be empty")
+	}
+	if c.ObjectDaysToKeep != nil && *c.ObjectDaysToKeep < 0 {
+		return errors.New("azure object days to keep must not be negative")
+	}
+	return c.Retention.Validate()
+}
+
+// New returns an Azure backup provider
+func New(log *slog.Logger, cfg *BackupProviderConfigAzure) (*BackupProviderAzure, error) {
+	if cfg == nil {
+		return nil, errors.New("azure backup provider requires a provider config")
+	}
+
+	if cfg.ObjectsToKeep == 0 {
+		cfg.ObjectsToKeep = constants.DefaultObjectsToKeep
+	}
+	if cfg.BackupName == "" {
+		cfg.BackupName = defaultBackupName
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", cfg.AccountName)
+	}
+
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure storage account credentials: %w", err)
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(cfg.Endpoint, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackupProviderAzure{
+		c:      client,
+		config: cfg,
+		log:    log,
+		suffix: cfg.Suffix,
+	}, nil
+}
+
+// EnsureBackupBucket ensures a backup bucket at the backup provider
+func (b *BackupProviderAzure) EnsureBackupBucket(ctx context.Context) error {
+	_, err := b.c.CreateContainer(ctx, b.config.ContainerName, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return fmt.Errorf("unable to create backup container: %w", err)
+	}
+
+	return nil
+}
+
+// CleanupBackups cleans up backups according to the given backup cleanup policy at the backup provider
+func (b *BackupProviderAzure) CleanupBackups(ctx context.Context) error {
+	versions, err := b.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var maxAge time.Duration
+	if b.config.ObjectDaysToKeep != nil {
+		maxAge = time.Duration(*b.config.ObjectDaysToKeep) * 24 * time.Hour
+	}
+
+	expired := common.Expired(versions.List(), b.config.ObjectsToKeep, maxAge, time.Now())
+	if b.config.Retention.Enabled() {
+		expired = b.config.Retention.Expired(versions.List())
+	}
+
+	var errs []error
+	for _, v := range expired {
+		b.log.Info("deleting expired backup", "blob", v.Name, "date", v.Date.String())
+
+		for _, name := range []string{v.Name, common.ManifestName(v.Name, "")} {
+			_, err := b.c.DeleteBlob(ctx, b.config.ContainerName, name, nil)
+			if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+				errs = append(errs, fmt.Errorf("unable to delete blob %s: %w", name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteBackup deletes the given backup version together with its manifest
+func (b *BackupProviderAzure) DeleteBackup(ctx context.Context, version *providers.BackupVersion) error {
+	b.log.Info("deleting backup", "blob", version.Name, "date", version.Date.String())
+
+	_, err := b.c.DeleteBlob(ctx, b.config.ContainerName, version.Name, nil)
+	if err != nil {
+		return fmt.Errorf("unable to delete blob %s: %w", version.Name, err)
+	}
+
+	manifest := common.ManifestName(version.Name, "")
+	_, err = b.c.DeleteBlob(ctx, b.config.ContainerName, manifest, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("unable to delete blob %s: %w", manifest, err)
+	}
+
+	return nil
+}
+
+// PinBackup copies the given backup version together with its manifest to the pinned directory
+func (b *BackupProviderAzure) PinBackup(ctx context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	if common.IsPinned(version.Name) {
+		return nil, fmt.Errorf("backup %s is already pinned", version.Version)
+	}
+
+	name := common.PinnedName(version.Name, b.config.BackupName, version.Date)
+
+	b.log.Info("pinning backup", "blob", version.Name, "pinned", name)
+
+	err := b.copyBlob(ctx, version.Name, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.copyBlob(ctx, common.ManifestName(version.Name, ""), common.ManifestName(name, ""))
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, err
+	}
+
+	date, pinnedVersion, _ := common.ParseTimestampedName(name, b.config.BackupName)
+
+	return &providers.BackupVersion{
+		Name:    name,
+		Version: common.PinnedVersion(pinnedVersion),
+		Date:    date,
+	}, nil
+}
+
+// copyBlob copies a blob by streaming it through the sidecar, a server-side copy would require a shared access signature for the source
+func (b *BackupProviderAzure) copyBlob(ctx context.Context, source, destination string) error {
+	resp, err := b.c.DownloadStream(ctx, b.config.ContainerName, source, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	_, err = b.c.UploadStream(ctx, b.config.ContainerName, destination, resp.Body, nil)
+	if err != nil {
+		return fmt.Errorf("unable to copy blob %s: %w", source, err)
+	}
+
+	return nil
+}
+
+// DownloadBackup downloads the given backup version to the specified folder
+func (b *BackupProviderAzure) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
+	b.log.Info("downloading", "blob", version.Name, "version", version.Version)
+
+	resp, err := b.c.DownloadStream(ctx, b.config.ContainerName, version.Name, nil)
+	if err != nil {
+		return fmt.Errorf("backup not found: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	_, err = io.Copy(writer, resp.Body)
+	if err != nil {
+		return fmt.Errorf("error writing file from azure to filesystem: %w", err)
+	}
+
+	return nil
+}
+
+// DownloadManifest returns the manifest stored alongside the given backup version
+func (b *BackupProviderAzure) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	resp, err := b.c.DownloadStream(ctx, b.config.ContainerName, common.ManifestName(version.Name, ""), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, providers.ErrManifestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	return common.DecodeManifest(resp.Body)
+}
+
+// UploadBackup uploads a backup to the backup provider
+func (b *BackupProviderAzure) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
+	destination := common.TimestampedName(b.config.BackupName, common.UploadDate(manifest)) + b.suffix
+	if b.config.ObjectPrefix != "" {
+		destination = b.config.ObjectPrefix + "/" + destination
+	}
+
+	b.log.Debug("uploading object", "dest", destination)
+
+	_, err := b.c.UploadStream(ctx, b.config.ContainerName, destination, reader, nil)
+	if err != nil {
+		return err
+	}
+
+	if manifest == nil {
+		return nil
+	}
+
+	encoded, err := common.EncodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.c.UploadStream(ctx, b.config.ContainerName, common.ManifestName(destination, ""), encoded, nil)
+	if err != nil {
+		return fmt.Errorf("unable to upload manifest: %w", err)
+	}
+
+	return nil
+}
+
+// IsRetryable returns true for throttling, server errors and connection errors
+func (b *BackupProviderAzure) IsRetryable(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return common.IsNetworkError(err)
+}
+
+// GetNextBackupName returns a name for the next backup archive that is going to be uploaded
+func (b *BackupProviderAzure) GetNextBackupName(_ context.Context) string {
+	// the blob name gets a timestamp on upload, the local archive name can therefore be constant
+	return b.config.BackupName
+}
+
+// ListBackups lists the available backups of the backup provider
+func (b *BackupProviderAzure) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
+	opts := &azblob.ListBlobsFlatOptions{}
+	if b.config.ObjectPrefix != "" {
+		opts.Prefix = new(b.config.ObjectPrefix + "/")
+	}
+
+	var blobs []*container.BlobItem
+
+	pager := b.c.NewListBlobsFlatPager(b.config.ContainerName, opts)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		blobs = append(blobs, page.Segment.BlobItems...)
+	}
+
+	return backupVersionsAzure{
+		blobs:      blobs,
+		backupName: b.config.BackupName,
+	}, nil
+}
+
+// ListBackupsPage lists a page of the backups in the order of common.CompareListed with the marker of the blob listing.
+// the blob names contain the timestamps of the backups, so they are listed by date.
+func (b *BackupProviderAzure) ListBackupsPage(ctx context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	return common.ListPage(ctx, opts, b.listPage)
+}
+
+// listPage lists up to size blobs of the backups or the pinned copies
+func (b *BackupProviderAzure) listPage(ctx context.Context, pinned bool, marker string, size int) ([]*providers.BackupVersion, string, error) {
+	dir := ""
+	if b.config.ObjectPrefix != "" {
+		dir = b.config.ObjectPrefix + "/"
+	}
+
+	opts := &azblob.ListBlobsFlatOptions{
+		Prefix:     new(dir + b.config.BackupName + "-"),
+		MaxResults: new(int32(min(size, math.MaxInt32))), // nolint:gosec
+	}
+	if pinned {
+		opts.Prefix = new(dir + common.PinnedDir + "/")
+	}
+	if marker != "" {
+		opts.Marker = new(marker)
+	}
+
+	page, err := b.c.NewListBlobsFlatPager(b.config.ContainerName, opts).NextPage(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	versions := backupVersionsAzure{
+		blobs:      page.Segment.BlobItems,
+		backupName: b.config.BackupName,
+	}.List()
+	slices.SortFunc(versions, common.CompareListed)
+
+	next := ""
+	if page.NextMarker != nil {
+		next = *page.NextMarker
+	}
+
+	return versions, next, nil
+}
+
+// PutObject stores an object in the objects directory next to the backups
+func (b *BackupProviderAzure) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	_, err := b.c.UploadStream(ctx, b.config.ContainerName, common.ObjectsRoot(b.config.ObjectPrefix)+name, reader, nil)
+	if err != nil {
+		return fmt.Errorf("unable to upload object %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// GetObject writes the object with the given name to writer
+func (b *BackupProviderAzure) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	resp, err := b.c.DownloadStream(ctx, b.config.ContainerName, common.ObjectsRoot(b.config.ObjectPrefix)+name, nil)
+	if err != nil {
+		return fmt.Errorf("unable to download object %s: %w", name, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	_, err = io.Copy(writer, resp.Body)
+	return err
+}
+
+// ListObjects returns the objects whose names start with the given prefix
+func (b *BackupProviderAzure) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	root := common.ObjectsRoot(b.config.ObjectPrefix)
+
+	pager := b.c.NewListBlobsFlatPager(b.config.ContainerName, &azblob.ListBlobsFlatOptions{
+		Prefix: new(root + prefix),
+	})
+
+	var objects []*providers.Object
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, blob := range page.Segment.BlobItems {
+			if blob.Name == nil {
+				continue
+			}
+
+			object := &providers.Object{Name: strings.TrimPrefix(*blob.Name, root)}
+			if blob.Properties != nil && blob.Properties.LastModified != nil {
+				object.Date = *blob.Properties.LastModified
+			}
+
+			objects = append(objects, object)
+		}
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object with the given name
+func (b *BackupProviderAzure) DeleteObject(ctx context.Context, name string) error {
+	_, err := b.c.DeleteBlob(ctx, b.config.ContainerName, common.ObjectsRoot(b.config.ObjectPrefix)+name, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("unable to delete object %s: %w", name, err)
+	}
+
+	return nil
+}
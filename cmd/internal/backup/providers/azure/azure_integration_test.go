@@ -0,0 +1,255 @@
+//go:build integration
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tlog "github.com/testcontainers/testcontainers-go/log"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/compress"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	// well-known development credentials of azurite, see https://learn.microsoft.com/en-us/azure/storage/common/storage-use-azurite#well-known-storage-account-and-key
+	azuriteAccountName = "devstoreaccount1"
+	azuriteAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==" //nolint:gosec
+)
+
+func Test_BackupProviderAzure(t *testing.T) {
+	var (
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+		log         = slog.Default()
+	)
+
+	defer cancel()
+
+	c, conn := startAzuriteContainer(t, ctx)
+	defer func() {
+		if t.Failed() {
+			r, err := c.Logs(ctx)
+			require.NoError(t, err)
+
+			if err == nil {
+				logs, err := io.ReadAll(r)
+				require.NoError(t, err)
+
+				fmt.Println(string(logs))
+			}
+		}
+		err := c.Terminate(ctx)
+		require.NoError(t, err)
+	}()
+
+	var (
+		backupAmount  = 5
+		objectsToKeep = 3
+		prefix        = fmt.Sprintf("test-with-%d", backupAmount)
+
+		fs = afero.NewMemMapFs()
+	)
+
+	compressor, err := compress.New("targz")
+	require.NoError(t, err)
+
+	p, err := New(log, &BackupProviderConfigAzure{
+		ContainerName: "test",
+		AccountName:   azuriteAccountName,
+		AccountKey:    azuriteAccountKey,
+		Endpoint:      conn.Endpoint,
+		ObjectPrefix:  prefix,
+		ObjectsToKeep: int64(objectsToKeep),
+		Suffix:        compressor.Extension(),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, p)
+
+	t.Run("ensure backup bucket", func(t *testing.T) {
+		err := p.EnsureBackupBucket(ctx)
+		require.NoError(t, err)
+
+		// must be idempotent
+		err = p.EnsureBackupBucket(ctx)
+		require.NoError(t, err)
+	})
+
+	if t.Failed() {
+		return
+	}
+
+	t.Run("verify upload", func(t *testing.T) {
+		for i := range backupAmount {
+			backupName := p.GetNextBackupName(ctx) + ".tar.gz"
+			assert.Equal(t, "db.tar.gz", backupName)
+
+			backupPath := path.Join(constants.UploadDir, backupName)
+			backupContent := fmt.Sprintf("precious data %d", i)
+
+			err = afero.WriteFile(fs, backupPath, []byte(backupContent), 0600)
+			require.NoError(t, err)
+
+			backupFile, err := fs.Open(backupPath)
+			require.NoError(t, err)
+			err = p.UploadBackup(ctx, backupFile, nil)
+			require.NoError(t, err)
+
+			// cleaning up after test
+			err = fs.Remove(backupPath)
+			require.NoError(t, err)
+		}
+	})
+
+	if t.Failed() {
+		return
+	}
+
+	t.Run("list backups", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		_, err = versions.Get("foo")
+		require.Error(t, err)
+
+		allVersions := versions.List()
+		require.Len(t, allVersions, backupAmount)
+
+		for i, v := range allVersions {
+			assert.True(t, strings.HasPrefix(v.Name, prefix+"/db-"))
+			assert.True(t, strings.HasSuffix(v.Name, ".tar.gz"))
+			assert.NotZero(t, v.Date)
+
+			getVersion, err := versions.Get(v.Version)
+			require.NoError(t, err)
+			assert.Equal(t, v, getVersion)
+
+			if i == 0 {
+				continue
+			}
+			assert.True(t, v.Date.Before(allVersions[i-1].Date))
+		}
+
+		latestVersion := versions.Latest()
+		assert.Equal(t, allVersions[0], latestVersion)
+	})
+
+	if t.Failed() {
+		return
+	}
+
+	t.Run("list backups page by page", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		// the pages list the oldest backups first
+		want := versions.List()
+		slices.Reverse(want)
+
+		var (
+			got   []*providers.BackupVersion
+			token string
+		)
+		for {
+			page, next, err := p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 2, PageToken: token})
+			require.NoError(t, err)
+
+			got = append(got, page...)
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		assert.Equal(t, want, got)
+	})
+
+	if t.Failed() {
+		return
+	}
+
+	t.Run("verify download", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		latestVersion := versions.Latest()
+		require.NotNil(t, latestVersion)
+
+		outputFile, err := fs.Create("outputfile")
+		require.NoError(t, err)
+		err = p.DownloadBackup(ctx, latestVersion, outputFile)
+		require.NoError(t, err)
+
+		gotContent, err := afero.ReadFile(fs, outputFile.Name())
+		require.NoError(t, err)
+
+		backupContent := fmt.Sprintf("precious data %d", backupAmount-1)
+		require.Equal(t, backupContent, string(gotContent))
+
+		// cleaning up after test
+		err = fs.Remove(outputFile.Name())
+		require.NoError(t, err)
+	})
+
+	if t.Failed() {
+		return
+	}
+
+	t.Run("verify cleanup", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+		before := versions.List()
+
+		err = p.CleanupBackups(ctx)
+		require.NoError(t, err)
+
+		versions, err = p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		after := versions.List()
+		require.Len(t, after, objectsToKeep)
+		assert.Equal(t, before[:objectsToKeep], after)
+	})
+
+}
+
+type connectionDetails struct {
+	Endpoint string
+}
+
+func startAzuriteContainer(t testing.TB, ctx context.Context) (testcontainers.Container, *connectionDetails) {
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "mcr.microsoft.com/azure-storage/azurite",
+			ExposedPorts: []string{"10000"},
+			Cmd:          []string{"azurite-blob", "--blobHost", "0.0.0.0", "--skipApiVersionCheck", "--loose"},
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort("10000/tcp"),
+			),
+		},
+		Started: true,
+		Logger:  tlog.TestLogger(t),
+	})
+	require.NoError(t, err)
+
+	endpoint, err := c.PortEndpoint(ctx, "10000", "http")
+	require.NoError(t, err)
+
+	conn := &connectionDetails{
+		Endpoint: endpoint + "/" + azuriteAccountName,
+	}
+
+	return c, conn
+}
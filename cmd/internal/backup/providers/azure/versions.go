@@ -0,0 +1,53 @@
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+)
+
+// backupVersionsAzure contains the list of available backup versions
+type backupVersionsAzure struct {
+	blobs      []*container.BlobItem
+	backupName string
+}
+
+// Latest returns latest backup version
+func (b backupVersionsAzure) Latest() *providers.BackupVersion {
+	return common.Latest(b.List())
+}
+
+// List return a list of all backup versions
+func (b backupVersionsAzure) List() []*providers.BackupVersion {
+	var result []*providers.BackupVersion
+
+	for _, blob := range b.blobs {
+		if blob.Name == nil {
+			continue
+		}
+
+		date, version, ok := common.ParseTimestampedName(*blob.Name, b.backupName)
+		if !ok {
+			continue
+		}
+		if common.IsPinned(*blob.Name) {
+			version = common.PinnedVersion(version)
+		}
+
+		result = append(result, &providers.BackupVersion{
+			Name:    *blob.Name,
+			Version: version,
+			Date:    date,
+		})
+	}
+
+	common.Sort(result)
+
+	return result
+}
+
+// Get returns the backup entry of the given version
+func (b backupVersionsAzure) Get(version string) (*providers.BackupVersion, error) {
+	return common.Get(b.List(), version)
+}
@@ -7,13 +7,21 @@ import (
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
 )
 
-// Sort the given list of backup versions
+// Sort the given list of backup versions, the latest version comes first
 func Sort(versions []*providers.BackupVersion) {
 	sort.Slice(versions, func(i, j int) bool {
-		return versions[i].Date.After(versions[j].Date)
+		return before(versions[i], versions[j])
 	})
 }
 
+// before reports whether a is sorted before b, versions with the same date are ordered by their version to keep listings stable
+func before(a, b *providers.BackupVersion) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
+	}
+	return a.Version > b.Version
+}
+
 // Latest returns latest backup version
 func Latest(versions []*providers.BackupVersion) *providers.BackupVersion {
 	Sort(versions)
@@ -1,7 +1,11 @@
 package common
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
 	"testing"
 	"time"
 
@@ -69,3 +73,495 @@ func TestLatest(t *testing.T) {
 		})
 	}
 }
+
+func TestTimestampedName(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	name := TimestampedName("db", now)
+	require.Equal(t, "db-20240102T030405.000000006Z", name)
+
+	tests := []struct {
+		name        string
+		objectName  string
+		wantOk      bool
+		wantVersion string
+	}{
+		{
+			name:        "plain",
+			objectName:  name,
+			wantOk:      true,
+			wantVersion: "20240102T030405.000000006Z",
+		},
+		{
+			name:        "with prefix and suffix",
+			objectName:  "prefix/" + name + ".tar.gz.aes",
+			wantOk:      true,
+			wantVersion: "20240102T030405.000000006Z",
+		},
+		{
+			name:       "other backup name",
+			objectName: "other-20240102T030405.000000006Z.tar.gz",
+			wantOk:     false,
+		},
+		{
+			name:       "no timestamp",
+			objectName: "db.tar.gz",
+			wantOk:     false,
+		},
+		{
+			name:       "invalid timestamp",
+			objectName: "db-20241302T030405.000000006Z.tar.gz",
+			wantOk:     false,
+		},
+		{
+			name:       "manifest",
+			objectName: "prefix/" + name + ".tar.gz.manifest.json",
+			wantOk:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, version, ok := ParseTimestampedName(tt.objectName, "db")
+			require.Equal(t, tt.wantOk, ok)
+			if !tt.wantOk {
+				return
+			}
+			require.Equal(t, tt.wantVersion, version)
+			require.True(t, now.Equal(got))
+		})
+	}
+}
+
+func TestPinnedName(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	tests := []struct {
+		name       string
+		objectName string
+		want       string
+	}{
+		{
+			name:       "timestamped",
+			objectName: "backups/db-20240102T030405.000000006Z.tar.gz.aes",
+			want:       "backups/pinned/db-20240102T030405.000000006Z.tar.gz.aes",
+		},
+		{
+			name:       "versioned",
+			objectName: "backups/db.tar.gz",
+			want:       "backups/pinned/db-20240102T030405.000000006Z.tar.gz",
+		},
+		{
+			name:       "former version",
+			objectName: "7.tar.gz",
+			want:       "pinned/db-20240102T030405.000000006Z.tar.gz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PinnedName(tt.objectName, "db", date)
+			require.Equal(t, tt.want, got)
+			require.True(t, IsPinned(got))
+			require.False(t, IsPinned(tt.objectName))
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+
+	var versions []*providers.BackupVersion
+	for i := range 10 {
+		versions = append(versions, &providers.BackupVersion{Name: fmt.Sprintf("%d.tgz", i), Date: now.Add(-time.Duration(i) * 24 * time.Hour)})
+	}
+	// pinned backups are never expired
+	versions = append(versions, &providers.BackupVersion{Name: "pinned/old.tgz", Date: now.Add(-100 * 24 * time.Hour)})
+
+	names := func(versions []*providers.BackupVersion) []string {
+		var result []string
+		for _, v := range versions {
+			result = append(result, v.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name          string
+		objectsToKeep int64
+		maxAge        time.Duration
+		want          []string
+	}{
+		{
+			name:          "keep all",
+			objectsToKeep: 20,
+			want:          nil,
+		},
+		{
+			name:          "by count",
+			objectsToKeep: 7,
+			want:          []string{"7.tgz", "8.tgz", "9.tgz"},
+		},
+		{
+			name:          "by age",
+			objectsToKeep: 20,
+			maxAge:        5*24*time.Hour + time.Hour,
+			want:          []string{"6.tgz", "7.tgz", "8.tgz", "9.tgz"},
+		},
+		{
+			name:          "by count and age",
+			objectsToKeep: 3,
+			maxAge:        5*24*time.Hour + time.Hour,
+			want:          []string{"3.tgz", "4.tgz", "5.tgz", "6.tgz", "7.tgz", "8.tgz", "9.tgz"},
+		},
+		{
+			name:          "latest is never expired",
+			objectsToKeep: 20,
+			maxAge:        time.Nanosecond,
+			want:          []string{"1.tgz", "2.tgz", "3.tgz", "4.tgz", "5.tgz", "6.tgz", "7.tgz", "8.tgz", "9.tgz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Expired(versions, tt.objectsToKeep, tt.maxAge, now)
+			require.Equal(t, tt.want, names(got))
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	now := time.Now()
+
+	newVersions := func() []*providers.BackupVersion {
+		var versions []*providers.BackupVersion
+		for i := range 10 {
+			versions = append(versions, &providers.BackupVersion{Name: fmt.Sprintf("%d.tgz", i), Version: fmt.Sprintf("%d", i), Date: now.Add(-time.Duration(i) * time.Hour)})
+		}
+		// two backups at the same time must not be skipped or listed twice
+		versions = append(versions, &providers.BackupVersion{Name: "3b.tgz", Version: "3b", Date: now.Add(-3 * time.Hour)})
+		// pinned copies are listed after all other backups
+		versions = append(versions, &providers.BackupVersion{Name: "pinned/5.tgz", Version: "pinned/5", Date: now.Add(-5 * time.Hour)})
+		return versions
+	}
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		pageSize int
+		want     [][]string
+	}{
+		{
+			name: "all at once",
+			want: [][]string{{"9.tgz", "8.tgz", "7.tgz", "6.tgz", "5.tgz", "4.tgz", "3.tgz", "3b.tgz", "2.tgz", "1.tgz", "0.tgz", "pinned/5.tgz"}},
+		},
+		{
+			name:     "pages",
+			pageSize: 5,
+			want:     [][]string{{"9.tgz", "8.tgz", "7.tgz", "6.tgz", "5.tgz"}, {"4.tgz", "3.tgz", "3b.tgz", "2.tgz", "1.tgz"}, {"0.tgz", "pinned/5.tgz"}},
+		},
+		{
+			name:     "exact pages",
+			pageSize: 12,
+			want:     [][]string{{"9.tgz", "8.tgz", "7.tgz", "6.tgz", "5.tgz", "4.tgz", "3.tgz", "3b.tgz", "2.tgz", "1.tgz", "0.tgz", "pinned/5.tgz"}},
+		},
+		{
+			name:     "time range",
+			from:     now.Add(-6 * time.Hour),
+			to:       now.Add(-2 * time.Hour),
+			pageSize: 2,
+			want:     [][]string{{"6.tgz", "5.tgz"}, {"4.tgz", "3.tgz"}, {"3b.tgz", "pinned/5.tgz"}},
+		},
+		{
+			name: "empty range",
+			from: now.Add(time.Hour),
+			want: [][]string{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got   [][]string
+				token string
+			)
+			for {
+				page, next, err := Page(newVersions(), &providers.ListOptions{From: tt.from, To: tt.to, PageSize: tt.pageSize, PageToken: token})
+				require.NoError(t, err)
+
+				got = append(got, names(page))
+				if next == "" {
+					break
+				}
+				token = next
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("token survives new backups", func(t *testing.T) {
+		versions := newVersions()
+
+		page, token, err := Page(versions, &providers.ListOptions{PageSize: 3})
+		require.NoError(t, err)
+		require.Equal(t, []string{"9.tgz", "8.tgz", "7.tgz"}, names(page))
+
+		versions = append(versions, &providers.BackupVersion{Name: "old.tgz", Version: "old", Date: now.Add(-24 * time.Hour)})
+
+		page, _, err = Page(versions, &providers.ListOptions{PageSize: 3, PageToken: token})
+		require.NoError(t, err)
+		require.Equal(t, []string{"6.tgz", "5.tgz", "4.tgz"}, names(page))
+	})
+
+	t.Run("token of a pinned copy", func(t *testing.T) {
+		versions := append(newVersions(), &providers.BackupVersion{Name: "pinned/7.tgz", Version: "pinned/7", Date: now.Add(-7 * time.Hour)})
+
+		page, token, err := Page(versions, &providers.ListOptions{PageSize: 12})
+		require.NoError(t, err)
+		require.Equal(t, "pinned/7.tgz", page[len(page)-1].Name)
+
+		page, next, err := Page(versions, &providers.ListOptions{PageSize: 12, PageToken: token})
+		require.NoError(t, err)
+		require.Equal(t, []string{"pinned/5.tgz"}, names(page))
+		require.Empty(t, next)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, _, err := Page(newVersions(), &providers.ListOptions{PageSize: 3, PageToken: "invalid"})
+		require.ErrorIs(t, err, providers.ErrInvalidPageToken)
+	})
+}
+
+func TestListPage(t *testing.T) {
+	var (
+		ctx = context.Background()
+		now = time.Now()
+	)
+
+	// the backups are listed like by a backup provider which returns at most size backups per request
+	newList := func(backups, pinned []*providers.BackupVersion) ListFunc {
+		return func(_ context.Context, isPinned bool, marker string, size int) ([]*providers.BackupVersion, string, error) {
+			versions := backups
+			if isPinned {
+				versions = pinned
+			}
+
+			start := 0
+			if marker != "" {
+				var err error
+				start, err = strconv.Atoi(marker)
+				if err != nil {
+					return nil, "", err
+				}
+			}
+
+			end := min(start+size, len(versions))
+			if end == len(versions) {
+				return versions[start:end], "", nil
+			}
+			return versions[start:end], strconv.Itoa(end), nil
+		}
+	}
+
+	var backups, pinned []*providers.BackupVersion
+	for i := range 5 {
+		backups = append(backups, &providers.BackupVersion{Name: fmt.Sprintf("%d.tgz", i), Version: fmt.Sprintf("%d", i), Date: now.Add(time.Duration(i) * time.Hour)})
+	}
+	for i := range 2 {
+		pinned = append(pinned, &providers.BackupVersion{Name: fmt.Sprintf("pinned/%d.tgz", i), Version: fmt.Sprintf("pinned/%d", i), Date: now.Add(time.Duration(i) * time.Hour)})
+	}
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		pinned   []*providers.BackupVersion
+		pageSize int
+		want     [][]string
+	}{
+		{
+			name:   "all at once",
+			pinned: pinned,
+			want:   [][]string{{"0.tgz", "1.tgz", "2.tgz", "3.tgz", "4.tgz", "pinned/0.tgz", "pinned/1.tgz"}},
+		},
+		{
+			name:     "pages across the pinned copies",
+			pinned:   pinned,
+			pageSize: 3,
+			want:     [][]string{{"0.tgz", "1.tgz", "2.tgz"}, {"3.tgz", "4.tgz", "pinned/0.tgz"}, {"pinned/1.tgz"}},
+		},
+		{
+			name:     "page ends with the last backup",
+			pageSize: 5,
+			want:     [][]string{{"0.tgz", "1.tgz", "2.tgz", "3.tgz", "4.tgz"}, nil},
+		},
+		{
+			name:     "time range",
+			from:     now.Add(3 * time.Hour),
+			pinned:   pinned,
+			pageSize: 2,
+			want:     [][]string{{"3.tgz", "4.tgz"}, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got   [][]string
+				token string
+			)
+			for {
+				page, next, err := ListPage(ctx, &providers.ListOptions{From: tt.from, PageSize: tt.pageSize, PageToken: token}, newList(backups, tt.pinned))
+				require.NoError(t, err)
+
+				got = append(got, names(page))
+				if next == "" {
+					break
+				}
+				token = next
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, _, err := ListPage(ctx, &providers.ListOptions{PageSize: 3, PageToken: "invalid"}, newList(backups, pinned))
+		require.ErrorIs(t, err, providers.ErrInvalidPageToken)
+	})
+}
+
+func names(versions []*providers.BackupVersion) []string {
+	var result []string
+	for _, v := range versions {
+		result = append(result, v.Name)
+	}
+	return result
+}
+
+func TestManifest(t *testing.T) {
+	backups := []*providers.BackupVersion{
+		{Name: "db.tar.gz", Version: "2"},
+		{Name: "db.tar.gz", Version: "3"},
+	}
+
+	require.Equal(t, "db-20240102T030405.000000006Z.tar.gz.manifest.json", ManifestName("db-20240102T030405.000000006Z.tar.gz", ""))
+	require.Equal(t, "db.tar.gz.3.manifest.json", ManifestName("db.tar.gz", "3"))
+
+	require.True(t, IsManifest(ManifestName("db.tar.gz", "3")))
+	require.False(t, IsManifest("db.tar.gz"))
+
+	require.False(t, OrphanedManifest("db.tar.gz.3.manifest.json", backups))
+	require.True(t, OrphanedManifest("db.tar.gz.1.manifest.json", backups))
+
+	manifest := &providers.Manifest{
+		DatabaseType:     "postgres",
+		UncompressedSize: 1024,
+		SHA256:           "abc",
+		Duration:         time.Minute,
+	}
+
+	encoded, err := EncodeManifest(manifest)
+	require.NoError(t, err)
+
+	decoded, err := DecodeManifest(encoded)
+	require.NoError(t, err)
+	require.Equal(t, manifest, decoded)
+}
+
+func TestRetention(t *testing.T) {
+	var versions []*providers.BackupVersion
+	for _, date := range []string{
+		"2024-01-15T12:00:00Z",
+		"2024-01-15T11:30:00Z",
+		"2024-01-15T11:00:00Z",
+		"2024-01-15T09:00:00Z",
+		"2024-01-14T20:00:00Z",
+		"2024-01-14T08:00:00Z",
+		"2024-01-10T08:00:00Z",
+		"2023-12-31T08:00:00Z",
+		"2023-12-01T08:00:00Z",
+		"2022-06-01T08:00:00Z",
+	} {
+		d, err := time.Parse(time.RFC3339, date)
+		require.NoError(t, err)
+		versions = append(versions, &providers.BackupVersion{Name: date, Version: date, Date: d})
+	}
+
+	names := func(versions []*providers.BackupVersion) []string {
+		var result []string
+		for _, v := range versions {
+			result = append(result, v.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		kept      []string
+	}{
+		{
+			name:      "hourly",
+			retention: Retention{Hourly: 3},
+			kept:      []string{"2024-01-15T12:00:00Z", "2024-01-15T11:30:00Z", "2024-01-15T09:00:00Z"},
+		},
+		{
+			name:      "daily",
+			retention: Retention{Daily: 3},
+			kept:      []string{"2024-01-15T12:00:00Z", "2024-01-14T20:00:00Z", "2024-01-10T08:00:00Z"},
+		},
+		{
+			name:      "weekly",
+			retention: Retention{Weekly: 2},
+			kept:      []string{"2024-01-15T12:00:00Z", "2024-01-14T20:00:00Z"},
+		},
+		{
+			name:      "monthly",
+			retention: Retention{Monthly: 2},
+			kept:      []string{"2024-01-15T12:00:00Z", "2023-12-31T08:00:00Z"},
+		},
+		{
+			name:      "yearly",
+			retention: Retention{Yearly: 5},
+			kept:      []string{"2024-01-15T12:00:00Z", "2023-12-31T08:00:00Z", "2022-06-01T08:00:00Z"},
+		},
+		{
+			name:      "tiers are combined",
+			retention: Retention{Daily: 2, Monthly: 3},
+			kept:      []string{"2024-01-15T12:00:00Z", "2024-01-14T20:00:00Z", "2023-12-31T08:00:00Z", "2022-06-01T08:00:00Z"},
+		},
+		{
+			name:      "only the newest backup of a period is kept",
+			retention: Retention{Hourly: 100},
+			kept:      slices.DeleteFunc(names(versions), func(name string) bool { return name == "2024-01-15T11:00:00Z" }),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.True(t, tt.retention.Enabled())
+			require.NoError(t, tt.retention.Validate())
+
+			expired := tt.retention.Expired(slices.Clone(versions))
+
+			var kept []string
+			for _, v := range versions {
+				if !slices.Contains(expired, v) {
+					kept = append(kept, v.Name)
+				}
+			}
+			require.Equal(t, tt.kept, kept)
+		})
+	}
+
+	pinned := &providers.BackupVersion{Name: "pinned/2020-01-01T08:00:00Z", Date: time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)}
+	require.NotContains(t, Retention{Hourly: 1}.Expired(append(slices.Clone(versions), pinned)), pinned)
+
+	require.False(t, Retention{}.Enabled())
+	require.EqualError(t, Retention{Daily: -1}.Validate(), "retention of backups must not be negative")
+}
+
+func TestIsObject(t *testing.T) {
+	require.Equal(t, "objects/", ObjectsRoot(""))
+	require.Equal(t, "postgres/objects/", ObjectsRoot("postgres"))
+
+	require.True(t, IsObject("postgres/objects/wal/000000010000000000000001", "postgres"))
+	require.True(t, IsObject("objects/wal/000000010000000000000001", ""))
+	require.False(t, IsObject("postgres/db.tar.gz", "postgres"))
+	// the object prefix itself may be named like the objects directory
+	require.False(t, IsObject("objects/db.tar.gz", "objects"))
+}
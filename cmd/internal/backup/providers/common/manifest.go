@@ -0,0 +1,57 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+)
+
+// ManifestSuffix is appended to the object names of backup manifests
+const ManifestSuffix = ".manifest.json"
+
+// ManifestName returns the object name of the manifest of a backup.
+// providers storing all backups under the same name need to pass the version of the backup, the others can leave it empty.
+func ManifestName(name, version string) string {
+	if version == "" {
+		return name + ManifestSuffix
+	}
+	return name + "." + version + ManifestSuffix
+}
+
+// IsManifest returns true if the given object name belongs to a manifest
+func IsManifest(name string) bool {
+	return strings.HasSuffix(name, ManifestSuffix)
+}
+
+// EncodeManifest returns the serialized manifest
+func EncodeManifest(manifest *providers.Manifest) (*bytes.Reader, error) {
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode manifest: %w", err)
+	}
+	return bytes.NewReader(raw), nil
+}
+
+// DecodeManifest reads a serialized manifest
+func DecodeManifest(r io.Reader) (*providers.Manifest, error) {
+	var manifest providers.Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("unable to decode manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// OrphanedManifest returns true if the manifest does not belong to any of the given backups.
+// this is meant for providers storing all backups under the same name, where manifests are not expired along with the backups.
+func OrphanedManifest(manifest string, backups []*providers.BackupVersion) bool {
+	for _, v := range backups {
+		if manifest == ManifestName(v.Name, v.Version) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+)
+
+// timestampLayout is used for embedding the backup creation time into object names,
+// it has a fixed length and sorts lexicographically in chronological order
+const timestampLayout = "20060102T150405.000000000Z"
+
+// TimestampedName returns a unique object name for a backup taken at the given time, e.g. db-20240101T120000.000000000Z
+func TimestampedName(backupName string, t time.Time) string {
+	return backupName + "-" + t.UTC().Format(timestampLayout)
+}
+
+// ParseTimestampedName returns the timestamp embedded into an object name created by TimestampedName.
+// the object name may contain a path and arbitrary suffixes like file extensions, manifests are not considered as backups.
+// the returned version is the formatted timestamp, which stays stable for the lifetime of the backup.
+func ParseTimestampedName(name, backupName string) (t time.Time, version string, ok bool) {
+	base := path.Base(name)
+	if IsManifest(base) {
+		return time.Time{}, "", false
+	}
+
+	rest, found := strings.CutPrefix(base, backupName+"-")
+	if !found || len(rest) < len(timestampLayout) {
+		return time.Time{}, "", false
+	}
+
+	version = rest[:len(timestampLayout)]
+
+	t, err := time.Parse(timestampLayout, version)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+
+	return t, version, true
+}
+
+// PinnedDir is the directory next to the backups in which pinned copies of backups are stored, these are excluded from the retention
+const PinnedDir = "pinned"
+
+// PinnedName returns the name of the pinned copy of the backup with the given name which was taken at the given time,
+// e.g. backups/pinned/db-20240101T120000.000000000Z.tar.gz for backups/db.tar.gz.
+// the timestamp makes the name unique and preserves the date of the backup for providers which use the modification time otherwise.
+func PinnedName(name, backupName string, date time.Time) string {
+	dir, _ := path.Split(name)
+	return dir + PinnedDir + "/" + TimestampedName(backupName, date) + Suffix(name, backupName)
+}
+
+// Suffix returns the file extensions of the backup with the given name, e.g. .tar.gz.aes for backups/db-20240101T120000.000000000Z.tar.gz.aes
+func Suffix(name, backupName string) string {
+	base := path.Base(name)
+
+	if _, version, ok := ParseTimestampedName(base, backupName); ok {
+		_, suffix, _ := strings.Cut(base, version)
+		return suffix
+	}
+
+	if suffix, found := strings.CutPrefix(base, backupName); found {
+		return suffix
+	}
+
+	// backups of former versions may have arbitrary names
+	if i := strings.Index(base, "."); i >= 0 {
+		return base[i:]
+	}
+
+	return ""
+}
+
+// UploadDate returns the date the name of an uploaded backup is derived from,
+// which is the date of the manifest if given, e.g. for backups copied from another provider
+func UploadDate(manifest *providers.Manifest) time.Time {
+	if manifest != nil && !manifest.Date.IsZero() {
+		return manifest.Date
+	}
+	return time.Now()
+}
+
+// IsPinned returns true if the given name is the name of a pinned copy of a backup
+func IsPinned(name string) bool {
+	return path.Base(path.Dir(name)) == PinnedDir
+}
+
+// PinnedVersion returns the version of a pinned copy for providers which derive the version from the timestamped name,
+// such that it does not collide with the version of the original backup
+func PinnedVersion(version string) string {
+	return PinnedDir + "/" + version
+}
+
+// Unpinned returns the backup versions which are not pinned
+func Unpinned(versions []*providers.BackupVersion) []*providers.BackupVersion {
+	var result []*providers.BackupVersion
+	for _, v := range versions {
+		if !IsPinned(v.Name) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
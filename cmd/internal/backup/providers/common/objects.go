@@ -0,0 +1,20 @@
+package common
+
+import (
+	"path"
+	"strings"
+)
+
+// ObjectsDir is the directory next to the backups in which the objects of an object store are kept
+const ObjectsDir = "objects"
+
+// ObjectsRoot returns the prefix of all objects of an object store whose backups are stored in the given directory,
+// e.g. backups/objects/ for backups. the object names are appended to it.
+func ObjectsRoot(dir string) string {
+	return path.Join(dir, ObjectsDir) + "/"
+}
+
+// IsObject returns true if the given name belongs to an object of an object store whose backups are stored in the given directory
+func IsObject(name, dir string) bool {
+	return strings.HasPrefix(name, ObjectsRoot(dir))
+}
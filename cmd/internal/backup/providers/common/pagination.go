@@ -0,0 +1,194 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+)
+
+// listPageSize is the number of backups listed with a single request if a listing is not limited to a page
+const listPageSize = 1000
+
+// CompareListed returns the order of two backups in a listing, the backups are sorted by date ascending and
+// the pinned copies follow after all other backups. versions with the same date are ordered by their version to keep listings stable.
+func CompareListed(a, b *providers.BackupVersion) int {
+	if IsPinned(a.Name) != IsPinned(b.Name) {
+		if IsPinned(a.Name) {
+			return 1
+		}
+		return -1
+	}
+	if c := a.Date.Compare(b.Date); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Version, b.Version)
+}
+
+// Page returns a page of the given backup versions in the order of CompareListed, for backup providers which cannot list their backups page by page.
+// the returned token continues the listing and is empty if there are no more versions.
+func Page(versions []*providers.BackupVersion, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	if opts.PageSize < 0 {
+		return nil, "", fmt.Errorf("page size must not be negative: %d", opts.PageSize)
+	}
+
+	var (
+		after *providers.BackupVersion
+		err   error
+	)
+	if opts.PageToken != "" {
+		after, err = decodePageToken(opts.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	slices.SortFunc(versions, CompareListed)
+
+	var result []*providers.BackupVersion
+	for _, v := range versions {
+		if !opts.Contains(v.Date) {
+			continue
+		}
+		// the token references the last version of the previous page, this is robust against versions added or removed in between
+		if after != nil && CompareListed(after, v) >= 0 {
+			continue
+		}
+
+		if opts.PageSize > 0 && len(result) == opts.PageSize {
+			return result, encodePageToken(result[len(result)-1]), nil
+		}
+
+		result = append(result, v)
+	}
+
+	return result, "", nil
+}
+
+// encodePageToken references the given version, only the directory of a pinned copy is kept as it determines the position in the listing
+func encodePageToken(v *providers.BackupVersion) string {
+	dir := ""
+	if IsPinned(v.Name) {
+		dir = PinnedDir
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(dir + "/" + strconv.FormatInt(v.Date.UnixNano(), 10) + "/" + v.Version))
+}
+
+func decodePageToken(token string) (*providers.BackupVersion, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, providers.ErrInvalidPageToken
+	}
+
+	dir, rest, found := strings.Cut(string(raw), "/")
+	if !found || (dir != "" && dir != PinnedDir) {
+		return nil, providers.ErrInvalidPageToken
+	}
+
+	// the version may contain slashes itself
+	date, version, found := strings.Cut(rest, "/")
+	if !found {
+		return nil, providers.ErrInvalidPageToken
+	}
+
+	nanos, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return nil, providers.ErrInvalidPageToken
+	}
+
+	// the name only needs to be recognized as pinned
+	name := ""
+	if dir != "" {
+		name = dir + "/"
+	}
+
+	return &providers.BackupVersion{Name: name, Version: version, Date: time.Unix(0, nanos)}, nil
+}
+
+// ListFunc lists up to size backups in the order of CompareListed, either the pinned copies or all other backups, continuing after the given marker.
+// the returned marker continues the listing and is empty if there are no more backups.
+type ListFunc func(ctx context.Context, pinned bool, marker string, size int) ([]*providers.BackupVersion, string, error)
+
+// listToken continues a listing of ListPage with the marker of the backup provider
+type listToken struct {
+	Pinned bool   `json:"pinned,omitempty"`
+	Marker string `json:"marker,omitempty"`
+}
+
+func (t listToken) encode() string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeListToken(token string) (listToken, error) {
+	var t listToken
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return t, providers.ErrInvalidPageToken
+	}
+
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return t, providers.ErrInvalidPageToken
+	}
+
+	return t, nil
+}
+
+// ListPage returns a page of backups for backup providers which list their backups page by page in the order of CompareListed.
+// the backups are listed in pages of the remaining page size until the page is full, first the backups and then the pinned copies.
+// the last page may be empty, if the previous page ended exactly with the last backup.
+func ListPage(ctx context.Context, opts *providers.ListOptions, list ListFunc) ([]*providers.BackupVersion, string, error) {
+	if opts.PageSize < 0 {
+		return nil, "", fmt.Errorf("page size must not be negative: %d", opts.PageSize)
+	}
+
+	var (
+		token listToken
+		err   error
+	)
+	if opts.PageToken != "" {
+		token, err = decodeListToken(opts.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var result []*providers.BackupVersion
+	for {
+		size := listPageSize
+		if opts.PageSize > 0 {
+			size = opts.PageSize - len(result)
+		}
+
+		versions, marker, err := list(ctx, token.Pinned, token.Marker, size)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, v := range versions {
+			if opts.Contains(v.Date) {
+				result = append(result, v)
+			}
+		}
+
+		switch {
+		case marker != "":
+			token.Marker = marker
+		case !token.Pinned:
+			token = listToken{Pinned: true}
+		default:
+			return result, "", nil
+		}
+
+		if opts.PageSize > 0 && len(result) >= opts.PageSize {
+			return result, token.encode(), nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+)
+
+// Expired returns the backup versions which are not covered by the retention anymore.
+// the newest objectsToKeep versions are retained, if maxAge is greater than zero older versions are expired as well.
+// the latest backup and pinned backups are never expired.
+func Expired(versions []*providers.BackupVersion, objectsToKeep int64, maxAge time.Duration, now time.Time) []*providers.BackupVersion {
+	versions = Unpinned(versions)
+	Sort(versions)
+
+	var expired []*providers.BackupVersion
+	for i, v := range versions {
+		if i == 0 {
+			continue
+		}
+
+		if objectsToKeep > 0 && int64(i) >= objectsToKeep {
+			expired = append(expired, v)
+			continue
+		}
+
+		if maxAge > 0 && now.Sub(v.Date) > maxAge {
+			expired = append(expired, v)
+		}
+	}
+
+	return expired
+}
+
+// Retention is a tiered grandfather-father-son retention policy.
+// for every tier the newest backup of each of the most recent periods containing backups is kept, e.g. Daily: 7 keeps one backup per day for the last seven days with backups.
+// a backup is retained if it is kept by any of the tiers.
+type Retention struct {
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+// Enabled returns true if any of the tiers is configured
+func (r Retention) Enabled() bool {
+	return r.Hourly > 0 || r.Daily > 0 || r.Weekly > 0 || r.Monthly > 0 || r.Yearly > 0
+}
+
+// Validate returns an error if the retention policy is invalid
+func (r Retention) Validate() error {
+	if r.Hourly < 0 || r.Daily < 0 || r.Weekly < 0 || r.Monthly < 0 || r.Yearly < 0 {
+		return errors.New("retention of backups must not be negative")
+	}
+	return nil
+}
+
+// Expired returns the backup versions which are not kept by any tier of the retention policy.
+// the latest backup and pinned backups are never expired.
+func (r Retention) Expired(versions []*providers.BackupVersion) []*providers.BackupVersion {
+	versions = Unpinned(versions)
+	Sort(versions)
+
+	keep := map[*providers.BackupVersion]bool{}
+	if len(versions) > 0 {
+		keep[versions[0]] = true
+	}
+
+	for _, tier := range []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{count: r.Hourly, period: func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{count: r.Daily, period: func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{count: r.Weekly, period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{count: r.Monthly, period: func(t time.Time) string { return t.Format("2006-01") }},
+		{count: r.Yearly, period: func(t time.Time) string { return t.Format("2006") }},
+	} {
+		var (
+			kept int
+			last string
+		)
+		for _, v := range versions {
+			if kept >= tier.count {
+				break
+			}
+
+			// versions are sorted descending, so the first version of a period is its newest
+			period := tier.period(v.Date.UTC())
+			if period == last {
+				continue
+			}
+
+			last = period
+			keep[v] = true
+			kept++
+		}
+	}
+
+	var expired []*providers.BackupVersion
+	for _, v := range versions {
+		if !keep[v] {
+			expired = append(expired, v)
+		}
+	}
+
+	return expired
+}
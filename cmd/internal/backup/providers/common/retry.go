@@ -0,0 +1,17 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// IsNetworkError returns true if the given error was caused by the network, e.g. a refused or reset connection or a timeout
+func IsNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
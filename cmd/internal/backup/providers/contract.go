@@ -2,17 +2,112 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 )
 
+// ErrManifestNotFound is returned if no manifest is stored alongside a backup, e.g. for backups of former versions
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// ErrInvalidPageToken is returned if a listing is continued with a page token which was not returned by the backup provider
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ErrObjectStoreNotSupported is returned by backup providers wrapping other providers, if these cannot store objects
+var ErrObjectStoreNotSupported = errors.New("backup provider does not support storing objects")
+
+// ErrObjectLocked is returned on deletion of objects which are protected by an object lock, they can be deleted once their retention period ended
+var ErrObjectLocked = errors.New("object is locked")
+
+// PartialObjectSuffix is the suffix of objects which are replaced until they are complete, e.g. partial write-ahead log segments.
+// such objects are not protected by an object lock.
+const PartialObjectSuffix = ".partial"
+
 type BackupProvider interface {
 	EnsureBackupBucket(ctx context.Context) error
 	ListBackups(ctx context.Context) (BackupVersions, error)
+	// ListBackupsPage lists a single page of the backups, the returned token continues the listing and is empty if there are no more backups.
+	// all providers list the backups by date ascending followed by the pinned copies by date ascending, see common.CompareListed.
+	// providers which are able to list their backups page by page do not list all backups for a page, so the last page may be empty.
+	ListBackupsPage(ctx context.Context, opts *ListOptions) ([]*BackupVersion, string, error)
 	CleanupBackups(ctx context.Context) error
 	GetNextBackupName(ctx context.Context) string
 	DownloadBackup(ctx context.Context, version *BackupVersion, writer io.Writer) error
-	UploadBackup(ctx context.Context, reader io.Reader) error
+	// UploadBackup uploads the backup read from reader and stores the manifest alongside of it, a nil manifest is skipped.
+	// the manifest describes the uploaded data, so it is only complete once the reader returned io.EOF.
+	UploadBackup(ctx context.Context, reader io.Reader, manifest *Manifest) error
+	// DownloadManifest returns the manifest stored alongside the given backup version
+	DownloadManifest(ctx context.Context, version *BackupVersion) (*Manifest, error)
+	// DeleteBackup deletes the given backup version together with its manifest
+	DeleteBackup(ctx context.Context, version *BackupVersion) error
+	// PinBackup stores a copy of the given backup version together with its manifest, which is excluded from the retention.
+	// the returned pinned copy can be restored like any other backup and is removed with DeleteBackup.
+	PinBackup(ctx context.Context, version *BackupVersion) (*BackupVersion, error)
+}
+
+// ListOptions limit a listing of backups to a page and a time range
+type ListOptions struct {
+	// PageSize is the maximum number of backups in a page, zero lists all backups in a single page
+	PageSize int
+	// PageToken continues the listing after the page which returned it, empty starts a new listing
+	PageToken string
+	// From and To limit the listing to the backups taken in the time range [From, To), zero times do not limit it
+	From time.Time
+	To   time.Time
+}
+
+// Contains returns true if the given date is within the time range of the listing
+func (o *ListOptions) Contains(date time.Time) bool {
+	if !o.From.IsZero() && date.Before(o.From) {
+		return false
+	}
+	if !o.To.IsZero() && !date.Before(o.To) {
+		return false
+	}
+	return true
+}
+
+// FallbackWriter can be implemented by writers passed to DownloadBackup which need to know if another backup version than the requested one is written,
+// e.g. because the backup is downloaded from a replica. the writer can then verify the download against the manifest of the given version.
+type FallbackWriter interface {
+	io.Writer
+	// Fallback is called before the given backup version is written instead of the requested one
+	Fallback(version *BackupVersion) error
+}
+
+// RetryClassifier can be implemented by backup providers to tell transient errors, after which an operation is retried, apart from permanent ones
+type RetryClassifier interface {
+	// IsRetryable returns true if an operation which failed with the given error can succeed when it is retried
+	IsRetryable(err error) bool
+}
+
+// ObjectStore can be implemented by backup providers which store further objects next to the backups, e.g. archived write-ahead logs.
+// the objects are kept in a directory of their own, so they are never listed as backups and are not subject to the retention.
+type ObjectStore interface {
+	// PutObject stores the object read from reader under the given name, an existing object is replaced
+	PutObject(ctx context.Context, name string, reader io.Reader) error
+	// GetObject writes the object with the given name to writer
+	GetObject(ctx context.Context, name string, writer io.Writer) error
+	// ListObjects returns all objects whose names start with the given prefix
+	ListObjects(ctx context.Context, prefix string) ([]*Object, error)
+	// DeleteObject deletes the object with the given name, deleting an object which does not exist is no error.
+	// if the object is still protected by an object lock, ErrObjectLocked is returned.
+	DeleteObject(ctx context.Context, name string) error
+}
+
+// Reopener is implemented by the readers passed to PutObject whose content can be read again from the start,
+// e.g. because it is read from a file. failed uploads of such objects can be retried.
+type Reopener interface {
+	// Reopen returns a new reader of the whole content, which is independent of the readers returned before
+	Reopen() (io.ReadCloser, error)
+}
+
+// Object is an object stored by an ObjectStore
+type Object struct {
+	// Name is the name the object was stored with, it may contain slashes
+	Name string
+	// Date is the time the object was stored
+	Date time.Time
 }
 
 type BackupVersions interface {
@@ -29,3 +124,31 @@ type BackupVersion struct {
 	Version string
 	Date    time.Time
 }
+
+// Manifest describes a backup, it is stored alongside of the backup archive
+type Manifest struct {
+	// DatabaseType is the kind of the backed up database, e.g. postgres
+	DatabaseType string `json:"database_type"`
+	// DatabaseVersion is the version of the database server, if it could be determined
+	DatabaseVersion string `json:"database_version,omitempty"`
+	// CompressionMethod is the method the archive was compressed with
+	CompressionMethod string `json:"compression_method"`
+	// EncryptionKeyFingerprint identifies the key the archive was encrypted with, empty if the archive is not encrypted
+	EncryptionKeyFingerprint string `json:"encryption_key_fingerprint,omitempty"`
+	// UncompressedSize is the size of the backed up files in bytes
+	UncompressedSize int64 `json:"uncompressed_size"`
+	// CompressedSize is the size of the uploaded archive in bytes
+	CompressedSize int64 `json:"compressed_size"`
+	// SHA256 is the hex encoded checksum of the uploaded archive
+	SHA256 string `json:"sha256"`
+	// SidecarVersion is the version of the backup-restore-sidecar which took the backup
+	SidecarVersion string `json:"sidecar_version"`
+	// Duration is the time it took to create and upload the backup
+	Duration time.Duration `json:"duration"`
+	// Pod is the name of the pod which took the backup
+	Pod string `json:"pod,omitempty"`
+	// Namespace is the namespace of the pod which took the backup
+	Namespace string `json:"namespace,omitempty"`
+	// Date is the time the backup was taken, it is kept when the backup is copied to another provider
+	Date time.Time `json:"date,omitzero"`
+}
@@ -8,10 +8,12 @@ import (
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
 
 	"errors"
 
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 	"github.com/spf13/afero"
 
@@ -46,6 +48,9 @@ type BackupProviderConfigGCP struct {
 	FS             afero.Fs
 	ClientOpts     []option.ClientOption
 	Suffix         string
+	// Retention is a tiered retention policy, if configured it replaces ObjectsToKeep.
+	// backups are then deleted by the sidecar instead of the lifecycle rule
+	Retention common.Retention
 }
 
 func (c *BackupProviderConfigGCP) validate() error {
@@ -61,7 +66,7 @@ func (c *BackupProviderConfigGCP) validate() error {
 		}
 	}
 
-	return nil
+	return c.Retention.Validate()
 }
 
 // New returns a GCP backup provider
@@ -113,13 +118,20 @@ func (b *BackupProviderGCP) EnsureBackupBucket(ctx context.Context) error {
 				Type: "Delete",
 			},
 		}
+
+		ownRules []storage.LifecycleRule
 	)
 
+	// a lifecycle rule only understands counts, so with a tiered retention the backups are expired by the sidecar
+	if !b.config.Retention.Enabled() {
+		ownRules = append(ownRules, rule)
+	}
+
 	if err := bucket.Create(ctx, b.config.ProjectID, &storage.BucketAttrs{
 		Location:          b.config.BucketLocation,
 		VersioningEnabled: true,
 		Lifecycle: storage.Lifecycle{
-			Rules: []storage.LifecycleRule{rule},
+			Rules: ownRules,
 		},
 	}); err != nil {
 		var googleErr *googleapi.Error
@@ -149,10 +161,9 @@ func (b *BackupProviderGCP) EnsureBackupBucket(ctx context.Context) error {
 	)
 
 	if idx >= 0 {
-		rules[idx] = rule
-	} else {
-		rules = append(rules, rule)
+		rules = slices.Delete(rules, idx, idx+1)
 	}
+	rules = append(rules, ownRules...)
 
 	if _, err := bucket.If(storage.BucketConditions{
 		MetagenerationMatch: bucketAttrs.MetaGeneration,
@@ -169,11 +180,129 @@ func (b *BackupProviderGCP) EnsureBackupBucket(ctx context.Context) error {
 }
 
 // CleanupBackups cleans up backups according to the given backup cleanup policy at the backup provider
-func (b *BackupProviderGCP) CleanupBackups(_ context.Context) error {
-	// nothing to do here, done with lifecycle rules
+func (b *BackupProviderGCP) CleanupBackups(ctx context.Context) error {
+	objectAttrs, err := b.listObjects(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		bucket   = b.c.Bucket(b.config.BucketName)
+		versions = backupVersionsGCP{objectAttrs: objectAttrs}.List()
+		errs     []error
+	)
+
+	// without a tiered retention backups are expired with lifecycle rules, only the manifests of expired backups need to be removed
+	if b.config.Retention.Enabled() {
+		// the manifests of these backups are deleted along with them
+		for _, v := range b.config.Retention.Expired(versions) {
+			b.log.Info("deleting expired backup", "object", v.Name, "gen", v.Version, "date", v.Date.String())
+
+			err := b.DeleteBackup(ctx, v)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, attrs := range objectAttrs {
+		if !common.IsManifest(attrs.Name) || !common.OrphanedManifest(attrs.Name, versions) {
+			continue
+		}
+
+		b.log.Info("deleting manifest of expired backup", "object", attrs.Name)
+
+		err := bucket.Object(attrs.Name).Generation(attrs.Generation).Delete(ctx)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			errs = append(errs, fmt.Errorf("unable to delete manifest %s: %w", attrs.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteBackup deletes the given generation of the backup together with its manifest
+func (b *BackupProviderGCP) DeleteBackup(ctx context.Context, version *providers.BackupVersion) error {
+	gen, err := strconv.ParseInt(version.Version, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	bucket := b.c.Bucket(b.config.BucketName)
+
+	b.log.Info("deleting backup", "object", version.Name, "gen", gen)
+
+	// deleting a specific generation removes it permanently instead of making it noncurrent
+	err = bucket.Object(version.Name).Generation(gen).Delete(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to delete backup %s: %w", version.Name, err)
+	}
+
+	manifest := bucket.Object(common.ManifestName(version.Name, version.Version))
+	attrs, err := manifest.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete manifest of backup %s: %w", version.Name, err)
+	}
+
+	err = manifest.Generation(attrs.Generation).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("unable to delete manifest of backup %s: %w", version.Name, err)
+	}
+
 	return nil
 }
 
+// PinBackup copies the given generation of the backup together with its manifest to the pinned directory.
+// the copy is stored under a unique name, so it is never expired by the lifecycle rule.
+func (b *BackupProviderGCP) PinBackup(ctx context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	if common.IsPinned(version.Name) {
+		return nil, fmt.Errorf("backup %s is already pinned", version.Version)
+	}
+
+	gen, err := strconv.ParseInt(version.Version, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		bucket = b.c.Bucket(b.config.BucketName)
+		name   = common.PinnedName(version.Name, defaultBackupName, version.Date)
+	)
+
+	b.log.Info("pinning backup", "object", version.Name, "gen", gen, "pinned", name)
+
+	attrs, err := bucket.Object(name).CopierFrom(bucket.Object(version.Name).Generation(gen)).Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to copy backup %s: %w", version.Name, err)
+	}
+
+	pinnedVersion := strconv.FormatInt(attrs.Generation, 10)
+
+	manifest := bucket.Object(common.ManifestName(version.Name, version.Version))
+	_, err = bucket.Object(common.ManifestName(name, pinnedVersion)).CopierFrom(manifest).Run(ctx)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("unable to copy manifest of backup %s: %w", version.Name, err)
+	}
+
+	return &providers.BackupVersion{
+		Name:    name,
+		Version: pinnedVersion,
+		Date:    version.Date,
+	}, nil
+}
+
+// isNotFound returns true if the error indicates a missing object
+func isNotFound(err error) bool {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) && googleErr.Code == http.StatusNotFound {
+		return true
+	}
+	return errors.Is(err, storage.ErrObjectNotExist)
+}
+
 // DownloadBackup downloads the given backup version to the specified folder
 func (b *BackupProviderGCP) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
 	gen, err := strconv.ParseInt(version.Version, 10, 64)
@@ -201,8 +330,24 @@ func (b *BackupProviderGCP) DownloadBackup(ctx context.Context, version *provide
 	return nil
 }
 
+// DownloadManifest returns the manifest stored alongside the given backup version
+func (b *BackupProviderGCP) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	r, err := b.c.Bucket(b.config.BucketName).Object(common.ManifestName(version.Name, version.Version)).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, providers.ErrManifestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	return common.DecodeManifest(r)
+}
+
 // UploadBackup uploads a backup to the backup ovider
-func (b *BackupProviderGCP) UploadBackup(ctx context.Context, reader io.Reader) error {
+func (b *BackupProviderGCP) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
 	bucket := b.c.Bucket(b.config.BucketName)
 
 	destination := defaultBackupName + b.suffix
@@ -215,16 +360,46 @@ func (b *BackupProviderGCP) UploadBackup(ctx context.Context, reader io.Reader)
 
 	obj := bucket.Object(destination)
 	w := obj.NewWriter(ctx)
+	if manifest != nil && !manifest.Date.IsZero() {
+		// the modification time cannot be set, the custom time keeps the date of backups copied from another provider
+		w.CustomTime = manifest.Date
+	}
 	if _, err := io.Copy(w, reader); err != nil {
+		_ = w.Close()
+		return err
+	}
+	// the upload is only finished on close
+	if err := w.Close(); err != nil {
 		return err
 	}
-	defer func() {
-		_ = w.Close()
-	}()
+
+	if manifest == nil {
+		return nil
+	}
+
+	encoded, err := common.EncodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	// all backups share the same object name, so the manifest is named after the generation of the backup
+	mw := bucket.Object(common.ManifestName(destination, strconv.FormatInt(w.Attrs().Generation, 10))).NewWriter(ctx)
+	if _, err := io.Copy(mw, encoded); err != nil {
+		_ = mw.Close()
+		return fmt.Errorf("unable to upload manifest: %w", err)
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("unable to upload manifest: %w", err)
+	}
 
 	return nil
 }
 
+// IsRetryable returns true for errors which the gcs client considers as transient, e.g. rate limits, server errors and connection errors
+func (b *BackupProviderGCP) IsRetryable(err error) bool {
+	return storage.ShouldRetry(err)
+}
+
 // GetNextBackupName returns a name for the next backup archive that is going to be uploaded
 func (b *BackupProviderGCP) GetNextBackupName(_ context.Context) string {
 	// name is constant because we use lifecycle rule to cleanup
@@ -233,6 +408,60 @@ func (b *BackupProviderGCP) GetNextBackupName(_ context.Context) string {
 
 // ListBackups lists the available backups of the backup provider
 func (b *BackupProviderGCP) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
+	objectAttrs, err := b.listObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return backupVersionsGCP{
+		objectAttrs: objectAttrs,
+	}, nil
+}
+
+// ListBackupsPage lists a page of the backups in the order of common.CompareListed with the page token of the object listing.
+// the generations of an object are listed in the order they were uploaded, the pinned copies contain the timestamps of the backups in their names.
+func (b *BackupProviderGCP) ListBackupsPage(ctx context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	return common.ListPage(ctx, opts, b.listPage)
+}
+
+// listPage lists up to size object generations of the backups or the pinned copies
+func (b *BackupProviderGCP) listPage(ctx context.Context, pinned bool, marker string, size int) ([]*providers.BackupVersion, string, error) {
+	dir := ""
+	if b.config.ObjectPrefix != "" {
+		dir = b.config.ObjectPrefix + "/"
+	}
+
+	// the delimiter omits the objects in sub directories like the pinned copies and the objects of the object store
+	query := &storage.Query{
+		Versions:  true,
+		Prefix:    dir,
+		Delimiter: "/",
+	}
+	if pinned {
+		query.Prefix = dir + common.PinnedDir + "/"
+	}
+
+	var objectAttrs []*storage.ObjectAttrs
+	next, err := iterator.NewPager(b.c.Bucket(b.config.BucketName).Objects(ctx, query), size, marker).NextPage(&objectAttrs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var result []*providers.BackupVersion
+	for _, attrs := range objectAttrs {
+		// sub directories are listed as prefixes
+		if attrs.Name == "" || common.IsManifest(attrs.Name) {
+			continue
+		}
+
+		result = append(result, backupVersion(attrs))
+	}
+
+	return result, next, nil
+}
+
+// listObjects returns all object generations below the object prefix
+func (b *BackupProviderGCP) listObjects(ctx context.Context) ([]*storage.ObjectAttrs, error) {
 	bucket := b.c.Bucket(b.config.BucketName)
 
 	query := &storage.Query{
@@ -253,10 +482,88 @@ func (b *BackupProviderGCP) ListBackups(ctx context.Context) (providers.BackupVe
 			return nil, err
 		}
 
+		// objects of the object store are not backups
+		if common.IsObject(attrs.Name, b.config.ObjectPrefix) {
+			continue
+		}
+
 		objectAttrs = append(objectAttrs, attrs)
 	}
 
-	return backupVersionsGCP{
-		objectAttrs: objectAttrs,
-	}, nil
+	return objectAttrs, nil
+}
+
+// PutObject stores an object in the objects directory next to the backups
+func (b *BackupProviderGCP) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	w := b.c.Bucket(b.config.BucketName).Object(common.ObjectsRoot(b.config.ObjectPrefix) + name).NewWriter(ctx)
+	if _, err := io.Copy(w, reader); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("unable to upload object %s: %w", name, err)
+	}
+	// the upload is only finished on close
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to upload object %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// GetObject writes the object with the given name to writer
+func (b *BackupProviderGCP) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	r, err := b.c.Bucket(b.config.BucketName).Object(common.ObjectsRoot(b.config.ObjectPrefix) + name).NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to download object %s: %w", name, err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	_, err = io.Copy(writer, r)
+	return err
+}
+
+// ListObjects returns the objects whose names start with the given prefix
+func (b *BackupProviderGCP) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	root := common.ObjectsRoot(b.config.ObjectPrefix)
+
+	it := b.c.Bucket(b.config.BucketName).Objects(ctx, &storage.Query{Prefix: root + prefix})
+
+	var objects []*providers.Object
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, &providers.Object{
+			Name: strings.TrimPrefix(attrs.Name, root),
+			Date: attrs.Updated,
+		})
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the live generation of the object with the given name
+func (b *BackupProviderGCP) DeleteObject(ctx context.Context, name string) error {
+	obj := b.c.Bucket(b.config.BucketName).Object(common.ObjectsRoot(b.config.ObjectPrefix) + name)
+
+	attrs, err := obj.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete object %s: %w", name, err)
+	}
+
+	// deleting a specific generation removes it permanently instead of making it noncurrent
+	err = obj.Generation(attrs.Generation).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("unable to delete object %s: %w", name, err)
+	}
+
+	return nil
 }
@@ -11,11 +11,13 @@ import (
 	"log/slog"
 	"net/http"
 	"path"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/compress"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 	"github.com/spf13/afero"
@@ -104,7 +106,7 @@ func Test_BackupProviderGCP(t *testing.T) {
 
 			backupFile, err := fs.Open(backupPath)
 			require.NoError(t, err)
-			err = p.UploadBackup(ctx, backupFile)
+			err = p.UploadBackup(ctx, backupFile, nil)
 			require.NoError(t, err)
 
 			// cleaning up after test
@@ -155,6 +157,35 @@ func Test_BackupProviderGCP(t *testing.T) {
 		return
 	}
 
+	t.Run("list backups page by page", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		// the pages list the oldest backups first
+		want := versions.List()
+		slices.Reverse(want)
+
+		var (
+			got   []*providers.BackupVersion
+			token string
+		)
+		for {
+			page, next, err := p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 2, PageToken: token})
+			require.NoError(t, err)
+
+			got = append(got, page...)
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		assert.Equal(t, want, got)
+	})
+
+	if t.Failed() {
+		return
+	}
+
 	t.Run("verify download", func(t *testing.T) {
 		versions, err := p.ListBackups(ctx)
 		require.NoError(t, err)
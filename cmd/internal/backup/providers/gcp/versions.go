@@ -21,14 +21,14 @@ func (b backupVersionsGCP) List() []*providers.BackupVersion {
 
 	tmp := make(map[int64]bool, len(result))
 	for _, attr := range b.objectAttrs {
+		if common.IsManifest(attr.Name) {
+			continue
+		}
+
 		ok := tmp[attr.Generation]
 		if !ok {
 			tmp[attr.Generation] = true
-			result = append(result, &providers.BackupVersion{
-				Name:    attr.Name,
-				Version: strconv.FormatInt(attr.Generation, 10),
-				Date:    attr.Updated,
-			})
+			result = append(result, backupVersion(attr))
 		}
 	}
 
@@ -40,3 +40,21 @@ func (b backupVersionsGCP) List() []*providers.BackupVersion {
 func (b backupVersionsGCP) Get(version string) (*providers.BackupVersion, error) {
 	return common.Get(b.List(), version)
 }
+
+// backupVersion returns the backup stored in the given object generation
+func backupVersion(attr *storage.ObjectAttrs) *providers.BackupVersion {
+	date := attr.Updated
+	if !attr.CustomTime.IsZero() {
+		date = attr.CustomTime
+	}
+	// the modification time of a pinned copy is the time it was pinned, the date of the backup is kept in its name
+	if pinnedDate, _, ok := common.ParseTimestampedName(attr.Name, defaultBackupName); ok && common.IsPinned(attr.Name) {
+		date = pinnedDate
+	}
+
+	return &providers.BackupVersion{
+		Name:    attr.Name,
+		Version: strconv.FormatInt(attr.Generation, 10),
+		Date:    date,
+	}
+}
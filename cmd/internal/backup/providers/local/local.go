@@ -6,40 +6,46 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
+	"strings"
+	"time"
 
 	"errors"
 
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 	"github.com/spf13/afero"
 )
 
 const (
 	defaultLocalBackupPath = constants.SidecarBaseDir + "/local-provider"
+	defaultBackupName      = "db"
 )
 
 // BackupProviderLocal implements the backup provider interface for no backup provider (useful to disable sidecar functionality in development environments)
 type BackupProviderLocal struct {
-	fs                afero.Fs
-	log               *slog.Logger
-	config            *BackupProviderConfigLocal
-	nextBackupCount   int64
-	suffix            string
-	currentBackupName string
+	fs     afero.Fs
+	log    *slog.Logger
+	config *BackupProviderConfigLocal
+	suffix string
 }
 
 // BackupProviderConfigLocal provides configuration for the BackupProviderLocal
 type BackupProviderConfigLocal struct {
-	LocalBackupPath string
-	ObjectsToKeep   int64
-	FS              afero.Fs
-	Suffix          string
+	LocalBackupPath  string
+	BackupName       string
+	ObjectsToKeep    int64
+	ObjectDaysToKeep *int64
+	FS               afero.Fs
+	Suffix           string
+	// Retention is a tiered retention policy, if configured it replaces ObjectsToKeep and ObjectDaysToKeep
+	Retention common.Retention
 }
 
 func (c *BackupProviderConfigLocal) validate() error {
-	return nil
+	return c.Retention.Validate()
 }
 
 // New returns a Local backup provider
@@ -55,6 +61,9 @@ func New(log *slog.Logger, config *BackupProviderConfigLocal) (*BackupProviderLo
 	if config.LocalBackupPath == "" {
 		config.LocalBackupPath = defaultLocalBackupPath
 	}
+	if config.BackupName == "" {
+		config.BackupName = defaultBackupName
+	}
 	if config.FS == nil {
 		config.FS = afero.NewOsFs()
 	}
@@ -84,12 +93,104 @@ func (b *BackupProviderLocal) EnsureBackupBucket(_ context.Context) error {
 }
 
 // CleanupBackups cleans up backups according to the given backup cleanup policy at the backup provider
-func (b *BackupProviderLocal) CleanupBackups(_ context.Context) error {
+func (b *BackupProviderLocal) CleanupBackups(ctx context.Context) error {
 	b.log.Info("cleanup backups called for provider local")
 
+	versions, err := b.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var maxAge time.Duration
+	if b.config.ObjectDaysToKeep != nil {
+		maxAge = time.Duration(*b.config.ObjectDaysToKeep) * 24 * time.Hour
+	}
+
+	expired := common.Expired(versions.List(), b.config.ObjectsToKeep, maxAge, time.Now())
+	if b.config.Retention.Enabled() {
+		expired = b.config.Retention.Expired(versions.List())
+	}
+
+	var errs []error
+	for _, v := range expired {
+		b.log.Info("deleting expired backup", "file", v.Name, "date", v.Date.String())
+
+		for _, name := range []string{v.Name, common.ManifestName(v.Name, "")} {
+			err := b.fs.Remove(filepath.Join(b.config.LocalBackupPath, name))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("unable to delete file %s: %w", name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteBackup deletes the given backup version together with its manifest
+func (b *BackupProviderLocal) DeleteBackup(_ context.Context, version *providers.BackupVersion) error {
+	b.log.Info("deleting backup", "file", version.Name, "date", version.Date.String())
+
+	err := b.fs.Remove(filepath.Join(b.config.LocalBackupPath, version.Name))
+	if err != nil {
+		return fmt.Errorf("unable to delete file %s: %w", version.Name, err)
+	}
+
+	manifest := common.ManifestName(version.Name, "")
+	err = b.fs.Remove(filepath.Join(b.config.LocalBackupPath, manifest))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete file %s: %w", manifest, err)
+	}
+
 	return nil
 }
 
+// PinBackup copies the given backup version together with its manifest to the pinned directory
+func (b *BackupProviderLocal) PinBackup(_ context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	if common.IsPinned(version.Name) {
+		return nil, fmt.Errorf("backup %s is already pinned", version.Version)
+	}
+
+	name := common.PinnedName(version.Name, b.config.BackupName, version.Date)
+
+	b.log.Info("pinning backup", "file", version.Name, "pinned", name)
+
+	err := b.fs.MkdirAll(filepath.Join(b.config.LocalBackupPath, common.PinnedDir), 0777)
+	if err != nil {
+		return nil, fmt.Errorf("could not create pinned backup directory: %w", err)
+	}
+
+	err = b.copyFile(version.Name, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.copyFile(common.ManifestName(version.Name, ""), common.ManifestName(name, ""))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	date, pinnedVersion, _ := common.ParseTimestampedName(name, b.config.BackupName)
+
+	return &providers.BackupVersion{
+		Name:    name,
+		Version: common.PinnedVersion(pinnedVersion),
+		Date:    date,
+	}, nil
+}
+
+// copyFile copies the file with the given name in the backup directory
+func (b *BackupProviderLocal) copyFile(source, destination string) error {
+	infile, err := b.fs.Open(filepath.Join(b.config.LocalBackupPath, source))
+	if err != nil {
+		return fmt.Errorf("could not open file %s: %w", source, err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	return b.writeFile(destination, infile)
+}
+
 // DownloadBackup downloads the given backup version to the specified folder
 func (b *BackupProviderLocal) DownloadBackup(_ context.Context, version *providers.BackupVersion, writer io.Writer) error {
 	b.log.Info("download backup called for provider local")
@@ -111,61 +212,262 @@ func (b *BackupProviderLocal) DownloadBackup(_ context.Context, version *provide
 	return err
 }
 
+// DownloadManifest returns the manifest stored alongside the given backup version
+func (b *BackupProviderLocal) DownloadManifest(_ context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	source := filepath.Join(b.config.LocalBackupPath, common.ManifestName(version.Name, ""))
+
+	infile, err := b.fs.Open(source)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, providers.ErrManifestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open file %s: %w", source, err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	return common.DecodeManifest(infile)
+}
+
 // UploadBackup uploads a backup to the backup provider by providing a reader to the backup archive
-func (b *BackupProviderLocal) UploadBackup(ctx context.Context, reader io.Reader) error {
+func (b *BackupProviderLocal) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
 	b.log.Info("upload backups called for provider local")
 
-	destination := b.config.LocalBackupPath + "/" + b.currentBackupName + b.suffix
-	b.log.Info("dest of provider file", "dest", destination)
+	name := common.TimestampedName(b.config.BackupName, common.UploadDate(manifest)) + b.suffix
+	b.log.Info("dest of provider file", "dest", filepath.Join(b.config.LocalBackupPath, name))
 
-	output, err := b.fs.Create(destination)
+	err := b.writeFile(name, reader)
 	if err != nil {
-		return fmt.Errorf("could not create file %s: %w", destination, err)
+		return err
+	}
+
+	if manifest == nil {
+		return nil
+	}
+
+	encoded, err := common.EncodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	return b.writeFile(common.ManifestName(name, ""), encoded)
+}
+
+// writeFile writes the content of the reader to the file with the given name in the backup directory
+func (b *BackupProviderLocal) writeFile(name string, reader io.Reader) error {
+	var (
+		destination = filepath.Join(b.config.LocalBackupPath, name)
+		// the file is written to a hidden file first such that incomplete uploads never show up as a backup
+		tmp = filepath.Join(filepath.Dir(destination), "."+filepath.Base(destination)+".part")
+	)
+
+	output, err := b.fs.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %w", tmp, err)
 	}
 
 	_, err = io.Copy(output, reader)
 	if err != nil {
+		_ = output.Close()
+		_ = b.fs.Remove(tmp)
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		_ = b.fs.Remove(tmp)
 		return err
 	}
 
+	if err := b.fs.Rename(tmp, destination); err != nil {
+		_ = b.fs.Remove(tmp)
+		return fmt.Errorf("could not move uploaded file to %s: %w", destination, err)
+	}
+
 	return nil
 }
 
 // GetNextBackupName returns a name for the next backup archive that is going to be uploaded
 func (b *BackupProviderLocal) GetNextBackupName(_ context.Context) string {
-	name := strconv.FormatInt(b.nextBackupCount, 10)
-	b.nextBackupCount++
-	b.nextBackupCount = b.nextBackupCount % b.config.ObjectsToKeep
-	b.currentBackupName = name
-	return name
+	// the file name gets a timestamp on upload, the archive name can therefore be constant
+	return b.config.BackupName
 }
 
 // ListBackups lists the available backups of the backup provider
 func (b *BackupProviderLocal) ListBackups(_ context.Context) (providers.BackupVersions, error) {
 	b.log.Info("listing backups called for provider local")
 
-	d, err := b.fs.Open(b.config.LocalBackupPath)
+	versions, err := b.listVersions()
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = d.Close()
-	}()
-	names, err := d.Readdirnames(-1)
+
+	return backupVersionsLocal{
+		versions: versions,
+	}, nil
+}
+
+// ListBackupsPage lists a page of the backups in the order of common.CompareListed.
+// a directory cannot be read page by page, so the names of all backup files are read to sort them by date.
+func (b *BackupProviderLocal) ListBackupsPage(_ context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	versions, err := b.listVersions()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return common.Page(versions, opts)
+}
+
+// listVersions returns the backups in the backup directory and its pinned directory.
+// the date of a backup is part of its name, only the files of former versions without a timestamp are examined.
+func (b *BackupProviderLocal) listVersions() ([]*providers.BackupVersion, error) {
+	names, err := b.readDirNames(b.config.LocalBackupPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var files []os.FileInfo
+	var result []*providers.BackupVersion
 	for _, name := range names {
+		if strings.HasPrefix(name, ".") || common.IsManifest(name) {
+			continue
+		}
+
+		if date, version, ok := common.ParseTimestampedName(name, b.config.BackupName); ok {
+			result = append(result, &providers.BackupVersion{
+				Name:    name,
+				Version: version,
+				Date:    date,
+			})
+			continue
+		}
+
+		// backups of former versions were not timestamped, these are still listed such that they can be restored and expire
 		info, err := b.fs.Stat(filepath.Join(b.config.LocalBackupPath, name))
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, info)
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		result = append(result, &providers.BackupVersion{
+			Name:    name,
+			Version: name,
+			Date:    info.ModTime(),
+		})
 	}
 
-	return backupVersionsLocal{
-		files: files,
-	}, nil
+	pinned, err := b.readDirNames(filepath.Join(b.config.LocalBackupPath, common.PinnedDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, name := range pinned {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		date, version, ok := common.ParseTimestampedName(name, b.config.BackupName)
+		if !ok {
+			continue
+		}
+
+		result = append(result, &providers.BackupVersion{
+			Name:    path.Join(common.PinnedDir, name),
+			Version: common.PinnedVersion(version),
+			Date:    date,
+		})
+	}
+
+	return result, nil
+}
+
+// readDirNames returns the names of the files in the given directory without examining the files
+func (b *BackupProviderLocal) readDirNames(dir string) ([]string, error) {
+	d, err := b.fs.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = d.Close()
+	}()
+
+	return d.Readdirnames(-1)
+}
+
+// PutObject stores an object in the objects directory next to the backups
+func (b *BackupProviderLocal) PutObject(_ context.Context, name string, reader io.Reader) error {
+	name = filepath.Join(common.ObjectsDir, filepath.FromSlash(name))
+
+	err := b.fs.MkdirAll(filepath.Join(b.config.LocalBackupPath, filepath.Dir(name)), 0777)
+	if err != nil {
+		return fmt.Errorf("could not create object directory: %w", err)
+	}
+
+	return b.writeFile(name, reader)
+}
+
+// GetObject writes the object with the given name to writer
+func (b *BackupProviderLocal) GetObject(_ context.Context, name string, writer io.Writer) error {
+	source := filepath.Join(b.config.LocalBackupPath, common.ObjectsDir, filepath.FromSlash(name))
+
+	infile, err := b.fs.Open(source)
+	if err != nil {
+		return fmt.Errorf("could not open file %s: %w", source, err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	_, err = io.Copy(writer, infile)
+	return err
+}
+
+// ListObjects returns the objects whose names start with the given prefix
+func (b *BackupProviderLocal) ListObjects(_ context.Context, prefix string) ([]*providers.Object, error) {
+	root := filepath.Join(b.config.LocalBackupPath, common.ObjectsDir)
+
+	// the objects directory is only created with the first object
+	_, err := b.fs.Stat(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	var objects []*providers.Object
+	err = afero.Walk(b.fs, root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// hidden files are incomplete uploads
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, &providers.Object{Name: name, Date: info.ModTime()})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object with the given name
+func (b *BackupProviderLocal) DeleteObject(_ context.Context, name string) error {
+	err := b.fs.Remove(filepath.Join(b.config.LocalBackupPath, common.ObjectsDir, filepath.FromSlash(name)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete object %s: %w", name, err)
+	}
+
+	return nil
 }
@@ -1,14 +1,19 @@
 package local
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	iofs "io/fs"
 	"log/slog"
+	"os"
 	"path"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/compress"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 	"github.com/spf13/afero"
@@ -52,6 +57,8 @@ func Test_BackupProviderLocal(t *testing.T) {
 			t.Run("verify upload", func(t *testing.T) {
 				for i := range backupAmount {
 					backupName := p.GetNextBackupName(ctx) + compressor.Extension()
+					assert.Equal(t, "db.tar.gz", backupName)
+
 					backupPath := path.Join(constants.UploadDir, backupName)
 					backupContent := fmt.Sprintf("precious data %d", i+1)
 
@@ -61,20 +68,17 @@ func Test_BackupProviderLocal(t *testing.T) {
 					infile, err := fs.Open(backupPath)
 					require.NoError(t, err)
 
-					err = p.UploadBackup(ctx, infile)
-					require.NoError(t, err)
-
-					localPath := path.Join(localProviderBackupPath, backupName)
-					_, err = fs.Stat(localPath)
+					err = p.UploadBackup(ctx, infile, nil)
 					require.NoError(t, err)
 
 					backupFiles, err := afero.ReadDir(fs, localProviderBackupPath)
 					require.NoError(t, err)
-					if i+1 > constants.DefaultObjectsToKeep {
-						require.Len(t, backupFiles, constants.DefaultObjectsToKeep)
-					} else {
-						require.Len(t, backupFiles, i+1)
-					}
+					require.Len(t, backupFiles, i+1)
+
+					// timestamped names sort chronologically
+					localPath := path.Join(localProviderBackupPath, backupFiles[i].Name())
+					assert.True(t, strings.HasPrefix(backupFiles[i].Name(), "db-"))
+					assert.True(t, strings.HasSuffix(backupFiles[i].Name(), ".tar.gz"))
 
 					backedupContent, err := afero.ReadFile(fs, localPath)
 					require.NoError(t, err)
@@ -102,8 +106,7 @@ func Test_BackupProviderLocal(t *testing.T) {
 				require.Error(t, err)
 
 				allVersions := versions.List()
-				amount := min(backupAmount, constants.DefaultObjectsToKeep)
-				require.Len(t, allVersions, amount)
+				require.Len(t, allVersions, backupAmount)
 
 				for i, v := range allVersions {
 					assert.True(t, strings.HasSuffix(v.Name, ".tar.gz"))
@@ -157,6 +160,17 @@ func Test_BackupProviderLocal(t *testing.T) {
 			t.Run("verify cleanup", func(t *testing.T) {
 				err := p.CleanupBackups(ctx)
 				require.NoError(t, err)
+
+				versions, err := p.ListBackups(ctx)
+				require.NoError(t, err)
+				require.Len(t, versions.List(), min(backupAmount, constants.DefaultObjectsToKeep))
+
+				latestVersion := versions.Latest()
+				require.NotNil(t, latestVersion)
+
+				gotContent, err := afero.ReadFile(fs, path.Join(localProviderBackupPath, latestVersion.Name))
+				require.NoError(t, err)
+				require.Equal(t, fmt.Sprintf("precious data %d", backupAmount), string(gotContent))
 			})
 
 			if t.Failed() {
@@ -180,3 +194,409 @@ func Test_BackupProviderLocal(t *testing.T) {
 		})
 	}
 }
+
+func Test_BackupProviderLocalRestart(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	// a backup created by a former version of the sidecar
+	err := afero.WriteFile(fs, path.Join(defaultLocalBackupPath, "0.tar.gz"), []byte("legacy data"), 0600)
+	require.NoError(t, err)
+	err = fs.Chtimes(path.Join(defaultLocalBackupPath, "0.tar.gz"), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	for i := range 3 {
+		// every backup is taken by a new process
+		p, err := New(log, &BackupProviderConfigLocal{
+			FS:            fs,
+			Suffix:        ".tar.gz",
+			ObjectsToKeep: 2,
+		})
+		require.NoError(t, err)
+
+		err = p.EnsureBackupBucket(ctx)
+		require.NoError(t, err)
+
+		err = p.UploadBackup(ctx, strings.NewReader(fmt.Sprintf("precious data %d", i)), nil)
+		require.NoError(t, err)
+
+		err = p.CleanupBackups(ctx)
+		require.NoError(t, err)
+	}
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:     fs,
+		Suffix: ".tar.gz",
+	})
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+
+	allVersions := versions.List()
+	require.Len(t, allVersions, 2)
+
+	for i, v := range allVersions {
+		gotContent, err := afero.ReadFile(fs, path.Join(defaultLocalBackupPath, v.Name))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("precious data %d", 2-i), string(gotContent))
+	}
+}
+
+func Test_BackupProviderLocalStableVersions(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	err := afero.WriteFile(fs, path.Join(defaultLocalBackupPath, "0.tar.gz"), []byte("legacy data"), 0600)
+	require.NoError(t, err)
+	err = fs.Chtimes(path.Join(defaultLocalBackupPath, "0.tar.gz"), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:     fs,
+		Suffix: ".tar.gz",
+	})
+	require.NoError(t, err)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+	require.NoError(t, err)
+
+	before, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, before.List(), 2)
+
+	legacy, err := before.Get("0.tar.gz")
+	require.NoError(t, err)
+	assert.Equal(t, "0.tar.gz", legacy.Name)
+
+	// a backup taken in between must not change the meaning of a version
+	err = p.UploadBackup(ctx, strings.NewReader("newer data"), nil)
+	require.NoError(t, err)
+
+	after, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, after.List(), 3)
+
+	for _, v := range before.List() {
+		got, err := after.Get(v.Version)
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+
+	latest := after.Latest()
+	require.NotNil(t, latest)
+	assert.Equal(t, "db-"+latest.Version+".tar.gz", latest.Name)
+}
+
+func Test_BackupProviderLocalMaxAge(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+		now = time.Now()
+	)
+
+	for _, age := range []time.Duration{0, 24 * time.Hour, 72 * time.Hour, 96 * time.Hour} {
+		name := common.TimestampedName("db", now.Add(-age)) + ".tar.gz"
+		err := afero.WriteFile(fs, path.Join(defaultLocalBackupPath, name), []byte("precious data"), 0600)
+		require.NoError(t, err)
+	}
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:               fs,
+		Suffix:           ".tar.gz",
+		ObjectsToKeep:    10,
+		ObjectDaysToKeep: new(int64(2)),
+	})
+	require.NoError(t, err)
+
+	err = p.CleanupBackups(ctx)
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 2)
+}
+
+func Test_BackupProviderLocalRetention(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		log  = slog.Default()
+		fs   = afero.NewMemMapFs()
+		last = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	)
+
+	// a backup every six hours over ten days
+	for i := range 40 {
+		name := common.TimestampedName("db", last.Add(-time.Duration(i)*6*time.Hour)) + ".tar.gz"
+		err := afero.WriteFile(fs, path.Join(defaultLocalBackupPath, name), []byte("precious data"), 0600)
+		require.NoError(t, err)
+	}
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:            fs,
+		Suffix:        ".tar.gz",
+		ObjectsToKeep: 1,
+		Retention:     common.Retention{Hourly: 2, Daily: 7},
+	})
+	require.NoError(t, err)
+
+	err = p.CleanupBackups(ctx)
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+
+	var dates []time.Time
+	for _, v := range versions.List() {
+		dates = append(dates, v.Date)
+	}
+
+	assert.Equal(t, []time.Time{
+		last,
+		last.Add(-6 * time.Hour),
+		last.Add(-18 * time.Hour),
+		last.Add(-42 * time.Hour),
+		last.Add(-66 * time.Hour),
+		last.Add(-90 * time.Hour),
+		last.Add(-114 * time.Hour),
+		last.Add(-138 * time.Hour),
+	}, dates)
+}
+
+func Test_BackupProviderLocalManifest(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		log      = slog.Default()
+		fs       = afero.NewMemMapFs()
+		manifest = &providers.Manifest{
+			DatabaseType:      "postgres",
+			DatabaseVersion:   "17.2",
+			CompressionMethod: "targz",
+			SHA256:            "abc",
+			CompressedSize:    13,
+		}
+	)
+
+	err := afero.WriteFile(fs, path.Join(defaultLocalBackupPath, "0.tar.gz"), []byte("legacy data"), 0600)
+	require.NoError(t, err)
+	err = fs.Chtimes(path.Join(defaultLocalBackupPath, "0.tar.gz"), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:            fs,
+		Suffix:        ".tar.gz",
+		ObjectsToKeep: 1,
+	})
+	require.NoError(t, err)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), manifest)
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 2)
+
+	latest := versions.Latest()
+	require.NotNil(t, latest)
+
+	got, err := p.DownloadManifest(ctx, latest)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, got)
+
+	legacy, err := versions.Get("0.tar.gz")
+	require.NoError(t, err)
+
+	_, err = p.DownloadManifest(ctx, legacy)
+	require.ErrorIs(t, err, providers.ErrManifestNotFound)
+
+	err = p.UploadBackup(ctx, strings.NewReader("newer data"), manifest)
+	require.NoError(t, err)
+
+	err = p.CleanupBackups(ctx)
+	require.NoError(t, err)
+
+	files, err := afero.ReadDir(fs, defaultLocalBackupPath)
+	require.NoError(t, err)
+	require.Len(t, files, 2, "manifest of the expired backup must be removed as well")
+
+	_, err = fs.Stat(path.Join(defaultLocalBackupPath, common.ManifestName(latest.Name, "")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_BackupProviderLocalDelete(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:     fs,
+		Suffix: ".tar.gz",
+	})
+	require.NoError(t, err)
+
+	err = afero.WriteFile(fs, path.Join(defaultLocalBackupPath, "0.tar.gz"), []byte("legacy data"), 0600)
+	require.NoError(t, err)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), &providers.Manifest{DatabaseType: "postgres"})
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 2)
+
+	latest := versions.Latest()
+	require.NotNil(t, latest)
+
+	err = p.DeleteBackup(ctx, latest)
+	require.NoError(t, err)
+
+	_, err = fs.Stat(path.Join(defaultLocalBackupPath, common.ManifestName(latest.Name, "")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	legacy, err := versions.Get("0.tar.gz")
+	require.NoError(t, err)
+
+	err = p.DeleteBackup(ctx, legacy)
+	require.NoError(t, err)
+
+	files, err := afero.ReadDir(fs, defaultLocalBackupPath)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	err = p.DeleteBackup(ctx, legacy)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_BackupProviderLocalPin(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:            fs,
+		Suffix:        ".tar.gz",
+		ObjectsToKeep: 1,
+	})
+	require.NoError(t, err)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), &providers.Manifest{DatabaseType: "postgres"})
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	original := versions.Latest()
+	require.NotNil(t, original)
+
+	pinned, err := p.PinBackup(ctx, original)
+	require.NoError(t, err)
+	assert.True(t, common.IsPinned(pinned.Name))
+	assert.Equal(t, common.PinnedVersion(original.Version), pinned.Version)
+	assert.True(t, original.Date.Equal(pinned.Date))
+
+	_, err = p.PinBackup(ctx, pinned)
+	require.ErrorContains(t, err, "is already pinned")
+
+	for range 2 {
+		err = p.UploadBackup(ctx, strings.NewReader("newer data"), &providers.Manifest{DatabaseType: "postgres"})
+		require.NoError(t, err)
+	}
+
+	err = p.CleanupBackups(ctx)
+	require.NoError(t, err)
+
+	versions, err = p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 2)
+
+	_, err = versions.Get(original.Version)
+	require.Error(t, err)
+
+	got, err := versions.Get(pinned.Version)
+	require.NoError(t, err)
+	assert.Equal(t, pinned.Name, got.Name)
+
+	var buf bytes.Buffer
+	err = p.DownloadBackup(ctx, got, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "precious data", buf.String())
+
+	manifest, err := p.DownloadManifest(ctx, got)
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", manifest.DatabaseType)
+
+	err = p.DeleteBackup(ctx, got)
+	require.NoError(t, err)
+
+	versions, err = p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 1)
+
+	files, err := afero.ReadDir(fs, path.Join(defaultLocalBackupPath, common.PinnedDir))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func Test_BackupProviderLocalObjects(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	p, err := New(log, &BackupProviderConfigLocal{
+		FS:     fs,
+		Suffix: ".tar.gz",
+	})
+	require.NoError(t, err)
+
+	objects, err := p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+	require.NoError(t, err)
+
+	for _, name := range []string{"wal/000000010000000000000001", "wal/000000010000000000000002", "other"} {
+		err = p.PutObject(ctx, name, strings.NewReader("content of "+name))
+		require.NoError(t, err)
+	}
+
+	objects, err = p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "wal/000000010000000000000001", objects[0].Name)
+	assert.Equal(t, "wal/000000010000000000000002", objects[1].Name)
+
+	var buf bytes.Buffer
+	err = p.GetObject(ctx, "wal/000000010000000000000002", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "content of wal/000000010000000000000002", buf.String())
+
+	// objects are not listed as backups
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 1)
+
+	err = p.DeleteObject(ctx, "wal/000000010000000000000001")
+	require.NoError(t, err)
+
+	err = p.DeleteObject(ctx, "wal/000000010000000000000001")
+	require.NoError(t, err)
+
+	objects, err = p.ListObjects(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "other", objects[0].Name)
+	assert.Equal(t, "wal/000000010000000000000002", objects[1].Name)
+}
@@ -1,15 +1,14 @@
 package local
 
 import (
-	"os"
-	"strconv"
+	"slices"
 
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
 )
 
 type backupVersionsLocal struct {
-	files []os.FileInfo
+	versions []*providers.BackupVersion
 }
 
 func (b backupVersionsLocal) Latest() *providers.BackupVersion {
@@ -17,21 +16,10 @@ func (b backupVersionsLocal) Latest() *providers.BackupVersion {
 }
 
 func (b backupVersionsLocal) List() []*providers.BackupVersion {
-	var result []*providers.BackupVersion
-
-	for _, file := range b.files {
-		result = append(result, &providers.BackupVersion{
-			Name: file.Name(),
-			Date: file.ModTime(),
-		})
-	}
+	result := slices.Clone(b.versions)
 
 	common.Sort(result)
 
-	for i, backup := range result {
-		backup.Version = strconv.FormatInt(int64(i), 10) // nolint:gosec
-	}
-
 	return result
 }
 
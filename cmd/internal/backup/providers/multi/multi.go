@@ -0,0 +1,789 @@
+package multi
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+)
+
+const (
+	// versionSeparator separates the provider name from the version of the underlying provider
+	versionSeparator = ":"
+
+	copyBufferSize = 1024 * 1024
+
+	// DefaultFallbackTolerance is the default maximum difference between the dates of corresponding backups at different providers
+	DefaultFallbackTolerance = 10 * time.Minute
+)
+
+// BackupProviderMulti implements the backup provider interface by replicating backups to multiple backup providers
+type BackupProviderMulti struct {
+	log       *slog.Logger
+	providers []Provider
+	tolerance time.Duration
+}
+
+// Provider is a backup provider participating in the replication
+type Provider struct {
+	// Name identifies the provider, it is used as a prefix for the backup versions
+	Name     string
+	Provider providers.BackupProvider
+}
+
+// BackupProviderConfigMulti provides configuration for the BackupProviderMulti
+type BackupProviderConfigMulti struct {
+	// Providers contains the backup providers to replicate to, the first provider is preferred on restore
+	Providers []Provider
+	// FallbackTolerance is the maximum difference between the date of a backup and the date of the backup
+	// a download falls back to at another provider, defaults to DefaultFallbackTolerance
+	FallbackTolerance time.Duration
+}
+
+func (c *BackupProviderConfigMulti) validate() error {
+	if len(c.Providers) == 0 {
+		return errors.New("multi backup provider requires at least one backup provider")
+	}
+
+	if c.FallbackTolerance < 0 {
+		return errors.New("fallback tolerance must not be negative")
+	}
+
+	names := map[string]bool{}
+	for _, p := range c.Providers {
+		if p.Name == "" {
+			return errors.New("backup provider name must not be empty")
+		}
+		if strings.Contains(p.Name, versionSeparator) {
+			return fmt.Errorf("backup provider name %q must not contain %q", p.Name, versionSeparator)
+		}
+		if p.Provider == nil {
+			return fmt.Errorf("backup provider %q must not be nil", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("backup provider %q configured more than once", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	return nil
+}
+
+// New returns a backup provider replicating every backup to all of the given providers
+func New(log *slog.Logger, config *BackupProviderConfigMulti) (*BackupProviderMulti, error) {
+	if config == nil {
+		return nil, errors.New("multi backup provider requires a provider config")
+	}
+
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	tolerance := config.FallbackTolerance
+	if tolerance == 0 {
+		tolerance = DefaultFallbackTolerance
+	}
+
+	return &BackupProviderMulti{
+		log:       log,
+		providers: config.Providers,
+		tolerance: tolerance,
+	}, nil
+}
+
+// EnsureBackupBucket ensures the backup buckets at all backup providers
+//
+// an unreachable provider is tolerated as long as at least one provider is available,
+// otherwise the sidecar could not restore from the remaining providers.
+func (b *BackupProviderMulti) EnsureBackupBucket(ctx context.Context) error {
+	var errs []error
+	for _, p := range b.providers {
+		err := p.Provider.EnsureBackupBucket(ctx)
+		if err != nil {
+			b.log.Error("unable to ensure backup bucket", "provider", p.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		}
+	}
+
+	if len(errs) == len(b.providers) {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// CleanupBackups cleans up backups according to the given backup cleanup policy at all backup providers
+func (b *BackupProviderMulti) CleanupBackups(ctx context.Context) error {
+	var errs []error
+	for _, p := range b.providers {
+		err := p.Provider.CleanupBackups(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DownloadBackup downloads the given backup version from the provider it was listed from.
+// if this provider is unreachable or the backup is missing, the corresponding backup is downloaded from the next provider.
+// falling back is only possible as long as nothing was written or the writer can be rewound.
+func (b *BackupProviderMulti) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
+	idx, inner, err := b.split(version)
+	if err != nil {
+		return err
+	}
+
+	w := &countingWriter{w: writer}
+
+	err = b.providers[idx].Provider.DownloadBackup(ctx, inner, w)
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{fmt.Errorf("%s: %w", b.providers[idx].Name, err)}
+
+	// the manifest identifies the corresponding backup at the other providers
+	manifest, err := b.providers[idx].Provider.DownloadManifest(ctx, inner)
+	if err != nil {
+		b.log.Warn("unable to download manifest of the failed backup, falling back to the backup closest in time", "error", err, "tolerance", b.tolerance.String())
+		manifest = nil
+	}
+
+	for i, p := range b.providers {
+		if i == idx {
+			continue
+		}
+
+		if err := w.reset(); err != nil {
+			b.log.Error("unable to fall back to next backup provider because the download was already partially written", "error", err)
+			return errors.Join(errs...)
+		}
+
+		b.log.Warn("download failed, falling back to next backup provider", "failed-provider", b.providers[idx].Name, "error", errs[len(errs)-1], "provider", p.Name)
+
+		fallback, err := b.counterpart(ctx, p, manifest, version)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+
+		b.log.Info("downloading corresponding backup", "provider", p.Name, "version", fallback.Version, "date", fallback.Date.String(), "requested-date", version.Date.String())
+
+		if fw, ok := writer.(providers.FallbackWriter); ok {
+			err := fw.Fallback(&providers.BackupVersion{
+				Name:    fallback.Name,
+				Version: p.Name + versionSeparator + fallback.Version,
+				Date:    fallback.Date,
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+				continue
+			}
+		}
+
+		err = p.Provider.DownloadBackup(ctx, fallback, w)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteBackup deletes the given backup version at the provider it was listed from
+func (b *BackupProviderMulti) DeleteBackup(ctx context.Context, version *providers.BackupVersion) error {
+	idx, inner, err := b.split(version)
+	if err != nil {
+		return err
+	}
+
+	err = b.providers[idx].Provider.DeleteBackup(ctx, inner)
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.providers[idx].Name, err)
+	}
+
+	return nil
+}
+
+// PinBackup pins the given backup version at the provider it was listed from
+func (b *BackupProviderMulti) PinBackup(ctx context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	idx, inner, err := b.split(version)
+	if err != nil {
+		return nil, err
+	}
+
+	p := b.providers[idx]
+
+	pinned, err := p.Provider.PinBackup(ctx, inner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name, err)
+	}
+
+	return &providers.BackupVersion{
+		Name:    pinned.Name,
+		Version: p.Name + versionSeparator + pinned.Version,
+		Date:    pinned.Date,
+	}, nil
+}
+
+// counterpart returns the backup of the given provider which corresponds to the given version.
+// the backups taken within the tolerance are identified by the checksum or the date of their manifests,
+// without a manifest the backup closest in time is returned.
+func (b *BackupProviderMulti) counterpart(ctx context.Context, p Provider, manifest *providers.Manifest, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	versions, err := p.Provider.ListBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*providers.BackupVersion
+	for _, v := range versions.List() {
+		if v.Date.Sub(version.Date).Abs() <= b.tolerance {
+			candidates = append(candidates, v)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no backup taken within %s of the requested backup", b.tolerance)
+	}
+
+	slices.SortStableFunc(candidates, func(x, y *providers.BackupVersion) int {
+		return cmp.Compare(x.Date.Sub(version.Date).Abs(), y.Date.Sub(version.Date).Abs())
+	})
+
+	if manifest == nil || (manifest.SHA256 == "" && manifest.Date.IsZero()) {
+		return candidates[0], nil
+	}
+
+	for _, c := range candidates {
+		m, err := p.Provider.DownloadManifest(ctx, c)
+		if err != nil {
+			b.log.Warn("unable to download manifest of fallback candidate", "provider", p.Name, "version", c.Version, "error", err)
+			continue
+		}
+
+		if sameBackup(manifest, m) {
+			return c, nil
+		}
+	}
+
+	return nil, errors.New("no backup matches the manifest of the requested backup")
+}
+
+// sameBackup returns true if both manifests describe the same backup, the checksum takes precedence over the date
+func sameBackup(a, b *providers.Manifest) bool {
+	if a.SHA256 != "" && b.SHA256 != "" {
+		return a.SHA256 == b.SHA256
+	}
+	return !a.Date.IsZero() && a.Date.Equal(b.Date)
+}
+
+// DownloadManifest returns the manifest of the given backup version from the provider it was listed from
+func (b *BackupProviderMulti) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	idx, inner, err := b.split(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.providers[idx].Provider.DownloadManifest(ctx, inner)
+}
+
+// UploadBackup uploads a backup to all backup providers concurrently
+//
+// a failing provider does not abort the uploads to the other providers, but its error is returned.
+func (b *BackupProviderMulti) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
+	return b.replicate(reader, func(p Provider, r io.Reader) error {
+		// the manifest is complete once the pipe returns io.EOF, which happens only after the reader was consumed
+		return p.Provider.UploadBackup(ctx, r, manifest)
+	})
+}
+
+// replicate passes the content of the reader to the upload of every backup provider, the uploads run concurrently
+func (b *BackupProviderMulti) replicate(reader io.Reader, upload func(p Provider, r io.Reader) error) error {
+	var (
+		wg      sync.WaitGroup
+		errs    = make([]error, len(b.providers))
+		writers = make([]*io.PipeWriter, len(b.providers))
+	)
+
+	for i, p := range b.providers {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Go(func() {
+			err := upload(p, pr)
+			if err != nil {
+				b.log.Error("upload failed", "provider", p.Name, "error", err)
+				errs[i] = fmt.Errorf("%s: %w", p.Name, err)
+			}
+			// unblocks the writer in case the provider stopped reading
+			_ = pr.CloseWithError(fmt.Errorf("upload to %s aborted", p.Name))
+		})
+	}
+
+	readErr := fanOut(reader, writers)
+
+	for _, w := range writers {
+		_ = w.CloseWithError(readErr)
+	}
+
+	wg.Wait()
+
+	if readErr != nil {
+		return fmt.Errorf("error reading upload: %w", readErr)
+	}
+
+	return errors.Join(errs...)
+}
+
+// replicateReopened passes an own reader of the content to the upload of every backup provider, the uploads run concurrently
+func (b *BackupProviderMulti) replicateReopened(opener providers.Reopener, upload func(p Provider, r io.Reader) error) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(b.providers))
+	)
+
+	for i, p := range b.providers {
+		wg.Go(func() {
+			err := func() error {
+				rc, err := opener.Reopen()
+				if err != nil {
+					return err
+				}
+				defer func() {
+					_ = rc.Close()
+				}()
+
+				return upload(p, &reopenedReader{ReadCloser: rc, Reopener: opener})
+			}()
+			if err != nil {
+				b.log.Error("upload failed", "provider", p.Name, "error", err)
+				errs[i] = fmt.Errorf("%s: %w", p.Name, err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// reopenedReader is the reader of a single provider, which can be reopened again by its upload
+type reopenedReader struct {
+	io.ReadCloser
+	providers.Reopener
+}
+
+// fanOut copies the reader to all writers, writers returning an error are skipped from then on
+func fanOut(reader io.Reader, writers []*io.PipeWriter) error {
+	var (
+		buf    = make([]byte, copyBufferSize)
+		failed = make([]bool, len(writers))
+	)
+
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			for i, w := range writers {
+				if failed[i] {
+					continue
+				}
+				if _, err := w.Write(buf[:n]); err != nil {
+					failed[i] = true
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// GetNextBackupName returns a name for the next backup archive that is going to be uploaded
+func (b *BackupProviderMulti) GetNextBackupName(ctx context.Context) string {
+	var name string
+	for i, p := range b.providers {
+		// all providers need to be called as some providers track the name of the next backup
+		n := p.Provider.GetNextBackupName(ctx)
+		if i == 0 {
+			name = n
+		}
+	}
+
+	return name
+}
+
+// ListBackups lists the available backups of all backup providers
+//
+// the versions are prefixed with the name of the provider, unreachable providers are skipped.
+func (b *BackupProviderMulti) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
+	var (
+		result []*providers.BackupVersion
+		errs   []error
+	)
+
+	for _, p := range b.providers {
+		versions, err := p.Provider.ListBackups(ctx)
+		if err != nil {
+			b.log.Error("unable to list backups", "provider", p.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+
+		for _, v := range versions.List() {
+			result = append(result, &providers.BackupVersion{
+				Name:    v.Name,
+				Version: p.Name + versionSeparator + v.Version,
+				Date:    v.Date,
+			})
+		}
+	}
+
+	if len(errs) == len(b.providers) {
+		return nil, errors.Join(errs...)
+	}
+
+	return backupVersionsMulti{
+		versions: result,
+	}, nil
+}
+
+// ListBackupsPage lists a page of the backups of all providers in the order of common.CompareListed.
+// the pages of the providers are merged, the page token contains the position of the listing of every provider.
+// unreachable providers are skipped for the rest of the listing, like they are skipped by ListBackups.
+func (b *BackupProviderMulti) ListBackupsPage(ctx context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	if opts.PageSize < 0 {
+		return nil, "", fmt.Errorf("page size must not be negative: %d", opts.PageSize)
+	}
+
+	cursors := map[string]cursor{}
+	if opts.PageToken != "" {
+		var err error
+		cursors, err = decodePageToken(opts.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var (
+		listings []*listing
+		errs     []error
+	)
+	for _, p := range b.providers {
+		l := &listing{provider: p, opts: opts, cursor: cursors[p.Name]}
+
+		err := l.list(ctx)
+		if err != nil {
+			b.log.Error("unable to list backups", "provider", p.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			l.cursor = cursor{Done: true}
+		}
+
+		listings = append(listings, l)
+	}
+
+	if len(errs) == len(b.providers) {
+		return nil, "", errors.Join(errs...)
+	}
+
+	var result []*providers.BackupVersion
+	for opts.PageSize == 0 || len(result) < opts.PageSize {
+		var next *listing
+		for _, l := range listings {
+			// the following backups of a provider whose page was returned completely are in its next page
+			if len(l.page) == 0 {
+				err := l.list(ctx)
+				if err != nil {
+					b.log.Error("unable to list backups", "provider", l.provider.Name, "error", err)
+					l.cursor = cursor{Done: true}
+				}
+			}
+
+			if len(l.page) > 0 && (next == nil || common.CompareListed(l.page[0], next.page[0]) < 0) {
+				next = l
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		result = append(result, next.page[0])
+		next.pop()
+	}
+
+	done := true
+	for _, l := range listings {
+		cursors[l.provider.Name] = l.cursor
+		done = done && l.cursor.Done
+	}
+	if done {
+		return result, "", nil
+	}
+
+	return result, encodePageToken(cursors), nil
+}
+
+// cursor is the position of the listing of a provider within the page token
+type cursor struct {
+	// Token is the page token of the page of the provider which is currently merged
+	Token string `json:"token,omitempty"`
+	// Skip is the number of backups of this page which were already returned
+	Skip int `json:"skip,omitempty"`
+	// Done is set once all backups of the provider were returned
+	Done bool `json:"done,omitempty"`
+}
+
+func encodePageToken(cursors map[string]cursor) string {
+	raw, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageToken(token string) (map[string]cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, providers.ErrInvalidPageToken
+	}
+
+	var cursors map[string]cursor
+	if err := json.Unmarshal(raw, &cursors); err != nil || cursors == nil {
+		return nil, providers.ErrInvalidPageToken
+	}
+
+	return cursors, nil
+}
+
+// listing holds the page of a provider which is merged into the page of the multi provider
+type listing struct {
+	provider Provider
+	opts     *providers.ListOptions
+	cursor   cursor
+	// page contains the backups of the current page which were not returned yet
+	page []*providers.BackupVersion
+	next string
+}
+
+// list lists the page of the cursor, empty pages are skipped until a backup is found or the listing is done
+func (l *listing) list(ctx context.Context) error {
+	for !l.cursor.Done {
+		page, next, err := l.provider.Provider.ListBackupsPage(ctx, &providers.ListOptions{
+			PageSize:  l.opts.PageSize,
+			PageToken: l.cursor.Token,
+			From:      l.opts.From,
+			To:        l.opts.To,
+		})
+		if err != nil {
+			return err
+		}
+
+		l.page = nil
+		for _, v := range page[min(l.cursor.Skip, len(page)):] {
+			l.page = append(l.page, &providers.BackupVersion{
+				Name:    v.Name,
+				Version: l.provider.Name + versionSeparator + v.Version,
+				Date:    v.Date,
+			})
+		}
+		l.next = next
+
+		if len(l.page) > 0 {
+			return nil
+		}
+
+		l.cursor = cursor{Token: next, Done: next == ""}
+	}
+
+	return nil
+}
+
+// pop removes the first backup of the page, the cursor continues with the next page once the page was returned completely
+func (l *listing) pop() {
+	l.page = l.page[1:]
+	l.cursor.Skip++
+
+	if len(l.page) == 0 {
+		l.cursor = cursor{Token: l.next, Done: l.next == ""}
+	}
+}
+
+// PutObject stores the object at all backup providers concurrently.
+// a reader which can be reopened is reopened for every provider, such that each of them is able to retry its upload.
+func (b *BackupProviderMulti) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	put := func(p Provider, r io.Reader) error {
+		store, ok := p.Provider.(providers.ObjectStore)
+		if !ok {
+			return providers.ErrObjectStoreNotSupported
+		}
+		return store.PutObject(ctx, name, r)
+	}
+
+	if opener, ok := reader.(providers.Reopener); ok {
+		return b.replicateReopened(opener, put)
+	}
+
+	return b.replicate(reader, put)
+}
+
+// GetObject writes the object with the given name to writer, it is read from the first backup provider which stores it
+func (b *BackupProviderMulti) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	var (
+		w    = &countingWriter{w: writer}
+		errs []error
+	)
+
+	for _, p := range b.providers {
+		store, ok := p.Provider.(providers.ObjectStore)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, providers.ErrObjectStoreNotSupported))
+			continue
+		}
+
+		if err := w.reset(); err != nil {
+			b.log.Error("unable to fall back to next backup provider because the download was already partially written", "error", err)
+			return errors.Join(errs...)
+		}
+
+		err := store.GetObject(ctx, name, w)
+		if err == nil {
+			return nil
+		}
+
+		b.log.Warn("object download failed, falling back to next backup provider", "failed-provider", p.Name, "object", name, "error", err)
+
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ListObjects returns the objects of all backup providers, objects stored at several providers are listed once.
+// unreachable providers are skipped.
+func (b *BackupProviderMulti) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	var (
+		result []*providers.Object
+		seen   = map[string]bool{}
+		errs   []error
+	)
+
+	for _, p := range b.providers {
+		store, ok := p.Provider.(providers.ObjectStore)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, providers.ErrObjectStoreNotSupported))
+			continue
+		}
+
+		objects, err := store.ListObjects(ctx, prefix)
+		if err != nil {
+			b.log.Error("unable to list objects", "provider", p.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+
+		for _, o := range objects {
+			if seen[o.Name] {
+				continue
+			}
+			seen[o.Name] = true
+			result = append(result, o)
+		}
+	}
+
+	if len(errs) == len(b.providers) {
+		return nil, errors.Join(errs...)
+	}
+
+	return result, nil
+}
+
+// DeleteObject deletes the object with the given name at all backup providers
+func (b *BackupProviderMulti) DeleteObject(ctx context.Context, name string) error {
+	var errs []error
+	for _, p := range b.providers {
+		store, ok := p.Provider.(providers.ObjectStore)
+		if !ok {
+			continue
+		}
+
+		err := store.DeleteObject(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// split returns the index of the provider and the version of the underlying provider
+func (b *BackupProviderMulti) split(version *providers.BackupVersion) (int, *providers.BackupVersion, error) {
+	name, inner, found := strings.Cut(version.Version, versionSeparator)
+	if !found {
+		return 0, nil, fmt.Errorf("version %q does not reference a backup provider", version.Version)
+	}
+
+	for i, p := range b.providers {
+		if p.Name == name {
+			return i, &providers.BackupVersion{
+				Name:    version.Name,
+				Version: inner,
+				Date:    version.Date,
+			}, nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("backup provider %q is not configured", name)
+}
+
+// countingWriter tracks whether data was written such that a failed download can be retried
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// reset rewinds the underlying writer if data was already written to it
+func (c *countingWriter) reset() error {
+	if c.n == 0 {
+		return nil
+	}
+
+	f, ok := c.w.(interface {
+		io.Seeker
+		Truncate(size int64) error
+	})
+	if !ok {
+		return fmt.Errorf("%d bytes were already written", c.n)
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	c.n = 0
+
+	return nil
+}
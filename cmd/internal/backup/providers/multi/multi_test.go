@@ -0,0 +1,506 @@
+package multi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+)
+
+var errUnreachable = errors.New("provider unreachable")
+
+// unreachableProvider simulates a backup provider which cannot be reached
+type unreachableProvider struct{}
+
+func (unreachableProvider) EnsureBackupBucket(context.Context) error { return errUnreachable }
+func (unreachableProvider) ListBackups(context.Context) (providers.BackupVersions, error) {
+	return nil, errUnreachable
+}
+func (unreachableProvider) ListBackupsPage(context.Context, *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	return nil, "", errUnreachable
+}
+func (unreachableProvider) CleanupBackups(context.Context) error     { return errUnreachable }
+func (unreachableProvider) GetNextBackupName(context.Context) string { return "unreachable" }
+func (unreachableProvider) UploadBackup(context.Context, io.Reader, *providers.Manifest) error {
+	return errUnreachable
+}
+func (unreachableProvider) DownloadBackup(context.Context, *providers.BackupVersion, io.Writer) error {
+	return errUnreachable
+}
+func (unreachableProvider) DeleteBackup(context.Context, *providers.BackupVersion) error {
+	return errUnreachable
+}
+func (unreachableProvider) PinBackup(context.Context, *providers.BackupVersion) (*providers.BackupVersion, error) {
+	return nil, errUnreachable
+}
+func (unreachableProvider) DownloadManifest(context.Context, *providers.BackupVersion) (*providers.Manifest, error) {
+	return nil, errUnreachable
+}
+
+// fallbackRecorder records the backup version the multi provider falls back to
+type fallbackRecorder struct {
+	bytes.Buffer
+	fallback *providers.BackupVersion
+}
+
+func (r *fallbackRecorder) Fallback(version *providers.BackupVersion) error {
+	r.fallback = version
+	return nil
+}
+
+func newLocalProvider(t *testing.T, fs afero.Fs, backupPath string) providers.BackupProvider {
+	p, err := local.New(slog.Default(), &local.BackupProviderConfigLocal{
+		LocalBackupPath: backupPath,
+		FS:              fs,
+		Suffix:          ".tar.gz",
+	})
+	require.NoError(t, err)
+	return p
+}
+
+// latestFile returns the path of the most recent backup of a local provider, timestamped names sort chronologically
+func latestFile(t *testing.T, fs afero.Fs, dir string) string {
+	files, err := afero.ReadDir(fs, dir)
+	require.NoError(t, err)
+
+	var latest string
+	for _, f := range files {
+		if !common.IsManifest(f.Name()) {
+			latest = f.Name()
+		}
+	}
+	require.NotEmpty(t, latest)
+
+	return path.Join(dir, latest)
+}
+
+func Test_BackupProviderMulti(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		log          = slog.Default()
+		fs           = afero.NewMemMapFs()
+		backupAmount = 3
+	)
+
+	p, err := New(log, &BackupProviderConfigMulti{
+		Providers: []Provider{
+			{Name: "primary", Provider: newLocalProvider(t, fs, "/backup/primary")},
+			{Name: "secondary", Provider: newLocalProvider(t, fs, "/backup/secondary")},
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("ensure backup bucket", func(t *testing.T) {
+		err := p.EnsureBackupBucket(ctx)
+		require.NoError(t, err)
+	})
+
+	t.Run("verify upload", func(t *testing.T) {
+		for i := range backupAmount {
+			assert.Equal(t, "db", p.GetNextBackupName(ctx))
+			content := fmt.Sprintf("precious data %d", i+1)
+
+			err := p.UploadBackup(ctx, strings.NewReader(content), &providers.Manifest{DatabaseType: "postgres", CompressedSize: int64(len(content))})
+			require.NoError(t, err)
+
+			for _, dir := range []string{"/backup/primary", "/backup/secondary"} {
+				got, err := afero.ReadFile(fs, latestFile(t, fs, dir))
+				require.NoError(t, err)
+				assert.Equal(t, content, string(got))
+			}
+		}
+	})
+
+	t.Run("list backups", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		allVersions := versions.List()
+		require.Len(t, allVersions, 2*backupAmount)
+
+		var primary, secondary int
+		for _, v := range allVersions {
+			switch {
+			case strings.HasPrefix(v.Version, "primary:"):
+				primary++
+			case strings.HasPrefix(v.Version, "secondary:"):
+				secondary++
+			}
+
+			got, err := versions.Get(v.Version)
+			require.NoError(t, err)
+			assert.Equal(t, v, got)
+		}
+		assert.Equal(t, backupAmount, primary)
+		assert.Equal(t, backupAmount, secondary)
+	})
+
+	t.Run("list backups page by page", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		want := versions.List()
+		slices.SortFunc(want, common.CompareListed)
+
+		var (
+			got   []*providers.BackupVersion
+			pages int
+			token string
+		)
+		for {
+			page, next, err := p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 4, PageToken: token})
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(page), 4)
+
+			got = append(got, page...)
+			pages++
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		assert.Equal(t, want, got)
+		assert.Equal(t, 2, pages)
+
+		_, _, err = p.ListBackupsPage(ctx, &providers.ListOptions{PageToken: "invalid"})
+		require.ErrorIs(t, err, providers.ErrInvalidPageToken)
+	})
+
+	t.Run("download manifest", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		for _, v := range versions.List() {
+			manifest, err := p.DownloadManifest(ctx, v)
+			require.NoError(t, err)
+			assert.Equal(t, "postgres", manifest.DatabaseType)
+		}
+
+		_, err = p.DownloadManifest(ctx, &providers.BackupVersion{Name: "db.tar.gz", Version: "foo:0"})
+		require.EqualError(t, err, `backup provider "foo" is not configured`)
+	})
+
+	t.Run("verify download", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		for _, v := range versions.List() {
+			if !strings.HasPrefix(v.Version, "primary:") {
+				continue
+			}
+
+			var buf bytes.Buffer
+			err = p.DownloadBackup(ctx, v, &buf)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("precious data %d", backupAmount), buf.String())
+
+			break
+		}
+	})
+
+	t.Run("download falls back if backup is missing", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		var latestPrimary *providers.BackupVersion
+		for _, v := range versions.List() {
+			if strings.HasPrefix(v.Version, "primary:") {
+				latestPrimary = v
+				break
+			}
+		}
+		require.NotNil(t, latestPrimary)
+
+		err = fs.Remove(path.Join("/backup/primary", latestPrimary.Name))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = p.DownloadBackup(ctx, latestPrimary, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("precious data %d", backupAmount), buf.String())
+	})
+
+	t.Run("delete backup", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		before := len(versions.List())
+
+		var latestSecondary *providers.BackupVersion
+		for _, v := range versions.List() {
+			if strings.HasPrefix(v.Version, "secondary:") {
+				latestSecondary = v
+				break
+			}
+		}
+		require.NotNil(t, latestSecondary)
+
+		err = p.DeleteBackup(ctx, latestSecondary)
+		require.NoError(t, err)
+
+		versions, err = p.ListBackups(ctx)
+		require.NoError(t, err)
+		assert.Len(t, versions.List(), before-1)
+
+		_, err = versions.Get(latestSecondary.Version)
+		require.Error(t, err)
+	})
+
+	t.Run("pin backup", func(t *testing.T) {
+		versions, err := p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		latest := versions.Latest()
+		require.NotNil(t, latest)
+
+		pinned, err := p.PinBackup(ctx, latest)
+		require.NoError(t, err)
+
+		provider, _, _ := strings.Cut(latest.Version, ":")
+		assert.True(t, strings.HasPrefix(pinned.Version, provider+":pinned/"), pinned.Version)
+
+		versions, err = p.ListBackups(ctx)
+		require.NoError(t, err)
+
+		_, err = versions.Get(pinned.Version)
+		require.NoError(t, err)
+
+		err = p.DeleteBackup(ctx, pinned)
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		err := p.DownloadBackup(ctx, &providers.BackupVersion{Name: "db.tar.gz", Version: "foo:0"}, io.Discard)
+		require.EqualError(t, err, `backup provider "foo" is not configured`)
+
+		err = p.DownloadBackup(ctx, &providers.BackupVersion{Name: "db.tar.gz", Version: "0"}, io.Discard)
+		require.EqualError(t, err, `version "0" does not reference a backup provider`)
+	})
+}
+
+func Test_BackupProviderMultiUnreachable(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	p, err := New(log, &BackupProviderConfigMulti{
+		Providers: []Provider{
+			{Name: "unreachable", Provider: unreachableProvider{}},
+			{Name: "local", Provider: newLocalProvider(t, fs, "/backup/local")},
+		},
+	})
+	require.NoError(t, err)
+
+	err = p.EnsureBackupBucket(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, "unreachable", p.GetNextBackupName(ctx))
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+	require.ErrorIs(t, err, errUnreachable)
+
+	got, err := afero.ReadFile(fs, latestFile(t, fs, "/backup/local"))
+	require.NoError(t, err)
+	assert.Equal(t, "precious data", string(got))
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+
+	latest := versions.Latest()
+	require.NotNil(t, latest)
+	assert.True(t, strings.HasPrefix(latest.Version, "local:"))
+
+	page, token, err := p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, latest.Version, page[0].Version)
+	assert.Empty(t, token)
+
+	var buf fallbackRecorder
+	err = p.DownloadBackup(ctx, &providers.BackupVersion{Name: latest.Name, Version: "unreachable:abc", Date: latest.Date}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "precious data", buf.String())
+	require.NotNil(t, buf.fallback)
+	assert.Equal(t, latest.Version, buf.fallback.Version)
+
+	err = p.CleanupBackups(ctx)
+	require.ErrorIs(t, err, errUnreachable)
+
+	all, err := New(log, &BackupProviderConfigMulti{
+		Providers: []Provider{
+			{Name: "a", Provider: unreachableProvider{}},
+			{Name: "b", Provider: unreachableProvider{}},
+		},
+	})
+	require.NoError(t, err)
+
+	err = all.EnsureBackupBucket(ctx)
+	require.ErrorIs(t, err, errUnreachable)
+
+	_, err = all.ListBackups(ctx)
+	require.ErrorIs(t, err, errUnreachable)
+
+	_, _, err = all.ListBackupsPage(ctx, &providers.ListOptions{})
+	require.ErrorIs(t, err, errUnreachable)
+}
+
+func Test_BackupProviderMultiFallbackMatchesManifest(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		fs        = afero.NewMemMapFs()
+		primary   = newLocalProvider(t, fs, "/backup/primary")
+		secondary = newLocalProvider(t, fs, "/backup/secondary")
+	)
+
+	p, err := New(slog.Default(), &BackupProviderConfigMulti{
+		Providers: []Provider{
+			{Name: "primary", Provider: primary},
+			{Name: "secondary", Provider: secondary},
+		},
+	})
+	require.NoError(t, err)
+
+	// the secondary only holds a different backup which was taken at about the same time
+	require.NoError(t, primary.UploadBackup(ctx, strings.NewReader("backup a"), &providers.Manifest{SHA256: "a"}))
+	require.NoError(t, secondary.UploadBackup(ctx, strings.NewReader("backup b"), &providers.Manifest{SHA256: "b"}))
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+
+	var backupA *providers.BackupVersion
+	for _, v := range versions.List() {
+		if strings.HasPrefix(v.Version, "primary:") {
+			backupA = v
+		}
+	}
+	require.NotNil(t, backupA)
+
+	require.NoError(t, fs.Remove(path.Join("/backup/primary", backupA.Name)))
+
+	var buf bytes.Buffer
+	err = p.DownloadBackup(ctx, backupA, &buf)
+	require.ErrorContains(t, err, "no backup matches the manifest of the requested backup")
+	assert.Empty(t, buf.String())
+
+	// the matching backup is found among the backups within the tolerance
+	require.NoError(t, secondary.UploadBackup(ctx, strings.NewReader("backup a"), &providers.Manifest{SHA256: "a"}))
+
+	err = p.DownloadBackup(ctx, backupA, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "backup a", buf.String())
+
+	// backups outside of the tolerance are not considered
+	buf.Reset()
+	err = p.DownloadBackup(ctx, &providers.BackupVersion{Name: backupA.Name, Version: backupA.Version, Date: backupA.Date.Add(-time.Hour)}, &buf)
+	require.ErrorContains(t, err, "no backup taken within 10m0s of the requested backup")
+	_, err = New(slog.Default(), &BackupProviderConfigMulti{
+		Providers:         []Provider{{Name: "primary", Provider: primary}},
+		FallbackTolerance: -time.Minute,
+	})
+	require.EqualError(t, err, "fallback tolerance must not be negative")
+}
+
+func Test_BackupProviderMultiObjects(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		fs  = afero.NewMemMapFs()
+	)
+
+	p, err := New(log, &BackupProviderConfigMulti{
+		Providers: []Provider{
+			{Name: "a", Provider: newLocalProvider(t, fs, "/backup/a")},
+			{Name: "b", Provider: newLocalProvider(t, fs, "/backup/b")},
+		},
+	})
+	require.NoError(t, err)
+
+	err = p.PutObject(ctx, "wal/000000010000000000000001", strings.NewReader("segment"))
+	require.NoError(t, err)
+
+	for _, dir := range []string{"/backup/a", "/backup/b"} {
+		got, err := afero.ReadFile(fs, path.Join(dir, common.ObjectsDir, "wal/000000010000000000000001"))
+		require.NoError(t, err)
+		assert.Equal(t, "segment", string(got))
+	}
+
+	// objects stored at several providers are listed once
+	objects, err := p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "wal/000000010000000000000001", objects[0].Name)
+
+	// a missing object is read from the next provider
+	err = fs.Remove(path.Join("/backup/a", common.ObjectsDir, "wal/000000010000000000000001"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = p.GetObject(ctx, "wal/000000010000000000000001", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "segment", buf.String())
+
+	err = p.DeleteObject(ctx, "wal/000000010000000000000001")
+	require.NoError(t, err)
+
+	objects, err = p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+
+	unsupported, err := New(log, &BackupProviderConfigMulti{
+		Providers: []Provider{
+			{Name: "unreachable", Provider: unreachableProvider{}},
+			{Name: "local", Provider: newLocalProvider(t, fs, "/backup/local")},
+		},
+	})
+	require.NoError(t, err)
+
+	err = unsupported.PutObject(ctx, "wal/000000010000000000000002", strings.NewReader("segment"))
+	require.ErrorIs(t, err, providers.ErrObjectStoreNotSupported)
+
+	objects, err = unsupported.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+}
+
+func Test_BackupProviderMultiPartialDownload(t *testing.T) {
+	w := &countingWriter{w: &bytes.Buffer{}}
+
+	require.NoError(t, w.reset())
+
+	_, err := w.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.Error(t, w.reset())
+
+	fs := afero.NewMemMapFs()
+	f, err := fs.Create("/download")
+	require.NoError(t, err)
+
+	w = &countingWriter{w: f}
+	_, err = w.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, w.reset())
+
+	_, err = w.Write([]byte("complete"))
+	require.NoError(t, err)
+
+	got, err := afero.ReadFile(fs, "/download")
+	require.NoError(t, err)
+	assert.Equal(t, "complete", string(got))
+}
@@ -0,0 +1,37 @@
+package multi
+
+import (
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+)
+
+// backupVersionsMulti contains the merged backup versions of all providers
+type backupVersionsMulti struct {
+	versions []*providers.BackupVersion
+}
+
+// Latest returns latest backup version
+func (b backupVersionsMulti) Latest() *providers.BackupVersion {
+	return common.Latest(b.List())
+}
+
+// List return a list of all backup versions
+func (b backupVersionsMulti) List() []*providers.BackupVersion {
+	result := make([]*providers.BackupVersion, 0, len(b.versions))
+	for _, v := range b.versions {
+		result = append(result, &providers.BackupVersion{
+			Name:    v.Name,
+			Version: v.Version,
+			Date:    v.Date,
+		})
+	}
+
+	common.Sort(result)
+
+	return result
+}
+
+// Get returns the backup entry of the given version
+func (b backupVersionsMulti) Get(version string) (*providers.BackupVersion, error) {
+	return common.Get(b.List(), version)
+}
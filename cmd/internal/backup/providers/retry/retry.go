@@ -0,0 +1,387 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	retrygo "github.com/avast/retry-go/v4"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
+)
+
+const (
+	defaultAttempts = 3
+	defaultDelay    = time.Second
+	defaultMaxDelay = 30 * time.Second
+)
+
+// BackupProviderRetry implements the backup provider interface by retrying failed operations of another backup provider
+// with exponential backoff. only errors which are classified as transient by the backup provider are retried.
+type BackupProviderRetry struct {
+	log    *slog.Logger
+	config *BackupProviderConfigRetry
+}
+
+// BackupProviderConfigRetry provides configuration for the BackupProviderRetry
+type BackupProviderConfigRetry struct {
+	// Provider is the backup provider whose operations are retried
+	Provider providers.BackupProvider
+	// Attempts is the maximum number of attempts of an operation, a single attempt disables retries. defaults to 3
+	Attempts uint
+	// Delay is the delay before the first retry, it is doubled for every further retry and jittered. defaults to 1s
+	Delay time.Duration
+	// MaxDelay is the maximum delay between two attempts, defaults to 30s
+	MaxDelay time.Duration
+	// SpoolDir is the directory in which uploads of backups are buffered as a whole such that they can be retried.
+	// empty does not buffer them, a failed upload of a backup is then not retried by this provider and only the
+	// retries of the underlying provider apply, e.g. the retried parts of a multipart upload.
+	SpoolDir string
+	// UploadLimiter limits the bandwidth of retried uploads like the one of the first attempt, nil does not limit it
+	UploadLimiter *throttle.Limiter
+}
+
+func (c *BackupProviderConfigRetry) validate() error {
+	if c.Provider == nil {
+		return errors.New("backup provider must not be nil")
+	}
+	if c.Delay < 0 || c.MaxDelay < 0 {
+		return errors.New("retry delays must not be negative")
+	}
+
+	return nil
+}
+
+// New returns a backup provider retrying the operations of the given backup provider
+func New(log *slog.Logger, config *BackupProviderConfigRetry) (*BackupProviderRetry, error) {
+	if config == nil {
+		return nil, errors.New("retry backup provider requires a provider config")
+	}
+
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Attempts == 0 {
+		config.Attempts = defaultAttempts
+	}
+	if config.Delay == 0 {
+		config.Delay = defaultDelay
+	}
+	if config.MaxDelay == 0 {
+		config.MaxDelay = defaultMaxDelay
+	}
+
+	return &BackupProviderRetry{
+		log:    log,
+		config: config,
+	}, nil
+}
+
+// EnsureBackupBucket ensures the backup bucket of the underlying provider, failed attempts are retried
+func (r *BackupProviderRetry) EnsureBackupBucket(ctx context.Context) error {
+	return r.do(ctx, "ensure backup bucket", func() error {
+		return r.config.Provider.EnsureBackupBucket(ctx)
+	})
+}
+
+// ListBackups lists the backups of the underlying provider, failed attempts are retried
+func (r *BackupProviderRetry) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
+	var versions providers.BackupVersions
+	err := r.do(ctx, "list backups", func() error {
+		var err error
+		versions, err = r.config.Provider.ListBackups(ctx)
+		return err
+	})
+	return versions, err
+}
+
+// ListBackupsPage lists a page of the backups of the underlying provider, failed attempts are retried
+func (r *BackupProviderRetry) ListBackupsPage(ctx context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	var (
+		versions []*providers.BackupVersion
+		token    string
+	)
+	err := r.do(ctx, "list backups", func() error {
+		var err error
+		versions, token, err = r.config.Provider.ListBackupsPage(ctx, opts)
+		return err
+	})
+	return versions, token, err
+}
+
+// CleanupBackups cleans up the backups of the underlying provider
+func (r *BackupProviderRetry) CleanupBackups(ctx context.Context) error {
+	return r.config.Provider.CleanupBackups(ctx)
+}
+
+// GetNextBackupName returns the name of the next backup of the underlying provider
+func (r *BackupProviderRetry) GetNextBackupName(ctx context.Context) string {
+	return r.config.Provider.GetNextBackupName(ctx)
+}
+
+// DownloadBackup downloads the given backup version from the underlying provider.
+// a retried download continues where the failed attempt stopped, such that every byte is written to the writer exactly once.
+// a writer which implements io.WriterAt is passed on as such, a retried download then writes the parts at their offsets again.
+func (r *BackupProviderRetry) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
+	w := &resumeWriter{w: writer}
+
+	var dst io.Writer = w
+	if writerAt, ok := writer.(io.WriterAt); ok {
+		dst = &resumeWriterAt{resumeWriter: w, w: writerAt}
+	}
+
+	return r.do(ctx, "download backup", func() error {
+		w.skip = w.n
+
+		err := r.config.Provider.DownloadBackup(ctx, version, dst)
+		if err != nil && w.err != nil {
+			// the download cannot succeed if the data cannot be written
+			return retrygo.Unrecoverable(err)
+		}
+
+		return err
+	})
+}
+
+// UploadBackup uploads the backup to the underlying provider.
+// if a spool directory is configured, the first attempt reads the stream and buffers it in the spool directory at the same time,
+// further attempts upload the buffered stream. otherwise the stream is uploaded once.
+func (r *BackupProviderRetry) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
+	if r.config.Attempts <= 1 || r.config.SpoolDir == "" {
+		return r.config.Provider.UploadBackup(ctx, reader, manifest)
+	}
+
+	f, err := os.CreateTemp(r.config.SpoolDir, ".upload-*")
+	if err != nil {
+		r.log.Warn("unable to buffer upload, a failed upload is not retried", "error", err)
+		return r.config.Provider.UploadBackup(ctx, reader, manifest)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	var (
+		s       = &spool{f: f}
+		attempt int
+	)
+
+	return r.do(ctx, "upload backup", func() error {
+		attempt++
+
+		if attempt == 1 {
+			err := r.config.Provider.UploadBackup(ctx, io.TeeReader(reader, s), manifest)
+			if err != nil && s.err != nil {
+				return retrygo.Unrecoverable(err)
+			}
+			return err
+		}
+
+		// the rest of the stream which was not read by the failed attempt completes the buffer
+		_, err := io.Copy(s, reader)
+		if err != nil {
+			return retrygo.Unrecoverable(fmt.Errorf("unable to buffer upload: %w", err))
+		}
+
+		return r.config.Provider.UploadBackup(ctx, r.config.UploadLimiter.Reader(ctx, io.NewSectionReader(f, 0, s.n)), manifest)
+	})
+}
+
+// DownloadManifest downloads the manifest of the given backup version from the underlying provider, failed attempts are retried
+func (r *BackupProviderRetry) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	var manifest *providers.Manifest
+	err := r.do(ctx, "download manifest", func() error {
+		var err error
+		manifest, err = r.config.Provider.DownloadManifest(ctx, version)
+		return err
+	})
+	return manifest, err
+}
+
+// DeleteBackup deletes the given backup version at the underlying provider
+func (r *BackupProviderRetry) DeleteBackup(ctx context.Context, version *providers.BackupVersion) error {
+	return r.config.Provider.DeleteBackup(ctx, version)
+}
+
+// PinBackup pins the given backup version at the underlying provider
+func (r *BackupProviderRetry) PinBackup(ctx context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	return r.config.Provider.PinBackup(ctx, version)
+}
+
+// PutObject stores the object at the underlying provider. failed uploads are retried with a reopened reader
+// if the reader implements providers.Reopener, otherwise the stream cannot be read again and they are not retried.
+func (r *BackupProviderRetry) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	store, ok := r.config.Provider.(providers.ObjectStore)
+	if !ok {
+		return providers.ErrObjectStoreNotSupported
+	}
+
+	opener, ok := reader.(providers.Reopener)
+	if !ok || r.config.Attempts <= 1 {
+		return store.PutObject(ctx, name, reader)
+	}
+
+	var attempt int
+
+	return r.do(ctx, "put object", func() error {
+		attempt++
+
+		if attempt == 1 {
+			return store.PutObject(ctx, name, reader)
+		}
+
+		rc, err := opener.Reopen()
+		if err != nil {
+			return retrygo.Unrecoverable(fmt.Errorf("unable to reopen %s: %w", name, err))
+		}
+		defer func() {
+			_ = rc.Close()
+		}()
+
+		return store.PutObject(ctx, name, rc)
+	})
+}
+
+// GetObject downloads the object with the given name from the underlying provider, failed attempts are retried
+// and continue where the failed attempt stopped
+func (r *BackupProviderRetry) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	store, ok := r.config.Provider.(providers.ObjectStore)
+	if !ok {
+		return providers.ErrObjectStoreNotSupported
+	}
+
+	w := &resumeWriter{w: writer}
+
+	return r.do(ctx, "get object", func() error {
+		w.skip = w.n
+
+		err := store.GetObject(ctx, name, w)
+		if err != nil && w.err != nil {
+			return retrygo.Unrecoverable(err)
+		}
+
+		return err
+	})
+}
+
+// ListObjects lists the objects of the underlying provider, failed attempts are retried
+func (r *BackupProviderRetry) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	store, ok := r.config.Provider.(providers.ObjectStore)
+	if !ok {
+		return nil, providers.ErrObjectStoreNotSupported
+	}
+
+	var objects []*providers.Object
+	err := r.do(ctx, "list objects", func() error {
+		var err error
+		objects, err = store.ListObjects(ctx, prefix)
+		return err
+	})
+	return objects, err
+}
+
+// DeleteObject deletes the object with the given name at the underlying provider
+func (r *BackupProviderRetry) DeleteObject(ctx context.Context, name string) error {
+	store, ok := r.config.Provider.(providers.ObjectStore)
+	if !ok {
+		return providers.ErrObjectStoreNotSupported
+	}
+
+	return store.DeleteObject(ctx, name)
+}
+
+// do runs the given operation until it succeeds, fails with an error which is not retryable or the attempts are exhausted
+func (r *BackupProviderRetry) do(ctx context.Context, operation string, fn func() error) error {
+	return retrygo.Do(fn,
+		retrygo.Context(ctx),
+		retrygo.Attempts(r.config.Attempts),
+		retrygo.Delay(r.config.Delay),
+		retrygo.MaxDelay(r.config.MaxDelay),
+		retrygo.MaxJitter(r.config.Delay),
+		retrygo.DelayType(retrygo.CombineDelay(retrygo.BackOffDelay, retrygo.RandomDelay)),
+		retrygo.LastErrorOnly(true),
+		retrygo.RetryIf(func(err error) bool {
+			return ctx.Err() == nil && r.retryable(err)
+		}),
+		retrygo.OnRetry(func(attempt uint, err error) {
+			r.log.Warn("backup provider operation failed, retrying", "operation", operation, "attempt", attempt+1, "error", err)
+		}),
+	)
+}
+
+// retryable returns true if the given error is transient according to the underlying provider
+func (r *BackupProviderRetry) retryable(err error) bool {
+	if !retrygo.IsRecoverable(err) || errors.Is(err, providers.ErrManifestNotFound) {
+		return false
+	}
+
+	if classifier, ok := r.config.Provider.(providers.RetryClassifier); ok {
+		return classifier.IsRetryable(err)
+	}
+
+	return common.IsNetworkError(err)
+}
+
+// resumeWriter passes every byte to the underlying writer only once, the bytes which were already written by a previous attempt are skipped
+type resumeWriter struct {
+	w    io.Writer
+	n    int64
+	skip int64
+	err  error
+}
+
+func (w *resumeWriter) Write(p []byte) (int, error) {
+	skipped := int(min(w.skip, int64(len(p))))
+	w.skip -= int64(skipped)
+
+	n, err := w.w.Write(p[skipped:])
+	w.n += int64(n)
+	if err != nil {
+		w.err = err
+	}
+
+	return skipped + n, err
+}
+
+// resumeWriterAt additionally passes parts written at an offset to the underlying writer, e.g. by concurrent ranged downloads
+type resumeWriterAt struct {
+	*resumeWriter
+	w  io.WriterAt
+	mu sync.Mutex
+}
+
+func (w *resumeWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.w.WriteAt(p, off)
+	if err != nil {
+		w.mu.Lock()
+		w.resumeWriter.err = err
+		w.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// spool buffers the stream of an upload such that the upload can be retried
+type spool struct {
+	f   *os.File
+	n   int64
+	err error
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.n += int64(n)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
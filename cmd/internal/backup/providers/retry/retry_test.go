@@ -0,0 +1,298 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+// flakyProvider fails the first calls of an operation after it transferred a part of the data
+type flakyProvider struct {
+	providers.BackupProvider
+	failures int
+	err      error
+	calls    int
+	// writtenAt is set if a download was written at offsets
+	writtenAt bool
+}
+
+func (f *flakyProvider) fail() bool {
+	f.calls++
+	return f.calls <= f.failures
+}
+
+func (f *flakyProvider) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
+	if f.fail() {
+		return nil, f.err
+	}
+	return f.BackupProvider.ListBackups(ctx)
+}
+
+func (f *flakyProvider) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
+	if f.fail() {
+		_, _ = io.CopyN(io.Discard, reader, 3)
+		return f.err
+	}
+	return f.BackupProvider.UploadBackup(ctx, reader, manifest)
+}
+
+func (f *flakyProvider) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
+	writerAt, ok := writer.(io.WriterAt)
+	if !ok {
+		if f.fail() {
+			_, _ = writer.Write([]byte("pre"))
+			return f.err
+		}
+		return f.BackupProvider.DownloadBackup(ctx, version, writer)
+	}
+
+	f.writtenAt = true
+
+	if f.fail() {
+		_, _ = writerAt.WriteAt([]byte("xxx"), 0)
+		return f.err
+	}
+
+	// like a ranged download, the content is written at its offset
+	var buf bytes.Buffer
+	if err := f.BackupProvider.DownloadBackup(ctx, version, &buf); err != nil {
+		return err
+	}
+	_, err := writerAt.WriteAt(buf.Bytes(), 0)
+	return err
+}
+
+func (f *flakyProvider) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	if f.fail() {
+		_, _ = io.CopyN(io.Discard, reader, 3)
+		return f.err
+	}
+	return f.BackupProvider.(providers.ObjectStore).PutObject(ctx, name, reader)
+}
+
+func (f *flakyProvider) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	if f.fail() {
+		_, _ = writer.Write([]byte("seg"))
+		return f.err
+	}
+	return f.BackupProvider.(providers.ObjectStore).GetObject(ctx, name, writer)
+}
+
+func (f *flakyProvider) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	return f.BackupProvider.(providers.ObjectStore).ListObjects(ctx, prefix)
+}
+
+func (f *flakyProvider) DeleteObject(ctx context.Context, name string) error {
+	return f.BackupProvider.(providers.ObjectStore).DeleteObject(ctx, name)
+}
+
+// reopenableReader reads the given content, like a file it can be reopened
+type reopenableReader struct {
+	content string
+	r       io.Reader
+}
+
+func (r *reopenableReader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		r.r = strings.NewReader(r.content)
+	}
+	return r.r.Read(p)
+}
+
+func (r *reopenableReader) Reopen() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(r.content)), nil
+}
+
+func Test_BackupProviderRetry(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	newProvider := func(t *testing.T, failures int, err error) (*BackupProviderRetry, *flakyProvider) {
+		p, err2 := local.New(log, &local.BackupProviderConfigLocal{
+			FS:     afero.NewMemMapFs(),
+			Suffix: ".tar.gz",
+		})
+		require.NoError(t, err2)
+		require.NoError(t, p.EnsureBackupBucket(ctx))
+
+		flaky := &flakyProvider{BackupProvider: p, failures: failures, err: err}
+
+		r, err2 := New(log, &BackupProviderConfigRetry{
+			Provider: flaky,
+			Delay:    time.Millisecond,
+			SpoolDir: t.TempDir(),
+		})
+		require.NoError(t, err2)
+
+		return r, flaky
+	}
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		r, flaky := newProvider(t, 2, errTransient)
+
+		_, err := r.ListBackups(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, flaky.calls)
+	})
+
+	t.Run("attempts are limited", func(t *testing.T) {
+		r, flaky := newProvider(t, 5, errTransient)
+
+		_, err := r.ListBackups(ctx)
+		require.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 3, flaky.calls)
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		r, flaky := newProvider(t, 5, errors.New("access denied"))
+
+		_, err := r.ListBackups(ctx)
+		require.EqualError(t, err, "access denied")
+		assert.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("canceled operations are not retried", func(t *testing.T) {
+		r, flaky := newProvider(t, 5, errTransient)
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := r.ListBackups(ctx)
+		require.Error(t, err)
+		assert.LessOrEqual(t, flaky.calls, 1)
+	})
+
+	t.Run("upload is retried from the buffered stream", func(t *testing.T) {
+		r, flaky := newProvider(t, 2, errTransient)
+
+		err := r.UploadBackup(ctx, strings.NewReader("precious data"), &providers.Manifest{DatabaseType: "postgres"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, flaky.calls)
+
+		flaky.failures = 0
+
+		versions, err := r.ListBackups(ctx)
+		require.NoError(t, err)
+		require.Len(t, versions.List(), 1)
+
+		var buf bytes.Buffer
+		err = r.DownloadBackup(ctx, versions.Latest(), &buf)
+		require.NoError(t, err)
+		assert.Equal(t, "precious data", buf.String())
+
+		files, err := afero.ReadDir(afero.NewOsFs(), r.config.SpoolDir)
+		require.NoError(t, err)
+		assert.Empty(t, files, "buffered upload must be removed")
+	})
+
+	t.Run("upload is not retried without spool dir", func(t *testing.T) {
+		r, flaky := newProvider(t, 2, errTransient)
+		r.config.SpoolDir = ""
+
+		err := r.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+		require.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("download continues where the failed attempt stopped", func(t *testing.T) {
+		r, flaky := newProvider(t, 0, errTransient)
+
+		err := r.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+		require.NoError(t, err)
+
+		versions, err := r.ListBackups(ctx)
+		require.NoError(t, err)
+
+		flaky.calls = 0
+		flaky.failures = 2
+
+		var buf bytes.Buffer
+		err = r.DownloadBackup(ctx, versions.Latest(), &buf)
+		require.NoError(t, err)
+		assert.Equal(t, "precious data", buf.String())
+		assert.Equal(t, 3, flaky.calls)
+	})
+	t.Run("download to a writer at rewrites the parts of failed attempts", func(t *testing.T) {
+		r, flaky := newProvider(t, 0, errTransient)
+
+		err := r.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+		require.NoError(t, err)
+
+		versions, err := r.ListBackups(ctx)
+		require.NoError(t, err)
+
+		flaky.calls = 0
+		flaky.failures = 2
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "download"))
+		require.NoError(t, err)
+		defer func() {
+			_ = f.Close()
+		}()
+
+		err = r.DownloadBackup(ctx, versions.Latest(), f)
+		require.NoError(t, err)
+		assert.Equal(t, 3, flaky.calls)
+		assert.True(t, flaky.writtenAt)
+
+		content, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		assert.Equal(t, "precious data", string(content))
+	})
+
+	t.Run("object upload is retried with a reopened reader", func(t *testing.T) {
+		r, flaky := newProvider(t, 2, errTransient)
+
+		err := r.PutObject(ctx, "basebackups/base.tar.gz", &reopenableReader{content: "base backup"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, flaky.calls)
+
+		var buf bytes.Buffer
+		err = r.GetObject(ctx, "basebackups/base.tar.gz", &buf)
+		require.NoError(t, err)
+		assert.Equal(t, "base backup", buf.String())
+	})
+
+	t.Run("object upload is not retried without reopener", func(t *testing.T) {
+		r, flaky := newProvider(t, 2, errTransient)
+
+		err := r.PutObject(ctx, "wal/000000010000000000000001", strings.NewReader("segment"))
+		require.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("object download continues where the failed attempt stopped", func(t *testing.T) {
+		r, flaky := newProvider(t, 0, errTransient)
+
+		err := r.PutObject(ctx, "wal/000000010000000000000001", strings.NewReader("segment"))
+		require.NoError(t, err)
+
+		flaky.calls = 0
+		flaky.failures = 2
+
+		var buf bytes.Buffer
+		err = r.GetObject(ctx, "wal/000000010000000000000001", &buf)
+		require.NoError(t, err)
+		assert.Equal(t, "segment", buf.String())
+		assert.Equal(t, 3, flaky.calls)
+	})
+}
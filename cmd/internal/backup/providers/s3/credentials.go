@@ -0,0 +1,42 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// credentialsFileRefresh is the interval after which the credentials file is read again, e.g. after a mounted secret was rotated
+const credentialsFileRefresh = 5 * time.Minute
+
+// fileCredentialsProvider reads the credentials of a profile from a shared credentials file only,
+// without falling back to other sources of the default chain
+type fileCredentialsProvider struct {
+	file    string
+	profile string
+	refresh time.Duration
+}
+
+// Retrieve reads the credentials from the file, they expire after the refresh interval such that a credentials cache reads the file again
+func (p *fileCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	shared, err := config.LoadSharedConfigProfile(ctx, p.profile, func(o *config.LoadSharedConfigOptions) {
+		o.CredentialsFiles = []string{p.file}
+		o.ConfigFiles = []string{}
+	})
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("unable to read s3 credentials file: %w", err)
+	}
+	if !shared.Credentials.HasKeys() {
+		return aws.Credentials{}, fmt.Errorf("s3 credentials file does not contain keys for profile %q", p.profile)
+	}
+
+	creds := shared.Credentials
+	creds.Source = "SharedCredentialsFile"
+	creds.CanExpire = true
+	creds.Expires = time.Now().Add(p.refresh)
+
+	return creds, nil
+}
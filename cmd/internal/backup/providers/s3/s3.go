@@ -2,24 +2,37 @@ package s3
 
 import (
 	"context"
+	"crypto/md5" // nolint:gosec
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/spf13/afero"
 
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/utils"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 )
@@ -28,6 +41,27 @@ const (
 	defaultBackupName     = "db"
 	checksumWhenSupported = "when_supported"
 	checksumWhenRequired  = "when_required"
+
+	// CredentialsModeStatic uses the configured access and secret key
+	CredentialsModeStatic = "static"
+	// CredentialsModeDefaultChain resolves credentials like the aws cli from env, shared files, web identity tokens and instance roles
+	CredentialsModeDefaultChain = "default-chain"
+	// CredentialsModeWebIdentity assumes a role with a web identity token, e.g. IRSA on EKS
+	CredentialsModeWebIdentity = "web-identity"
+	// CredentialsModeFile reads the credentials from a shared credentials file
+	CredentialsModeFile = "file"
+
+	// SSEModeS3 encrypts backups at rest with keys managed by s3
+	SSEModeS3 = "sse-s3"
+	// SSEModeKMS encrypts backups at rest with a key managed by kms
+	SSEModeKMS = "sse-kms"
+	// SSEModeC encrypts backups at rest with a key provided by the customer
+	SSEModeC = "sse-c"
+
+	// ObjectLockModeGovernance protects backups from deletion, unless a user has special permissions
+	ObjectLockModeGovernance = "governance"
+	// ObjectLockModeCompliance protects backups from deletion by any user including the root account
+	ObjectLockModeCompliance = "compliance"
 )
 
 // BackupProviderS3 implements the backup provider interface for S3
@@ -37,15 +71,29 @@ type BackupProviderS3 struct {
 	c      *s3.Client
 	config *BackupProviderConfigS3
 	suffix string
+
+	// sseCustomerKey and sseCustomerKeyMD5 are base64 encoded for usage with sse-c
+	sseCustomerKey    string
+	sseCustomerKeyMD5 string
 }
 
 // BackupProviderConfigS3 provides configuration for the BackupProviderS3
 type BackupProviderConfigS3 struct {
-	BucketName                 string
-	Endpoint                   string
-	Region                     string
-	AccessKey                  string
-	SecretKey                  string
+	BucketName string
+	Endpoint   string
+	Region     string
+	// CredentialsMode defines how credentials are obtained, defaults to static
+	CredentialsMode string
+	// AccessKey and SecretKey are used with the static credentials mode
+	AccessKey string
+	SecretKey string
+	// RoleARN and WebIdentityTokenFile are used with the web-identity credentials mode,
+	// they default to AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE from the environment
+	RoleARN              string
+	WebIdentityTokenFile string
+	// CredentialsFile and Profile are used with the file credentials mode
+	CredentialsFile            string
+	Profile                    string
 	BackupName                 string
 	InsecureSkipVerify         *bool
 	TrustedCaCert              *string
@@ -55,6 +103,26 @@ type BackupProviderConfigS3 struct {
 	FS                         afero.Fs
 	Suffix                     string
 	RequestChecksumCalculation *string
+	// DisableVersioning stores every backup under a timestamped object key instead of relying on bucket versioning,
+	// retention is then applied by the sidecar instead of lifecycle rules
+	DisableVersioning *bool
+	// DownloadConcurrency is the number of parts which are downloaded in parallel with ranged requests
+	DownloadConcurrency int
+	// DownloadPartSize is the size in bytes of a single part of a download
+	DownloadPartSize int64
+	// SSEMode enables server-side encryption of the backups, one of sse-s3, sse-kms or sse-c
+	SSEMode string
+	// SSEKMSKeyID is the kms key used with sse-kms, if empty the default key of s3 is used
+	SSEKMSKeyID string
+	// SSECustomerKeyFile is the path to the 256 bit key used with sse-c, either raw or base64 encoded
+	SSECustomerKeyFile string
+	// ObjectLockMode enables object lock for the bucket and protects every uploaded backup, one of governance or compliance
+	ObjectLockMode string
+	// ObjectLockRetentionDays is the number of days an uploaded backup is protected from deletion
+	ObjectLockRetentionDays int32
+	// Retention is a tiered retention policy, if configured it replaces ObjectsToKeep and ObjectDaysToKeep.
+	// backups are then deleted by the sidecar instead of the lifecycle rule
+	Retention common.Retention
 }
 
 func (c *BackupProviderConfigS3) validate() error {
@@ -64,11 +132,28 @@ func (c *BackupProviderConfigS3) validate() error {
 	if c.Endpoint == "" {
 		return errors.New("s3 endpoint must not be empty")
 	}
-	if c.AccessKey == "" {
-		return errors.New("s3 accesskey must not be empty")
-	}
-	if c.SecretKey == "" {
-		return errors.New("s3 secretkey must not be empty")
+	switch c.CredentialsMode {
+	case CredentialsModeStatic:
+		if c.AccessKey == "" {
+			return errors.New("s3 accesskey must not be empty")
+		}
+		if c.SecretKey == "" {
+			return errors.New("s3 secretkey must not be empty")
+		}
+	case CredentialsModeDefaultChain:
+	case CredentialsModeWebIdentity:
+		if c.RoleARN == "" {
+			return errors.New("s3 role arn must not be empty")
+		}
+		if c.WebIdentityTokenFile == "" {
+			return errors.New("s3 web identity token file must not be empty")
+		}
+	case CredentialsModeFile:
+		if c.CredentialsFile == "" {
+			return errors.New("s3 credentials file must not be empty")
+		}
+	default:
+		return fmt.Errorf("s3 credentials mode must be one of %q, %q, %q or %q", CredentialsModeStatic, CredentialsModeDefaultChain, CredentialsModeWebIdentity, CredentialsModeFile)
 	}
 	if c.InsecureSkipVerify != nil && *c.InsecureSkipVerify && c.TrustedCaCert != nil {
 		return errors.New("s3 skip verify certificate and trusted CA certificate cannot be set at the same time")
@@ -80,7 +165,44 @@ func (c *BackupProviderConfigS3) validate() error {
 			return fmt.Errorf("s3 request checksum calculation must be %q or %q", checksumWhenRequired, checksumWhenSupported)
 		}
 	}
-	return nil
+	switch c.SSEMode {
+	case "", SSEModeS3:
+	case SSEModeKMS:
+	case SSEModeC:
+		if c.SSECustomerKeyFile == "" {
+			return errors.New("s3 sse customer key file must not be empty")
+		}
+	default:
+		return fmt.Errorf("s3 sse mode must be one of %q, %q or %q", SSEModeS3, SSEModeKMS, SSEModeC)
+	}
+	if c.SSEKMSKeyID != "" && c.SSEMode != SSEModeKMS {
+		return fmt.Errorf("s3 sse kms key id requires sse mode %q", SSEModeKMS)
+	}
+	if c.SSECustomerKeyFile != "" && c.SSEMode != SSEModeC {
+		return fmt.Errorf("s3 sse customer key file requires sse mode %q", SSEModeC)
+	}
+	switch c.ObjectLockMode {
+	case "":
+		if c.ObjectLockRetentionDays != 0 {
+			return errors.New("s3 object lock retention days require an object lock mode")
+		}
+	case ObjectLockModeGovernance, ObjectLockModeCompliance:
+		if c.ObjectLockRetentionDays <= 0 {
+			return errors.New("s3 object lock retention days must be greater than zero")
+		}
+		if c.DisableVersioning != nil && *c.DisableVersioning {
+			return errors.New("s3 object lock requires versioning")
+		}
+	default:
+		return fmt.Errorf("s3 object lock mode must be %q or %q", ObjectLockModeGovernance, ObjectLockModeCompliance)
+	}
+	if c.DownloadConcurrency < 0 {
+		return errors.New("s3 download concurrency must not be negative")
+	}
+	if c.DownloadPartSize < 0 {
+		return errors.New("s3 download part size must not be negative")
+	}
+	return c.Retention.Validate()
 }
 
 // New returns a S3 backup provider
@@ -98,6 +220,26 @@ func New(log *slog.Logger, cfg *BackupProviderConfigS3) (*BackupProviderS3, erro
 	if cfg.FS == nil {
 		cfg.FS = afero.NewOsFs()
 	}
+	if cfg.CredentialsMode == "" {
+		cfg.CredentialsMode = CredentialsModeStatic
+	}
+	if cfg.CredentialsMode == CredentialsModeFile && cfg.Profile == "" {
+		cfg.Profile = "default"
+	}
+	if cfg.CredentialsMode == CredentialsModeWebIdentity {
+		if cfg.RoleARN == "" {
+			cfg.RoleARN = os.Getenv("AWS_ROLE_ARN")
+		}
+		if cfg.WebIdentityTokenFile == "" {
+			cfg.WebIdentityTokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		}
+	}
+	if cfg.DownloadConcurrency == 0 {
+		cfg.DownloadConcurrency = manager.DefaultDownloadConcurrency
+	}
+	if cfg.DownloadPartSize == 0 {
+		cfg.DownloadPartSize = manager.DefaultDownloadPartSize
+	}
 
 	err := cfg.validate()
 	if err != nil {
@@ -125,14 +267,38 @@ func New(log *slog.Logger, cfg *BackupProviderConfigS3) (*BackupProviderS3, erro
 		}
 	}
 
-	s3Cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")),
+	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(cfg.Region),
 		config.WithHTTPClient(httpClient),
-	)
+	}
+
+	switch cfg.CredentialsMode {
+	case CredentialsModeStatic:
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")))
+	case CredentialsModeFile:
+		provider := &fileCredentialsProvider{file: cfg.CredentialsFile, profile: cfg.Profile, refresh: credentialsFileRefresh}
+		// the file is read once on startup to fail early on missing credentials, afterwards it is read again whenever the cached credentials expired
+		if _, err := provider.Retrieve(context.TODO()); err != nil {
+			return nil, err
+		}
+		opts = append(opts, config.WithCredentialsProvider(aws.NewCredentialsCache(provider)))
+	}
+
+	s3Cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
 	if err != nil {
 		return nil, err
 	}
+
+	if cfg.CredentialsMode == CredentialsModeWebIdentity {
+		// the role is assumed at sts of aws, the s3 endpoint only applies to the s3 client
+		s3Cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			sts.NewFromConfig(s3Cfg),
+			cfg.RoleARN,
+			stscreds.IdentityTokenFile(cfg.WebIdentityTokenFile),
+		))
+	}
+
+	log.Info("using s3 credentials", "mode", cfg.CredentialsMode)
 	client := s3.NewFromConfig(s3Cfg, func(o *s3.Options) {
 		o.BaseEndpoint = aws.String(cfg.Endpoint)
 		o.UsePathStyle = true
@@ -146,13 +312,135 @@ func New(log *slog.Logger, cfg *BackupProviderConfigS3) (*BackupProviderS3, erro
 		}
 	})
 
-	return &BackupProviderS3{
+	b := &BackupProviderS3{
 		c:      client,
 		config: cfg,
 		log:    log,
 		fs:     cfg.FS,
 		suffix: cfg.Suffix,
-	}, nil
+	}
+
+	if cfg.SSEMode == SSEModeC {
+		key, err := readCustomerKey(cfg.FS, cfg.SSECustomerKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// the md5 digest of the key is required by the sse-c protocol for integrity checks
+		sum := md5.Sum(key) // nolint:gosec
+		b.sseCustomerKey = base64.StdEncoding.EncodeToString(key)
+		b.sseCustomerKeyMD5 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	return b, nil
+}
+
+// readCustomerKey reads the sse-c key, which is either stored raw or base64 encoded
+func readCustomerKey(fs afero.Fs, path string) ([]byte, error) {
+	content, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read s3 sse customer key file: %w", err)
+	}
+
+	if len(content) == 32 {
+		return content, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+
+	return nil, errors.New("s3 sse customer key must be 32 bytes, either raw or base64 encoded")
+}
+
+// encryptUpload sets the server-side encryption parameters for uploading a backup
+func (b *BackupProviderS3) encryptUpload(input *s3.PutObjectInput) {
+	switch b.config.SSEMode {
+	case SSEModeS3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case SSEModeKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if b.config.SSEKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(b.config.SSEKMSKeyID)
+		}
+	case SSEModeC:
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(b.sseCustomerKey)
+		input.SSECustomerKeyMD5 = aws.String(b.sseCustomerKeyMD5)
+	}
+}
+
+// lockUpload sets the object lock retention for uploading a backup
+func (b *BackupProviderS3) lockUpload(input *s3.PutObjectInput) {
+	switch b.config.ObjectLockMode {
+	case ObjectLockModeGovernance:
+		input.ObjectLockMode = types.ObjectLockModeGovernance
+	case ObjectLockModeCompliance:
+		input.ObjectLockMode = types.ObjectLockModeCompliance
+	default:
+		return
+	}
+
+	input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(time.Duration(b.config.ObjectLockRetentionDays) * 24 * time.Hour))
+}
+
+// encryptCopy sets the server-side encryption parameters for copying a backup within the bucket
+func (b *BackupProviderS3) encryptCopy(input *s3.CopyObjectInput) {
+	switch b.config.SSEMode {
+	case SSEModeS3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case SSEModeKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if b.config.SSEKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(b.config.SSEKMSKeyID)
+		}
+	case SSEModeC:
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(b.sseCustomerKey)
+		input.SSECustomerKeyMD5 = aws.String(b.sseCustomerKeyMD5)
+		input.CopySourceSSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.CopySourceSSECustomerKey = aws.String(b.sseCustomerKey)
+		input.CopySourceSSECustomerKeyMD5 = aws.String(b.sseCustomerKeyMD5)
+	}
+}
+
+// lockCopy sets the object lock retention for copying a backup within the bucket
+func (b *BackupProviderS3) lockCopy(input *s3.CopyObjectInput) {
+	switch b.config.ObjectLockMode {
+	case ObjectLockModeGovernance:
+		input.ObjectLockMode = types.ObjectLockModeGovernance
+	case ObjectLockModeCompliance:
+		input.ObjectLockMode = types.ObjectLockModeCompliance
+	default:
+		return
+	}
+
+	input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(time.Duration(b.config.ObjectLockRetentionDays) * 24 * time.Hour))
+}
+
+// encryptDownload sets the server-side encryption parameters for downloading a backup,
+// only sse-c requires the key to be passed on download
+func (b *BackupProviderS3) encryptDownload(input *s3.GetObjectInput) {
+	if b.config.SSEMode != SSEModeC {
+		return
+	}
+
+	input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+	input.SSECustomerKey = aws.String(b.sseCustomerKey)
+	input.SSECustomerKeyMD5 = aws.String(b.sseCustomerKeyMD5)
+}
+
+func (b *BackupProviderS3) versioningDisabled() bool {
+	return b.config.DisableVersioning != nil && *b.config.DisableVersioning
+}
+
+// objectPrefix returns the key prefix all backups of this provider are stored with
+func (b *BackupProviderS3) objectPrefix() string {
+	if b.config.ObjectPrefix == "" {
+		return ""
+	}
+	return b.config.ObjectPrefix + "/"
 }
 
 // EnsureBackupBucket ensures a backup bucket at the backup provider
@@ -178,9 +466,14 @@ func (b *BackupProviderS3) EnsureBackupBucket(ctx context.Context) error {
 
 	if !alreadyExists {
 		// create bucket
-		_, err = b.c.CreateBucket(ctx, &s3.CreateBucketInput{
+		input := &s3.CreateBucketInput{
 			Bucket: aws.String(b.config.BucketName),
-		})
+		}
+		if b.config.ObjectLockMode != "" {
+			input.ObjectLockEnabledForBucket = aws.Bool(true)
+		}
+
+		_, err = b.c.CreateBucket(ctx, input)
 		if err != nil {
 			var (
 				bucketAlreadyExists     *types.BucketAlreadyExists
@@ -192,6 +485,24 @@ func (b *BackupProviderS3) EnsureBackupBucket(ctx context.Context) error {
 		}
 	}
 
+	if alreadyExists && b.config.ObjectLockMode != "" {
+		// object lock can only be enabled on bucket creation, so an existing bucket must have been created with it
+		lock, err := b.c.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+			Bucket: aws.String(b.config.BucketName),
+		})
+		if err != nil {
+			return fmt.Errorf("unable to get object lock configuration of bucket %s: %w", b.config.BucketName, err)
+		}
+		if lock.ObjectLockConfiguration == nil || lock.ObjectLockConfiguration.ObjectLockEnabled != types.ObjectLockEnabledEnabled {
+			return fmt.Errorf("object lock is not enabled for existing bucket %s", b.config.BucketName)
+		}
+	}
+
+	if b.versioningDisabled() {
+		// backups are stored with timestamped keys and cleaned up by the sidecar
+		return nil
+	}
+
 	// enable versioning
 	_, err = b.c.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
 		Bucket: aws.String(b.config.BucketName),
@@ -212,15 +523,17 @@ func (b *BackupProviderS3) EnsureBackupBucket(ctx context.Context) error {
 		noncurrentExpiration.NoncurrentDays = b.config.ObjectDaysToKeep
 	}
 
-	rules := []types.LifecycleRule{
-		{
+	var rules []types.LifecycleRule
+	// a lifecycle rule only understands counts and days, so with a tiered retention the backups are expired by the sidecar
+	if !b.config.Retention.Enabled() {
+		rules = append(rules, types.LifecycleRule{
 			NoncurrentVersionExpiration: noncurrentExpiration,
 			Status:                      types.ExpirationStatusEnabled,
 			ID:                          lifecycleRuleID,
 			Filter: &types.LifecycleRuleFilter{
 				Prefix: aws.String(b.config.ObjectPrefix + "/"),
 			},
-		},
+		})
 	}
 
 	// get existing lifecycle configuration
@@ -241,6 +554,18 @@ func (b *BackupProviderS3) EnsureBackupBucket(ctx context.Context) error {
 		}
 	}
 
+	if len(rules) == 0 {
+		// a lifecycle configuration requires at least one rule
+		if bucketLifecycleConfiguration == nil {
+			return nil
+		}
+
+		_, err = b.c.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(b.config.BucketName),
+		})
+		return err
+	}
+
 	// add lifecycle policy
 	_, err = b.c.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
 		Bucket: aws.String(b.config.BucketName),
@@ -255,62 +580,428 @@ func (b *BackupProviderS3) EnsureBackupBucket(ctx context.Context) error {
 }
 
 // CleanupBackups cleans up backups according to the given backup cleanup policy at the backup provider
-func (b *BackupProviderS3) CleanupBackups(_ context.Context) error {
-	// nothing to do here, done with lifecycle rules
+func (b *BackupProviderS3) CleanupBackups(ctx context.Context) error {
+	if !b.versioningDisabled() {
+		if b.config.Retention.Enabled() {
+			if err := b.cleanupVersions(ctx); err != nil {
+				return err
+			}
+		}
+
+		// without a tiered retention backups are expired with lifecycle rules, only the manifests of expired backups need to be removed
+		return b.cleanupManifests(ctx)
+	}
+
+	versions, err := b.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var maxAge time.Duration
+	if b.config.ObjectDaysToKeep != nil {
+		maxAge = time.Duration(*b.config.ObjectDaysToKeep) * 24 * time.Hour
+	}
+
+	expired := common.Expired(versions.List(), int64(b.config.ObjectsToKeep), maxAge, time.Now())
+	if b.config.Retention.Enabled() {
+		expired = b.config.Retention.Expired(versions.List())
+	}
+
+	var errs []error
+	for _, v := range expired {
+		b.log.Info("deleting expired backup", "object", v.Name, "date", v.Date.String())
+
+		for _, key := range []string{v.Name, common.ManifestName(v.Name, "")} {
+			_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(b.config.BucketName),
+				Key:    aws.String(key),
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to delete object %s: %w", key, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// cleanupVersions deletes the object versions of the backups which are expired by the tiered retention
+func (b *BackupProviderS3) cleanupVersions(ctx context.Context) error {
+	versions, err := b.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, v := range b.config.Retention.Expired(versions.List()) {
+		b.log.Info("deleting expired backup", "object", v.Name, "version", v.Version, "date", v.Date.String())
+
+		err := b.DeleteBackup(ctx, v)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// cleanupManifests deletes the manifests of backup versions which were expired by the lifecycle rules
+func (b *BackupProviderS3) cleanupManifests(ctx context.Context) error {
+	objectVersions, err := b.listObjectVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		versions = backupVersionsS3{objectAttrs: objectVersions}.List()
+		errs     []error
+	)
+	for _, v := range objectVersions {
+		if v.Key == nil || !common.IsManifest(*v.Key) || !common.OrphanedManifest(*v.Key, versions) {
+			continue
+		}
+
+		b.log.Info("deleting manifest of expired backup", "object", *v.Key)
+
+		_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:    aws.String(b.config.BucketName),
+			Key:       v.Key,
+			VersionId: v.VersionId,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete manifest %s: %w", *v.Key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteBackup deletes the given backup version together with its manifest.
+// with object lock enabled, versions which are still within their retention period cannot be deleted and an error is returned.
+func (b *BackupProviderS3) DeleteBackup(ctx context.Context, version *providers.BackupVersion) error {
+	bucket := aws.String(b.config.BucketName)
+
+	b.log.Info("deleting backup", "object", version.Name, "version", version.Version)
+
+	if b.versioningDisabled() {
+		for _, key := range []string{version.Name, common.ManifestName(version.Name, "")} {
+			_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: bucket,
+				Key:    aws.String(key),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to delete object %s: %w", key, err)
+			}
+		}
+
+		return nil
+	}
+
+	// deleting a specific object version removes it permanently instead of adding a delete marker
+	_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    bucket,
+		Key:       aws.String(version.Name),
+		VersionId: aws.String(version.Version),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete object %s in version %s: %w", version.Name, version.Version, err)
+	}
+
+	manifest := common.ManifestName(version.Name, version.Version)
+
+	out, err := b.c.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket: bucket,
+		Prefix: aws.String(manifest),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list versions of manifest %s: %w", manifest, err)
+	}
+
+	for _, v := range out.Versions {
+		if v.Key == nil || *v.Key != manifest {
+			continue
+		}
+
+		_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:    bucket,
+			Key:       v.Key,
+			VersionId: v.VersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to delete manifest %s: %w", manifest, err)
+		}
+	}
+
 	return nil
 }
 
+// PinBackup copies the given backup version together with its manifest to the pinned directory.
+// the copy is stored under a unique key, so it never becomes a noncurrent version which is expired by the lifecycle rule.
+func (b *BackupProviderS3) PinBackup(ctx context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	if common.IsPinned(version.Name) {
+		return nil, fmt.Errorf("backup %s is already pinned", version.Version)
+	}
+
+	var (
+		source     = b.copySource(version.Name)
+		manifest   = common.ManifestName(version.Name, "")
+		backupName = b.config.BackupName
+	)
+	if !b.versioningDisabled() {
+		source += "?versionId=" + url.QueryEscape(version.Version)
+		manifest = common.ManifestName(version.Name, version.Version)
+		backupName = defaultBackupName
+	}
+
+	name := common.PinnedName(version.Name, backupName, version.Date)
+
+	b.log.Info("pinning backup", "object", version.Name, "version", version.Version, "pinned", name)
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(b.config.BucketName),
+		Key:        aws.String(name),
+		CopySource: aws.String(source),
+	}
+	b.encryptCopy(input)
+	b.lockCopy(input)
+
+	out, err := b.c.CopyObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to copy object %s: %w", version.Name, err)
+	}
+
+	pinned := &providers.BackupVersion{
+		Name: name,
+		Date: version.Date,
+	}
+
+	manifestKey := common.ManifestName(name, "")
+	if b.versioningDisabled() {
+		_, pinnedVersion, _ := common.ParseTimestampedName(name, backupName)
+		pinned.Version = common.PinnedVersion(pinnedVersion)
+	} else {
+		pinned.Version = aws.ToString(out.VersionId)
+		manifestKey = common.ManifestName(name, pinned.Version)
+	}
+
+	manifestInput := &s3.CopyObjectInput{
+		Bucket:     aws.String(b.config.BucketName),
+		Key:        aws.String(manifestKey),
+		CopySource: aws.String(b.copySource(manifest)),
+	}
+	b.encryptCopy(manifestInput)
+	b.lockCopy(manifestInput)
+
+	_, err = b.c.CopyObject(ctx, manifestInput)
+	if err != nil {
+		// copy object does not model the no such key error of a missing source
+		var respErr *awshttp.ResponseError
+		if !errors.As(err, &respErr) || respErr.HTTPStatusCode() != http.StatusNotFound {
+			return nil, fmt.Errorf("unable to copy manifest %s: %w", manifest, err)
+		}
+	}
+
+	return pinned, nil
+}
+
+// copySource returns the url encoded source of a copy within the bucket
+func (b *BackupProviderS3) copySource(key string) string {
+	return (&url.URL{Path: b.config.BucketName + "/" + key}).EscapedPath()
+}
+
 // DownloadBackup downloads the given backup version to the specified folder
 func (b *BackupProviderS3) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
 	bucket := aws.String(b.config.BucketName)
 
-	downloader := manager.NewDownloader(b.c)
-	// we need to download the backup sequentially since we fake the download with a io.Writer instead of io.WriterAt
-	downloader.Concurrency = 1
+	b.log.Info("downloading", "object", version.Name, "get", version.Version, "concurrency", b.config.DownloadConcurrency)
+
+	input := &s3.GetObjectInput{
+		Bucket: bucket,
+		Key:    &version.Name,
+	}
+	if !b.versioningDisabled() {
+		input.VersionId = &version.Version
+	}
+	b.encryptDownload(input)
 
-	b.log.Info("downloading", "object", version.Name, "get", version.Version)
+	// parts are downloaded concurrently, if the writer does not support random access the parts are put in order before writing
+	if writerAt, ok := writer.(io.WriterAt); ok {
+		_, err := manager.NewDownloader(b.c, func(d *manager.Downloader) {
+			d.Concurrency = b.config.DownloadConcurrency
+			d.PartSize = b.config.DownloadPartSize
+		}).Download(ctx, writerAt, input)
+		return err
+	}
 
-	streamWriter := utils.NewSequentialWriterAt(writer)
-	_, err := downloader.Download(
-		ctx,
-		streamWriter,
-		&s3.GetObjectInput{
-			Bucket:    bucket,
-			Key:       &version.Name,
-			VersionId: &version.Version,
-		})
+	// parts which are ahead of the stream wait for it to catch up, which bounds the memory to the parts being downloaded
+	ordered := utils.NewOrderedWriterAt(writer, int64(b.config.DownloadConcurrency)*b.config.DownloadPartSize)
+
+	stop := context.AfterFunc(ctx, func() {
+		ordered.Abort(ctx.Err())
+	})
+	defer stop()
+
+	client := &abortingClient{
+		DownloadAPIClient: b.c,
+		ordered:           ordered,
+		retries:           manager.DefaultPartBodyMaxRetries,
+		failures:          map[string]int{},
+	}
+
+	_, err := manager.NewDownloader(client, func(d *manager.Downloader) {
+		d.Concurrency = b.config.DownloadConcurrency
+		d.PartSize = b.config.DownloadPartSize
+		d.PartBodyMaxRetries = client.retries
+	}).Download(ctx, ordered, input)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return ordered.Close()
+}
+
+// abortingClient aborts the ordered writer of a download as soon as a part failed for good,
+// otherwise the parts waiting for the failed part would block the download forever
+type abortingClient struct {
+	manager.DownloadAPIClient
+	ordered *utils.OrderedWriterAt
+	// retries is the number of times the body of a part is requested again after reading it failed
+	retries int
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (c *abortingClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	out, err := c.DownloadAPIClient.GetObject(ctx, params, optFns...)
+	if err != nil {
+		c.ordered.Abort(err)
+		return nil, err
+	}
+
+	out.Body = &abortingBody{ReadCloser: out.Body, client: c, part: aws.ToString(params.Range)}
+
+	return out, nil
+}
+
+// bodyFailed aborts the download if reading the body of the given part failed more often than it is retried
+func (c *abortingClient) bodyFailed(part string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures[part]++
+	if c.failures[part] > c.retries {
+		c.ordered.Abort(err)
+	}
+}
+
+type abortingBody struct {
+	io.ReadCloser
+	client *abortingClient
+	part   string
+}
+
+func (b *abortingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.client.bodyFailed(b.part, err)
+	}
+	return n, err
+}
+
+// DownloadManifest returns the manifest stored alongside the given backup version
+func (b *BackupProviderS3) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	key := common.ManifestName(version.Name, "")
+	if !b.versioningDisabled() {
+		key = common.ManifestName(version.Name, version.Version)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.config.BucketName),
+		Key:    aws.String(key),
+	}
+	b.encryptDownload(input)
+
+	out, err := b.c.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, providers.ErrManifestNotFound
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+
+	return common.DecodeManifest(out.Body)
 }
 
 // UploadBackup uploads a backup to the backup provider
-func (b *BackupProviderS3) UploadBackup(ctx context.Context, reader io.Reader) error {
+func (b *BackupProviderS3) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
 	bucket := aws.String(b.config.BucketName)
 
 	destination := defaultBackupName + b.suffix
-
-	if b.config.ObjectPrefix != "" {
-		destination = b.config.ObjectPrefix + "/" + destination
+	if b.versioningDisabled() {
+		destination = common.TimestampedName(b.config.BackupName, common.UploadDate(manifest)) + b.suffix
 	}
 
+	destination = b.objectPrefix() + destination
+
 	b.log.Debug("uploading object", "dest", destination)
 
-	uploader := manager.NewUploader(b.c)
-	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: bucket,
 		Key:    aws.String(destination),
 		Body:   reader,
-	})
+	}
+	b.encryptUpload(input)
+	b.lockUpload(input)
+
+	uploader := manager.NewUploader(b.c)
+	out, err := uploader.Upload(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	if manifest == nil {
+		return nil
+	}
+
+	encoded, err := common.EncodeManifest(manifest)
 	if err != nil {
 		return err
 	}
 
+	key := common.ManifestName(destination, "")
+	if !b.versioningDisabled() {
+		// all backups share the same object key, so the manifest is named after the version of the backup
+		key = common.ManifestName(destination, aws.ToString(out.VersionID))
+	}
+
+	manifestInput := &s3.PutObjectInput{
+		Bucket:      bucket,
+		Key:         aws.String(key),
+		Body:        encoded,
+		ContentType: aws.String("application/json"),
+	}
+	b.encryptUpload(manifestInput)
+	// the manifest is retained as long as the backup, otherwise it could be replaced while the backup is still locked
+	b.lockUpload(manifestInput)
+
+	_, err = b.c.PutObject(ctx, manifestInput)
+	if err != nil {
+		return fmt.Errorf("unable to upload manifest: %w", err)
+	}
+
 	return nil
 }
 
+// IsRetryable returns true for errors which the aws sdk considers as transient, e.g. throttling, server errors and connection errors
+func (b *BackupProviderS3) IsRetryable(err error) bool {
+	return awsretry.IsErrorRetryables(awsretry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
 // GetNextBackupName returns a name for the next backup archive that is going to be uploaded
 func (b *BackupProviderS3) GetNextBackupName(_ context.Context) string {
 	// name is constant because we use lifecycle rule to cleanup
@@ -319,15 +1010,246 @@ func (b *BackupProviderS3) GetNextBackupName(_ context.Context) string {
 
 // ListBackups lists the available backups of the backup provider
 func (b *BackupProviderS3) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
-	it, err := b.c.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
-		Bucket: aws.String(b.config.BucketName),
-		Prefix: &b.config.ObjectPrefix,
-	})
+	if b.versioningDisabled() {
+		var objects []types.Object
+
+		paginator := s3.NewListObjectsV2Paginator(b.c, &s3.ListObjectsV2Input{
+			Bucket: aws.String(b.config.BucketName),
+			Prefix: aws.String(b.objectPrefix()),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			objects = append(objects, page.Contents...)
+		}
+
+		return backupVersionsS3Timestamped{
+			objects:    objects,
+			backupName: b.config.BackupName,
+		}, nil
+	}
+
+	versions, err := b.listObjectVersions(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	return backupVersionsS3{
-		objectAttrs: it.Versions,
+		objectAttrs: versions,
 	}, nil
 }
+
+// ListBackupsPage lists a page of the backups in the order of common.CompareListed. timestamped backups are listed page by page
+// with the listing of the bucket. s3 lists the versions of an object from newest to oldest, so the versions of a versioned bucket are listed completely.
+func (b *BackupProviderS3) ListBackupsPage(ctx context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	if !b.versioningDisabled() {
+		versions, err := b.ListBackups(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return common.Page(versions.List(), opts)
+	}
+
+	return common.ListPage(ctx, opts, b.listTimestampedPage)
+}
+
+// listTimestampedPage lists up to size timestamped backups or pinned copies, the continuation token of the bucket listing is the marker.
+// the keys contain the timestamps of the backups, so they are listed by date.
+func (b *BackupProviderS3) listTimestampedPage(ctx context.Context, pinned bool, marker string, size int) ([]*providers.BackupVersion, string, error) {
+	prefix := b.objectPrefix() + b.config.BackupName + "-"
+	if pinned {
+		prefix = b.objectPrefix() + common.PinnedDir + "/"
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(b.config.BucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(min(size, math.MaxInt32))), // nolint:gosec
+	}
+	if marker != "" {
+		input.ContinuationToken = aws.String(marker)
+	}
+
+	page, err := b.c.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var result []*providers.BackupVersion
+	for _, object := range page.Contents {
+		if v, ok := timestampedBackupVersion(object, b.config.BackupName); ok {
+			result = append(result, v)
+		}
+	}
+
+	if !aws.ToBool(page.IsTruncated) {
+		return result, "", nil
+	}
+
+	return result, aws.ToString(page.NextContinuationToken), nil
+}
+
+// listObjectVersions returns all object versions below the object prefix
+func (b *BackupProviderS3) listObjectVersions(ctx context.Context) ([]types.ObjectVersion, error) {
+	var versions []types.ObjectVersion
+
+	paginator := s3.NewListObjectVersionsPaginator(b.c, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.config.BucketName),
+		Prefix: &b.config.ObjectPrefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range page.Versions {
+			// objects of the object store are not backups
+			if v.Key != nil && common.IsObject(*v.Key, b.config.ObjectPrefix) {
+				continue
+			}
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, nil
+}
+
+// PutObject stores an object in the objects directory next to the backups
+func (b *BackupProviderS3) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.config.BucketName),
+		Key:    aws.String(common.ObjectsRoot(b.config.ObjectPrefix) + name),
+		Body:   reader,
+	}
+	b.encryptUpload(input)
+	// partial objects are replaced until they are complete, locking them would keep every replaced version
+	if !strings.HasSuffix(name, providers.PartialObjectSuffix) {
+		b.lockUpload(input)
+	}
+
+	_, err := manager.NewUploader(b.c).Upload(ctx, input)
+	if err != nil {
+		return fmt.Errorf("unable to upload object %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// GetObject writes the object with the given name to writer
+func (b *BackupProviderS3) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.config.BucketName),
+		Key:    aws.String(common.ObjectsRoot(b.config.ObjectPrefix) + name),
+	}
+	b.encryptDownload(input)
+
+	out, err := b.c.GetObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("unable to download object %s: %w", name, err)
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+
+	_, err = io.Copy(writer, out.Body)
+	return err
+}
+
+// ListObjects returns the objects whose names start with the given prefix
+func (b *BackupProviderS3) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	root := common.ObjectsRoot(b.config.ObjectPrefix)
+
+	paginator := s3.NewListObjectsV2Paginator(b.c, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.config.BucketName),
+		Prefix: aws.String(root + prefix),
+	})
+
+	var objects []*providers.Object
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range page.Contents {
+			objects = append(objects, &providers.Object{
+				Name: strings.TrimPrefix(aws.ToString(o.Key), root),
+				Date: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object with the given name, with bucket versioning all of its versions are deleted
+func (b *BackupProviderS3) DeleteObject(ctx context.Context, name string) error {
+	var (
+		bucket = aws.String(b.config.BucketName)
+		key    = common.ObjectsRoot(b.config.ObjectPrefix) + name
+	)
+
+	if b.versioningDisabled() {
+		_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: bucket,
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("unable to delete object %s: %w", name, err)
+		}
+
+		return nil
+	}
+
+	out, err := b.c.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket: bucket,
+		Prefix: aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list versions of object %s: %w", name, err)
+	}
+
+	locked := false
+	for _, v := range out.Versions {
+		if aws.ToString(v.Key) != key {
+			continue
+		}
+
+		// versions within their retention period cannot be deleted, the remaining versions are deleted anyway
+		if b.objectLocked(name, v) {
+			locked = true
+			continue
+		}
+
+		_, err := b.c.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:    bucket,
+			Key:       v.Key,
+			VersionId: v.VersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to delete object %s: %w", name, err)
+		}
+	}
+
+	if locked {
+		return fmt.Errorf("unable to delete object %s: %w", name, providers.ErrObjectLocked)
+	}
+
+	return nil
+}
+
+// objectLocked returns true if the given version of an object was uploaded with an object lock whose retention period did not end yet
+func (b *BackupProviderS3) objectLocked(name string, version types.ObjectVersion) bool {
+	if b.config.ObjectLockMode == "" || strings.HasSuffix(name, providers.PartialObjectSuffix) {
+		return false
+	}
+
+	retainUntil := aws.ToTime(version.LastModified).Add(time.Duration(b.config.ObjectLockRetentionDays) * 24 * time.Hour)
+
+	return time.Now().Before(retainUntil)
+}
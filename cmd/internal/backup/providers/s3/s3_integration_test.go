@@ -50,155 +50,174 @@ func Test_BackupProviderS3(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
-	var (
-		endpoint           = conn.Endpoint
-		trustedCaCert      = &conn.TrustedCaCert
-		backupAmount       = 5
-		expectedBackupName = "db.tar.gz"
-		prefix             = fmt.Sprintf("test-with-%d", backupAmount)
+	for _, disableVersioning := range []bool{false, true} {
+		t.Run(fmt.Sprintf("versioning disabled %t", disableVersioning), func(t *testing.T) {
+			var (
+				endpoint           = conn.Endpoint
+				trustedCaCert      = &conn.TrustedCaCert
+				backupAmount       = 5
+				expectedBackupName = "db.tar.gz"
+				objectsToKeep      = 3
+				prefix             = fmt.Sprintf("test-with-%d-versioning-disabled-%t", backupAmount, disableVersioning)
+
+				fs = afero.NewMemMapFs()
+			)
+
+			compressor, err := compress.New("targz")
+			require.NoError(t, err)
 
-		fs = afero.NewMemMapFs()
-	)
+			p, err := New(log, &BackupProviderConfigS3{
+				BucketName:        "test",
+				Endpoint:          endpoint,
+				Region:            "dummy",
+				AccessKey:         "ACCESSKEY",
+				SecretKey:         "SECRETKEY",
+				TrustedCaCert:     trustedCaCert,
+				ObjectPrefix:      prefix,
+				FS:                fs,
+				Suffix:            compressor.Extension(),
+				ObjectsToKeep:     int32(objectsToKeep),
+				DisableVersioning: new(disableVersioning),
+			})
+			require.NoError(t, err)
+			require.NotNil(t, p)
 
-	compressor, err := compress.New("targz")
-	require.NoError(t, err)
+			t.Run("ensure backup bucket", func(t *testing.T) {
+				err := p.EnsureBackupBucket(ctx)
+				require.NoError(t, err)
+			})
 
-	p, err := New(log, &BackupProviderConfigS3{
-		BucketName:    "test",
-		Endpoint:      endpoint,
-		Region:        "dummy",
-		AccessKey:     "ACCESSKEY",
-		SecretKey:     "SECRETKEY",
-		TrustedCaCert: trustedCaCert,
-		ObjectPrefix:  prefix,
-		FS:            fs,
-		Suffix:        compressor.Extension(),
-	})
-	require.NoError(t, err)
-	require.NotNil(t, p)
+			if t.Failed() {
+				return
+			}
 
-	t.Run("ensure backup bucket", func(t *testing.T) {
-		err := p.EnsureBackupBucket(ctx)
-		require.NoError(t, err)
-	})
+			t.Run("verify upload", func(t *testing.T) {
+				for i := range backupAmount {
+					backupName := p.GetNextBackupName(ctx) + ".tar.gz"
+					assert.Equal(t, expectedBackupName, backupName)
 
-	if t.Failed() {
-		return
-	}
+					backupPath := path.Join(constants.UploadDir, backupName)
+					backupContent := fmt.Sprintf("precious data %d", i)
 
-	t.Run("verify upload", func(t *testing.T) {
-		for i := range backupAmount {
-			backupName := p.GetNextBackupName(ctx) + ".tar.gz"
-			assert.Equal(t, expectedBackupName, backupName)
+					err = afero.WriteFile(fs, backupPath, []byte(backupContent), 0600)
+					require.NoError(t, err)
 
-			backupPath := path.Join(constants.UploadDir, backupName)
-			backupContent := fmt.Sprintf("precious data %d", i)
+					backupFile, err := fs.Open(backupPath)
+					require.NoError(t, err)
+					err = p.UploadBackup(ctx, backupFile, nil)
+					require.NoError(t, err)
 
-			err = afero.WriteFile(fs, backupPath, []byte(backupContent), 0600)
-			require.NoError(t, err)
+					// cleaning up after test
+					err = fs.Remove(backupPath)
+					require.NoError(t, err)
+				}
+			})
 
-			backupFile, err := fs.Open(backupPath)
-			require.NoError(t, err)
-			err = p.UploadBackup(ctx, backupFile)
-			require.NoError(t, err)
+			if t.Failed() {
+				return
+			}
 
-			// cleaning up after test
-			err = fs.Remove(backupPath)
-			require.NoError(t, err)
-		}
-	})
+			if backupAmount <= 0 {
+				return
+			}
 
-	if t.Failed() {
-		return
-	}
+			t.Run("list backups", func(t *testing.T) {
+				versions, err := p.ListBackups(ctx)
+				require.NoError(t, err)
 
-	if backupAmount <= 0 {
-		return
-	}
+				_, err = versions.Get("foo")
+				require.Error(t, err)
 
-	t.Run("list backups", func(t *testing.T) {
-		versions, err := p.ListBackups(ctx)
-		require.NoError(t, err)
+				allVersions := versions.List()
+				require.Len(t, allVersions, backupAmount)
 
-		_, err = versions.Get("foo")
-		require.Error(t, err)
+				for i, v := range allVersions {
+					v := v
 
-		allVersions := versions.List()
-		require.Len(t, allVersions, backupAmount)
+					fmt.Println(v)
 
-		for i, v := range allVersions {
-			v := v
+					assert.True(t, strings.HasSuffix(v.Name, ".tar.gz"))
+					if disableVersioning {
+						assert.True(t, strings.HasPrefix(v.Name, prefix+"/db-"))
+					}
+					assert.NotZero(t, v.Date)
 
-			fmt.Println(v)
+					getVersion, err := versions.Get(v.Version)
+					require.NoError(t, err)
+					assert.Equal(t, v, getVersion)
 
-			assert.True(t, strings.HasSuffix(v.Name, ".tar.gz"))
-			assert.NotZero(t, v.Date)
+					if i == 0 {
+						continue
+					}
+					assert.True(t, v.Date.Before(allVersions[i-1].Date))
+				}
 
-			getVersion, err := versions.Get(v.Version)
-			require.NoError(t, err)
-			assert.Equal(t, v, getVersion)
+				latestVersion := versions.Latest()
+				assert.Equal(t, allVersions[0], latestVersion)
+			})
 
-			if i == 0 {
-				continue
+			if t.Failed() {
+				return
 			}
-			assert.True(t, v.Date.Before(allVersions[i-1].Date))
-		}
 
-		latestVersion := versions.Latest()
-		assert.Equal(t, allVersions[0], latestVersion)
-	})
+			t.Run("verify download", func(t *testing.T) {
+				versions, err := p.ListBackups(ctx)
+				require.NoError(t, err)
 
-	if t.Failed() {
-		return
-	}
+				latestVersion := versions.Latest()
+				require.NotNil(t, latestVersion)
 
-	t.Run("verify download", func(t *testing.T) {
-		versions, err := p.ListBackups(ctx)
-		require.NoError(t, err)
+				outputFile, err := fs.Create("outputfile")
+				require.NoError(t, err)
+				err = p.DownloadBackup(ctx, latestVersion, outputFile)
+				require.NoError(t, err)
 
-		latestVersion := versions.Latest()
-		require.NotNil(t, latestVersion)
+				gotContent, err := afero.ReadFile(fs, outputFile.Name())
+				require.NoError(t, err)
 
-		outputFile, err := fs.Create("outputfile")
-		require.NoError(t, err)
-		err = p.DownloadBackup(ctx, latestVersion, outputFile)
-		require.NoError(t, err)
+				backupContent := fmt.Sprintf("precious data %d", backupAmount-1)
+				require.Equal(t, backupContent, string(gotContent))
 
-		gotContent, err := afero.ReadFile(fs, outputFile.Name())
-		require.NoError(t, err)
+				// cleaning up after test
+				err = fs.Remove(outputFile.Name())
+				require.NoError(t, err)
+			})
 
-		backupContent := fmt.Sprintf("precious data %d", backupAmount-1)
-		require.Equal(t, backupContent, string(gotContent))
+			if t.Failed() {
+				return
+			}
 
-		// cleaning up after test
-		err = fs.Remove(outputFile.Name())
-		require.NoError(t, err)
-	})
+			t.Run("verify cleanup", func(t *testing.T) {
+				err := p.CleanupBackups(ctx)
+				require.NoError(t, err)
 
-	if t.Failed() {
-		return
-	}
+				if !disableVersioning {
+					// cleanup is done by lifecycle rules
+					return
+				}
 
-	t.Run("verify cleanup", func(t *testing.T) {
-		err := p.CleanupBackups(ctx)
-		require.NoError(t, err)
-	})
+				versions, err := p.ListBackups(ctx)
+				require.NoError(t, err)
+				require.Len(t, versions.List(), objectsToKeep)
+			})
 
-	if t.Failed() {
-		return
-	}
+			if t.Failed() {
+				return
+			}
 
-	err = afero.Walk(fs, "/", func(path string, info iofs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
+			err = afero.Walk(fs, "/", func(path string, info iofs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
 
-		return fmt.Errorf("provider messed around in the file system at: %s", path)
-	})
-	require.NoError(t, err)
+				return fmt.Errorf("provider messed around in the file system at: %s", path)
+			})
+			require.NoError(t, err)
+		})
+	}
 }
 
 type connectionDetails struct {
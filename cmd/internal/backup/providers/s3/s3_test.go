@@ -0,0 +1,1160 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+)
+
+func Test_BackupProviderS3ParallelDownload(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		log      = slog.Default()
+		partSize = int64(256 * 1024)
+		latency  = 50 * time.Millisecond
+		content  = make([]byte, 16*partSize+1234)
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(rangedObjectHandler(t, content, latency))
+	defer server.Close()
+
+	download := func(concurrency int) ([]byte, time.Duration) {
+		p, err := New(log, &BackupProviderConfigS3{
+			BucketName:          "test",
+			Endpoint:            server.URL,
+			Region:              "dummy",
+			AccessKey:           "ACCESSKEY",
+			SecretKey:           "SECRETKEY",
+			FS:                  afero.NewMemMapFs(),
+			DownloadConcurrency: concurrency,
+			DownloadPartSize:    partSize,
+		})
+		require.NoError(t, err)
+
+		// a buffer does not implement io.WriterAt, so the parts need to be ordered by the provider
+		var buf bytes.Buffer
+
+		start := time.Now()
+		err = p.DownloadBackup(ctx, &providers.BackupVersion{Name: "db.tar.gz", Version: "1"}, &buf)
+		require.NoError(t, err)
+
+		return buf.Bytes(), time.Since(start)
+	}
+
+	sequential, sequentialDuration := download(1)
+	require.Equal(t, content, sequential)
+
+	parallel, parallelDuration := download(8)
+	require.Equal(t, content, parallel)
+
+	speedup := float64(sequentialDuration) / float64(parallelDuration)
+	t.Logf("sequential download took %s, parallel download took %s, speed-up %.1fx", sequentialDuration, parallelDuration, speedup)
+
+	assert.Greater(t, speedup, 2.0)
+}
+
+func Test_BackupProviderS3ParallelDownloadFailedPart(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		partSize = int64(64 * 1024)
+		content  = make([]byte, 32*partSize)
+	)
+
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	objects := rangedObjectHandler(t, content, 0)
+
+	// the second part fails for good, the parts after it must not wait for it forever
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), fmt.Sprintf("bytes=%d-", partSize)) {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		objects(w, r)
+	}))
+	defer server.Close()
+
+	p, err := New(slog.Default(), &BackupProviderConfigS3{
+		BucketName:          "test",
+		Endpoint:            server.URL,
+		Region:              "dummy",
+		AccessKey:           "ACCESSKEY",
+		SecretKey:           "SECRETKEY",
+		FS:                  afero.NewMemMapFs(),
+		DownloadConcurrency: 4,
+		DownloadPartSize:    partSize,
+	})
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- p.DownloadBackup(ctx, &providers.BackupVersion{Name: "db.tar.gz", Version: "1"}, &bytes.Buffer{})
+	}()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not return after a part failed")
+	}
+}
+
+// rangedObjectHandler serves the content for ranged get object requests, every request is delayed by the given latency
+func rangedObjectHandler(t *testing.T, content []byte, latency time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/test/db.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+
+		time.Sleep(latency)
+
+		start, end := int64(0), int64(len(content)-1)
+
+		if rng := r.Header.Get("Range"); rng != "" {
+			from, to, found := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+			if !found {
+				t.Errorf("unexpected range header: %s", rng)
+				http.Error(w, "invalid range", http.StatusBadRequest)
+				return
+			}
+
+			start, _ = strconv.ParseInt(from, 10, 64)
+			end, _ = strconv.ParseInt(to, 10, 64)
+			end = min(end, int64(len(content)-1))
+
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+		}
+
+		_, _ = w.Write(content[start : end+1])
+	}
+}
+
+func Test_BackupProviderS3Credentials(t *testing.T) {
+	ctx := context.Background()
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENVACCESSKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ENVSECRETKEY")
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(credentialsFile, []byte(`[default]
+aws_access_key_id = FILEACCESSKEY
+aws_secret_access_key = FILESECRETKEY
+
+[backup]
+aws_access_key_id = PROFILEACCESSKEY
+aws_secret_access_key = PROFILESECRETKEY
+`), 0600)
+	require.NoError(t, err)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err = os.WriteFile(tokenFile, []byte("web-identity-token"), 0600)
+	require.NoError(t, err)
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		assert.Equal(t, "web-identity-token", r.Form.Get("WebIdentityToken"))
+
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>STSACCESSKEY</AccessKeyId>
+      <SecretAccessKey>STSSECRETKEY</SecretAccessKey>
+      <SessionToken>STSSESSIONTOKEN</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`)
+	}))
+	defer sts.Close()
+
+	t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+
+	tests := []struct {
+		name          string
+		config        *BackupProviderConfigS3
+		wantAccessKey string
+	}{
+		{
+			name:          "static is the default",
+			config:        &BackupProviderConfigS3{AccessKey: "ACCESSKEY", SecretKey: "SECRETKEY"},
+			wantAccessKey: "ACCESSKEY",
+		},
+		{
+			name:          "default chain",
+			config:        &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain},
+			wantAccessKey: "ENVACCESSKEY",
+		},
+		{
+			name:          "file",
+			config:        &BackupProviderConfigS3{CredentialsMode: CredentialsModeFile, CredentialsFile: credentialsFile},
+			wantAccessKey: "FILEACCESSKEY",
+		},
+		{
+			name:          "file with profile",
+			config:        &BackupProviderConfigS3{CredentialsMode: CredentialsModeFile, CredentialsFile: credentialsFile, Profile: "backup"},
+			wantAccessKey: "PROFILEACCESSKEY",
+		},
+		{
+			name:          "web identity",
+			config:        &BackupProviderConfigS3{CredentialsMode: CredentialsModeWebIdentity, RoleARN: "arn:aws:iam::123456789012:role/backup", WebIdentityTokenFile: tokenFile},
+			wantAccessKey: "STSACCESSKEY",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.BucketName = "test"
+			tt.config.Endpoint = "http://localhost:9000"
+			tt.config.Region = "dummy"
+			tt.config.FS = afero.NewMemMapFs()
+
+			p, err := New(slog.Default(), tt.config)
+			require.NoError(t, err)
+
+			creds, err := p.c.Options().Credentials.Retrieve(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAccessKey, creds.AccessKeyID)
+		})
+	}
+}
+
+func Test_BackupProviderS3CredentialsFileRotation(t *testing.T) {
+	ctx := context.Background()
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	writeCredentials := func(accessKey string) {
+		err := os.WriteFile(credentialsFile, fmt.Appendf(nil, "[default]\naws_access_key_id = %s\naws_secret_access_key = SECRETKEY\n", accessKey), 0600)
+		require.NoError(t, err)
+	}
+
+	writeCredentials("OLDACCESSKEY")
+
+	cache := aws.NewCredentialsCache(&fileCredentialsProvider{file: credentialsFile, profile: "default", refresh: 10 * time.Millisecond})
+
+	creds, err := cache.Retrieve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "OLDACCESSKEY", creds.AccessKeyID)
+
+	// a rotated secret is picked up as soon as the cached credentials expired
+	writeCredentials("NEWACCESSKEY")
+
+	assert.Eventually(t, func() bool {
+		creds, err := cache.Retrieve(ctx)
+		return err == nil && creds.AccessKeyID == "NEWACCESSKEY"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_BackupProviderConfigS3Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *BackupProviderConfigS3
+		wantErr string
+	}{
+		{
+			name:    "static without keys",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeStatic},
+			wantErr: "s3 accesskey must not be empty",
+		},
+		{
+			name:    "web identity without role",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeWebIdentity, WebIdentityTokenFile: "/var/run/token"},
+			wantErr: "s3 role arn must not be empty",
+		},
+		{
+			name:    "web identity without token file",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeWebIdentity, RoleARN: "arn:aws:iam::123456789012:role/backup"},
+			wantErr: "s3 web identity token file must not be empty",
+		},
+		{
+			name:   "web identity",
+			config: &BackupProviderConfigS3{CredentialsMode: CredentialsModeWebIdentity, RoleARN: "arn:aws:iam::123456789012:role/backup", WebIdentityTokenFile: "/var/run/token"},
+		},
+		{
+			name:    "file without credentials file",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeFile},
+			wantErr: "s3 credentials file must not be empty",
+		},
+		{
+			name:   "default chain",
+			config: &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain},
+		},
+		{
+			name:    "sse-c without key file",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain, SSEMode: SSEModeC},
+			wantErr: "s3 sse customer key file must not be empty",
+		},
+		{
+			name:    "kms key without sse-kms",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain, SSEMode: SSEModeS3, SSEKMSKeyID: "key"},
+			wantErr: `s3 sse kms key id requires sse mode "sse-kms"`,
+		},
+		{
+			name:    "unknown sse mode",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain, SSEMode: "foo"},
+			wantErr: `s3 sse mode must be one of "sse-s3", "sse-kms" or "sse-c"`,
+		},
+		{
+			name:    "object lock without retention",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain, ObjectLockMode: ObjectLockModeGovernance},
+			wantErr: "s3 object lock retention days must be greater than zero",
+		},
+		{
+			name:    "object lock without versioning",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain, ObjectLockMode: ObjectLockModeGovernance, ObjectLockRetentionDays: 7, DisableVersioning: new(true)},
+			wantErr: "s3 object lock requires versioning",
+		},
+		{
+			name:    "unknown object lock mode",
+			config:  &BackupProviderConfigS3{CredentialsMode: CredentialsModeDefaultChain, ObjectLockMode: "foo", ObjectLockRetentionDays: 7},
+			wantErr: `s3 object lock mode must be "governance" or "compliance"`,
+		},
+		{
+			name:    "unknown mode",
+			config:  &BackupProviderConfigS3{CredentialsMode: "foo"},
+			wantErr: `s3 credentials mode must be one of "static", "default-chain", "web-identity" or "file"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.BucketName = "test"
+			tt.config.Endpoint = "http://localhost:9000"
+
+			err := tt.config.validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_BackupProviderS3ServerSideEncryption(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		log     = slog.Default()
+		content = []byte("precious data")
+		key     = bytes.Repeat([]byte("k"), 32)
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	tests := []struct {
+		name         string
+		config       *BackupProviderConfigS3
+		wantUpload   map[string]string
+		wantDownload map[string]string
+	}{
+		{
+			name:   "sse-s3",
+			config: &BackupProviderConfigS3{SSEMode: SSEModeS3},
+			wantUpload: map[string]string{
+				"X-Amz-Server-Side-Encryption": "AES256",
+			},
+			wantDownload: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Key": "",
+			},
+		},
+		{
+			name:   "sse-kms",
+			config: &BackupProviderConfigS3{SSEMode: SSEModeKMS, SSEKMSKeyID: "backup-key"},
+			wantUpload: map[string]string{
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "backup-key",
+			},
+			wantDownload: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Key": "",
+			},
+		},
+		{
+			name:   "sse-c",
+			config: &BackupProviderConfigS3{SSEMode: SSEModeC, SSECustomerKeyFile: "/sse-c.key"},
+			wantUpload: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       "a2tra2tra2tra2tra2tra2tra2tra2tra2tra2tra2s=",
+				"X-Amz-Server-Side-Encryption-Customer-Key-Md5":   "mT2HRsMGJ5IX5C+0rreZ8Q==",
+			},
+			wantDownload: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       "a2tra2tra2tra2tra2tra2tra2tra2tra2tra2tra2s=",
+				"X-Amz-Server-Side-Encryption-Customer-Key-Md5":   "mT2HRsMGJ5IX5C+0rreZ8Q==",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var uploadHeaders, downloadHeaders http.Header
+
+			get := rangedObjectHandler(t, content, 0)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					uploadHeaders = r.Header.Clone()
+					w.Header().Set("ETag", `"etag"`)
+				case http.MethodGet:
+					downloadHeaders = r.Header.Clone()
+					get(w, r)
+				}
+			}))
+			defer server.Close()
+
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "/sse-c.key", key, 0600))
+
+			tt.config.BucketName = "test"
+			tt.config.Endpoint = server.URL
+			tt.config.Region = "dummy"
+			tt.config.AccessKey = "ACCESSKEY"
+			tt.config.SecretKey = "SECRETKEY"
+			tt.config.Suffix = ".tar.gz"
+			tt.config.FS = fs
+
+			p, err := New(log, tt.config)
+			require.NoError(t, err)
+
+			err = p.UploadBackup(ctx, bytes.NewReader(content), nil)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = p.DownloadBackup(ctx, &providers.BackupVersion{Name: "db.tar.gz", Version: "1"}, &buf)
+			require.NoError(t, err)
+			assert.Equal(t, content, buf.Bytes())
+
+			for header, want := range tt.wantUpload {
+				assert.Equal(t, want, uploadHeaders.Get(header), header)
+			}
+			for header, want := range tt.wantDownload {
+				assert.Equal(t, want, downloadHeaders.Get(header), header)
+			}
+		})
+	}
+}
+
+func Test_BackupProviderS3ObjectLock(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	tests := []struct {
+		name          string
+		bucketExists  bool
+		lockEnabled   bool
+		wantCreate    bool
+		wantEnsureErr string
+	}{
+		{
+			name:       "bucket is created with object lock",
+			wantCreate: true,
+		},
+		{
+			name:         "existing bucket with object lock",
+			bucketExists: true,
+			lockEnabled:  true,
+		},
+		{
+			name:          "existing bucket without object lock",
+			bucketExists:  true,
+			wantEnsureErr: "object lock is not enabled for existing bucket test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				created         bool
+				uploadHeaders   http.Header
+				manifestHeaders http.Header
+				objectHeaders   = map[string]http.Header{}
+				deleted         []string
+				mu              sync.Mutex
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/":
+					buckets := ""
+					if tt.bucketExists {
+						buckets = "<Bucket><Name>test</Name></Bucket>"
+					}
+					_, _ = fmt.Fprintf(w, "<ListAllMyBucketsResult><Buckets>%s</Buckets></ListAllMyBucketsResult>", buckets)
+				case r.Method == http.MethodPut && r.URL.Path == "/test" && len(query) == 0:
+					created = true
+					assert.Equal(t, "true", r.Header.Get("X-Amz-Bucket-Object-Lock-Enabled"))
+				case r.Method == http.MethodGet && query.Has("object-lock"):
+					status := "Disabled"
+					if tt.lockEnabled {
+						status = "Enabled"
+					}
+					_, _ = fmt.Fprintf(w, "<ObjectLockConfiguration><ObjectLockEnabled>%s</ObjectLockEnabled></ObjectLockConfiguration>", status)
+				case r.Method == http.MethodGet && query.Has("lifecycle"):
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = fmt.Fprint(w, "<Error><Code>NoSuchLifecycleConfiguration</Code></Error>")
+				case r.Method == http.MethodPut && r.URL.Path == "/test/db.tar.gz":
+					uploadHeaders = r.Header.Clone()
+					w.Header().Set("ETag", `"etag"`)
+					w.Header().Set("X-Amz-Version-Id", "1")
+				case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, common.ManifestSuffix):
+					manifestHeaders = r.Header.Clone()
+					w.Header().Set("ETag", `"etag"`)
+				case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/test/objects/"):
+					mu.Lock()
+					objectHeaders[strings.TrimPrefix(r.URL.Path, "/test/objects/")] = r.Header.Clone()
+					mu.Unlock()
+					w.Header().Set("ETag", `"etag"`)
+				case r.Method == http.MethodGet && query.Has("versions"):
+					// a version within the retention period and one whose retention period ended
+					key := query.Get("prefix")
+					_, _ = fmt.Fprintf(w, "<ListVersionsResult><Version><Key>%s</Key><VersionId>new</VersionId><LastModified>%s</LastModified></Version><Version><Key>%s</Key><VersionId>old</VersionId><LastModified>%s</LastModified></Version></ListVersionsResult>",
+						key, time.Now().UTC().Format(time.RFC3339), key, time.Now().Add(-30*24*time.Hour).UTC().Format(time.RFC3339))
+				case r.Method == http.MethodDelete:
+					mu.Lock()
+					deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/test/objects/")+"@"+query.Get("versionId"))
+					mu.Unlock()
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer server.Close()
+
+			p, err := New(log, &BackupProviderConfigS3{
+				BucketName:              "test",
+				Endpoint:                server.URL,
+				Region:                  "dummy",
+				AccessKey:               "ACCESSKEY",
+				SecretKey:               "SECRETKEY",
+				Suffix:                  ".tar.gz",
+				FS:                      afero.NewMemMapFs(),
+				ObjectLockMode:          ObjectLockModeCompliance,
+				ObjectLockRetentionDays: 7,
+			})
+			require.NoError(t, err)
+
+			err = p.EnsureBackupBucket(ctx)
+			if tt.wantEnsureErr != "" {
+				require.EqualError(t, err, tt.wantEnsureErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCreate, created)
+
+			err = p.UploadBackup(ctx, strings.NewReader("precious data"), &providers.Manifest{DatabaseType: "postgres"})
+			require.NoError(t, err)
+
+			for _, headers := range []http.Header{uploadHeaders, manifestHeaders} {
+				require.NotNil(t, headers)
+				assert.Equal(t, "COMPLIANCE", headers.Get("X-Amz-Object-Lock-Mode"))
+
+				retainUntil, err := time.Parse(time.RFC3339, headers.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+				require.NoError(t, err)
+				assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), retainUntil, time.Minute)
+			}
+
+			// completed objects are locked, partial objects are replaced until they are complete and therefore not locked
+			for name, want := range map[string]string{
+				"wal/000000010000000000000001":         "COMPLIANCE",
+				"wal/000000010000000000000002.partial": "",
+			} {
+				err = p.PutObject(ctx, name, strings.NewReader("wal"))
+				require.NoError(t, err)
+
+				require.Contains(t, objectHeaders, name)
+				assert.Equal(t, want, objectHeaders[name].Get("X-Amz-Object-Lock-Mode"), name)
+			}
+
+			err = p.DeleteObject(ctx, "wal/000000010000000000000001")
+			require.ErrorIs(t, err, providers.ErrObjectLocked)
+
+			err = p.DeleteObject(ctx, "wal/000000010000000000000002.partial")
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{
+				"wal/000000010000000000000001@old",
+				"wal/000000010000000000000002.partial@new",
+				"wal/000000010000000000000002.partial@old",
+			}, deleted)
+		})
+	}
+}
+
+func Test_BackupProviderS3ListBackupsPaginated(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		log   = slog.Default()
+		pages = 3
+		now   = time.Now().UTC().Truncate(time.Second)
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodGet || !query.Has("versions") {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		page := 0
+		if marker := query.Get("version-id-marker"); marker != "" {
+			var err error
+			page, err = strconv.Atoi(strings.TrimPrefix(marker, "page-"))
+			require.NoError(t, err)
+		}
+
+		var versions string
+		for i := range 2 {
+			id := page*2 + i
+			versions += fmt.Sprintf("<Version><Key>db.tar.gz</Key><VersionId>%d</VersionId><LastModified>%s</LastModified></Version>", id, now.Add(-time.Duration(id)*time.Hour).Format(time.RFC3339))
+		}
+
+		truncated := ""
+		if page < pages-1 {
+			truncated = fmt.Sprintf("<IsTruncated>true</IsTruncated><NextKeyMarker>db.tar.gz</NextKeyMarker><NextVersionIdMarker>page-%d</NextVersionIdMarker>", page+1)
+		}
+
+		_, _ = fmt.Fprintf(w, "<ListVersionsResult>%s%s</ListVersionsResult>", truncated, versions)
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName: "test",
+		Endpoint:   server.URL,
+		Region:     "dummy",
+		AccessKey:  "ACCESSKEY",
+		SecretKey:  "SECRETKEY",
+		Suffix:     ".tar.gz",
+		FS:         afero.NewMemMapFs(),
+	})
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+
+	all := versions.List()
+	require.Len(t, all, 2*pages)
+
+	for i, v := range all {
+		assert.Equal(t, strconv.Itoa(i), v.Version)
+	}
+
+	oldest, err := versions.Get(strconv.Itoa(2*pages - 1))
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Duration(2*pages-1)*time.Hour), oldest.Date)
+}
+
+func Test_BackupProviderS3ListBackupsPage(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		log      = slog.Default()
+		now      = time.Now().UTC().Truncate(time.Second)
+		backups  = 7
+		requests int
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	type objectVersion struct {
+		key, id string
+		date    time.Time
+	}
+
+	// the bucket lists the versions by key and the versions of a key from newest to oldest
+	var bucket []objectVersion
+	for _, key := range []string{"db.tar.gz", "db.tar.gz" + common.ManifestSuffix} {
+		for i := range backups {
+			bucket = append(bucket, objectVersion{key: key, id: fmt.Sprintf("%s-%d", key, i), date: now.Add(-time.Duration(i) * time.Hour)})
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodGet || !query.Has("versions") {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		requests++
+
+		start := 0
+		if marker := query.Get("version-id-marker"); marker != "" {
+			start = slices.IndexFunc(bucket, func(v objectVersion) bool {
+				return v.key == query.Get("key-marker") && v.id == marker
+			}) + 1
+			require.Positive(t, start)
+		}
+
+		end := min(start+3, len(bucket))
+
+		var versions string
+		for _, v := range bucket[start:end] {
+			versions += fmt.Sprintf("<Version><Key>%s</Key><VersionId>%s</VersionId><LastModified>%s</LastModified></Version>", v.key, v.id, v.date.Format(time.RFC3339))
+		}
+
+		truncated := ""
+		if end < len(bucket) {
+			truncated = fmt.Sprintf("<IsTruncated>true</IsTruncated><NextKeyMarker>%s</NextKeyMarker><NextVersionIdMarker>%s</NextVersionIdMarker>", bucket[end-1].key, bucket[end-1].id)
+		}
+
+		_, _ = fmt.Fprintf(w, "<ListVersionsResult>%s%s</ListVersionsResult>", truncated, versions)
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName: "test",
+		Endpoint:   server.URL,
+		Region:     "dummy",
+		AccessKey:  "ACCESSKEY",
+		SecretKey:  "SECRETKEY",
+		Suffix:     ".tar.gz",
+		FS:         afero.NewMemMapFs(),
+	})
+	require.NoError(t, err)
+
+	// the versions of a key are listed from newest to oldest, so they are listed completely to return the oldest first
+	versions, token, err := p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, "db.tar.gz-6", versions[0].Version)
+	assert.Equal(t, "db.tar.gz-5", versions[1].Version)
+	assert.NotEmpty(t, token)
+
+	var got []string
+	for token != "" {
+		versions, token, err = p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 2, PageToken: token, To: now.Add(-time.Hour)})
+		require.NoError(t, err)
+
+		for _, v := range versions {
+			got = append(got, v.Version)
+		}
+	}
+	assert.Equal(t, []string{"db.tar.gz-4", "db.tar.gz-3", "db.tar.gz-2"}, got)
+
+	_, _, err = p.ListBackupsPage(ctx, &providers.ListOptions{PageToken: "invalid"})
+	require.ErrorIs(t, err, providers.ErrInvalidPageToken)
+}
+
+func Test_BackupProviderS3ListBackupsPageTimestamped(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		log      = slog.Default()
+		now      = time.Now().UTC().Truncate(time.Second)
+		backups  = 5
+		requests int
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	// the bucket lists the keys in lexical order, which is the order of the timestamps in the names of the backups
+	var keys []string
+	for i := range backups {
+		name := common.TimestampedName("db", now.Add(-time.Duration(backups-i)*time.Hour)) + ".tar.gz"
+		keys = append(keys, name, common.ManifestName(name, ""))
+	}
+	keys = append(keys, common.PinnedName(keys[2], "db", now.Add(-time.Duration(backups-1)*time.Hour)))
+	slices.Sort(keys)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodGet || query.Get("list-type") != "2" {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		requests++
+
+		var matching []string
+		for _, key := range keys {
+			if strings.HasPrefix(key, query.Get("prefix")) {
+				matching = append(matching, key)
+			}
+		}
+
+		start := 0
+		if token := query.Get("continuation-token"); token != "" {
+			var err error
+			start, err = strconv.Atoi(token)
+			require.NoError(t, err)
+		}
+
+		maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+		require.NoError(t, err)
+
+		end := min(start+maxKeys, len(matching))
+
+		var contents string
+		for _, key := range matching[start:end] {
+			contents += fmt.Sprintf("<Contents><Key>%s</Key><LastModified>%s</LastModified></Contents>", key, now.Format(time.RFC3339))
+		}
+
+		truncated := ""
+		if end < len(matching) {
+			truncated = fmt.Sprintf("<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+		}
+
+		_, _ = fmt.Fprintf(w, "<ListBucketResult>%s%s</ListBucketResult>", truncated, contents)
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName:        "test",
+		Endpoint:          server.URL,
+		Region:            "dummy",
+		AccessKey:         "ACCESSKEY",
+		SecretKey:         "SECRETKEY",
+		Suffix:            ".tar.gz",
+		FS:                afero.NewMemMapFs(),
+		DisableVersioning: new(true),
+	})
+	require.NoError(t, err)
+
+	versions, token, err := p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, now.Add(-time.Duration(backups)*time.Hour), versions[0].Date)
+	assert.Equal(t, now.Add(-time.Duration(backups-1)*time.Hour), versions[1].Date)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, 2, requests, "a page must not list the whole bucket")
+
+	var got []time.Time
+	for token != "" {
+		versions, token, err = p.ListBackupsPage(ctx, &providers.ListOptions{PageSize: 2, PageToken: token})
+		require.NoError(t, err)
+
+		for _, v := range versions {
+			got = append(got, v.Date)
+		}
+	}
+
+	// the pinned copy follows after the backups
+	assert.Equal(t, []time.Time{
+		now.Add(-3 * time.Hour),
+		now.Add(-2 * time.Hour),
+		now.Add(-1 * time.Hour),
+		now.Add(-4 * time.Hour),
+	}, got)
+}
+
+func Test_BackupProviderS3Manifest(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		log      = slog.Default()
+		now      = time.Now().UTC().Truncate(time.Second)
+		manifest = &providers.Manifest{DatabaseType: "postgres", SHA256: "abc"}
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	var (
+		objects = map[string][]byte{}
+		deleted []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		key := strings.TrimPrefix(r.URL.Path, "/test/")
+
+		switch {
+		case r.Method == http.MethodPut && key == "backups/db.tar.gz":
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("X-Amz-Version-Id", "v2")
+		case r.Method == http.MethodPut:
+			content, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			objects[key] = content
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodGet && query.Has("versions"):
+			var versions string
+			for _, v := range []struct{ key, id string }{
+				{"backups/db.tar.gz", "v2"},
+				{"backups/db.tar.gz.v2.manifest.json", "m2"},
+				// the manifest of a backup expired by the lifecycle rules
+				{"backups/db.tar.gz.v1.manifest.json", "m1"},
+			} {
+				versions += fmt.Sprintf("<Version><Key>%s</Key><VersionId>%s</VersionId><LastModified>%s</LastModified></Version>", v.key, v.id, now.Format(time.RFC3339))
+			}
+			_, _ = fmt.Fprintf(w, "<ListVersionsResult>%s</ListVersionsResult>", versions)
+		case r.Method == http.MethodGet:
+			content, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+				return
+			}
+			_, _ = w.Write(content)
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, key+"?versionId="+query.Get("versionId"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName:   "test",
+		Endpoint:     server.URL,
+		Region:       "dummy",
+		AccessKey:    "ACCESSKEY",
+		SecretKey:    "SECRETKEY",
+		ObjectPrefix: "backups",
+		Suffix:       ".tar.gz",
+		FS:           afero.NewMemMapFs(),
+	})
+	require.NoError(t, err)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), manifest)
+	require.NoError(t, err)
+	require.Contains(t, objects, "backups/db.tar.gz.v2.manifest.json")
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 1, "manifests must not be listed as backups")
+
+	got, err := p.DownloadManifest(ctx, versions.Latest())
+	require.NoError(t, err)
+	assert.Equal(t, manifest, got)
+
+	_, err = p.DownloadManifest(ctx, &providers.BackupVersion{Name: "backups/db.tar.gz", Version: "v0"})
+	require.ErrorIs(t, err, providers.ErrManifestNotFound)
+
+	err = p.CleanupBackups(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backups/db.tar.gz.v1.manifest.json?versionId=m1"}, deleted)
+
+	deleted = nil
+
+	err = p.DeleteBackup(ctx, versions.Latest())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backups/db.tar.gz?versionId=v2", "backups/db.tar.gz.v2.manifest.json?versionId=m2"}, deleted)
+}
+
+func Test_BackupProviderS3Retention(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		now = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	var (
+		lifecycle        string
+		lifecycleDeleted bool
+		deleted          []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		key := strings.TrimPrefix(r.URL.Path, "/test/")
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/":
+			_, _ = fmt.Fprint(w, "<ListAllMyBucketsResult><Buckets><Bucket><Name>test</Name></Bucket></Buckets></ListAllMyBucketsResult>")
+		case r.Method == http.MethodPut && query.Has("versioning"):
+		case r.Method == http.MethodGet && query.Has("lifecycle"):
+			_, _ = fmt.Fprint(w, "<LifecycleConfiguration>"+
+				"<Rule><ID>backups-backup-restore-lifecycle</ID><Status>Enabled</Status><Filter><Prefix>backups/</Prefix></Filter><NoncurrentVersionExpiration><NewerNoncurrentVersions>20</NewerNoncurrentVersions></NoncurrentVersionExpiration></Rule>"+
+				"<Rule><ID>other</ID><Status>Enabled</Status><Filter><Prefix>other/</Prefix></Filter><Expiration><Days>1</Days></Expiration></Rule>"+
+				"</LifecycleConfiguration>")
+		case r.Method == http.MethodPut && query.Has("lifecycle"):
+			content, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			lifecycle = string(content)
+		case r.Method == http.MethodDelete && query.Has("lifecycle"):
+			lifecycleDeleted = true
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && query.Has("versions"):
+			var versions string
+			for i, date := range []time.Time{now, now.Add(-time.Minute), now.Add(-24 * time.Hour), now.Add(-48 * time.Hour)} {
+				versions += fmt.Sprintf("<Version><Key>backups/db.tar.gz</Key><VersionId>v%d</VersionId><LastModified>%s</LastModified></Version>", i, date.Format(time.RFC3339))
+			}
+			_, _ = fmt.Fprintf(w, "<ListVersionsResult>%s</ListVersionsResult>", versions)
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, key+"?versionId="+query.Get("versionId"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName:   "test",
+		Endpoint:     server.URL,
+		Region:       "dummy",
+		AccessKey:    "ACCESSKEY",
+		SecretKey:    "SECRETKEY",
+		ObjectPrefix: "backups",
+		Suffix:       ".tar.gz",
+		FS:           afero.NewMemMapFs(),
+		Retention:    common.Retention{Daily: 2},
+	})
+	require.NoError(t, err)
+
+	err = p.EnsureBackupBucket(ctx)
+	require.NoError(t, err)
+	assert.False(t, lifecycleDeleted)
+	assert.Contains(t, lifecycle, "<ID>other</ID>")
+	assert.NotContains(t, lifecycle, "backups-backup-restore-lifecycle", "the lifecycle rule of the sidecar must be removed")
+
+	err = p.CleanupBackups(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"backups/db.tar.gz?versionId=v1", "backups/db.tar.gz?versionId=v3"}, deleted)
+}
+
+func Test_BackupProviderS3Pin(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		log  = slog.Default()
+		date = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	var (
+		manifests = map[string]bool{"test/backups/db.tar.gz.v2.manifest.json": true}
+		copied    []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/test/")
+		source := r.Header.Get("X-Amz-Copy-Source")
+
+		switch {
+		case r.Method == http.MethodPut && source != "":
+			if strings.HasSuffix(source, ".manifest.json") && !manifests[source] {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+				return
+			}
+			copied = append(copied, source+" -> "+key)
+			w.Header().Set("X-Amz-Version-Id", "p1")
+			_, _ = fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName:   "test",
+		Endpoint:     server.URL,
+		Region:       "dummy",
+		AccessKey:    "ACCESSKEY",
+		SecretKey:    "SECRETKEY",
+		ObjectPrefix: "backups",
+		Suffix:       ".tar.gz",
+		FS:           afero.NewMemMapFs(),
+	})
+	require.NoError(t, err)
+
+	pinned, err := p.PinBackup(ctx, &providers.BackupVersion{Name: "backups/db.tar.gz", Version: "v2", Date: date})
+	require.NoError(t, err)
+	assert.Equal(t, &providers.BackupVersion{Name: "backups/pinned/db-20240102T030405.000000000Z.tar.gz", Version: "p1", Date: date}, pinned)
+	assert.Equal(t, []string{
+		"test/backups/db.tar.gz?versionId=v2 -> backups/pinned/db-20240102T030405.000000000Z.tar.gz",
+		"test/backups/db.tar.gz.v2.manifest.json -> backups/pinned/db-20240102T030405.000000000Z.tar.gz.p1.manifest.json",
+	}, copied)
+
+	copied = nil
+
+	// backups of former versions have no manifest
+	_, err = p.PinBackup(ctx, &providers.BackupVersion{Name: "backups/db.tar.gz", Version: "v1", Date: date.Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test/backups/db.tar.gz?versionId=v1 -> backups/pinned/db-20240102T020405.000000000Z.tar.gz"}, copied)
+
+	_, err = p.PinBackup(ctx, pinned)
+	require.ErrorContains(t, err, "is already pinned")
+}
+
+func Test_BackupProviderS3ListBackupsSkipsObjects(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		now = time.Now().UTC().Truncate(time.Second)
+	)
+
+	// a custom ca bundle from the environment cannot be applied to the http client of the provider
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !r.URL.Query().Has("versions") {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		var versions string
+		for i, key := range []string{"postgres/db.tar.gz", "postgres/objects/wal/000000010000000000000001"} {
+			versions += fmt.Sprintf("<Version><Key>%s</Key><VersionId>%d</VersionId><LastModified>%s</LastModified></Version>", key, i, now.Format(time.RFC3339))
+		}
+
+		_, _ = fmt.Fprintf(w, "<ListVersionsResult>%s</ListVersionsResult>", versions)
+	}))
+	defer server.Close()
+
+	p, err := New(log, &BackupProviderConfigS3{
+		BucketName:   "test",
+		Endpoint:     server.URL,
+		Region:       "dummy",
+		AccessKey:    "ACCESSKEY",
+		SecretKey:    "SECRETKEY",
+		ObjectPrefix: "postgres",
+		Suffix:       ".tar.gz",
+		FS:           afero.NewMemMapFs(),
+	})
+	require.NoError(t, err)
+
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+
+	all := versions.List()
+	require.Len(t, all, 1)
+	assert.Equal(t, "postgres/db.tar.gz", all[0].Name)
+}
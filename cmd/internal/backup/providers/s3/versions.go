@@ -22,11 +22,9 @@ func (b backupVersionsS3) List() []*providers.BackupVersion {
 	var result []*providers.BackupVersion
 
 	for _, attr := range b.objectAttrs {
-		result = append(result, &providers.BackupVersion{
-			Name:    *attr.Key,
-			Version: *attr.VersionId,
-			Date:    *attr.LastModified,
-		})
+		if v, ok := backupVersion(attr); ok {
+			result = append(result, v)
+		}
 	}
 
 	common.Sort(result)
@@ -38,3 +36,74 @@ func (b backupVersionsS3) List() []*providers.BackupVersion {
 func (b backupVersionsS3) Get(version string) (*providers.BackupVersion, error) {
 	return common.Get(b.List(), version)
 }
+
+// backupVersion returns the backup stored in the given object version, false is returned for manifests
+func backupVersion(attr types.ObjectVersion) (*providers.BackupVersion, bool) {
+	if attr.Key == nil || common.IsManifest(*attr.Key) {
+		return nil, false
+	}
+
+	date := *attr.LastModified
+	// the modification time of a pinned copy is the time it was pinned, the date of the backup is kept in its name
+	if pinnedDate, _, ok := common.ParseTimestampedName(*attr.Key, defaultBackupName); ok && common.IsPinned(*attr.Key) {
+		date = pinnedDate
+	}
+
+	return &providers.BackupVersion{
+		Name:    *attr.Key,
+		Version: *attr.VersionId,
+		Date:    date,
+	}, true
+}
+
+// backupVersionsS3Timestamped contains the list of available backups stored with timestamped object keys
+type backupVersionsS3Timestamped struct {
+	objects    []types.Object
+	backupName string
+}
+
+// Latest returns latest backup version
+func (b backupVersionsS3Timestamped) Latest() *providers.BackupVersion {
+	return common.Latest(b.List())
+}
+
+// List return a list of all backup versions
+func (b backupVersionsS3Timestamped) List() []*providers.BackupVersion {
+	var result []*providers.BackupVersion
+
+	for _, object := range b.objects {
+		if v, ok := timestampedBackupVersion(object, b.backupName); ok {
+			result = append(result, v)
+		}
+	}
+
+	common.Sort(result)
+
+	return result
+}
+
+// Get returns the backup entry of the given version
+func (b backupVersionsS3Timestamped) Get(version string) (*providers.BackupVersion, error) {
+	return common.Get(b.List(), version)
+}
+
+// timestampedBackupVersion returns the backup stored in the given object, false is returned for objects which are no backups
+func timestampedBackupVersion(object types.Object, backupName string) (*providers.BackupVersion, bool) {
+	if object.Key == nil {
+		return nil, false
+	}
+
+	date, version, ok := common.ParseTimestampedName(*object.Key, backupName)
+	if !ok {
+		return nil, false
+	}
+	if common.IsPinned(*object.Key) {
+		version = common.PinnedVersion(version)
+	}
+
+	return &providers.BackupVersion{
+		Name:    *object.Key,
+		Version: version,
+		Date:    date,
+	}, true
+}
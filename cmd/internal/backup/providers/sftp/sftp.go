@@ -0,0 +1,590 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	defaultBackupName = "db"
+	defaultPort       = "22"
+	dialTimeout       = 30 * time.Second
+)
+
+// BackupProviderSFTP implements the backup provider interface for a remote host reachable over SFTP
+type BackupProviderSFTP struct {
+	log          *slog.Logger
+	config       *BackupProviderConfigSFTP
+	clientConfig *ssh.ClientConfig
+	suffix       string
+}
+
+// BackupProviderConfigSFTP provides configuration for the BackupProviderSFTP
+type BackupProviderConfigSFTP struct {
+	// Host is the address of the remote host, the port defaults to 22
+	Host string
+	User string
+	// Password is used for password authentication, can be combined with a private key
+	Password string
+	// PrivateKey is a PEM encoded private key used for public key authentication
+	PrivateKey           string
+	PrivateKeyPassphrase string
+	// HostKey is the pinned public key of the remote host in authorized_keys format
+	HostKey               string
+	InsecureIgnoreHostKey *bool
+	// BasePath is the directory on the remote host in which the backups are stored
+	BasePath         string
+	BackupName       string
+	ObjectPrefix     string
+	ObjectsToKeep    int64
+	ObjectDaysToKeep *int64
+	Suffix           string
+	// Retention is a tiered retention policy, if configured it replaces ObjectsToKeep and ObjectDaysToKeep
+	Retention common.Retention
+}
+
+func (c *BackupProviderConfigSFTP) validate() error {
+	if c.Host == "" {
+		return errors.New("sftp host must not be empty")
+	}
+	if c.User == "" {
+		return errors.New("sftp user must not be empty")
+	}
+	if c.Password == "" && c.PrivateKey == "" {
+		return errors.New("sftp password or private key must be set")
+	}
+	if c.InsecureIgnoreHostKey != nil && *c.InsecureIgnoreHostKey {
+		if c.HostKey != "" {
+			return errors.New("sftp ignore host key and pinned host key cannot be set at the same time")
+		}
+	} else if c.HostKey == "" {
+		return errors.New("sftp host key must not be empty")
+	}
+	if c.ObjectDaysToKeep != nil && *c.ObjectDaysToKeep < 0 {
+		return errors.New("sftp object days to keep must not be negative")
+	}
+	return c.Retention.Validate()
+}
+
+// New returns a SFTP backup provider
+func New(log *slog.Logger, cfg *BackupProviderConfigSFTP) (*BackupProviderSFTP, error) {
+	if cfg == nil {
+		return nil, errors.New("sftp backup provider requires a provider config")
+	}
+
+	if cfg.ObjectsToKeep == 0 {
+		cfg.ObjectsToKeep = constants.DefaultObjectsToKeep
+	}
+	if cfg.BackupName == "" {
+		cfg.BackupName = defaultBackupName
+	}
+	if cfg.BasePath == "" {
+		cfg.BasePath = "."
+	}
+	if _, _, err := net.SplitHostPort(cfg.Host); err != nil {
+		cfg.Host = net.JoinHostPort(cfg.Host, defaultPort)
+	}
+
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var auth []ssh.AuthMethod
+
+	if cfg.PrivateKey != "" {
+		var signer ssh.Signer
+		if cfg.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(cfg.PrivateKey), []byte(cfg.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse sftp private key: %w", err)
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey() // nolint:gosec
+	if cfg.HostKey != "" {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse sftp host key: %w", err)
+		}
+
+		hostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+
+	return &BackupProviderSFTP{
+		log:    log,
+		config: cfg,
+		clientConfig: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         dialTimeout,
+		},
+		suffix: cfg.Suffix,
+	}, nil
+}
+
+// connect opens a new sftp session, connections are not kept open between backups as they may break in the meantime
+func (b *BackupProviderSFTP) connect(ctx context.Context) (*sftp.Client, func(), error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", b.config.Host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to sftp host: %w", err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, b.config.Host, b.clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("unable to establish ssh connection: %w", err)
+	}
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, nil, fmt.Errorf("unable to start sftp session: %w", err)
+	}
+
+	// abort pending operations when the context gets cancelled
+	stop := context.AfterFunc(ctx, func() {
+		_ = client.Close()
+		_ = sshClient.Close()
+	})
+
+	return client, func() {
+		stop()
+		_ = client.Close()
+		_ = sshClient.Close()
+	}, nil
+}
+
+func (b *BackupProviderSFTP) backupDir() string {
+	return path.Join(b.config.BasePath, b.config.ObjectPrefix)
+}
+
+// EnsureBackupBucket ensures a backup bucket at the backup provider
+func (b *BackupProviderSFTP) EnsureBackupBucket(ctx context.Context) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := client.MkdirAll(b.backupDir()); err != nil {
+		return fmt.Errorf("could not create remote backup directory: %w", err)
+	}
+
+	return nil
+}
+
+// CleanupBackups cleans up backups according to the given backup cleanup policy at the backup provider
+func (b *BackupProviderSFTP) CleanupBackups(ctx context.Context) error {
+	versions, err := b.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var maxAge time.Duration
+	if b.config.ObjectDaysToKeep != nil {
+		maxAge = time.Duration(*b.config.ObjectDaysToKeep) * 24 * time.Hour
+	}
+
+	expired := common.Expired(versions.List(), b.config.ObjectsToKeep, maxAge, time.Now())
+	if b.config.Retention.Enabled() {
+		expired = b.config.Retention.Expired(versions.List())
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	var errs []error
+	for _, v := range expired {
+		b.log.Info("deleting expired backup", "file", v.Name, "date", v.Date.String())
+
+		for _, name := range []string{v.Name, common.ManifestName(v.Name, "")} {
+			err := client.Remove(path.Join(b.backupDir(), name))
+			if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("unable to delete %s: %w", name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteBackup deletes the given backup version together with its manifest
+func (b *BackupProviderSFTP) DeleteBackup(ctx context.Context, version *providers.BackupVersion) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	b.log.Info("deleting backup", "file", version.Name, "date", version.Date.String())
+
+	err = client.Remove(path.Join(b.backupDir(), version.Name))
+	if err != nil {
+		return fmt.Errorf("unable to delete %s: %w", version.Name, err)
+	}
+
+	manifest := common.ManifestName(version.Name, "")
+	err = client.Remove(path.Join(b.backupDir(), manifest))
+	if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return fmt.Errorf("unable to delete %s: %w", manifest, err)
+	}
+
+	return nil
+}
+
+// PinBackup copies the given backup version together with its manifest to the pinned directory
+func (b *BackupProviderSFTP) PinBackup(ctx context.Context, version *providers.BackupVersion) (*providers.BackupVersion, error) {
+	if common.IsPinned(version.Name) {
+		return nil, fmt.Errorf("backup %s is already pinned", version.Version)
+	}
+
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	name := common.PinnedName(version.Name, b.config.BackupName, version.Date)
+
+	b.log.Info("pinning backup", "file", version.Name, "pinned", name)
+
+	err = client.MkdirAll(path.Join(b.backupDir(), common.PinnedDir))
+	if err != nil {
+		return nil, fmt.Errorf("could not create pinned backup directory: %w", err)
+	}
+
+	err = b.copyFile(client, version.Name, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.copyFile(client, common.ManifestName(version.Name, ""), common.ManifestName(name, ""))
+	if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return nil, err
+	}
+
+	date, pinnedVersion, _ := common.ParseTimestampedName(name, b.config.BackupName)
+
+	return &providers.BackupVersion{
+		Name:    name,
+		Version: common.PinnedVersion(pinnedVersion),
+		Date:    date,
+	}, nil
+}
+
+// copyFile copies the file with the given name in the backup directory on the remote host
+func (b *BackupProviderSFTP) copyFile(client *sftp.Client, source, destination string) error {
+	infile, err := client.Open(path.Join(b.backupDir(), source))
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", source, err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	return b.writeFile(client, destination, infile)
+}
+
+// DownloadBackup downloads the given backup version to the specified folder
+func (b *BackupProviderSFTP) DownloadBackup(ctx context.Context, version *providers.BackupVersion, writer io.Writer) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	source := path.Join(b.backupDir(), version.Name)
+
+	b.log.Info("downloading", "file", source, "version", version.Version)
+
+	infile, err := client.Open(source)
+	if err != nil {
+		return fmt.Errorf("backup not found: %w", err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	_, err = io.Copy(writer, infile)
+	if err != nil {
+		return fmt.Errorf("error writing file from sftp to filesystem: %w", err)
+	}
+
+	return nil
+}
+
+// DownloadManifest returns the manifest stored alongside the given backup version
+func (b *BackupProviderSFTP) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	source := path.Join(b.backupDir(), common.ManifestName(version.Name, ""))
+
+	infile, err := client.Open(source)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, providers.ErrManifestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", source, err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	return common.DecodeManifest(infile)
+}
+
+// UploadBackup uploads a backup to the backup provider
+func (b *BackupProviderSFTP) UploadBackup(ctx context.Context, reader io.Reader, manifest *providers.Manifest) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	name := common.TimestampedName(b.config.BackupName, common.UploadDate(manifest)) + b.suffix
+
+	b.log.Debug("uploading object", "dest", path.Join(b.backupDir(), name))
+
+	err = b.writeFile(client, name, reader)
+	if err != nil {
+		return err
+	}
+
+	if manifest == nil {
+		return nil
+	}
+
+	encoded, err := common.EncodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	return b.writeFile(client, common.ManifestName(name, ""), encoded)
+}
+
+// writeFile writes the content of the reader to the file with the given name in the backup directory
+func (b *BackupProviderSFTP) writeFile(client *sftp.Client, name string, reader io.Reader) error {
+	var (
+		destination = path.Join(b.backupDir(), name)
+		// the file is written to a hidden file first such that incomplete uploads never show up as a backup
+		tmp = path.Join(path.Dir(destination), "."+path.Base(destination)+".part")
+	)
+
+	output, err := client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %w", tmp, err)
+	}
+
+	_, err = io.Copy(output, reader)
+	if err != nil {
+		_ = output.Close()
+		_ = client.Remove(tmp)
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		_ = client.Remove(tmp)
+		return err
+	}
+
+	if err := replace(client, tmp, destination); err != nil {
+		_ = client.Remove(tmp)
+		return fmt.Errorf("could not move uploaded file to %s: %w", destination, err)
+	}
+
+	return nil
+}
+
+// replace renames the file and replaces an existing destination, which the rename of sftp v3 refuses to do.
+// servers without the posix rename extension get the destination removed first, so the file is missing in between.
+func replace(client *sftp.Client, source, destination string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(source, destination)
+	}
+
+	if err := client.Remove(destination); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return err
+	}
+
+	return client.Rename(source, destination)
+}
+
+// IsRetryable returns true for connection errors, every operation opens a new connection such that it can succeed when it is retried
+func (b *BackupProviderSFTP) IsRetryable(err error) bool {
+	// the server closing the connection surfaces as eof
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) || common.IsNetworkError(err)
+}
+
+// GetNextBackupName returns a name for the next backup archive that is going to be uploaded
+func (b *BackupProviderSFTP) GetNextBackupName(_ context.Context) string {
+	// the file name gets a timestamp on upload, the local archive name can therefore be constant
+	return b.config.BackupName
+}
+
+// ListBackups lists the available backups of the backup provider
+func (b *BackupProviderSFTP) ListBackups(ctx context.Context) (providers.BackupVersions, error) {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	files, err := client.ReadDir(b.backupDir())
+	if err != nil {
+		return nil, err
+	}
+
+	pinned, err := client.ReadDir(path.Join(b.backupDir(), common.PinnedDir))
+	if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return nil, err
+	}
+
+	return backupVersionsSFTP{
+		files:      files,
+		pinned:     pinned,
+		backupName: b.config.BackupName,
+	}, nil
+}
+
+// ListBackupsPage lists a page of the backups in the order of common.CompareListed.
+// sftp cannot read a directory page by page, so the backup directory is read completely to sort the backups by date.
+func (b *BackupProviderSFTP) ListBackupsPage(ctx context.Context, opts *providers.ListOptions) ([]*providers.BackupVersion, string, error) {
+	versions, err := b.ListBackups(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return common.Page(versions.List(), opts)
+}
+
+// PutObject stores an object in the objects directory next to the backups
+func (b *BackupProviderSFTP) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	name = path.Join(common.ObjectsDir, name)
+
+	err = client.MkdirAll(path.Dir(path.Join(b.backupDir(), name)))
+	if err != nil {
+		return fmt.Errorf("could not create remote object directory: %w", err)
+	}
+
+	return b.writeFile(client, name, reader)
+}
+
+// GetObject writes the object with the given name to writer
+func (b *BackupProviderSFTP) GetObject(ctx context.Context, name string, writer io.Writer) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	source := path.Join(b.backupDir(), common.ObjectsDir, name)
+
+	infile, err := client.Open(source)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", source, err)
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	_, err = io.Copy(writer, infile)
+	return err
+}
+
+// ListObjects returns the objects whose names start with the given prefix
+func (b *BackupProviderSFTP) ListObjects(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	root := common.ObjectsRoot(b.backupDir())
+
+	var objects []*providers.Object
+	for walker := client.Walk(root); walker.Step(); {
+		if err := walker.Err(); err != nil {
+			// the objects directory is only created with the first object
+			if errors.Is(err, iofs.ErrNotExist) && walker.Path() == root {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		info := walker.Stat()
+		// hidden files are incomplete uploads
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		name := strings.TrimPrefix(walker.Path(), root)
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, &providers.Object{Name: name, Date: info.ModTime()})
+		}
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object with the given name
+func (b *BackupProviderSFTP) DeleteObject(ctx context.Context, name string) error {
+	client, closeFn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	err = client.Remove(path.Join(b.backupDir(), common.ObjectsDir, name))
+	if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return fmt.Errorf("unable to delete object %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,465 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/compress"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	testUser     = "backup"
+	testPassword = "secret"
+)
+
+func Test_BackupProviderSFTP(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	server := startSFTPServer(t)
+
+	for _, auth := range []string{"password", "key"} {
+		for _, backupAmount := range []int{0, 1, 5} {
+			t.Run(fmt.Sprintf("testing %s auth with %d backups", auth, backupAmount), func(t *testing.T) {
+				var (
+					fs            = afero.NewMemMapFs()
+					objectsToKeep = 3
+					prefix        = fmt.Sprintf("test-%s-with-%d", auth, backupAmount)
+				)
+
+				compressor, err := compress.New("targz")
+				require.NoError(t, err)
+
+				config := &BackupProviderConfigSFTP{
+					Host:          server.addr,
+					User:          testUser,
+					HostKey:       server.hostKey,
+					BasePath:      "/backups",
+					ObjectPrefix:  prefix,
+					ObjectsToKeep: int64(objectsToKeep),
+					Suffix:        compressor.Extension(),
+				}
+
+				switch auth {
+				case "password":
+					config.Password = testPassword
+				case "key":
+					config.PrivateKey = server.clientKey
+				}
+
+				p, err := New(log, config)
+				require.NoError(t, err)
+				require.NotNil(t, p)
+
+				t.Run("ensure backup bucket", func(t *testing.T) {
+					err := p.EnsureBackupBucket(ctx)
+					require.NoError(t, err)
+				})
+
+				if t.Failed() {
+					return
+				}
+
+				t.Run("verify upload", func(t *testing.T) {
+					for i := range backupAmount {
+						backupName := p.GetNextBackupName(ctx) + compressor.Extension()
+						backupPath := path.Join(constants.UploadDir, backupName)
+						backupContent := fmt.Sprintf("precious data %d", i+1)
+
+						err = afero.WriteFile(fs, backupPath, []byte(backupContent), 0600)
+						require.NoError(t, err)
+
+						infile, err := fs.Open(backupPath)
+						require.NoError(t, err)
+
+						err = p.UploadBackup(ctx, infile, &providers.Manifest{DatabaseType: "postgres", SHA256: fmt.Sprintf("checksum %d", i+1)})
+						require.NoError(t, err)
+
+						// cleaning up after test
+						err = fs.Remove(backupPath)
+						require.NoError(t, err)
+					}
+				})
+
+				if t.Failed() {
+					return
+				}
+
+				t.Run("list backups", func(t *testing.T) {
+					versions, err := p.ListBackups(ctx)
+					require.NoError(t, err)
+
+					_, err = versions.Get("foo")
+					require.Error(t, err)
+
+					allVersions := versions.List()
+					require.Len(t, allVersions, backupAmount)
+
+					for i, v := range allVersions {
+						assert.True(t, strings.HasPrefix(v.Name, "db-"))
+						assert.True(t, strings.HasSuffix(v.Name, ".tar.gz"))
+						assert.NotZero(t, v.Date)
+
+						getVersion, err := versions.Get(v.Version)
+						require.NoError(t, err)
+						assert.Equal(t, v, getVersion)
+
+						if i == 0 {
+							continue
+						}
+						assert.True(t, v.Date.Before(allVersions[i-1].Date))
+					}
+
+					if backupAmount == 0 {
+						assert.Nil(t, versions.Latest())
+					} else {
+						assert.Equal(t, allVersions[0], versions.Latest())
+					}
+				})
+
+				if t.Failed() {
+					return
+				}
+
+				if backupAmount <= 0 {
+					return
+				}
+
+				t.Run("verify download", func(t *testing.T) {
+					versions, err := p.ListBackups(ctx)
+					require.NoError(t, err)
+
+					latestVersion := versions.Latest()
+					require.NotNil(t, latestVersion)
+
+					outputFile, err := fs.Create("output.tar.gz")
+					require.NoError(t, err)
+
+					err = p.DownloadBackup(ctx, latestVersion, outputFile)
+					require.NoError(t, err)
+
+					gotContent, err := afero.ReadFile(fs, outputFile.Name())
+					require.NoError(t, err)
+
+					require.Equal(t, fmt.Sprintf("precious data %d", backupAmount), string(gotContent))
+
+					manifest, err := p.DownloadManifest(ctx, latestVersion)
+					require.NoError(t, err)
+					assert.Equal(t, &providers.Manifest{DatabaseType: "postgres", SHA256: fmt.Sprintf("checksum %d", backupAmount)}, manifest)
+
+					// cleaning up after test
+					err = fs.Remove(outputFile.Name())
+					require.NoError(t, err)
+				})
+
+				if t.Failed() {
+					return
+				}
+
+				t.Run("verify cleanup", func(t *testing.T) {
+					versions, err := p.ListBackups(ctx)
+					require.NoError(t, err)
+					before := versions.List()
+
+					err = p.CleanupBackups(ctx)
+					require.NoError(t, err)
+
+					versions, err = p.ListBackups(ctx)
+					require.NoError(t, err)
+
+					after := versions.List()
+					require.Len(t, after, min(backupAmount, objectsToKeep))
+					assert.Equal(t, before[:len(after)], after)
+
+					for _, v := range before[len(after):] {
+						_, err := p.DownloadManifest(ctx, v)
+						require.ErrorIs(t, err, providers.ErrManifestNotFound)
+					}
+				})
+
+				t.Run("verify delete", func(t *testing.T) {
+					versions, err := p.ListBackups(ctx)
+					require.NoError(t, err)
+
+					latest := versions.Latest()
+					if latest == nil {
+						return
+					}
+
+					err = p.DeleteBackup(ctx, latest)
+					require.NoError(t, err)
+
+					_, err = p.DownloadManifest(ctx, latest)
+					require.ErrorIs(t, err, providers.ErrManifestNotFound)
+
+					after, err := p.ListBackups(ctx)
+					require.NoError(t, err)
+					assert.ElementsMatch(t, versions.List()[1:], after.List())
+				})
+			})
+		}
+	}
+
+	t.Run("host key mismatch", func(t *testing.T) {
+		otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		otherPub, err := ssh.NewPublicKey(otherKey)
+		require.NoError(t, err)
+
+		p, err := New(log, &BackupProviderConfigSFTP{
+			Host:     server.addr,
+			User:     testUser,
+			Password: testPassword,
+			HostKey:  string(ssh.MarshalAuthorizedKey(otherPub)),
+		})
+		require.NoError(t, err)
+
+		err = p.EnsureBackupBucket(ctx)
+		require.ErrorContains(t, err, "host key mismatch")
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		p, err := New(log, &BackupProviderConfigSFTP{
+			Host:     server.addr,
+			User:     testUser,
+			Password: "wrong",
+			HostKey:  server.hostKey,
+		})
+		require.NoError(t, err)
+
+		err = p.EnsureBackupBucket(ctx)
+		require.ErrorContains(t, err, "unable to authenticate")
+	})
+}
+
+func Test_BackupProviderConfigSFTPValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *BackupProviderConfigSFTP
+		wantErr string
+	}{
+		{
+			name:    "missing host",
+			config:  &BackupProviderConfigSFTP{User: testUser, Password: testPassword, HostKey: "key"},
+			wantErr: "sftp host must not be empty",
+		},
+		{
+			name:    "missing credentials",
+			config:  &BackupProviderConfigSFTP{Host: "localhost", User: testUser, HostKey: "key"},
+			wantErr: "sftp password or private key must be set",
+		},
+		{
+			name:    "missing host key",
+			config:  &BackupProviderConfigSFTP{Host: "localhost", User: testUser, Password: testPassword},
+			wantErr: "sftp host key must not be empty",
+		},
+		{
+			name:    "ignore and pin host key",
+			config:  &BackupProviderConfigSFTP{Host: "localhost", User: testUser, Password: testPassword, HostKey: "key", InsecureIgnoreHostKey: new(true)},
+			wantErr: "sftp ignore host key and pinned host key cannot be set at the same time",
+		},
+		{
+			name:   "ignore host key",
+			config: &BackupProviderConfigSFTP{Host: "localhost", User: testUser, Password: testPassword, InsecureIgnoreHostKey: new(true)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_BackupProviderSFTPObjects(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		log    = slog.Default()
+		server = startSFTPServer(t)
+	)
+
+	p, err := New(log, &BackupProviderConfigSFTP{
+		Host:         server.addr,
+		User:         testUser,
+		Password:     testPassword,
+		HostKey:      server.hostKey,
+		BasePath:     "/backups",
+		ObjectPrefix: "objects-test",
+		Suffix:       ".tar.gz",
+	})
+	require.NoError(t, err)
+
+	err = p.EnsureBackupBucket(ctx)
+	require.NoError(t, err)
+
+	objects, err := p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+
+	err = p.UploadBackup(ctx, strings.NewReader("precious data"), nil)
+	require.NoError(t, err)
+
+	for _, name := range []string{"wal/000000010000000000000001", "wal/000000010000000000000002", "other"} {
+		err = p.PutObject(ctx, name, strings.NewReader("content of "+name))
+		require.NoError(t, err)
+	}
+
+	objects, err = p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "wal/000000010000000000000001", objects[0].Name)
+	assert.Equal(t, "wal/000000010000000000000002", objects[1].Name)
+
+	var buf strings.Builder
+	err = p.GetObject(ctx, "wal/000000010000000000000001", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "content of wal/000000010000000000000001", buf.String())
+
+	// an existing object is replaced, e.g. a partial segment which is archived again
+	err = p.PutObject(ctx, "wal/000000010000000000000001", strings.NewReader("replaced content"))
+	require.NoError(t, err)
+
+	buf.Reset()
+	err = p.GetObject(ctx, "wal/000000010000000000000001", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced content", buf.String())
+
+	// objects are not listed as backups
+	versions, err := p.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 1)
+
+	err = p.DeleteObject(ctx, "wal/000000010000000000000001")
+	require.NoError(t, err)
+
+	err = p.DeleteObject(ctx, "wal/000000010000000000000001")
+	require.NoError(t, err)
+
+	objects, err = p.ListObjects(ctx, "wal/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "wal/000000010000000000000002", objects[0].Name)
+}
+
+type testServer struct {
+	addr      string
+	hostKey   string
+	clientKey string
+}
+
+// startSFTPServer starts an in-process ssh server serving sftp from memory
+func startSFTPServer(t *testing.T) *testServer {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authorizedKey, err := ssh.NewPublicKey(clientPub)
+	require.NoError(t, err)
+	clientPEM, err := ssh.MarshalPrivateKey(clientPriv, "")
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testUser && string(password) == testPassword {
+				return nil, nil
+			}
+			return nil, errors.New("password rejected")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == testUser && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("public key rejected")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = lis.Close()
+	})
+
+	handlers := sftp.InMemHandler()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSFTP(conn, config, handlers)
+		}
+	}()
+
+	return &testServer{
+		addr:      lis.Addr().String(),
+		hostKey:   string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey())),
+		clientKey: string(pem.EncodeToMemory(clientPEM)),
+	}
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig, handlers sftp.Handlers) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+			}
+		}()
+
+		server := sftp.NewRequestServer(channel, handlers)
+		_ = server.Serve()
+		_ = server.Close()
+	}
+}
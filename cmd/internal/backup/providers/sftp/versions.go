@@ -0,0 +1,66 @@
+package sftp
+
+import (
+	"os"
+	"path"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+)
+
+type backupVersionsSFTP struct {
+	files []os.FileInfo
+	// pinned contains the files of the pinned directory
+	pinned     []os.FileInfo
+	backupName string
+}
+
+func (b backupVersionsSFTP) Latest() *providers.BackupVersion {
+	return common.Latest(b.List())
+}
+
+func (b backupVersionsSFTP) List() []*providers.BackupVersion {
+	var result []*providers.BackupVersion
+
+	for _, file := range b.files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		date, version, ok := common.ParseTimestampedName(file.Name(), b.backupName)
+		if !ok {
+			continue
+		}
+
+		result = append(result, &providers.BackupVersion{
+			Name:    file.Name(),
+			Version: version,
+			Date:    date,
+		})
+	}
+
+	for _, file := range b.pinned {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		date, version, ok := common.ParseTimestampedName(file.Name(), b.backupName)
+		if !ok {
+			continue
+		}
+
+		result = append(result, &providers.BackupVersion{
+			Name:    path.Join(common.PinnedDir, file.Name()),
+			Version: common.PinnedVersion(version),
+			Date:    date,
+		})
+	}
+
+	common.Sort(result)
+
+	return result
+}
+
+func (b backupVersionsSFTP) Get(version string) (*providers.BackupVersion, error) {
+	return common.Get(b.List(), version)
+}
@@ -1,23 +1,38 @@
 package compress
 
 import (
+	"archive/tar"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
-	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 	"github.com/mholt/archiver/v3"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
 )
 
 type (
 	// Compressor compress/decompress backup data before/after sending/receiving from storage
 	Compressor struct {
+		method    string
 		extension string
+		limiter   *throttle.Limiter
+	}
+
+	archive interface {
+		archiver.Writer
+		archiver.Reader
 	}
 )
 
 // New Returns a new Compressor
 func New(method string) (*Compressor, error) {
-	c := &Compressor{}
+	c := &Compressor{method: method}
 	switch method {
 	case "tar":
 		c.extension = ".tar"
@@ -31,18 +46,178 @@ func New(method string) (*Compressor, error) {
 	return c, nil
 }
 
-// Compress the given backupFile and returns the full filename with the extension
-func (c *Compressor) Compress(backupFilePath string) (string, error) {
-	filename := backupFilePath + c.extension
-	return filename, archiver.Archive([]string{constants.BackupDir}, filename)
+// SetLimiter limits the throughput at which files are read while compressing and written while decompressing, nil does not limit it
+func (c *Compressor) SetLimiter(limiter *throttle.Limiter) {
+	c.limiter = limiter
+}
+
+func (c *Compressor) archive() archive {
+	switch c.extension {
+	case ".tar.gz":
+		return archiver.NewTarGz()
+	case ".tar.lz4":
+		return archiver.NewTarLz4()
+	default:
+		return archiver.NewTar()
+	}
+}
+
+// Compress writes the compressed archive of the given directory to the writer.
+// the archive entries are stored below the base name of the directory, e.g. files/
+func (c *Compressor) Compress(w io.Writer, dir string) error {
+	a := c.archive()
+
+	err := a.Create(w)
+	if err != nil {
+		return err
+	}
+
+	topLevelFolder := filepath.Base(dir)
+
+	err = filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("traversing %s: %w", fpath, err)
+		}
+
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+
+		var file io.ReadCloser
+		if info.Mode().IsRegular() {
+			f, err := os.Open(fpath)
+			if err != nil {
+				return fmt.Errorf("%s: opening: %w", fpath, err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			// compression is not bound to a context, a canceled backup is stopped by the closed pipe of the upload
+			file = struct {
+				io.Reader
+				io.Closer
+			}{c.limiter.Reader(context.Background(), f), f}
+		}
+
+		err = a.Write(archiver.File{
+			FileInfo: archiver.FileInfo{
+				FileInfo:   info,
+				CustomName: path.Join(topLevelFolder, filepath.ToSlash(rel)),
+				SourcePath: fpath,
+			},
+			ReadCloser: file,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: writing: %w", fpath, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = a.Close()
+		return err
+	}
+
+	return a.Close()
+}
+
+// Decompress extracts the compressed archive read from the reader into the given directory
+func (c *Compressor) Decompress(r io.Reader, dir string) error {
+	a := c.archive()
+
+	err := a.Open(r, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = a.Close()
+	}()
+
+	for {
+		f, err := a.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+
+		err = c.extract(f, dir)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Compressor) extract(f archiver.File, dir string) error {
+	hdr, ok := f.Header.(*tar.Header)
+	if !ok {
+		return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+	}
+
+	to, err := within(dir, hdr.Name)
+	if err != nil {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(to, f.Mode().Perm())
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, f.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(c.limiter.Writer(context.Background(), out), f)
+		if err != nil {
+			_ = out.Close()
+			return fmt.Errorf("%s: writing: %w", hdr.Name, err)
+		}
+
+		return out.Close()
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, to)
+	case tar.TypeLink:
+		target, err := within(dir, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		return os.Link(target, to)
+	case tar.TypeXGlobalHeader:
+		return nil
+	default:
+		return fmt.Errorf("%s: unsupported type flag: %c", hdr.Name, hdr.Typeflag)
+	}
 }
 
-// Decompress the given backupFile
-func (c *Compressor) Decompress(backupFilePath string) error {
-	return archiver.Unarchive(backupFilePath, filepath.Dir(constants.RestoreDir))
+// within returns the path of the archive entry inside of dir and prevents path traversal
+func within(dir, name string) (string, error) {
+	to := filepath.Join(dir, name)
+	if to != filepath.Clean(dir) && !strings.HasPrefix(to, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return to, nil
 }
 
 // Extension returns the file extension of the configured compressor, depending on the method
 func (c *Compressor) Extension() string {
 	return c.extension
 }
+
+// Method returns the compression method of the compressor
+func (c *Compressor) Method() string {
+	return c.method
+}
@@ -0,0 +1,108 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/archiver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressor(t *testing.T) {
+	for _, method := range []string{"tar", "targz", "tarlz4"} {
+		t.Run(method, func(t *testing.T) {
+			var (
+				source = filepath.Join(t.TempDir(), "files")
+				target = t.TempDir()
+			)
+
+			require.NoError(t, os.MkdirAll(filepath.Join(source, "sub", "dir"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(source, "db.dump"), []byte("precious data"), 0600))
+			require.NoError(t, os.WriteFile(filepath.Join(source, "sub", "dir", "config"), []byte("more data"), 0640))
+			require.NoError(t, os.Symlink("db.dump", filepath.Join(source, "link")))
+
+			c, err := New(method)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = c.Compress(&buf, source)
+			require.NoError(t, err)
+
+			err = c.Decompress(&buf, target)
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(filepath.Join(target, "files", "db.dump"))
+			require.NoError(t, err)
+			assert.Equal(t, "precious data", string(content))
+
+			content, err = os.ReadFile(filepath.Join(target, "files", "sub", "dir", "config"))
+			require.NoError(t, err)
+			assert.Equal(t, "more data", string(content))
+
+			info, err := os.Stat(filepath.Join(target, "files", "sub", "dir", "config"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+			link, err := os.Readlink(filepath.Join(target, "files", "link"))
+			require.NoError(t, err)
+			assert.Equal(t, "db.dump", link)
+		})
+	}
+}
+
+func TestDecompressArchiverArchive(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		source  = filepath.Join(dir, "files")
+		archive = filepath.Join(dir, "db.tar.gz")
+		target  = t.TempDir()
+	)
+
+	require.NoError(t, os.MkdirAll(source, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "db.dump"), []byte("precious data"), 0600))
+
+	// backups of former versions were created by archiver
+	require.NoError(t, archiver.Archive([]string{source}, archive))
+
+	c, err := New("targz")
+	require.NoError(t, err)
+
+	f, err := os.Open(archive)
+	require.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	err = c.Decompress(f, target)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(target, "files", "db.dump"))
+	require.NoError(t, err)
+	assert.Equal(t, "precious data", string(content))
+}
+
+func TestDecompressPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	content := []byte("evil")
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	c, err := New("tar")
+	require.NoError(t, err)
+
+	target := filepath.Join(t.TempDir(), "restore")
+
+	err = c.Decompress(&buf, target)
+	require.EqualError(t, err, "illegal path in archive: ../evil")
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(target), "evil"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
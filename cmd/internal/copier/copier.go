@@ -0,0 +1,352 @@
+package copier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+)
+
+const (
+	defaultBackupName = "db"
+)
+
+// Copier copies backups from one backup provider to another
+type Copier struct {
+	log          *slog.Logger
+	config       *CopierConfig
+	destinations map[string]providers.BackupProvider
+}
+
+type CopierConfig struct {
+	// Source is the backup provider the backups are read from
+	Source providers.BackupProvider
+	// Destination returns the backup provider the backups are written to.
+	// the suffix of the copied backup is passed such that e.g. unencrypted backups are not stored under the name of encrypted ones.
+	Destination func(suffix string) (providers.BackupProvider, error)
+	// BackupName is the name the backups are stored with, defaults to db
+	BackupName string
+}
+
+func (c *CopierConfig) validate() error {
+	if c.Source == nil {
+		return errors.New("source backup provider must be configured")
+	}
+	if c.Destination == nil {
+		return errors.New("destination backup provider must be configured")
+	}
+
+	return nil
+}
+
+// New returns a copier for the given backup providers
+func New(log *slog.Logger, config *CopierConfig) (*Copier, error) {
+	if config == nil {
+		return nil, errors.New("copier config must not be nil")
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.BackupName == "" {
+		config.BackupName = defaultBackupName
+	}
+
+	return &Copier{
+		log:          log,
+		config:       config,
+		destinations: map[string]providers.BackupProvider{},
+	}, nil
+}
+
+// inventory holds the backups which are already stored at a backup provider
+type inventory struct {
+	dates     map[int64]bool
+	checksums map[string]bool
+}
+
+// Copy copies all backups of the source which are not yet present at the destination together with their manifests.
+// the objects of the source, which backups may reference like the base backups of postgres backup chains or the archived
+// write-ahead log, are copied before the backups such that the copied backups can be restored from the destination.
+// the oldest backup is copied first such that the order of the backups is kept by providers which use the upload time as date.
+// a backup which cannot be copied does not stop the copy of the others, all errors are returned once the copy is finished.
+func (c *Copier) Copy(ctx context.Context) error {
+	versions, err := c.config.Source.ListBackups(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list backups of source: %w", err)
+	}
+
+	list := versions.List()
+	if len(list) == 0 {
+		c.log.Info("source has no backups to copy")
+		return nil
+	}
+	slices.Reverse(list)
+
+	dst, err := c.destination(ctx, common.Suffix(list[0].Name, c.config.BackupName))
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.present(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs    []error
+		copied  int
+		skipped int
+	)
+
+	err = c.copyObjects(ctx, dst)
+	if err != nil {
+		c.log.Error("unable to copy objects", "error", err)
+		errs = append(errs, err)
+	}
+
+	for _, version := range list {
+		manifest, err := c.config.Source.DownloadManifest(ctx, version)
+		if errors.Is(err, providers.ErrManifestNotFound) {
+			// the checksum of backups of former versions is added while copying
+			manifest = &providers.Manifest{}
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("unable to download manifest of backup %s: %w", version.Version, err))
+			continue
+		}
+
+		if manifest.Date.IsZero() {
+			manifest.Date = version.Date
+		}
+
+		if existing.dates[manifest.Date.UnixNano()] || (manifest.SHA256 != "" && existing.checksums[manifest.SHA256]) {
+			c.log.Info("backup already present at destination, skipping", "version", version.Version, "date", manifest.Date)
+			skipped++
+			continue
+		}
+
+		err = c.copy(ctx, version, manifest)
+		if err != nil {
+			c.log.Error("unable to copy backup", "version", version.Version, "error", err)
+			errs = append(errs, fmt.Errorf("unable to copy backup %s: %w", version.Version, err))
+			continue
+		}
+
+		existing.dates[manifest.Date.UnixNano()] = true
+		existing.checksums[manifest.SHA256] = true
+		copied++
+	}
+
+	c.log.Info("copied backups", "copied", copied, "skipped", skipped, "failed", len(errs))
+
+	return errors.Join(errs...)
+}
+
+// copy streams the given backup version from the source to the destination
+func (c *Copier) copy(ctx context.Context, version *providers.BackupVersion, manifest *providers.Manifest) error {
+	dst, err := c.destination(ctx, common.Suffix(version.Name, c.config.BackupName))
+	if err != nil {
+		return err
+	}
+
+	c.log.Info("copying backup", "name", version.Name, "version", version.Version, "date", manifest.Date)
+
+	pr, pw := io.Pipe()
+
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := c.config.Source.DownloadBackup(ctx, version, pw)
+		_ = pw.CloseWithError(err)
+		downloadErr <- err
+	}()
+
+	reader := &checksumReader{r: pr, hash: sha256.New(), manifest: manifest, want: manifest.SHA256}
+	uploadErr := dst.UploadBackup(ctx, reader, manifest)
+	// unblocks the download in case the provider stopped reading
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+
+	err = <-downloadErr
+	if err != nil && (uploadErr == nil || !errors.Is(err, io.ErrClosedPipe)) {
+		return fmt.Errorf("unable to download backup: %w", err)
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("unable to upload backup: %w", uploadErr)
+	}
+
+	return nil
+}
+
+// copyObjects copies the objects of the source which are not yet present at the destination,
+// objects which were replaced at the source after they were copied are copied again
+func (c *Copier) copyObjects(ctx context.Context, dst providers.BackupProvider) error {
+	src, ok := c.config.Source.(providers.ObjectStore)
+	if !ok {
+		return nil
+	}
+
+	objects, err := src.ListObjects(ctx, "")
+	if errors.Is(err, providers.ErrObjectStoreNotSupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to list objects of source: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+
+	store, ok := dst.(providers.ObjectStore)
+	if !ok {
+		return fmt.Errorf("unable to copy %d objects referenced by the backups: %w", len(objects), providers.ErrObjectStoreNotSupported)
+	}
+
+	existing, err := store.ListObjects(ctx, "")
+	if err != nil {
+		return fmt.Errorf("unable to list objects of destination: %w", err)
+	}
+
+	present := map[string]time.Time{}
+	for _, o := range existing {
+		present[o.Name] = o.Date
+	}
+
+	var (
+		errs    []error
+		copied  int
+		skipped int
+	)
+	for _, o := range objects {
+		if date, ok := present[o.Name]; ok && !o.Date.After(date) {
+			skipped++
+			continue
+		}
+
+		err := c.copyObject(ctx, src, store, o.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to copy object %s: %w", o.Name, err))
+			continue
+		}
+
+		copied++
+	}
+
+	c.log.Info("copied objects", "copied", copied, "skipped", skipped, "failed", len(errs))
+
+	return errors.Join(errs...)
+}
+
+// copyObject streams the object with the given name from the source to the destination
+func (c *Copier) copyObject(ctx context.Context, src, dst providers.ObjectStore, name string) error {
+	pr, pw := io.Pipe()
+
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := src.GetObject(ctx, name, pw)
+		_ = pw.CloseWithError(err)
+		downloadErr <- err
+	}()
+
+	uploadErr := dst.PutObject(ctx, name, pr)
+	// unblocks the download in case the provider stopped reading
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+
+	err := <-downloadErr
+	if err != nil && (uploadErr == nil || !errors.Is(err, io.ErrClosedPipe)) {
+		return fmt.Errorf("unable to download object: %w", err)
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("unable to upload object: %w", uploadErr)
+	}
+
+	return nil
+}
+
+// destination returns the destination backup provider for backups with the given suffix
+func (c *Copier) destination(ctx context.Context, suffix string) (providers.BackupProvider, error) {
+	if dst, ok := c.destinations[suffix]; ok {
+		return dst, nil
+	}
+
+	dst, err := c.config.Destination(suffix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize destination backup provider: %w", err)
+	}
+
+	err = dst.EnsureBackupBucket(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to ensure backup bucket of destination: %w", err)
+	}
+
+	c.destinations[suffix] = dst
+
+	return dst, nil
+}
+
+// present returns the backups which are already stored at the destination, which are identified by their date or their checksum
+func (c *Copier) present(ctx context.Context, dst providers.BackupProvider) (*inventory, error) {
+	versions, err := dst.ListBackups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list backups of destination: %w", err)
+	}
+
+	result := &inventory{
+		dates:     map[int64]bool{},
+		checksums: map[string]bool{},
+	}
+
+	for _, version := range versions.List() {
+		result.dates[version.Date.UnixNano()] = true
+
+		manifest, err := dst.DownloadManifest(ctx, version)
+		if errors.Is(err, providers.ErrManifestNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to download manifest of backup %s at destination: %w", version.Version, err)
+		}
+
+		if manifest.SHA256 != "" {
+			result.checksums[manifest.SHA256] = true
+		}
+	}
+
+	return result, nil
+}
+
+// checksumReader verifies the copied backup against the checksum of its manifest,
+// the manifest of a backup without checksum is completed with the size and the checksum once the reader is exhausted
+type checksumReader struct {
+	r        io.Reader
+	n        int64
+	hash     hash.Hash
+	manifest *providers.Manifest
+	want     string
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	_, _ = c.hash.Write(p[:n])
+
+	if errors.Is(err, io.EOF) {
+		sum := hex.EncodeToString(c.hash.Sum(nil))
+		if c.want != "" && sum != c.want {
+			// fails the upload instead of storing a corrupt backup at the destination
+			return n, fmt.Errorf("backup is corrupt: sha256 checksum %s of %d downloaded bytes does not match checksum %s of the manifest", sum, c.n, c.want)
+		}
+
+		c.manifest.CompressedSize = c.n
+		c.manifest.SHA256 = sum
+	}
+
+	return n, err
+}
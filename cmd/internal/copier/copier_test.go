@@ -0,0 +1,140 @@
+package copier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Copier(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		log   = slog.Default()
+		srcFS = afero.NewMemMapFs()
+		dstFS = afero.NewMemMapFs()
+		date  = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	checksum := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	newProvider := func(fs afero.Fs, suffix string) providers.BackupProvider {
+		p, err := local.New(log, &local.BackupProviderConfigLocal{
+			LocalBackupPath: "/backups",
+			FS:              fs,
+			Suffix:          suffix,
+		})
+		require.NoError(t, err)
+		return p
+	}
+
+	src := newProvider(srcFS, ".tar.gz.aes")
+	require.NoError(t, src.EnsureBackupBucket(ctx))
+
+	// a backup of a former version without manifest and another suffix
+	err := afero.WriteFile(srcFS, "/backups/db-20240101T030405.000000000Z.tar.gz", []byte("legacy data"), 0600)
+	require.NoError(t, err)
+
+	for i, content := range []string{"first data", "second data"} {
+		err = src.UploadBackup(ctx, strings.NewReader(content), &providers.Manifest{
+			DatabaseType: "postgres",
+			SHA256:       checksum(content),
+			Date:         date.Add(time.Duration(i) * time.Hour),
+		})
+		require.NoError(t, err)
+	}
+
+	// objects referenced by the backups, like the base backups of backup chains
+	objects := map[string]string{
+		"postgres/basebackups/20240102T030405Z/0/base.tar.gz": "base backup",
+		"wal/000000010000000000000001":                        "segment",
+	}
+	for name, content := range objects {
+		err = src.(providers.ObjectStore).PutObject(ctx, name, strings.NewReader(content))
+		require.NoError(t, err)
+	}
+
+	c, err := New(log, &CopierConfig{
+		Source: src,
+		Destination: func(suffix string) (providers.BackupProvider, error) {
+			return newProvider(dstFS, suffix), nil
+		},
+	})
+	require.NoError(t, err)
+
+	err = c.Copy(ctx)
+	require.NoError(t, err)
+
+	dst := newProvider(dstFS, "")
+	versions, err := dst.ListBackups(ctx)
+	require.NoError(t, err)
+
+	var names []string
+	for _, v := range versions.List() {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{
+		"db-20240102T040405.000000000Z.tar.gz.aes",
+		"db-20240102T030405.000000000Z.tar.gz.aes",
+		"db-20240101T030405.000000000Z.tar.gz",
+	}, names)
+
+	for i, content := range []string{"second data", "first data", "legacy data"} {
+		version := versions.List()[i]
+
+		var buf bytes.Buffer
+		err = dst.DownloadBackup(ctx, version, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, content, buf.String())
+
+		manifest, err := dst.DownloadManifest(ctx, version)
+		require.NoError(t, err)
+		assert.Equal(t, checksum(content), manifest.SHA256)
+		assert.True(t, version.Date.Equal(manifest.Date))
+	}
+
+	for name, content := range objects {
+		var buf bytes.Buffer
+		err = dst.(providers.ObjectStore).GetObject(ctx, name, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, content, buf.String())
+	}
+
+	t.Run("present backups are skipped", func(t *testing.T) {
+		err = c.Copy(ctx)
+		require.NoError(t, err)
+
+		files, err := afero.ReadDir(dstFS, "/backups")
+		require.NoError(t, err)
+		// the backups with their manifests and the objects directory
+		assert.Len(t, files, 7)
+	})
+
+	t.Run("corrupt backups are not copied", func(t *testing.T) {
+		err = src.UploadBackup(ctx, strings.NewReader("third data"), &providers.Manifest{
+			SHA256: checksum("other data"),
+			Date:   date.Add(2 * time.Hour),
+		})
+		require.NoError(t, err)
+
+		err = c.Copy(ctx)
+		require.ErrorContains(t, err, "backup is corrupt")
+
+		_, err = dstFS.Stat(path.Join("/backups", "db-20240102T050405.000000000Z.tar.gz.aes"))
+		require.Error(t, err)
+	})
+}
@@ -1,6 +1,13 @@
 package database
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrSkipBackup is returned by Backup if this instance of the database must not be backed up, e.g. because it is not the primary of a replica set.
+// the backuper does not upload a backup then and does not count it as an error.
+var ErrSkipBackup = errors.New("backup skipped")
 
 type DatabaseInitializer interface {
 	// Check indicates whether a restore of the database is required or not.
@@ -23,6 +30,8 @@ type DatabaseProber interface {
 	Probe(ctx context.Context) error
 
 	// Backup creates a backup of the database.
+	//
+	// ErrSkipBackup is returned if no backup is supposed to be taken by this instance.
 	Backup(ctx context.Context) error
 }
 
@@ -30,3 +39,46 @@ type Database interface {
 	DatabaseInitializer
 	DatabaseProber
 }
+
+// DatabaseRecoverer is implemented by databases which are able to replay their log up to a recovery target after restoring a backup.
+type DatabaseRecoverer interface {
+	// RecoverTo performs a restore of the database and replays the log following the backup up to the given target.
+	// nil replays the whole log like Recover.
+	RecoverTo(ctx context.Context, target *RecoveryTarget) error
+}
+
+// RecoveryTarget is the point up to which the log following a restored backup is replayed, at most one of the fields may be set.
+type RecoveryTarget struct {
+	// Time is a timestamp like 2024-01-02 15:04:05+00
+	Time string
+	// LSN is a log sequence number like 0/3000060
+	LSN string
+	// Name is a restore point created with pg_create_restore_point()
+	Name string
+	// Immediate stops the replay as soon as the restored backup is consistent, so the log written after the backup is not replayed
+	Immediate bool
+}
+
+// Validate returns an error if more than one recovery target is set
+func (t *RecoveryTarget) Validate() error {
+	set := 0
+	for _, s := range []string{t.Time, t.LSN, t.Name} {
+		if s != "" {
+			set++
+		}
+	}
+	if t.Immediate {
+		set++
+	}
+	if set > 1 {
+		return errors.New("only one of recovery target time, lsn and name can be set")
+	}
+
+	return nil
+}
+
+// DatabaseVersioner is implemented by databases which are able to report their version.
+type DatabaseVersioner interface {
+	// Version returns the version of the database server.
+	Version(ctx context.Context) (string, error)
+}
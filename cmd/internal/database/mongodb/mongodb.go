@@ -0,0 +1,316 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/probe"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/utils"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	connectionTimeout             = 5 * time.Second
+	restoreDatabaseStartupTimeout = 60 * time.Second
+	restoreDatabasePort           = 27018
+
+	mongodbCmd        = "mongod"
+	mongodbDumpCmd    = "mongodump"
+	mongodbRestoreCmd = "mongorestore"
+
+	mongodbArchive = "mongodb.archive"
+	// mongodbOplogMarker is stored next to the archive if the archive contains the oplog, which can only be dumped from replica set members
+	mongodbOplogMarker = "oplog"
+	// mongodbStorageMetadata is created by the storage engine when the data directory gets initialized
+	mongodbStorageMetadata = "WiredTiger"
+)
+
+// MongoDB implements the database interface
+type MongoDB struct {
+	datadir  string
+	uri      string
+	log      *slog.Logger
+	executor *utils.CmdExecutor
+}
+
+// New instantiates a new mongodb database
+func New(log *slog.Logger, datadir string, uri string) *MongoDB {
+	return &MongoDB{
+		log:      log,
+		datadir:  datadir,
+		uri:      uri,
+		executor: utils.NewExecutor(log),
+	}
+}
+
+// Check indicates whether a restore of the database is required or not.
+func (db *MongoDB) Check(_ context.Context) (bool, error) {
+	empty, err := utils.IsEmpty(db.datadir)
+	if err != nil {
+		return false, err
+	}
+	if empty {
+		db.log.Info("data directory is empty")
+		return true, err
+	}
+
+	// a data directory without storage metadata was never initialized, e.g. it only contains lost+found of a fresh volume.
+	// the database would initialize a new database in it, so it has to be restored.
+	_, err = os.Stat(path.Join(db.datadir, mongodbStorageMetadata))
+	if errors.Is(err, fs.ErrNotExist) {
+		db.log.Info("data directory does not contain storage metadata")
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// Backup takes a dump of the database with mongodump, including the oplog for replica sets
+func (db *MongoDB) Backup(ctx context.Context) error {
+	hello, err := db.hello(ctx)
+	if err != nil {
+		return err
+	}
+	if !hello.IsWritablePrimary {
+		// the backup directory may still contain the dump of the time this member was primary, it must not be uploaded again
+		return fmt.Errorf("%w: this database is not primary", database.ErrSkipBackup)
+	}
+
+	if err := os.RemoveAll(constants.BackupDir); err != nil {
+		return fmt.Errorf("could not clean backup directory: %w", err)
+	}
+
+	if err := os.MkdirAll(constants.BackupDir, 0777); err != nil {
+		return fmt.Errorf("could not create backup directory: %w", err)
+	}
+
+	archive := path.Join(constants.BackupDir, mongodbArchive)
+
+	args := []string{"--uri=" + db.uri, "--archive=" + archive}
+	if hello.SetName != "" {
+		// the oplog makes the dump consistent to the point in time when the dump finished
+		args = append(args, "--oplog")
+	}
+
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, mongodbDumpCmd, nil, args...)
+	if err != nil {
+		return fmt.Errorf("error running backup command: %s %w", out, err)
+	}
+
+	if _, err := os.Stat(archive); os.IsNotExist(err) {
+		return fmt.Errorf("backup file was not created: %s", archive)
+	}
+
+	if hello.SetName != "" {
+		err = os.WriteFile(path.Join(constants.BackupDir, mongodbOplogMarker), nil, 0600)
+		if err != nil {
+			return fmt.Errorf("unable to mark backup to contain the oplog: %w", err)
+		}
+	}
+
+	db.log.Debug("successfully took backup of mongodb database", "output", out)
+
+	return nil
+}
+
+// Recover restores a database backup
+func (db *MongoDB) Recover(ctx context.Context) error {
+	archive := path.Join(constants.RestoreDir, mongodbArchive)
+
+	if _, err := os.Stat(archive); os.IsNotExist(err) {
+		return fmt.Errorf("restore file not present: %s", archive)
+	}
+
+	if err := utils.RemoveContents(db.datadir); err != nil {
+		return fmt.Errorf("could not clean database data directory: %w", err)
+	}
+
+	// mongodb requires to be running when restoring a backup.
+	// however, if we let the real database container start, we cannot interrupt it anymore in case
+	// an issue occurs during the restoration. therefore, we spin up an own instance of mongodb
+	// inside the sidecar against which we can restore. the instance does not enforce authentication.
+
+	var (
+		cmd                       *exec.Cmd
+		g, _                      = errgroup.WithContext(ctx)
+		mongodbCtx, cancelMongodb = context.WithCancel(ctx) // cancel sends a KILL signal to the process
+
+		// IMPORTANT: when the recovery goes wrong, the database directory MUST be cleaned up
+		// otherwise on pod restart the database directory is not empty anymore and
+		// the backup-restore-sidecar will assume it's a fresh database and let the
+		// database start without restored data, which can mess up things big time
+
+		handleFailedRecovery = func(restoreErr error) error {
+			db.log.Error("trying to handle failed database recovery", "error", restoreErr)
+
+			// kill the mongodb process
+			cancelMongodb()
+
+			db.log.Info("waiting for async mongodb go routine to stop")
+
+			err := g.Wait()
+			if err != nil {
+				db.log.Error("mongodb go routine finished with error", "error", err)
+			}
+
+			if err := utils.RemoveContents(db.datadir); err != nil {
+				db.log.Error("unable to cleanup database data directory after failed recovery attempt, high risk of starting with fresh database on container restart", "err", err)
+			} else {
+				db.log.Info("cleaned up database data directory after failed recovery attempt to prevent start of fresh database")
+			}
+
+			return restoreErr
+		}
+	)
+
+	defer cancelMongodb()
+
+	g.Go(func() error {
+		args := []string{"--dbpath", db.datadir, "--bind_ip", "127.0.0.1", "--port", strconv.Itoa(restoreDatabasePort)}
+		db.log.Debug("execute mongodb", "args", args)
+
+		cmd = exec.CommandContext(mongodbCtx, mongodbCmd, args...) // nolint:gosec
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("unable to run mongodb: %w", err)
+		}
+
+		db.log.Info("mongodb process finished")
+
+		return nil
+	})
+
+	db.log.Info("waiting for mongodb database to come up")
+
+	probeCtx, probeCancel := context.WithTimeout(ctx, restoreDatabaseStartupTimeout)
+	defer probeCancel()
+
+	restoreDB := New(db.log, db.datadir, fmt.Sprintf("mongodb://127.0.0.1:%d/?directConnection=true", restoreDatabasePort))
+	err := probe.Start(probeCtx, restoreDB.log, restoreDB)
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("mongodb did not come up: %w", err))
+	}
+
+	args := []string{"--uri=" + restoreDB.uri, "--archive=" + archive}
+	if _, err := os.Stat(path.Join(constants.RestoreDir, mongodbOplogMarker)); err == nil {
+		args = append(args, "--oplogReplay")
+	}
+
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, mongodbRestoreCmd, nil, args...)
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("error running restore command: %s %w", out, err))
+	}
+
+	db.log.Debug("restored mongodb archive", "output", out)
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		db.log.Error("failed to send sigterm signal to mongodb, killing it", "error", err)
+		cancelMongodb()
+	}
+
+	err = g.Wait()
+	if err != nil {
+		db.log.Error("mongodb process not properly terminated, but restore was successful", "error", err)
+	} else {
+		db.log.Info("successfully restored mongodb database")
+	}
+
+	return nil
+}
+
+// Probe figures out if the database is running and available for taking backups.
+func (db *MongoDB) Probe(ctx context.Context) error {
+	client, err := db.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to ping mongodb: %w", err)
+	}
+
+	return nil
+}
+
+// Upgrade performs an upgrade of the database in case a newer version of the database is detected.
+func (db *MongoDB) Upgrade(_ context.Context) error {
+	return nil
+}
+
+// Version returns the version of the running mongodb server
+func (db *MongoDB) Version(ctx context.Context) (string, error) {
+	client, err := db.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	var info struct {
+		Version string `bson:"version"`
+	}
+
+	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info)
+	if err != nil {
+		return "", fmt.Errorf("unable to get database build info: %w", err)
+	}
+
+	return info.Version, nil
+}
+
+type helloResponse struct {
+	IsWritablePrimary bool   `bson:"isWritablePrimary"`
+	SetName           string `bson:"setName"`
+}
+
+// hello returns the role of the database, a standalone database is a writable primary without replica set
+func (db *MongoDB) hello(ctx context.Context) (*helloResponse, error) {
+	client, err := db.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	var hello helloResponse
+	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get database role: %w", err)
+	}
+
+	return &hello, nil
+}
+
+func (db *MongoDB) connect(ctx context.Context) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(db.uri).SetConnectTimeout(connectionTimeout).SetServerSelectionTimeout(connectionTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create mongodb client: %w", err)
+	}
+	return client, nil
+}
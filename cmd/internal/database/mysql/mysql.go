@@ -0,0 +1,366 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/probe"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/utils"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	restoreDatabaseStartupTimeout = 60 * time.Second
+
+	mysqlDumpFile = "dump.sql"
+	// mysqlSystemSchema is the directory of the system schema, which is created when the data directory gets initialized
+	mysqlSystemSchema = "mysql"
+)
+
+var (
+	// mariadb deprecates the mysql names of its tools, so the mariadb names are preferred
+	mysqlDumpCmds    = []string{"mariadb-dump", "mysqldump"}
+	mysqlClientCmds  = []string{"mariadb", "mysql"}
+	mysqlServerCmds  = []string{"mariadbd", "mysqld"}
+	mysqlInstallCmds = []string{"mariadb-install-db", "mysql_install_db"}
+
+	mysqlRestoreSocket = path.Join(os.TempDir(), "mysql-restore.sock")
+)
+
+// MySQL implements the database interface for mysql and mariadb
+type MySQL struct {
+	datadir  string
+	host     string
+	port     int
+	socket   string
+	user     string
+	password string
+	log      *slog.Logger
+	executor *utils.CmdExecutor
+}
+
+// New instantiates a new mysql database
+func New(log *slog.Logger, datadir string, host string, port int, user string, password string) *MySQL {
+	return &MySQL{
+		log:      log,
+		datadir:  datadir,
+		host:     host,
+		port:     port,
+		user:     user,
+		password: password,
+		executor: utils.NewExecutor(log),
+	}
+}
+
+// Check indicates whether a restore of the database is required or not.
+func (db *MySQL) Check(_ context.Context) (bool, error) {
+	empty, err := utils.IsEmpty(db.datadir)
+	if err != nil {
+		return false, err
+	}
+	if empty {
+		db.log.Info("data directory is empty")
+		return true, err
+	}
+
+	// a data directory without system schema was never initialized, e.g. it only contains lost+found of a fresh volume.
+	// the database would initialize a new database in it, so it has to be restored.
+	_, err = os.Stat(path.Join(db.datadir, mysqlSystemSchema))
+	if errors.Is(err, fs.ErrNotExist) {
+		db.log.Info("data directory does not contain the system schema")
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// Backup takes a consistent dump of all databases with mysqldump
+func (db *MySQL) Backup(ctx context.Context) error {
+	if err := os.RemoveAll(constants.BackupDir); err != nil {
+		return fmt.Errorf("could not clean backup directory: %w", err)
+	}
+
+	if err := os.MkdirAll(constants.BackupDir, 0777); err != nil {
+		return fmt.Errorf("could not create backup directory: %w", err)
+	}
+
+	dumpFile := path.Join(constants.BackupDir, mysqlDumpFile)
+
+	// --single-transaction dumps innodb tables consistently without locking them
+	args := []string{"--single-transaction", "--all-databases", "--routines", "--events", "--triggers", "--hex-blob", "--result-file=" + dumpFile}
+	if db.host != "" {
+		args = append(args, "--host="+db.host)
+	}
+	if db.port != 0 {
+		args = append(args, "--port="+strconv.Itoa(db.port))
+	}
+	if db.user != "" {
+		args = append(args, "--user="+db.user)
+	}
+
+	var env []string
+	if db.password != "" {
+		env = append(env, "MYSQL_PWD="+db.password)
+	}
+
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, lookupCommand(mysqlDumpCmds), env, args...)
+	if err != nil {
+		return fmt.Errorf("error running backup command: %s %w", out, err)
+	}
+
+	if _, err := os.Stat(dumpFile); os.IsNotExist(err) {
+		return fmt.Errorf("backup file was not created: %s", dumpFile)
+	}
+
+	db.log.Debug("successfully took backup of mysql database", "output", out)
+
+	return nil
+}
+
+// Recover restores a database backup
+func (db *MySQL) Recover(ctx context.Context) error {
+	dumpFile := path.Join(constants.RestoreDir, mysqlDumpFile)
+
+	if _, err := os.Stat(dumpFile); os.IsNotExist(err) {
+		return fmt.Errorf("restore file not present: %s", dumpFile)
+	}
+
+	if err := utils.RemoveContents(db.datadir); err != nil {
+		return fmt.Errorf("could not clean database data directory: %w", err)
+	}
+
+	// a dump can only be restored into a running database.
+	// however, if we let the real database container start, we cannot interrupt it anymore in case
+	// an issue occurs during the restoration. therefore, we initialize a new data directory and
+	// spin up an own instance of the database inside the sidecar against which we can restore.
+	// the instance only listens on a socket and does not check privileges, so no credentials are required.
+
+	var (
+		cmd                     *exec.Cmd
+		g, _                    = errgroup.WithContext(ctx)
+		mysqlCtx, cancelMysqlDB = context.WithCancel(ctx) // cancel sends a KILL signal to the process
+
+		// IMPORTANT: when the recovery goes wrong, the database directory MUST be cleaned up
+		// otherwise on pod restart the database directory is not empty anymore and
+		// the backup-restore-sidecar will assume it's a fresh database and let the
+		// database start without restored data, which can mess up things big time
+
+		handleFailedRecovery = func(restoreErr error) error {
+			db.log.Error("trying to handle failed database recovery", "error", restoreErr)
+
+			// kill the database process
+			cancelMysqlDB()
+
+			db.log.Info("waiting for async mysql go routine to stop")
+
+			err := g.Wait()
+			if err != nil {
+				db.log.Error("mysql go routine finished with error", "error", err)
+			}
+
+			if err := utils.RemoveContents(db.datadir); err != nil {
+				db.log.Error("unable to cleanup database data directory after failed recovery attempt, high risk of starting with fresh database on container restart", "err", err)
+			} else {
+				db.log.Info("cleaned up database data directory after failed recovery attempt to prevent start of fresh database")
+			}
+
+			return restoreErr
+		}
+	)
+
+	defer cancelMysqlDB()
+
+	if err := db.initializeDatadir(ctx); err != nil {
+		return handleFailedRecovery(err)
+	}
+
+	g.Go(func() error {
+		args := append([]string{"--datadir=" + db.datadir, "--socket=" + mysqlRestoreSocket, "--skip-networking", "--skip-grant-tables"}, userArgs()...)
+		db.log.Debug("execute mysql", "args", args)
+
+		cmd = exec.CommandContext(mysqlCtx, lookupCommand(mysqlServerCmds), args...) // nolint:gosec
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("unable to run mysql: %w", err)
+		}
+
+		db.log.Info("mysql process finished")
+
+		return nil
+	})
+
+	db.log.Info("waiting for mysql database to come up")
+
+	probeCtx, probeCancel := context.WithTimeout(ctx, restoreDatabaseStartupTimeout)
+	defer probeCancel()
+
+	restoreDB := &MySQL{log: db.log, socket: mysqlRestoreSocket, user: "root"}
+	err := probe.Start(probeCtx, restoreDB.log, restoreDB)
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("mysql did not come up: %w", err))
+	}
+
+	dump, err := os.Open(dumpFile)
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("unable to open restore file: %w", err))
+	}
+	defer func() {
+		_ = dump.Close()
+	}()
+
+	restoreCmd := exec.CommandContext(ctx, lookupCommand(mysqlClientCmds), "--socket="+mysqlRestoreSocket, "--user=root") // nolint:gosec
+	restoreCmd.Stdin = dump
+
+	out, err := restoreCmd.CombinedOutput()
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("error running restore command: %s %w", string(out), err))
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		db.log.Error("failed to send sigterm signal to mysql, killing it", "error", err)
+		cancelMysqlDB()
+	}
+
+	err = g.Wait()
+	if err != nil {
+		db.log.Error("mysql process not properly terminated, but restore was successful", "error", err)
+	} else {
+		db.log.Info("successfully restored mysql database")
+	}
+
+	return nil
+}
+
+// initializeDatadir creates the system schema in the empty data directory
+func (db *MySQL) initializeDatadir(ctx context.Context) error {
+	var (
+		command string
+		args    []string
+	)
+
+	for _, c := range mysqlInstallCmds {
+		if utils.IsCommandPresent(c) {
+			command = c
+			args = []string{"--datadir=" + db.datadir, "--auth-root-authentication-method=normal", "--skip-test-db"}
+			break
+		}
+	}
+
+	if command == "" {
+		// mysql removed the install tool in favor of initializing the data directory with the server
+		command = lookupCommand(mysqlServerCmds)
+		args = []string{"--initialize-insecure", "--datadir=" + db.datadir}
+	}
+
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, command, nil, append(args, userArgs()...)...)
+	if err != nil {
+		return fmt.Errorf("error initializing data directory: %s %w", out, err)
+	}
+
+	db.log.Debug("initialized mysql data directory", "output", out)
+
+	return nil
+}
+
+// Probe figures out if the database is running and available for taking backups.
+func (db *MySQL) Probe(ctx context.Context) error {
+	dbc, err := db.open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbc.Close()
+	}()
+
+	err = dbc.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to ping mysql connection %w", err)
+	}
+
+	return nil
+}
+
+// Upgrade performs an upgrade of the database in case a newer version of the database is detected.
+//
+// the backups are logical dumps which can be restored into newer versions of the database,
+// the upgrade of the system schema on startup is left to the database container.
+func (db *MySQL) Upgrade(_ context.Context) error {
+	return nil
+}
+
+// Version returns the version of the running mysql server, mariadb appends its name to the version
+func (db *MySQL) Version(ctx context.Context) (string, error) {
+	dbc, err := db.open()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = dbc.Close()
+	}()
+
+	var version string
+	err = dbc.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("unable to query mysql version: %w", err)
+	}
+
+	return version, nil
+}
+
+func (db *MySQL) open() (*sql.DB, error) {
+	cfg := mysqldriver.NewConfig()
+	cfg.User = db.user
+	cfg.Passwd = db.password
+
+	if db.socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = db.socket
+	} else {
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(db.host, strconv.Itoa(db.port))
+	}
+
+	connector, err := mysqldriver.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open mysql connection %w", err)
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+// userArgs lets the database drop the privileges of root, which it refuses to run with
+func userArgs() []string {
+	if os.Geteuid() == 0 {
+		return []string{"--user=mysql"}
+	}
+	return nil
+}
+
+// lookupCommand returns the first of the given commands which is present, the last one otherwise
+func lookupCommand(commands []string) string {
+	for _, c := range commands {
+		if utils.IsCommandPresent(c) {
+			return c
+		}
+	}
+	return commands[len(commands)-1]
+}
@@ -0,0 +1,362 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/objectstore"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	postgresCombineBackupCmd = "pg_combinebackup"
+
+	postgresBackupManifest = "backup_manifest"
+	postgresBackupChain    = "backup_chain.json"
+
+	// baseBackupsPrefix is the prefix of the base backups of the backup chains in the object store of the backup provider
+	baseBackupsPrefix = "postgres/basebackups/"
+	chainTimeFormat   = "20060102T150405Z"
+
+	// incrementalMinVersion is the first version of postgres which supports incremental backups
+	incrementalMinVersion = 170000
+)
+
+// IncrementalConfig provides configuration for incremental base backups
+type IncrementalConfig struct {
+	// BackupProvider stores the base backups of the backup chains, it needs to implement the object store
+	BackupProvider providers.BackupProvider
+	// Encrypter encrypts the base backups, nil stores them unencrypted
+	Encrypter *encryption.Encrypter
+	// UploadLimiter and DownloadLimiter limit the bandwidth to the backup provider, nil does not limit it
+	UploadLimiter   *throttle.Limiter
+	DownloadLimiter *throttle.Limiter
+	// FullBackupInterval is the interval in which a full base backup is taken, the backups in between are incremental.
+	// zero only takes full backups, but backups taken incrementally before can still be restored.
+	FullBackupInterval time.Duration
+}
+
+// backupChain is a full base backup followed by the incremental base backups which are based on it,
+// it is stored in the backup instead of the base backup
+type backupChain struct {
+	// Started is the time at which the full base backup was started
+	Started time.Time `json:"started"`
+	// Backups are the base backups in the order they were taken, starting with the full base backup
+	Backups []chainBackup `json:"backups"`
+}
+
+// chainBackup references the objects of a base backup of a backup chain
+type chainBackup struct {
+	Base     string `json:"base"`
+	Manifest string `json:"manifest"`
+}
+
+// SetIncrementalBackups stores the physical base backups in backup chains, which are restored with pg_combinebackup
+func (db *Postgres) SetIncrementalBackups(config *IncrementalConfig) error {
+	if config.FullBackupInterval < 0 {
+		return errors.New("full backup interval must not be negative")
+	}
+
+	if config.FullBackupInterval > 0 && db.mode != BackupModePhysical {
+		return fmt.Errorf("incremental backups require the %s backup mode", BackupModePhysical)
+	}
+
+	store, err := objectstore.New(&objectstore.StoreConfig{
+		Log:             db.log,
+		BackupProvider:  config.BackupProvider,
+		Encrypter:       config.Encrypter,
+		UploadLimiter:   config.UploadLimiter,
+		DownloadLimiter: config.DownloadLimiter,
+	})
+	if err != nil {
+		return err
+	}
+
+	db.bp = config.BackupProvider
+	db.store = store
+	db.fullBackupInterval = config.FullBackupInterval
+
+	return nil
+}
+
+// currentBackupChain returns the backup chain which is continued by the next base backup,
+// a new chain is returned if a full base backup is due. nil is returned if incremental backups are disabled or not supported.
+func (db *Postgres) currentBackupChain(ctx context.Context) (*backupChain, error) {
+	if db.store == nil || db.fullBackupInterval == 0 {
+		return nil, nil
+	}
+
+	supported, err := db.incrementalSupported(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		db.log.Warn("incremental backups require postgres 17 or newer with summarize_wal enabled, taking a full backup")
+		return nil, nil
+	}
+
+	newChain := &backupChain{Started: time.Now()}
+
+	content, err := os.ReadFile(path.Join(constants.BackupChainDir, postgresBackupChain))
+	if errors.Is(err, os.ErrNotExist) {
+		return newChain, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read backup chain: %w", err)
+	}
+
+	var chain backupChain
+	err = json.Unmarshal(content, &chain)
+	if err != nil {
+		db.log.Error("unable to parse backup chain, starting a new one", "error", err)
+		return newChain, nil
+	}
+
+	if _, err := os.Stat(path.Join(constants.BackupChainDir, postgresBackupManifest)); err != nil || len(chain.Backups) == 0 {
+		return newChain, nil
+	}
+
+	if time.Since(chain.Started) >= db.fullBackupInterval {
+		db.log.Info("full backup interval elapsed, starting a new backup chain")
+		return newChain, nil
+	}
+
+	return &chain, nil
+}
+
+// incrementalSupported returns true if the running database is able to take incremental backups
+func (db *Postgres) incrementalSupported(ctx context.Context) (bool, error) {
+	connString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=disable", db.host, db.port, db.user, db.password)
+
+	dbc, err := sql.Open("postgres", connString)
+	if err != nil {
+		return false, fmt.Errorf("unable to open postgres connection %w", err)
+	}
+	defer func() {
+		_ = dbc.Close()
+	}()
+
+	var (
+		version      int
+		summarizeWAL string
+	)
+	err = dbc.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int, coalesce(current_setting('summarize_wal', true), 'off')").Scan(&version, &summarizeWAL)
+	if err != nil {
+		return false, fmt.Errorf("unable to query postgres settings: %w", err)
+	}
+
+	return version >= incrementalMinVersion && summarizeWAL == "on", nil
+}
+
+// storeBackupChain stores the base backup which was just taken in the object store and replaces it with the backup chain,
+// the manifest of the base backup is kept for the next incremental backup
+func (db *Postgres) storeBackupChain(ctx context.Context, chain *backupChain) error {
+	prefix := fmt.Sprintf("%s%s/%d/", baseBackupsPrefix, chain.Started.UTC().Format(chainTimeFormat), len(chain.Backups))
+
+	backup := chainBackup{
+		Base:     db.store.ObjectName(prefix + postgresBaseTar),
+		Manifest: db.store.ObjectName(prefix + postgresBackupManifest),
+	}
+
+	err := db.store.Upload(ctx, path.Join(constants.BackupDir, postgresBaseTar), backup.Base)
+	if err != nil {
+		return err
+	}
+
+	err = db.store.Upload(ctx, path.Join(constants.BackupDir, postgresBackupManifest), backup.Manifest)
+	if err != nil {
+		return err
+	}
+
+	chain.Backups = append(chain.Backups, backup)
+
+	content, err := json.Marshal(chain)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path.Join(constants.BackupDir, postgresBaseTar)); err != nil {
+		return fmt.Errorf("unable to remove stored base backup: %w", err)
+	}
+
+	if err := os.WriteFile(path.Join(constants.BackupDir, postgresBackupChain), content, 0600); err != nil {
+		return fmt.Errorf("unable to write backup chain: %w", err)
+	}
+
+	if err := os.MkdirAll(constants.BackupChainDir, 0777); err != nil {
+		return fmt.Errorf("could not create backup chain directory: %w", err)
+	}
+
+	if err := os.Rename(path.Join(constants.BackupDir, postgresBackupManifest), path.Join(constants.BackupChainDir, postgresBackupManifest)); err != nil {
+		return fmt.Errorf("unable to keep backup manifest: %w", err)
+	}
+
+	if err := os.WriteFile(path.Join(constants.BackupChainDir, postgresBackupChain), content, 0600); err != nil {
+		return fmt.Errorf("unable to write backup chain: %w", err)
+	}
+
+	db.log.Info("stored base backup in backup chain", "started", chain.Started.String(), "backups", len(chain.Backups))
+
+	err = db.cleanupBackupChains(ctx, chain)
+	if err != nil {
+		db.log.Error("unable to clean up expired backup chains", "error", err)
+	}
+
+	return nil
+}
+
+// cleanupBackupChains deletes the backup chains which are not referenced by any backup anymore.
+// a backup references the newest chain which was started before the backup was taken.
+func (db *Postgres) cleanupBackupChains(ctx context.Context, current *backupChain) error {
+	versions, err := db.bp.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	objects, err := db.store.List(ctx, baseBackupsPrefix)
+	if err != nil {
+		return err
+	}
+
+	chains := map[string][]string{}
+	for _, o := range objects {
+		started, _, _ := strings.Cut(strings.TrimPrefix(o.Name, baseBackupsPrefix), "/")
+		chains[started] = append(chains[started], o.Name)
+	}
+
+	var starts []time.Time
+	for started := range chains {
+		t, err := time.Parse(chainTimeFormat, started)
+		if err != nil {
+			db.log.Warn("skipping unknown object in backup chains", "name", started)
+			continue
+		}
+		starts = append(starts, t)
+	}
+	slices.SortFunc(starts, func(a, b time.Time) int { return b.Compare(a) })
+
+	referenced := map[string]bool{
+		current.Started.UTC().Format(chainTimeFormat): true,
+	}
+	for _, v := range versions.List() {
+		for _, started := range starts {
+			if !started.After(v.Date) {
+				referenced[started.UTC().Format(chainTimeFormat)] = true
+				break
+			}
+		}
+	}
+
+	var errs []error
+	for started, names := range chains {
+		if referenced[started] {
+			continue
+		}
+
+		db.log.Info("deleting expired backup chain", "started", started)
+
+		for _, name := range names {
+			err := db.store.Delete(ctx, name)
+			if errors.Is(err, providers.ErrObjectLocked) {
+				db.log.Info("base backup of expired backup chain is still locked, deleting it later", "name", name)
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// restoreBackupChain combines the base backups of the backup chain of the restored backup into the data directory
+func (db *Postgres) restoreBackupChain(ctx context.Context) error {
+	content, err := os.ReadFile(path.Join(constants.RestoreDir, postgresBackupChain))
+	if err != nil {
+		return fmt.Errorf("unable to read backup chain: %w", err)
+	}
+
+	var chain backupChain
+	err = json.Unmarshal(content, &chain)
+	if err != nil {
+		return fmt.Errorf("unable to parse backup chain: %w", err)
+	}
+
+	if len(chain.Backups) == 0 {
+		return errors.New("backup chain does not contain any base backups")
+	}
+
+	if db.store == nil {
+		return errors.New("backup is part of a backup chain, which cannot be restored without an object store")
+	}
+
+	chainDir := path.Join(constants.RestoreDir, "chain")
+	defer func() {
+		_ = os.RemoveAll(chainDir)
+	}()
+
+	var dirs []string
+	for i, backup := range chain.Backups {
+		dir := path.Join(chainDir, strconv.Itoa(i))
+
+		if err := os.MkdirAll(path.Join(dir, "data"), 0777); err != nil {
+			return fmt.Errorf("could not create base backup directory: %w", err)
+		}
+
+		err := db.store.Download(ctx, backup.Base, path.Join(dir, postgresBaseTar))
+		if err != nil {
+			return err
+		}
+
+		out, err := db.executor.ExecuteCommandWithOutput(ctx, "tar", nil, "-xzf", path.Join(dir, postgresBaseTar), "-C", path.Join(dir, "data"))
+		if err != nil {
+			return fmt.Errorf("error untaring base backup: %s %w", out, err)
+		}
+
+		if err := os.Remove(path.Join(dir, postgresBaseTar)); err != nil {
+			return err
+		}
+
+		err = db.store.Download(ctx, backup.Manifest, path.Join(dir, "data", postgresBackupManifest))
+		if err != nil {
+			return err
+		}
+
+		db.log.Info("restored base backup of backup chain", "backup", i+1, "backups", len(chain.Backups))
+
+		dirs = append(dirs, path.Join(dir, "data"))
+	}
+
+	// the combined data directory has to belong to the postgres user
+	attr, err := postgresProcAttr(db.datadir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, postgresCombineBackupCmd, append(dirs, "--output="+db.datadir)...) // nolint:gosec
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = attr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("error combining base backups: %w", err)
+	}
+
+	db.log.Info("combined base backups of backup chain", "started", chain.Started.String(), "backups", len(chain.Backups))
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+)
+
+func TestPostgres_cleanupBackupChains(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		now = time.Now()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+
+	db := &Postgres{log: log, mode: BackupModePhysical}
+	require.NoError(t, db.SetIncrementalBackups(&IncrementalConfig{BackupProvider: bp, FullBackupInterval: time.Hour}))
+
+	chains := []*backupChain{
+		{Started: now.Add(-3 * time.Hour)},
+		{Started: now.Add(-2 * time.Hour)},
+		{Started: now.Add(-1 * time.Hour)},
+		{Started: now.Add(time.Hour)},
+	}
+
+	for _, chain := range chains {
+		for i := range 2 {
+			name := baseBackupsPrefix + chain.Started.UTC().Format(chainTimeFormat) + "/" + strconv.Itoa(i) + "/" + postgresBaseTar
+			require.NoError(t, bp.PutObject(ctx, name, strings.NewReader("base backup")))
+		}
+	}
+
+	// the backup references the newest chain which was started before it was taken
+	err = bp.UploadBackup(ctx, strings.NewReader("backup"), &providers.Manifest{Date: now})
+	require.NoError(t, err)
+
+	err = db.cleanupBackupChains(ctx, chains[3])
+	require.NoError(t, err)
+
+	objects, err := bp.ListObjects(ctx, baseBackupsPrefix)
+	require.NoError(t, err)
+
+	var remaining []string
+	for _, o := range objects {
+		started, _, _ := strings.Cut(strings.TrimPrefix(o.Name, baseBackupsPrefix), "/")
+		remaining = append(remaining, started)
+	}
+
+	assert.ElementsMatch(t, []string{
+		chains[2].Started.UTC().Format(chainTimeFormat),
+		chains[2].Started.UTC().Format(chainTimeFormat),
+		chains[3].Started.UTC().Format(chainTimeFormat),
+		chains[3].Started.UTC().Format(chainTimeFormat),
+	}, remaining)
+}
+
+func TestPostgres_SetIncrementalBackups(t *testing.T) {
+	bp, err := local.New(slog.Default(), &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+
+	db := &Postgres{log: slog.Default(), mode: BackupModeLogical}
+	require.ErrorContains(t, db.SetIncrementalBackups(&IncrementalConfig{BackupProvider: bp, FullBackupInterval: time.Hour}), "require the physical backup mode")
+	require.NoError(t, db.SetIncrementalBackups(&IncrementalConfig{BackupProvider: bp}))
+
+	db = &Postgres{log: slog.Default(), mode: BackupModePhysical}
+	require.ErrorContains(t, db.SetIncrementalBackups(&IncrementalConfig{BackupProvider: bp, FullBackupInterval: -time.Hour}), "must not be negative")
+}
@@ -0,0 +1,329 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/probe"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/utils"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	postgresDumpAllCmd = "pg_dumpall"
+	postgresDumpCmd    = "pg_dump"
+	postgresRestoreCmd = "pg_restore"
+	postgresClientCmd  = "psql"
+	postgresServerCmd  = "postgres"
+
+	postgresGlobalsFile  = "globals.sql"
+	postgresDatabasesDir = "databases"
+	postgresConfigDir    = "config"
+
+	// postgresMaintenanceDB is created by initdb, so it is restored into instead of being created
+	postgresMaintenanceDB = "postgres"
+
+	restoreDatabaseStartupTimeout = 60 * time.Second
+)
+
+// logicalBackup dumps the global objects like roles and tablespaces and every database in directory format,
+// which allows to restore the backup into other major versions and to restore single databases with SetRestoreDatabase.
+func (db *Postgres) logicalBackup(ctx context.Context) error {
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, postgresDumpAllCmd, db.connectionEnv(), append(db.connectionArgs(), "--globals-only", "--file="+path.Join(constants.BackupDir, postgresGlobalsFile))...)
+	if err != nil {
+		return fmt.Errorf("error dumping global objects: %s %w", out, err)
+	}
+
+	databases, err := db.listDatabases(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range databases {
+		args := append(db.connectionArgs(),
+			"--dbname="+name,
+			"--format=directory",
+			"--create",
+			"--jobs="+strconv.Itoa(db.jobs),
+			"--file="+path.Join(constants.BackupDir, postgresDatabasesDir, url.PathEscape(name)),
+		)
+
+		out, err := db.executor.ExecuteCommandWithOutput(ctx, postgresDumpCmd, db.connectionEnv(), args...)
+		if err != nil {
+			return fmt.Errorf("error dumping database %q: %s %w", name, out, err)
+		}
+
+		db.log.Debug("dumped postgres database", "database", name)
+	}
+
+	// the configuration is not part of the dump, it is restored into the new data directory like on an upgrade
+	if err := os.MkdirAll(path.Join(constants.BackupDir, postgresConfigDir), 0777); err != nil {
+		return fmt.Errorf("could not create config backup directory: %w", err)
+	}
+
+	for _, config := range []string{postgresHBAConf, postgresqlConf} {
+		cfg, err := os.ReadFile(path.Join(db.datadir, config))
+		if err != nil {
+			db.log.Warn("unable to back up configuration, it is not restored", "config", config, "error", err)
+			continue
+		}
+
+		err = os.WriteFile(path.Join(constants.BackupDir, postgresConfigDir, config), cfg, 0600)
+		if err != nil {
+			return fmt.Errorf("unable to back up configuration %s: %w", config, err)
+		}
+	}
+
+	db.log.Debug("successfully took logical backup of postgres database", "databases", databases)
+
+	return nil
+}
+
+// logicalRecover replays a logical backup into a freshly initialized database cluster
+func (db *Postgres) logicalRecover(ctx context.Context) error {
+	if db.database != "" {
+		_, err := os.Stat(path.Join(constants.RestoreDir, postgresDatabasesDir, url.PathEscape(db.database)))
+		if err != nil {
+			return fmt.Errorf("database %q is not part of the backup: %w", db.database, err)
+		}
+	}
+
+	if err := utils.RemoveContents(db.datadir); err != nil {
+		return fmt.Errorf("could not clean database data directory: %w", err)
+	}
+
+	// the dump can only be replayed into a running database.
+	// however, if we let the real database container start, we cannot interrupt it anymore in case
+	// an issue occurs during the restoration. therefore, we spin up an own instance of postgres
+	// inside the sidecar which only listens on a socket.
+
+	var (
+		cmd                         *exec.Cmd
+		g, _                        = errgroup.WithContext(ctx)
+		postgresCtx, cancelPostgres = context.WithCancel(ctx) // cancel sends a KILL signal to the process
+		socketDir                   = os.TempDir()
+
+		// IMPORTANT: when the recovery goes wrong, the database directory MUST be cleaned up
+		// otherwise on pod restart the database directory is not empty anymore and
+		// the backup-restore-sidecar will assume it's a fresh database and let the
+		// database start without restored data, which can mess up things big time
+
+		handleFailedRecovery = func(restoreErr error) error {
+			db.log.Error("trying to handle failed database recovery", "error", restoreErr)
+
+			// kill the postgres process
+			cancelPostgres()
+
+			db.log.Info("waiting for async postgres go routine to stop")
+
+			err := g.Wait()
+			if err != nil {
+				db.log.Error("postgres go routine finished with error", "error", err)
+			}
+
+			if err := utils.RemoveContents(db.datadir); err != nil {
+				db.log.Error("unable to cleanup database data directory after failed recovery attempt, high risk of starting with fresh database on container restart", "err", err)
+			} else {
+				db.log.Info("cleaned up database data directory after failed recovery attempt to prevent start of fresh database")
+			}
+
+			return restoreErr
+		}
+	)
+
+	defer cancelPostgres()
+
+	attr, err := postgresProcAttr(db.datadir)
+	if err != nil {
+		return handleFailedRecovery(err)
+	}
+
+	superuser := db.user
+	if superuser == "" {
+		superuser = "postgres"
+	}
+
+	// local connections are trusted like in the postgres container image, until the backed up configuration is restored
+	initdb := exec.CommandContext(ctx, postgresInitDBCmd, "-D", db.datadir, "--username="+superuser, "--auth-local=trust", "--auth-host=scram-sha-256") // nolint:gosec
+	initdb.Stdout = os.Stdout
+	initdb.Stderr = os.Stderr
+	initdb.SysProcAttr = attr
+	err = initdb.Run()
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("unable to initialize data directory: %w", err))
+	}
+
+	g.Go(func() error {
+		args := []string{"-D", db.datadir, "-c", "listen_addresses=", "-c", "unix_socket_directories=" + socketDir}
+		db.log.Debug("execute postgres", "args", args)
+
+		cmd = exec.CommandContext(postgresCtx, postgresServerCmd, args...) // nolint:gosec
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.SysProcAttr = attr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("unable to run postgres: %w", err)
+		}
+
+		db.log.Info("postgres process finished")
+
+		return nil
+	})
+
+	db.log.Info("waiting for postgres database to come up")
+
+	probeCtx, probeCancel := context.WithTimeout(ctx, restoreDatabaseStartupTimeout)
+	defer probeCancel()
+
+	restoreDB := &Postgres{log: db.log, host: socketDir, port: 5432, user: superuser, jobs: db.jobs, executor: db.executor}
+	err = probe.Start(probeCtx, restoreDB.log, restoreDB)
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("postgres did not come up: %w", err))
+	}
+
+	// the role of the superuser already exists, psql continues on this error
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, postgresClientCmd, nil, append(restoreDB.connectionArgs(), "--dbname="+postgresMaintenanceDB, "--file="+path.Join(constants.RestoreDir, postgresGlobalsFile))...)
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("error restoring global objects: %s %w", out, err))
+	}
+
+	db.log.Debug("restored postgres global objects", "output", out)
+
+	entries, err := os.ReadDir(path.Join(constants.RestoreDir, postgresDatabasesDir))
+	if err != nil {
+		return handleFailedRecovery(fmt.Errorf("unable to read databases of backup: %w", err))
+	}
+
+	for _, e := range entries {
+		name, err := url.PathUnescape(e.Name())
+		if err != nil {
+			return handleFailedRecovery(fmt.Errorf("invalid database directory %q in backup: %w", e.Name(), err))
+		}
+
+		if db.database != "" && name != db.database {
+			db.log.Info("skipping restore of postgres database", "database", name)
+			continue
+		}
+
+		args := append(restoreDB.connectionArgs(), "--dbname="+postgresMaintenanceDB, "--exit-on-error", "--jobs="+strconv.Itoa(db.jobs))
+		if name != postgresMaintenanceDB {
+			args = append(args, "--create")
+		}
+		args = append(args, path.Join(constants.RestoreDir, postgresDatabasesDir, e.Name()))
+
+		out, err := db.executor.ExecuteCommandWithOutput(ctx, postgresRestoreCmd, nil, args...)
+		if err != nil {
+			return handleFailedRecovery(fmt.Errorf("error restoring database %q: %s %w", name, out, err))
+		}
+
+		db.log.Info("restored postgres database", "database", name)
+	}
+
+	for _, config := range []string{postgresHBAConf, postgresqlConf} {
+		cfg, err := os.ReadFile(path.Join(constants.RestoreDir, postgresConfigDir, config))
+		if err != nil {
+			db.log.Warn("configuration is not part of the backup, keeping the default", "config", config, "error", err)
+			continue
+		}
+
+		err = os.WriteFile(path.Join(db.datadir, config), cfg, 0600)
+		if err != nil {
+			return handleFailedRecovery(fmt.Errorf("unable to restore configuration %s: %w", config, err))
+		}
+
+		if attr != nil {
+			err = os.Chown(path.Join(db.datadir, config), int(attr.Credential.Uid), int(attr.Credential.Gid))
+			if err != nil {
+				return handleFailedRecovery(fmt.Errorf("unable to restore configuration %s: %w", config, err))
+			}
+		}
+	}
+
+	// sigint requests a fast shutdown, which does not wait for clients to disconnect
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		db.log.Error("failed to send sigint signal to postgres, killing it", "error", err)
+		cancelPostgres()
+	}
+
+	err = g.Wait()
+	if err != nil {
+		db.log.Error("postgres process not properly terminated, but restore was successful", "error", err)
+	} else {
+		db.log.Info("successfully restored postgres database from logical backup")
+	}
+
+	return nil
+}
+
+// listDatabases returns the names of all databases which can be dumped
+func (db *Postgres) listDatabases(ctx context.Context) ([]string, error) {
+	connString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=disable", db.host, db.port, db.user, db.password)
+
+	dbc, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open postgres connection %w", err)
+	}
+	defer func() {
+		_ = dbc.Close()
+	}()
+
+	rows, err := dbc.QueryContext(ctx, "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get database names: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// postgresProcAttr lets processes which refuse to run as root run as the postgres user and hands the data directory over to it
+func postgresProcAttr(datadir string) (*syscall.SysProcAttr, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil
+	}
+
+	pgUser, err := user.Lookup("postgres")
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(pgUser.Uid)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.Atoi(pgUser.Gid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chown(datadir, uid, gid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, // nolint:gosec
+	}, nil
+}
@@ -3,13 +3,19 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path"
 	"strconv"
+	"time"
 
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/objectstore"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/utils"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/wal"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 
 	_ "github.com/lib/pq"
@@ -21,6 +27,13 @@ const (
 	postgresWalTar    = "pg_wal.tar.gz"
 )
 
+const (
+	// BackupModePhysical takes a base backup of the database cluster, which can only be restored with the same major version
+	BackupModePhysical = "physical"
+	// BackupModeLogical dumps the global objects and every database, which can be restored into other major versions
+	BackupModeLogical = "logical"
+)
+
 // Postgres implements the database interface
 type Postgres struct {
 	datadir  string
@@ -28,12 +41,31 @@ type Postgres struct {
 	port     int
 	user     string
 	password string
+	mode     string
+	jobs     int
+	database string
 	log      *slog.Logger
 	executor *utils.CmdExecutor
+
+	archive *wal.Archive
+
+	bp                 providers.BackupProvider
+	store              *objectstore.Store
+	fullBackupInterval time.Duration
 }
 
-// New instantiates a new postgres database
-func New(log *slog.Logger, datadir string, host string, port int, user string, password string) *Postgres {
+// New instantiates a new postgres database, jobs is the number of tables which are dumped and restored in parallel in logical backup mode
+func New(log *slog.Logger, datadir string, host string, port int, user string, password string, mode string, jobs int) (*Postgres, error) {
+	switch mode {
+	case BackupModePhysical, BackupModeLogical:
+	default:
+		return nil, fmt.Errorf("unsupported postgres backup mode: %s", mode)
+	}
+
+	if jobs < 1 {
+		return nil, fmt.Errorf("number of parallel jobs must be at least 1")
+	}
+
 	return &Postgres{
 		log:      log,
 		datadir:  datadir,
@@ -41,8 +73,16 @@ func New(log *slog.Logger, datadir string, host string, port int, user string, p
 		port:     port,
 		user:     user,
 		password: password,
+		mode:     mode,
+		jobs:     jobs,
 		executor: utils.NewExecutor(log),
-	}
+	}, nil
+}
+
+// SetRestoreDatabase restricts the restore of logical backups to the global objects and the given database,
+// physical backups are always restored as a whole
+func (db *Postgres) SetRestoreDatabase(name string) {
+	db.database = name
 }
 
 // Check indicates whether a restore of the database is required or not.
@@ -78,25 +118,41 @@ func (db *Postgres) Backup(ctx context.Context) error {
 		return fmt.Errorf("could not create backup directory: %w", err)
 	}
 
-	args := []string{"-D", constants.BackupDir, "--wal-method=stream", "--checkpoint=fast", "-z", "--format=t"}
-	if db.host != "" {
-		args = append(args, "--host="+db.host)
+	if db.mode == BackupModeLogical {
+		return db.logicalBackup(ctx)
 	}
-	if db.port != 0 {
-		args = append(args, "--port="+strconv.Itoa(db.port))
+
+	if err := db.cleanupWALRecovery(); err != nil {
+		return fmt.Errorf("could not clean restored wal directory: %w", err)
 	}
-	if db.user != "" {
-		args = append(args, "--username="+db.user)
+
+	chain, err := db.currentBackupChain(ctx)
+	if err != nil {
+		return err
 	}
 
-	var env []string
-	if db.password != "" {
-		env = append(env, "PGPASSWORD="+db.password)
+	args := append([]string{"-D", constants.BackupDir, "--wal-method=stream", "--checkpoint=fast", "-z", "--format=t"}, db.connectionArgs()...)
+
+	var out string
+	if chain != nil && len(chain.Backups) > 0 {
+		out, err = db.executor.ExecuteCommandWithOutput(ctx, postgresBackupCmd, db.connectionEnv(), append(args, "--incremental="+path.Join(constants.BackupChainDir, postgresBackupManifest))...)
+		if err != nil {
+			// e.g. the wal summaries since the previous backup were removed
+			db.log.Error("error taking incremental backup, starting a new backup chain", "output", out, "error", err)
+
+			chain = &backupChain{Started: time.Now()}
+
+			if err := utils.RemoveContents(constants.BackupDir); err != nil {
+				return fmt.Errorf("could not clean backup directory: %w", err)
+			}
+		}
 	}
 
-	out, err := db.executor.ExecuteCommandWithOutput(ctx, postgresBackupCmd, env, args...)
-	if err != nil {
-		return fmt.Errorf("error running backup command: %s %w", out, err)
+	if chain == nil || len(chain.Backups) == 0 {
+		out, err = db.executor.ExecuteCommandWithOutput(ctx, postgresBackupCmd, db.connectionEnv(), args...)
+		if err != nil {
+			return fmt.Errorf("error running backup command: %s %w", out, err)
+		}
 	}
 
 	for _, p := range []string{postgresBaseTar, postgresWalTar} {
@@ -106,30 +162,81 @@ func (db *Postgres) Backup(ctx context.Context) error {
 		}
 	}
 
+	if chain != nil {
+		err = db.storeBackupChain(ctx, chain)
+		if err != nil {
+			return fmt.Errorf("error storing base backup in backup chain: %w", err)
+		}
+	}
+
 	db.log.Debug("successfully took backup of postgres database", "output", out)
 
 	return nil
 }
 
-// Recover restores a database backup
+// Recover restores a database backup and replays the whole archived write-ahead log
 func (db *Postgres) Recover(ctx context.Context) error {
-	for _, p := range []string{postgresBaseTar, postgresWalTar} {
+	return db.RecoverTo(ctx, nil)
+}
+
+// RecoverTo restores a database backup and replays the archived write-ahead log up to the given target,
+// logical backups are detected by their dump of the global objects
+func (db *Postgres) RecoverTo(ctx context.Context, target *database.RecoveryTarget) error {
+	if target != nil {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+		if !target.Immediate && db.archive == nil {
+			return errors.New("recovery targets require wal archiving")
+		}
+	}
+
+	if _, err := os.Stat(path.Join(constants.RestoreDir, postgresGlobalsFile)); err == nil {
+		return db.logicalRecover(ctx)
+	}
+
+	if db.database != "" {
+		db.log.Warn("physical backups cannot be restored partially, restoring all databases", "database", db.database)
+	}
+
+	// base backups which are part of a backup chain are stored in the object store
+	_, err := os.Stat(path.Join(constants.RestoreDir, postgresBackupChain))
+	incremental := err == nil
+
+	required := []string{postgresBaseTar, postgresWalTar}
+	if incremental {
+		required = []string{postgresWalTar}
+	}
+
+	for _, p := range required {
 		fullPath := path.Join(constants.RestoreDir, p)
 		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 			return fmt.Errorf("restore file not present: %s", fullPath)
 		}
 	}
 
+	// the next backup has to start a new backup chain for the restored database
+	if err := os.RemoveAll(constants.BackupChainDir); err != nil {
+		return fmt.Errorf("could not clean backup chain directory: %w", err)
+	}
+
 	if err := utils.RemoveContents(db.datadir); err != nil {
 		return fmt.Errorf("could not clean database data directory: %w", err)
 	}
 
-	out, err := db.executor.ExecuteCommandWithOutput(ctx, "tar", nil, "-xzvf", path.Join(constants.RestoreDir, postgresBaseTar), "-C", db.datadir)
-	if err != nil {
-		return fmt.Errorf("error untaring base backup: %s %w", out, err)
-	}
+	if incremental {
+		err := db.restoreBackupChain(ctx)
+		if err != nil {
+			return err
+		}
+	} else {
+		out, err := db.executor.ExecuteCommandWithOutput(ctx, "tar", nil, "-xzvf", path.Join(constants.RestoreDir, postgresBaseTar), "-C", db.datadir)
+		if err != nil {
+			return fmt.Errorf("error untaring base backup: %s %w", out, err)
+		}
 
-	db.log.Debug("restored postgres base backup", "output", out)
+		db.log.Debug("restored postgres base backup", "output", out)
+	}
 
 	if err := os.RemoveAll(path.Join(db.datadir, "pg_wal")); err != nil {
 		return fmt.Errorf("could not clean pg_wal directory: %w", err)
@@ -139,18 +246,67 @@ func (db *Postgres) Recover(ctx context.Context) error {
 		return fmt.Errorf("could not create pg_wal directory: %w", err)
 	}
 
-	out, err = db.executor.ExecuteCommandWithOutput(ctx, "tar", nil, "-xzvf", path.Join(constants.RestoreDir, postgresWalTar), "-C", path.Join(db.datadir, "pg_wal"))
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, "tar", nil, "-xzvf", path.Join(constants.RestoreDir, postgresWalTar), "-C", path.Join(db.datadir, "pg_wal"))
 	if err != nil {
 		return fmt.Errorf("error untaring wal backup: %s %w", out, err)
 	}
 
 	db.log.Debug("restored postgres pg_wal backup", "output", out)
 
+	if err := db.prepareWALRecovery(ctx, target); err != nil {
+		return err
+	}
+
 	db.log.Info("successfully restored postgres database")
 
 	return nil
 }
 
+// connectionArgs returns the arguments of the postgres client tools to connect to the database
+func (db *Postgres) connectionArgs() []string {
+	var args []string
+	if db.host != "" {
+		args = append(args, "--host="+db.host)
+	}
+	if db.port != 0 {
+		args = append(args, "--port="+strconv.Itoa(db.port))
+	}
+	if db.user != "" {
+		args = append(args, "--username="+db.user)
+	}
+	return args
+}
+
+// connectionEnv returns the environment of the postgres client tools to authenticate at the database
+func (db *Postgres) connectionEnv() []string {
+	var env []string
+	if db.password != "" {
+		env = append(env, "PGPASSWORD="+db.password)
+	}
+	return env
+}
+
+// Version returns the version of the running postgres server
+func (db *Postgres) Version(ctx context.Context) (string, error) {
+	connString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=postgres sslmode=disable", db.host, db.port, db.user, db.password)
+
+	dbc, err := sql.Open("postgres", connString)
+	if err != nil {
+		return "", fmt.Errorf("unable to open postgres connection %w", err)
+	}
+	defer func() {
+		_ = dbc.Close()
+	}()
+
+	var version string
+	err = dbc.QueryRowContext(ctx, "SHOW server_version").Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("unable to query postgres version: %w", err)
+	}
+
+	return version, nil
+}
+
 // Probe figures out if the database is running and available for taking backups.
 func (db *Postgres) Probe(ctx context.Context) error {
 	// TODO is postgres db OK ?
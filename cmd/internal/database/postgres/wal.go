@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/wal"
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+)
+
+const (
+	postgresReceiveWALCmd = "pg_receivewal"
+
+	// postgresReplicationSlot retains the write-ahead log at the database until it was streamed by pg_receivewal
+	postgresReplicationSlot = "backup_restore_sidecar"
+
+	postgresBackupLabel   = "backup_label"
+	postgresAutoConf      = "postgresql.auto.conf"
+	postgresRecoverSignal = "recovery.signal"
+
+	// postgresRestoredWALDir is the directory inside the data directory into which the archived wal segments
+	// are restored, it is read by the restore command of postgres
+	postgresRestoredWALDir = "backup-restore-wal"
+
+	receiveWALRestartDelay = 10 * time.Second
+)
+
+// backupLabelStartRegex matches the segment of the start of a base backup in the backup label,
+// e.g. START WAL LOCATION: 0/2000028 (file 000000010000000000000002)
+var backupLabelStartRegex = regexp.MustCompile(`^START WAL LOCATION: \S+ \(file ([0-9A-F]{24})\)$`)
+
+// SetWALArchive enables the continuous archiving of the write-ahead log to the given archive and the point-in-time recovery
+func (db *Postgres) SetWALArchive(archive *wal.Archive) error {
+	if db.mode != BackupModePhysical {
+		return fmt.Errorf("wal archiving requires the %s backup mode", BackupModePhysical)
+	}
+
+	db.archive = archive
+
+	return nil
+}
+
+// ArchiveWAL streams the write-ahead log of the running database with pg_receivewal and ships it to the archive
+// until the context is canceled. it does nothing if wal archiving is not enabled.
+func (db *Postgres) ArchiveWAL(ctx context.Context) error {
+	if db.archive == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(constants.WALDir, 0777); err != nil {
+		return fmt.Errorf("could not create wal directory: %w", err)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return db.archive.Run(ctx, constants.WALDir)
+	})
+
+	g.Go(func() error {
+		return db.receiveWAL(ctx)
+	})
+
+	return g.Wait()
+}
+
+// receiveWAL runs pg_receivewal and restarts it when it terminates, e.g. because the database was restarted
+func (db *Postgres) receiveWAL(ctx context.Context) error {
+	for {
+		err := db.runReceiveWAL(ctx)
+		if err != nil {
+			db.log.Error("error streaming write-ahead log, restarting", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(receiveWALRestartDelay):
+		}
+	}
+}
+
+func (db *Postgres) runReceiveWAL(ctx context.Context) error {
+	out, err := db.executor.ExecuteCommandWithOutput(ctx, postgresReceiveWALCmd, db.connectionEnv(), append(db.connectionArgs(), "--create-slot", "--if-not-exists", "--slot="+postgresReplicationSlot)...)
+	if err != nil {
+		return fmt.Errorf("error creating replication slot: %s %w", out, err)
+	}
+
+	args := append(db.connectionArgs(), "--directory="+constants.WALDir, "--slot="+postgresReplicationSlot, "--no-loop")
+	db.log.Info("streaming write-ahead log", "args", args)
+
+	cmd := exec.CommandContext(ctx, postgresReceiveWALCmd, args...) // nolint:gosec
+	cmd.Env = append(os.Environ(), db.connectionEnv()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// prepareWALRecovery restores the archived write-ahead log following the restored base backup
+// and configures postgres to replay it up to the recovery target when it is started, nil replays the whole archive
+func (db *Postgres) prepareWALRecovery(ctx context.Context, target *database.RecoveryTarget) error {
+	// the streamed segments which were not shipped yet belong to the history of the replaced database
+	if err := os.RemoveAll(constants.WALDir); err != nil {
+		return fmt.Errorf("could not clean wal directory: %w", err)
+	}
+
+	if db.archive == nil {
+		return nil
+	}
+
+	start, err := backupStartSegment(path.Join(db.datadir, postgresBackupLabel))
+	if err != nil {
+		return err
+	}
+
+	walDir := path.Join(db.datadir, postgresRestoredWALDir)
+
+	if err := os.MkdirAll(walDir, 0777); err != nil {
+		return fmt.Errorf("could not create restored wal directory: %w", err)
+	}
+
+	n, err := db.archive.Restore(ctx, walDir, start)
+	if err != nil {
+		return fmt.Errorf("error restoring archived write-ahead log: %w", err)
+	}
+
+	db.log.Info("restored archived write-ahead log", "start", start, "files", n)
+
+	settings := append([]string{
+		fmt.Sprintf("restore_command = 'cp %s/%%f \"%%p\"'", postgresRestoredWALDir),
+		"recovery_target_timeline = 'latest'",
+	}, recoveryTargetSettings(target)...)
+
+	err = writeRecoverySettings(path.Join(db.datadir, postgresAutoConf), settings)
+	if err != nil {
+		return fmt.Errorf("unable to configure recovery: %w", err)
+	}
+
+	err = os.WriteFile(path.Join(db.datadir, postgresRecoverSignal), nil, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create recovery signal: %w", err)
+	}
+
+	db.log.Info("configured point-in-time recovery", "settings", settings)
+
+	return nil
+}
+
+// recoveryTargetSettings returns the settings which stop the replay at the given target and promote the database on a new timeline,
+// no settings are returned if no target is set
+func recoveryTargetSettings(target *database.RecoveryTarget) []string {
+	if target == nil {
+		return nil
+	}
+
+	var setting string
+	switch {
+	case target.Time != "":
+		setting = "recovery_target_time = " + quoteSetting(target.Time)
+	case target.LSN != "":
+		setting = "recovery_target_lsn = " + quoteSetting(target.LSN)
+	case target.Name != "":
+		setting = "recovery_target_name = " + quoteSetting(target.Name)
+	case target.Immediate:
+		setting = "recovery_target = 'immediate'"
+	default:
+		return nil
+	}
+
+	return []string{setting, "recovery_target_action = 'promote'"}
+}
+
+// cleanupWALRecovery removes the restored write-ahead log once postgres finished the recovery
+func (db *Postgres) cleanupWALRecovery() error {
+	if _, err := os.Stat(path.Join(db.datadir, postgresRecoverSignal)); err == nil {
+		return nil
+	}
+
+	return os.RemoveAll(path.Join(db.datadir, postgresRestoredWALDir))
+}
+
+// backupStartSegment returns the segment at which the replay of the write-ahead log starts for the base backup with the given label
+func backupStartSegment(label string) (string, error) {
+	content, err := os.ReadFile(label)
+	if err != nil {
+		return "", fmt.Errorf("unable to read backup label: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if match := backupLabelStartRegex.FindStringSubmatch(scanner.Text()); match != nil {
+			return match[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("backup label does not contain the start of the backup")
+}
+
+// writeRecoverySettings appends the given settings to the configuration file, replacing the recovery settings of a previous recovery
+func writeRecoverySettings(file string, settings []string) error {
+	content, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var lines []string
+	for line := range strings.Lines(string(content)) {
+		setting := strings.TrimSpace(line)
+		if strings.HasPrefix(setting, "restore_command") || strings.HasPrefix(setting, "recovery_target") {
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	lines = append(lines, settings...)
+
+	return os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// quoteSetting quotes the given value as a string of the postgres configuration
+func quoteSetting(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
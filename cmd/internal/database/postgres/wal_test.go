@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
+)
+
+func Test_backupStartSegment(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "backup label",
+			label: `START WAL LOCATION: 0/2000028 (file 000000010000000000000002)
+CHECKPOINT LOCATION: 0/2000060
+BACKUP METHOD: streamed
+BACKUP FROM: primary
+START TIME: 2024-01-02 15:04:05 UTC
+LABEL: pg_basebackup base backup
+START TIMELINE: 1
+`,
+			want: "000000010000000000000002",
+		},
+		{
+			name:    "start is missing",
+			label:   "CHECKPOINT LOCATION: 0/2000060\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label := path.Join(t.TempDir(), postgresBackupLabel)
+			require.NoError(t, os.WriteFile(label, []byte(tt.label), 0600))
+
+			got, err := backupStartSegment(label)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_writeRecoverySettings(t *testing.T) {
+	conf := path.Join(t.TempDir(), postgresAutoConf)
+	require.NoError(t, os.WriteFile(conf, []byte(`# Do not edit this file manually!
+max_connections = '200'
+restore_command = 'cp old/%f "%p"'
+recovery_target_time = '2024-01-02 15:04:05+00'`), 0600))
+
+	err := writeRecoverySettings(conf, []string{"recovery_target_name = " + quoteSetting("before 'migration'")})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(conf)
+	require.NoError(t, err)
+	assert.Equal(t, `# Do not edit this file manually!
+max_connections = '200'
+recovery_target_name = 'before ''migration'''
+`, string(content))
+}
+
+func TestPostgres_SetWALArchive(t *testing.T) {
+	db := &Postgres{mode: BackupModeLogical}
+	require.ErrorContains(t, db.SetWALArchive(nil), "requires the physical backup mode")
+
+	db = &Postgres{mode: BackupModePhysical}
+	require.NoError(t, db.SetWALArchive(nil))
+}
+
+func TestPostgres_RecoverTo(t *testing.T) {
+	db := &Postgres{mode: BackupModePhysical}
+
+	err := db.RecoverTo(context.Background(), &database.RecoveryTarget{Time: "2024-01-02 15:04:05+00", LSN: "0/3000060"})
+	require.ErrorContains(t, err, "only one of")
+
+	err = db.RecoverTo(context.Background(), &database.RecoveryTarget{LSN: "0/3000060"})
+	require.ErrorContains(t, err, "require wal archiving")
+}
+
+func Test_recoveryTargetSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		target *database.RecoveryTarget
+		want   []string
+	}{
+		{
+			name:   "no target replays the whole archive",
+			target: nil,
+			want:   nil,
+		},
+		{
+			name:   "empty target replays the whole archive",
+			target: &database.RecoveryTarget{},
+			want:   nil,
+		},
+		{
+			name:   "time",
+			target: &database.RecoveryTarget{Time: "2024-01-02 15:04:05+00"},
+			want:   []string{"recovery_target_time = '2024-01-02 15:04:05+00'", "recovery_target_action = 'promote'"},
+		},
+		{
+			name:   "immediate",
+			target: &database.RecoveryTarget{Immediate: true},
+			want:   []string{"recovery_target = 'immediate'", "recovery_target_action = 'promote'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, recoveryTargetSettings(tt.target))
+		})
+	}
+}
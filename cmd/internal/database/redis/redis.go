@@ -158,6 +158,22 @@ func (db *Redis) Upgrade(_ context.Context) error {
 	return nil
 }
 
+// Version returns the version of the running redis server, valkey and keydb report the redis version they are compatible to
+func (db *Redis) Version(ctx context.Context) (string, error) {
+	info, err := db.client.Info(ctx, "server").Result()
+	if err != nil {
+		return "", fmt.Errorf("unable to get database info %w", err)
+	}
+
+	for line := range strings.Lines(info) {
+		if version, found := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); found {
+			return version, nil
+		}
+	}
+
+	return "", fmt.Errorf("no version found in database info")
+}
+
 func (db *Redis) isMaster(ctx context.Context) (bool, error) {
 	info, err := db.client.Info(ctx, "replication").Result()
 	if err != nil {
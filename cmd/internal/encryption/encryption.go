@@ -1,16 +1,18 @@
 package encryption
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 	"unicode"
 
 	"github.com/spf13/afero"
@@ -19,6 +21,9 @@ import (
 // suffix is appended on encryption and removed on decryption from given input
 const suffix = ".aes"
 
+// magic starts every encrypted stream and is followed by the initialization vector
+var magic = []byte("BRSAES\x00\x01")
+
 // Encrypter is used to encrypt/decrypt backups
 type Encrypter struct {
 	fs  afero.Fs
@@ -52,86 +57,96 @@ func New(log *slog.Logger, config *EncrypterConfig) (*Encrypter, error) {
 
 }
 
-// Encrypt input file with key and store encrypted result with suffix
-func (e *Encrypter) Encrypt(inputPath string) (string, error) {
-	output := inputPath + suffix
-	e.log.Debug("encrypt", "input", inputPath, "output", output)
-	infile, err := e.fs.Open(inputPath)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		_ = infile.Close()
-	}()
+// Fingerprint identifies the key without revealing it, it is the beginning of the hex encoded SHA-256 checksum of the key
+func (e *Encrypter) Fingerprint() string {
+	sum := sha256.Sum256([]byte(e.key))
+	return hex.EncodeToString(sum[:8])
+}
 
+// Encrypt returns a writer which encrypts everything written to it with key and writes the result to w.
+// the stream starts with a header containing the initialization vector, so it can be decrypted without seeking.
+func (e *Encrypter) Encrypt(w io.Writer) (io.Writer, error) {
 	block, err := e.createCipher()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	iv, err := e.generateIV(block)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	outfile, err := e.openOutputFile(output)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		_ = outfile.Close()
-	}()
-	if err := e.encryptFile(infile, outfile, block, iv); err != nil {
-		return "", err
+	if _, err := w.Write(append(slices.Clone(magic), iv...)); err != nil {
+		return nil, fmt.Errorf("could not write header: %w", err)
 	}
 
-	if err := e.fs.Remove(inputPath); err != nil {
-		e.log.Warn("unable to remove input", "error", err)
+	return &cipher.StreamWriter{S: cipher.NewCTR(block, iv), W: w}, nil
+}
+
+// Decrypt returns a reader which decrypts the stream read from r with key.
+//
+// backups encrypted by former versions have the initialization vector appended instead of prepended,
+// these are spooled to a temporary file in tmpDir first. the returned reader must be closed to remove it.
+func (e *Encrypter) Decrypt(r io.Reader, tmpDir string) (io.ReadCloser, error) {
+	block, err := e.createCipher()
+	if err != nil {
+		return nil, err
 	}
 
-	return output, nil
-}
+	br := bufio.NewReader(r)
+
+	header, err := br.Peek(len(magic) + block.BlockSize())
+	if err == nil && bytes.Equal(header[:len(magic)], magic) {
+		iv := slices.Clone(header[len(magic):])
 
-// Decrypt input file with key and store decrypted result with suffix removed
-// if input does not end with suffix, it is assumed that the file was not encrypted.
-func (e *Encrypter) Decrypt(inputPath string) (string, error) {
-	output := strings.TrimSuffix(inputPath, suffix)
-	e.log.Debug("decrypt", "input", inputPath, "output", output)
+		if _, err := br.Discard(len(header)); err != nil {
+			return nil, err
+		}
 
-	if !IsEncrypted(inputPath) {
-		return "", fmt.Errorf("input is not encrypted")
+		return io.NopCloser(&cipher.StreamReader{S: cipher.NewCTR(block, iv), R: br}), nil
 	}
 
-	infile, err := e.fs.Open(inputPath)
+	e.log.Info("backup was encrypted in legacy format, buffering it to disk for decryption")
+
+	return e.decryptLegacy(br, block, tmpDir)
+}
+
+// decryptLegacy decrypts a stream which has the initialization vector appended at its end
+func (e *Encrypter) decryptLegacy(r io.Reader, block cipher.Block, tmpDir string) (io.ReadCloser, error) {
+	tmp, err := afero.TempFile(e.fs, tmpDir, "legacy-*"+suffix)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer func() {
-		_ = infile.Close()
-	}()
-	block, err := e.createCipher()
-	if err != nil {
-		return "", err
+
+	cleanup := func() error {
+		_ = tmp.Close()
+		return e.fs.Remove(tmp.Name())
 	}
 
-	iv, msgLen, err := e.readIVAndMessageLength(infile, block)
-	if err != nil {
-		return "", err
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = cleanup()
+		return nil, fmt.Errorf("error buffering encrypted backup: %w", err)
 	}
 
-	outfile, err := e.openOutputFile(output)
+	iv, msgLen, err := e.readIVAndMessageLength(tmp, block)
 	if err != nil {
-		return "", err
+		_ = cleanup()
+		return nil, err
 	}
 
-	if err := e.decryptFile(infile, outfile, block, iv, msgLen); err != nil {
-		return "", err
-	}
+	return &legacyReader{
+		Reader:  &cipher.StreamReader{S: cipher.NewCTR(block, iv), R: io.NewSectionReader(tmp, 0, msgLen)},
+		cleanup: cleanup,
+	}, nil
+}
 
-	if err := e.fs.Remove(inputPath); err != nil {
-		e.log.Warn("unable to remove input", "error", err)
-	}
-	return output, nil
+type legacyReader struct {
+	io.Reader
+	cleanup func() error
+}
+
+func (l *legacyReader) Close() error {
+	return l.cleanup()
 }
 
 func isASCII(s string) bool {
@@ -149,10 +164,6 @@ func (e *Encrypter) createCipher() (cipher.Block, error) {
 	return aes.NewCipher(key)
 }
 
-func (e *Encrypter) openOutputFile(output string) (afero.File, error) {
-	return e.fs.OpenFile(output, os.O_RDWR|os.O_CREATE, 0644)
-}
-
 // generateIV() returns unique initialization vector of same size as cipher block for encryption
 func (e *Encrypter) generateIV(block cipher.Block) ([]byte, error) {
 	iv := make([]byte, block.BlockSize())
@@ -162,35 +173,6 @@ func (e *Encrypter) generateIV(block cipher.Block) ([]byte, error) {
 	return iv, nil
 }
 
-// encryptFile() encrypts infile to outfile using CTR mode (cipher and iv) and appends iv for decryption
-func (e *Encrypter) encryptFile(infile, outfile afero.File, block cipher.Block, iv []byte) error {
-	buf := make([]byte, 1024)
-	stream := cipher.NewCTR(block, iv)
-
-	for {
-		n, err := infile.Read(buf)
-		if n > 0 {
-			stream.XORKeyStream(buf, buf[:n])
-			if _, err := outfile.Write(buf[:n]); err != nil {
-				return err
-			}
-		}
-
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error reading from file (%d bytes read): %w", n, err)
-		}
-	}
-
-	if _, err := outfile.Write(iv); err != nil {
-		return fmt.Errorf("could not append iv: %w", err)
-	}
-
-	return nil
-}
-
 // IsEncrypted() tests if target file is encrypted
 func IsEncrypted(path string) bool {
 	return filepath.Ext(path) == suffix
@@ -212,35 +194,6 @@ func (e *Encrypter) readIVAndMessageLength(infile afero.File, block cipher.Block
 	return iv, msgLen, nil
 }
 
-// decryptFile() decrypts infile to outfile using CTR mode (cipher and iv)
-func (e *Encrypter) decryptFile(infile, outfile afero.File, block cipher.Block, iv []byte, msgLen int64) error {
-	buf := make([]byte, 1024)
-	stream := cipher.NewCTR(block, iv)
-
-	for {
-		n, err := infile.Read(buf)
-		if n > 0 {
-			if n > int(msgLen) {
-				n = int(msgLen)
-			}
-			msgLen -= int64(n)
-			stream.XORKeyStream(buf, buf[:n])
-			if _, err := outfile.Write(buf[:n]); err != nil {
-				return err
-			}
-		}
-
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error reading from file (%d bytes read): %w", n, err)
-		}
-	}
-
-	return nil
-}
-
 func (e *Encrypter) Extension() string {
 	return suffix
 }
@@ -1,6 +1,9 @@
 package encryption
 
 import (
+	"bytes"
+	"crypto/cipher"
+	"io"
 	"log/slog"
 	"testing"
 
@@ -25,38 +28,60 @@ func TestEncrypter(t *testing.T) {
 	e, err := New(slog.Default(), &EncrypterConfig{Key: "01234567891234560123456789123456", FS: fs})
 	require.NoError(t, err, "")
 
-	input, err := fs.Create("encrypt")
-	require.NoError(t, err)
-
 	cleartextInput := []byte("This is the content of the file")
-	err = afero.WriteFile(fs, input.Name(), cleartextInput, 0600)
-	require.NoError(t, err)
-	output, err := e.Encrypt(input.Name())
+
+	var encrypted bytes.Buffer
+	w, err := e.Encrypt(&encrypted)
 	require.NoError(t, err)
-	encryptedText, err := afero.ReadFile(fs, output)
+	_, err = w.Write(cleartextInput)
 	require.NoError(t, err)
 
-	require.Equal(t, input.Name()+suffix, output)
-	require.NotEqual(t, cleartextInput, encryptedText)
+	encryptedText := encrypted.Bytes()
+	require.True(t, bytes.HasPrefix(encryptedText, magic))
+	require.NotContains(t, string(encryptedText), string(cleartextInput))
 
-	cleartextFile, err := e.Decrypt(output)
+	r, err := e.Decrypt(bytes.NewReader(encryptedText), "/tmp")
 	require.NoError(t, err)
-	cleartext, err := afero.ReadFile(fs, cleartextFile)
+	cleartext, err := io.ReadAll(r)
 	require.NoError(t, err)
+	require.NoError(t, r.Close())
 	require.Equal(t, cleartextInput, cleartext)
 
-	// Test with 100MB file
+	// Test with 100MB stream
 	bigBuff := make([]byte, 100000000)
-	err = afero.WriteFile(fs, "bigfile.test", bigBuff, 0600)
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := e.Encrypt(pw)
+		if err == nil {
+			_, err = w.Write(bigBuff)
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	r, err = e.Decrypt(pr, "/tmp")
 	require.NoError(t, err)
+	n, err := io.Copy(io.Discard, r)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(bigBuff)), n)
 
-	bigEncFile, err := e.Encrypt("bigfile.test")
+	// Test with legacy format which has the iv appended
+	block, err := e.createCipher()
 	require.NoError(t, err)
-	_, err = e.Decrypt(bigEncFile)
+	iv, err := e.generateIV(block)
 	require.NoError(t, err)
 
-	err = fs.Remove(input.Name())
+	legacy := make([]byte, len(cleartextInput))
+	cipher.NewCTR(block, iv).XORKeyStream(legacy, cleartextInput)
+	legacy = append(legacy, iv...)
+
+	r, err = e.Decrypt(bytes.NewReader(legacy), "/tmp")
+	require.NoError(t, err)
+	cleartext, err = io.ReadAll(r)
 	require.NoError(t, err)
-	err = fs.Remove("bigfile.test")
+	require.Equal(t, cleartextInput, cleartext)
+
+	require.NoError(t, r.Close())
+	tmpFiles, err := afero.ReadDir(fs, "/tmp")
 	require.NoError(t, err)
+	require.Empty(t, tmpFiles)
 }
@@ -0,0 +1,99 @@
+package initializer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+)
+
+// checksumWriter hashes the downloaded backup in order to verify it against the checksum of its manifest
+type checksumWriter struct {
+	ctx      context.Context
+	log      *slog.Logger
+	bp       providers.BackupProvider
+	w        io.Writer
+	hash     hash.Hash
+	n        int64
+	manifest *providers.Manifest
+	err      error
+}
+
+func newChecksumWriter(ctx context.Context, log *slog.Logger, bp providers.BackupProvider, version *providers.BackupVersion, w io.Writer) *checksumWriter {
+	c := &checksumWriter{
+		ctx:  ctx,
+		log:  log,
+		bp:   bp,
+		w:    w,
+		hash: sha256.New(),
+	}
+
+	// the download of the backup might still succeed from a replica, so the error is reported on verification
+	c.err = c.Fallback(version)
+
+	return c
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.hash.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+// Fallback looks up the checksum of the given backup version which is written instead of the requested one
+func (c *checksumWriter) Fallback(version *providers.BackupVersion) error {
+	c.hash.Reset()
+	c.n = 0
+	c.manifest = nil
+	c.err = nil
+
+	manifest, err := c.bp.DownloadManifest(c.ctx, version)
+	if errors.Is(err, providers.ErrManifestNotFound) {
+		c.log.Warn("backup has no manifest, skipping checksum verification", "version", version.Version)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to download manifest of backup %q: %w", version.Version, err)
+	}
+
+	if manifest.SHA256 == "" {
+		c.log.Warn("manifest of backup has no checksum, skipping checksum verification", "version", version.Version)
+		return nil
+	}
+
+	c.manifest = manifest
+
+	return nil
+}
+
+// verifies returns true if the written backup can be verified
+func (c *checksumWriter) verifies() bool {
+	return c.manifest != nil
+}
+
+// verify returns an error if the written backup does not match the checksum of its manifest
+func (c *checksumWriter) verify() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	if c.manifest == nil {
+		return nil
+	}
+
+	sum := hex.EncodeToString(c.hash.Sum(nil))
+	if sum != c.manifest.SHA256 {
+		return fmt.Errorf("backup is corrupt: sha256 checksum %s of %d downloaded bytes does not match checksum %s of %d bytes in the manifest", sum, c.n, c.manifest.SHA256, c.manifest.CompressedSize)
+	}
+
+	c.log.Info("verified checksum of backup", "sha256", sum)
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package initializer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checksumWriter(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		log     = slog.Default()
+		content = "precious data"
+		raw     = sha256.Sum256([]byte(content))
+		sum     = hex.EncodeToString(raw[:])
+	)
+
+	tests := []struct {
+		name     string
+		manifest *providers.Manifest
+		stored   string
+		wantErr  string
+	}{
+		{
+			name:     "valid backup",
+			manifest: &providers.Manifest{SHA256: sum, CompressedSize: int64(len(content))},
+			stored:   content,
+		},
+		{
+			name:     "corrupt backup",
+			manifest: &providers.Manifest{SHA256: sum, CompressedSize: int64(len(content))},
+			stored:   "precious dada",
+			wantErr:  "backup is corrupt: sha256 checksum",
+		},
+		{
+			name:   "backup without manifest",
+			stored: "precious dada",
+		},
+		{
+			name:     "manifest without checksum",
+			manifest: &providers.Manifest{DatabaseType: "postgres"},
+			stored:   "precious dada",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+
+			bp, err := local.New(log, &local.BackupProviderConfigLocal{
+				LocalBackupPath: "/backup",
+				FS:              fs,
+				Suffix:          ".tar.gz",
+			})
+			require.NoError(t, err)
+			require.NoError(t, bp.EnsureBackupBucket(ctx))
+
+			err = bp.UploadBackup(ctx, strings.NewReader(content), tt.manifest)
+			require.NoError(t, err)
+
+			versions, err := bp.ListBackups(ctx)
+			require.NoError(t, err)
+			version := versions.Latest()
+			require.NotNil(t, version)
+
+			err = afero.WriteFile(fs, path.Join("/backup", version.Name), []byte(tt.stored), 0600)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			w := newChecksumWriter(ctx, log, bp, version, &buf)
+			assert.Equal(t, tt.manifest != nil && tt.manifest.SHA256 != "", w.verifies())
+
+			err = bp.DownloadBackup(ctx, version, w)
+			require.NoError(t, err)
+			assert.Equal(t, tt.stored, buf.String())
+
+			err = w.verify()
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_downloadVerified(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		log     = slog.Default()
+		content = "precious data"
+		raw     = sha256.Sum256([]byte(content))
+		fs      = afero.NewMemMapFs()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{
+		LocalBackupPath: "/backup",
+		FS:              fs,
+		Suffix:          ".tar.gz",
+	})
+	require.NoError(t, err)
+	require.NoError(t, bp.EnsureBackupBucket(ctx))
+
+	err = bp.UploadBackup(ctx, strings.NewReader(content), &providers.Manifest{SHA256: hex.EncodeToString(raw[:]), CompressedSize: int64(len(content))})
+	require.NoError(t, err)
+
+	versions, err := bp.ListBackups(ctx)
+	require.NoError(t, err)
+	version := versions.Latest()
+	require.NotNil(t, version)
+
+	err = afero.WriteFile(fs, path.Join("/backup", version.Name), []byte("precious dada"), 0600)
+	require.NoError(t, err)
+
+	spoolDir := t.TempDir()
+
+	// the corrupt backup is rejected before it is passed to the compressor, which is not configured
+	i := &Initializer{log: log, bp: bp}
+	i.SetSpoolDir(spoolDir)
+
+	err = i.downloadVerified(ctx, version)
+	require.ErrorContains(t, err, "backup is corrupt")
+
+	files, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "downloaded backup must be removed")
+}
@@ -2,13 +2,13 @@ package initializer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
 
 	v1 "github.com/metal-stack/backup-restore-sidecar/api/v1"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup"
@@ -17,6 +17,7 @@ import (
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/metrics"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 
 	"google.golang.org/grpc"
@@ -36,9 +37,14 @@ type Initializer struct {
 	metrics       *metrics.Metrics
 	dbDataDir     string
 	encrypter     *encryption.Encrypter
+	// downloadLimiter limits the bandwidth of the download from the backup provider
+	downloadLimiter *throttle.Limiter
+	// spoolDir is the directory in which a backup is downloaded to verify it before it is extracted, empty extracts it while it is downloaded.
+	// defaults to the download directory.
+	spoolDir string
 }
 
-func New(log *slog.Logger, addr string, db database.Database, bp providers.BackupProvider, comp *compress.Compressor, metrics *metrics.Metrics, dbDataDir string, encrypter *encryption.Encrypter) *Initializer {
+func New(log *slog.Logger, addr string, db database.Database, bp providers.BackupProvider, comp *compress.Compressor, metrics *metrics.Metrics, dbDataDir string, encrypter *encryption.Encrypter, downloadLimiter *throttle.Limiter) *Initializer {
 	return &Initializer{
 		currentStatus: &v1.StatusResponse{
 			Status:  v1.StatusResponse_CHECKING,
@@ -52,9 +58,19 @@ func New(log *slog.Logger, addr string, db database.Database, bp providers.Backu
 		dbDataDir: dbDataDir,
 		metrics:   metrics,
 		encrypter: encrypter,
+
+		downloadLimiter: downloadLimiter,
+		spoolDir:        constants.DownloadDir,
 	}
 }
 
+// SetSpoolDir downloads backups into the given directory and verifies their checksum before they are decrypted and uncompressed.
+// the directory must provide enough space for the whole compressed backup, it defaults to the download directory.
+// an empty directory decrypts and uncompresses backups while they are downloaded, their checksum is then only verified afterwards.
+func (i *Initializer) SetSpoolDir(dir string) {
+	i.spoolDir = dir
+}
+
 // Start starts the initializer, which includes a server component and the initializer itself, which is potentially restoring a backup
 func (i *Initializer) Start(ctx context.Context, backuper *backup.Backuper) error {
 	opts := []grpc.ServerOption{
@@ -73,7 +89,7 @@ func (i *Initializer) Start(ctx context.Context, backuper *backup.Backuper) erro
 	grpcServer := grpc.NewServer(opts...)
 
 	initializerService := newInitializerService(i.currentStatus)
-	backupService := newBackupProviderService(i.bp, i.Restore)
+	backupService := newBackupProviderService(i.log, i.bp, i.Restore)
 	databaseService := newDatabaseService(func() error {
 		return backuper.CreateBackup(ctx)
 	})
@@ -178,7 +194,7 @@ func (i *Initializer) initialize(ctx context.Context) error {
 		}
 	}
 
-	err = i.Restore(ctx, latestBackup)
+	err = i.Restore(ctx, latestBackup, nil)
 	if err != nil {
 		return fmt.Errorf("unable to restore database: %w", err)
 	}
@@ -186,10 +202,16 @@ func (i *Initializer) initialize(ctx context.Context) error {
 	return nil
 }
 
-// Restore restores the database with the given backup version
-func (i *Initializer) Restore(ctx context.Context, version *providers.BackupVersion) error {
+// Restore restores the database with the given backup version and replays the log of the database up to the given target.
+// nil replays the whole log, if the database supports it.
+func (i *Initializer) Restore(ctx context.Context, version *providers.BackupVersion, target *database.RecoveryTarget) error {
 	i.log.Info("restoring backup", "version", version.Version, "date", version.Date.String())
 
+	recoverer, supportsTarget := i.db.(database.DatabaseRecoverer)
+	if target != nil && !target.Immediate && !supportsTarget {
+		return errors.New("database does not support recovery targets")
+	}
+
 	i.currentStatus.Status = v1.StatusResponse_RESTORING
 	i.currentStatus.Message = "prepare restore"
 
@@ -202,51 +224,127 @@ func (i *Initializer) Restore(ctx context.Context, version *providers.BackupVers
 	}
 
 	i.currentStatus.Message = "downloading backup"
+	i.log.Info("downloading backup", "version", version.Version, "path", constants.RestoreDir)
 
-	downloadFileName := version.Name
-	if strings.Contains(downloadFileName, "/") {
-		downloadFileName = filepath.Base(downloadFileName)
+	var err error
+	if i.spoolDir != "" {
+		err = i.downloadVerified(ctx, version)
+	} else {
+		err = i.downloadStreamed(ctx, version)
 	}
-	backupFilePath := path.Join(constants.DownloadDir, downloadFileName)
-	if err := os.RemoveAll(backupFilePath); err != nil {
-		return fmt.Errorf("could not delete priorly downloaded file: %w", err)
+	if err != nil {
+		return err
 	}
 
-	outputFile, err := os.Create(backupFilePath)
+	i.currentStatus.Message = "restoring backup"
+	if supportsTarget {
+		err = recoverer.RecoverTo(ctx, target)
+	} else {
+		err = i.db.Recover(ctx)
+	}
 	if err != nil {
-		return fmt.Errorf("could not open file for writing: %w", err)
+		return fmt.Errorf("restoring database was not successful: %w", err)
+	}
+
+	return nil
+}
+
+// downloadStreamed downloads, decrypts and uncompresses the backup as a stream into the restore directory
+func (i *Initializer) downloadStreamed(ctx context.Context, version *providers.BackupVersion) error {
+	// the backup is downloaded, decrypted and uncompressed as a stream such that no intermediate files are required.
+	// the restore directory is only handed over to the database after the checksum of the download was verified.
+	pr, pw := io.Pipe()
+	sum := newChecksumWriter(ctx, i.log, i.bp, version, i.downloadLimiter.Writer(ctx, pw))
+
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := i.bp.DownloadBackup(ctx, version, sum)
+		_ = pw.CloseWithError(err)
+		downloadErr <- err
+	}()
+
+	err := i.extract(version, pr)
+	if err != nil && sum.verifies() {
+		// complete the download such that a corrupt backup is reported as the cause of the error
+		_, _ = io.Copy(io.Discard, pr)
+	}
+	// unblocks the download in case the extraction stopped reading
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+
+	dlErr := <-downloadErr
+	if dlErr == nil {
+		if verifyErr := sum.verify(); verifyErr != nil {
+			_ = os.RemoveAll(constants.RestoreDir)
+			return verifyErr
+		}
+	}
+	if dlErr != nil && (err == nil || !errors.Is(dlErr, io.ErrClosedPipe)) {
+		return fmt.Errorf("unable to download backup: %w", dlErr)
+	}
+
+	return err
+}
+
+// downloadVerified downloads the backup into the spool directory and only decrypts and uncompresses it into the restore directory
+// once its checksum was verified
+func (i *Initializer) downloadVerified(ctx context.Context, version *providers.BackupVersion) error {
+	f, err := os.CreateTemp(i.spoolDir, ".download-*")
+	if err != nil {
+		return fmt.Errorf("unable to create download file: %w", err)
 	}
 	defer func() {
-		_ = outputFile.Close()
+		_ = f.Close()
+		_ = os.Remove(f.Name())
 	}()
-	i.log.Info("downloading backup", "version", version.Version, "path", backupFilePath)
 
-	err = i.bp.DownloadBackup(ctx, version, outputFile)
+	sum := newChecksumWriter(ctx, i.log, i.bp, version, i.downloadLimiter.Writer(ctx, f))
+
+	err = i.bp.DownloadBackup(ctx, version, sum)
 	if err != nil {
 		return fmt.Errorf("unable to download backup: %w", err)
 	}
 
+	err = sum.verify()
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("unable to read downloaded backup: %w", err)
+	}
+
+	return i.extract(version, f)
+}
+
+// extract decrypts and uncompresses the downloaded backup into the restore directory
+func (i *Initializer) extract(version *providers.BackupVersion, r io.Reader) error {
 	if i.encrypter != nil {
-		if encryption.IsEncrypted(backupFilePath) {
-			backupFilePath, err = i.encrypter.Decrypt(backupFilePath)
+		if encryption.IsEncrypted(version.Name) {
+			decrypted, err := i.encrypter.Decrypt(r, constants.DownloadDir)
 			if err != nil {
 				return fmt.Errorf("unable to decrypt backup: %w", err)
 			}
+			defer func() {
+				_ = decrypted.Close()
+			}()
+
+			r = decrypted
 		} else {
 			i.log.Info("restoring unencrypted backup with configured encryption - skipping decryption...")
 		}
 	}
 
 	i.currentStatus.Message = "uncompressing backup"
-	err = i.comp.Decompress(backupFilePath)
+	err := i.comp.Decompress(r, filepath.Dir(constants.RestoreDir))
 	if err != nil {
 		return fmt.Errorf("unable to uncompress backup: %w", err)
 	}
 
-	i.currentStatus.Message = "restoring backup"
-	err = i.db.Recover(ctx)
+	// consume trailing data of the archive such that the download completes
+	_, err = io.Copy(io.Discard, r)
 	if err != nil {
-		return fmt.Errorf("restoring database was not successful: %w", err)
+		return fmt.Errorf("unable to download backup: %w", err)
 	}
 
 	return nil
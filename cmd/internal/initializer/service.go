@@ -2,13 +2,18 @@ package initializer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 
 	v1 "github.com/metal-stack/backup-restore-sidecar/api/v1"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -26,36 +31,62 @@ func (s *initializerService) Status(context.Context, *v1.StatusRequest) (*v1.Sta
 	return s.currentStatus, nil
 }
 
+// manifestConcurrency is the maximum number of manifests which are downloaded concurrently for a listing of backups
+const manifestConcurrency = 10
+
 type backupService struct {
+	log       *slog.Logger
 	bp        providers.BackupProvider
-	restoreFn func(ctx context.Context, version *providers.BackupVersion) error
+	restoreFn func(ctx context.Context, version *providers.BackupVersion, target *database.RecoveryTarget) error
 }
 
-func newBackupProviderService(bp providers.BackupProvider, restoreFn func(ctx context.Context, version *providers.BackupVersion) error) *backupService {
+func newBackupProviderService(log *slog.Logger, bp providers.BackupProvider, restoreFn func(ctx context.Context, version *providers.BackupVersion, target *database.RecoveryTarget) error) *backupService {
 	return &backupService{
+		log:       log,
 		bp:        bp,
 		restoreFn: restoreFn,
 	}
 }
 
-func (s *backupService) ListBackups(ctx context.Context, _ *v1.ListBackupsRequest) (*v1.BackupListResponse, error) {
-	versions, err := s.bp.ListBackups(ctx)
+func (s *backupService) ListBackups(ctx context.Context, req *v1.ListBackupsRequest) (*v1.BackupListResponse, error) {
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	}
+
+	opts := &providers.ListOptions{
+		PageSize:  int(req.GetPageSize()),
+		PageToken: req.GetPageToken(),
+	}
+	if req.GetFrom() != nil {
+		opts.From = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		opts.To = req.GetTo().AsTime()
+	}
+
+	backups, nextPageToken, err := s.bp.ListBackupsPage(ctx, opts)
+	if errors.Is(err, providers.ErrInvalidPageToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	// List internally sorts the backups
-	backups := versions.List()
-	common.Sort(backups)
+	response := &v1.BackupListResponse{
+		Backups:       make([]*v1.Backup, len(backups)),
+		NextPageToken: nextPageToken,
+	}
 
-	response := &v1.BackupListResponse{}
-	for _, b := range backups {
-		response.Backups = append(response.GetBackups(), &v1.Backup{
-			Name:      b.Name,
-			Version:   b.Version,
-			Timestamp: timestamppb.New(b.Date),
+	// the manifests are downloaded concurrently, a page of backups would otherwise take a request per backup one after another
+	var g errgroup.Group
+	g.SetLimit(manifestConcurrency)
+	for i, b := range backups {
+		g.Go(func() error {
+			response.Backups[i] = s.toBackup(ctx, b)
+			return nil
 		})
 	}
+	_ = g.Wait()
 
 	return response, nil
 }
@@ -75,7 +106,25 @@ func (s *backupService) RestoreBackup(ctx context.Context, req *v1.RestoreBackup
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	err = s.restoreFn(ctx, version)
+	target := &database.RecoveryTarget{
+		Time: req.GetRecoveryTarget().GetTime(),
+		LSN:  req.GetRecoveryTarget().GetLsn(),
+		Name: req.GetRecoveryTarget().GetName(),
+	}
+	if err := target.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if *target == (database.RecoveryTarget{}) {
+		target = nil
+
+		// an older backup is restored to roll back to it, replaying the log would restore the newest state instead
+		if latest := versions.Latest(); latest != nil && latest.Version != version.Version {
+			target = &database.RecoveryTarget{Immediate: true}
+		}
+	}
+
+	err = s.restoreFn(ctx, version, target)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("error restoring backup: %s", err))
 	}
@@ -98,8 +147,88 @@ func (s *backupService) GetBackupByVersion(ctx context.Context, req *v1.GetBacku
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	return &v1.GetBackupByVersionResponse{Backup: &v1.Backup{Name: version.Name, Version: version.Version, Timestamp: timestamppb.New(version.Date)}}, nil
+	return &v1.GetBackupByVersionResponse{Backup: s.toBackup(ctx, version)}, nil
+}
+
+func (s *backupService) DeleteBackup(ctx context.Context, req *v1.DeleteBackupRequest) (*v1.DeleteBackupResponse, error) {
+	if req.GetVersion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "version to delete must be defined explicitly")
+	}
+
+	versions, err := s.bp.ListBackups(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	version, err := versions.Get(req.GetVersion())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	err = s.bp.DeleteBackup(ctx, version)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("error deleting backup: %s", err))
+	}
+
+	return &v1.DeleteBackupResponse{}, nil
+}
+
+func (s *backupService) PinBackup(ctx context.Context, req *v1.PinBackupRequest) (*v1.PinBackupResponse, error) {
+	if req.GetVersion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "version to pin must be defined explicitly")
+	}
+
+	versions, err := s.bp.ListBackups(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	version, err := versions.Get(req.GetVersion())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	pinned, err := s.bp.PinBackup(ctx, version)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("error pinning backup: %s", err))
+	}
+
+	return &v1.PinBackupResponse{Backup: s.toBackup(ctx, pinned)}, nil
+}
+
+// toBackup converts a backup version including its manifest, the backup is returned without manifest if it cannot be downloaded
+func (s *backupService) toBackup(ctx context.Context, version *providers.BackupVersion) *v1.Backup {
+	backup := &v1.Backup{
+		Name:      version.Name,
+		Version:   version.Version,
+		Timestamp: timestamppb.New(version.Date),
+		Pinned:    common.IsPinned(version.Name),
+	}
+
+	manifest, err := s.bp.DownloadManifest(ctx, version)
+	if errors.Is(err, providers.ErrManifestNotFound) {
+		return backup
+	}
+	if err != nil {
+		s.log.Error("unable to get manifest of backup", "version", version.Version, "error", err)
+		return backup
+	}
+
+	backup.Manifest = &v1.BackupManifest{
+		DatabaseType:             manifest.DatabaseType,
+		DatabaseVersion:          manifest.DatabaseVersion,
+		CompressionMethod:        manifest.CompressionMethod,
+		EncryptionKeyFingerprint: manifest.EncryptionKeyFingerprint,
+		UncompressedSize:         manifest.UncompressedSize,
+		CompressedSize:           manifest.CompressedSize,
+		Sha256:                   manifest.SHA256,
+		SidecarVersion:           manifest.SidecarVersion,
+		Duration:                 durationpb.New(manifest.Duration),
+		Pod:                      manifest.Pod,
+		Namespace:                manifest.Namespace,
+	}
 
+	return backup
 }
 
 type databaseService struct {
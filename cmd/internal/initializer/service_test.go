@@ -0,0 +1,72 @@
+package initializer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	v1 "github.com/metal-stack/backup-restore-sidecar/api/v1"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenManifestProvider fails to download the manifest of the given backup name
+type brokenManifestProvider struct {
+	providers.BackupProvider
+	broken string
+}
+
+func (p *brokenManifestProvider) DownloadManifest(ctx context.Context, version *providers.BackupVersion) (*providers.Manifest, error) {
+	if version.Name == p.broken {
+		return nil, errors.New("connection reset")
+	}
+	return p.BackupProvider.DownloadManifest(ctx, version)
+}
+
+func Test_backupService_ListBackups(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{
+		FS:     afero.NewMemMapFs(),
+		Suffix: ".tar.gz",
+	})
+	require.NoError(t, err)
+	require.NoError(t, bp.EnsureBackupBucket(ctx))
+
+	for range 3 {
+		err := bp.UploadBackup(ctx, strings.NewReader("backup"), &providers.Manifest{DatabaseType: "postgres"})
+		require.NoError(t, err)
+	}
+
+	versions, err := bp.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, versions.List(), 3)
+
+	s := newBackupProviderService(log, &brokenManifestProvider{BackupProvider: bp, broken: versions.List()[1].Name}, nil)
+
+	resp, err := s.ListBackups(ctx, &v1.ListBackupsRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetBackups(), 3)
+
+	// the backups are listed oldest first
+	listed := versions.List()
+	slices.Reverse(listed)
+
+	for i, b := range resp.GetBackups() {
+		assert.Equal(t, listed[i].Version, b.GetVersion())
+		if i == 1 {
+			assert.Nil(t, b.GetManifest(), "a manifest which cannot be downloaded is left out")
+			continue
+		}
+		assert.Equal(t, "postgres", b.GetManifest().GetDatabaseType())
+	}
+}
@@ -3,7 +3,6 @@ package metrics
 import (
 	"log/slog"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -85,12 +84,11 @@ func (m *Metrics) Start(log *slog.Logger) {
 	}()
 }
 
-// CountBackup updates metrics counter
-func (m *Metrics) CountBackup(backupFile string) {
-	s, _ := os.Stat(backupFile)
+// CountBackup updates metrics counter with the size of the uploaded backup
+func (m *Metrics) CountBackup(size int64) {
 	m.totalBackups.Inc()
 	m.backupSuccess.Set(1)
-	m.backupSize.Set(float64(s.Size()))
+	m.backupSize.Set(float64(size))
 }
 
 // CountError increases error counter for the given operation
@@ -0,0 +1,213 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
+)
+
+// StoreConfig provides configuration for the Store
+type StoreConfig struct {
+	Log *slog.Logger
+	// BackupProvider stores the files, it needs to implement the object store
+	BackupProvider providers.BackupProvider
+	// Encrypter encrypts the stored files, nil stores them unencrypted
+	Encrypter *encryption.Encrypter
+	// UploadLimiter and DownloadLimiter limit the bandwidth to the backup provider, nil does not limit it
+	UploadLimiter   *throttle.Limiter
+	DownloadLimiter *throttle.Limiter
+}
+
+// Store transfers files between the local filesystem and the object store of a backup provider
+type Store struct {
+	log             *slog.Logger
+	store           providers.ObjectStore
+	encrypter       *encryption.Encrypter
+	uploadLimiter   *throttle.Limiter
+	downloadLimiter *throttle.Limiter
+}
+
+// New returns a new store
+func New(config *StoreConfig) (*Store, error) {
+	if config == nil {
+		return nil, errors.New("object store requires a config")
+	}
+
+	store, ok := config.BackupProvider.(providers.ObjectStore)
+	if !ok {
+		return nil, providers.ErrObjectStoreNotSupported
+	}
+
+	return &Store{
+		log:             config.Log,
+		store:           store,
+		encrypter:       config.Encrypter,
+		uploadLimiter:   config.UploadLimiter,
+		downloadLimiter: config.DownloadLimiter,
+	}, nil
+}
+
+// ObjectName returns the name under which a file with the given name is stored, encrypted files carry the extension of the encrypter
+func (s *Store) ObjectName(name string) string {
+	return name + s.extension()
+}
+
+// FileName returns the name of the file which is stored under the given object name
+func (s *Store) FileName(object string) string {
+	return strings.TrimSuffix(object, s.extension())
+}
+
+func (s *Store) extension() string {
+	if s.encrypter == nil {
+		return ""
+	}
+	return s.encrypter.Extension()
+}
+
+// Upload stores the given file under the given object name.
+// the file is passed as a reader which can be reopened, such that the backup provider is able to retry a failed upload.
+func (s *Store) Upload(ctx context.Context, file, object string) error {
+	open := func() (io.ReadCloser, error) {
+		return s.open(ctx, file)
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	err = s.store.PutObject(ctx, object, &fileReader{ReadCloser: r, open: open})
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %w", object, err)
+	}
+
+	return nil
+}
+
+// open returns a reader of the given file, which is encrypted and limited while it is read
+func (s *Store) open(ctx context.Context, file string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		var w io.Writer = pw
+		if s.encrypter != nil {
+			var err error
+			w, err = s.encrypter.Encrypt(pw)
+			if err != nil {
+				_ = pw.CloseWithError(fmt.Errorf("error encrypting %s: %w", file, err))
+				return
+			}
+		}
+
+		_, err := io.Copy(w, f)
+		_ = pw.CloseWithError(err)
+	}()
+
+	return &uploadReader{r: s.uploadLimiter.Reader(ctx, pr), pr: pr, f: f}, nil
+}
+
+// uploadReader reads the encrypted content of a file
+type uploadReader struct {
+	r  io.Reader
+	pr *io.PipeReader
+	f  *os.File
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	return u.r.Read(p)
+}
+
+// Close unblocks the encryption in case the provider stopped reading and closes the file
+func (u *uploadReader) Close() error {
+	_ = u.pr.CloseWithError(io.ErrClosedPipe)
+	return u.f.Close()
+}
+
+// fileReader is the reader of an uploaded file, it implements providers.Reopener
+type fileReader struct {
+	io.ReadCloser
+	open func() (io.ReadCloser, error)
+}
+
+func (f *fileReader) Reopen() (io.ReadCloser, error) {
+	return f.open()
+}
+
+// Download writes the given object to the given file, encrypted objects are decrypted
+func (s *Store) Download(ctx context.Context, object, file string) error {
+	tmp := path.Join(path.Dir(file), "."+path.Base(file)+".part")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+	}()
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		err := s.store.GetObject(ctx, object, s.downloadLimiter.Writer(ctx, pw))
+		_ = pw.CloseWithError(err)
+	}()
+	defer func() {
+		_ = pr.CloseWithError(io.ErrClosedPipe)
+	}()
+
+	var r io.Reader = pr
+	if encryption.IsEncrypted(object) {
+		if s.encrypter == nil {
+			return fmt.Errorf("%s is encrypted, but no encryption key is configured", object)
+		}
+
+		decrypted, err := s.encrypter.Decrypt(pr, path.Dir(file))
+		if err != nil {
+			return fmt.Errorf("unable to decrypt %s: %w", object, err)
+		}
+		defer func() {
+			_ = decrypted.Close()
+		}()
+
+		r = decrypted
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", object, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// List returns the stored objects with the given prefix
+func (s *Store) List(ctx context.Context, prefix string) ([]*providers.Object, error) {
+	return s.store.ListObjects(ctx, prefix)
+}
+
+// Delete deletes the given object, deleting an object which does not exist is no error
+func (s *Store) Delete(ctx context.Context, object string) error {
+	return s.store.DeleteObject(ctx, object)
+}
@@ -0,0 +1,125 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
+)
+
+func Test_Store(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		dir = t.TempDir()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+
+	encrypter, err := encryption.New(log, &encryption.EncrypterConfig{Key: "01234567891234560123456789123456"})
+	require.NoError(t, err)
+
+	encrypted, err := New(&StoreConfig{Log: log, BackupProvider: bp, Encrypter: encrypter})
+	require.NoError(t, err)
+
+	plain, err := New(&StoreConfig{Log: log, BackupProvider: bp})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path.Join(dir, "file"), []byte("precious"), 0600))
+
+	object := encrypted.ObjectName("dir/file")
+	assert.Equal(t, "dir/file.aes", object)
+	assert.Equal(t, "dir/file", encrypted.FileName(object))
+
+	err = encrypted.Upload(ctx, path.Join(dir, "file"), object)
+	require.NoError(t, err)
+
+	objects, err := encrypted.List(ctx, "dir/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, object, objects[0].Name)
+
+	err = plain.Download(ctx, object, path.Join(dir, "restored"))
+	require.ErrorContains(t, err, "no encryption key is configured")
+
+	err = encrypted.Download(ctx, object, path.Join(dir, "restored"))
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path.Join(dir, "restored"))
+	require.NoError(t, err)
+	assert.Equal(t, "precious", string(content))
+
+	err = encrypted.Delete(ctx, object)
+	require.NoError(t, err)
+
+	objects, err = encrypted.List(ctx, "dir/")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+// reopeningProvider discards the first bytes of an object and stores it from a reopened reader, like a retried upload
+type reopeningProvider struct {
+	*local.BackupProviderLocal
+}
+
+func (p *reopeningProvider) PutObject(ctx context.Context, name string, reader io.Reader) error {
+	opener, ok := reader.(providers.Reopener)
+	if !ok {
+		return errors.New("reader cannot be reopened")
+	}
+
+	_, _ = io.CopyN(io.Discard, reader, 3)
+
+	rc, err := opener.Reopen()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	return p.BackupProviderLocal.PutObject(ctx, name, rc)
+}
+
+func Test_StoreUploadReopened(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+		dir = t.TempDir()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+
+	encrypter, err := encryption.New(log, &encryption.EncrypterConfig{Key: "01234567891234560123456789123456"})
+	require.NoError(t, err)
+
+	store, err := New(&StoreConfig{Log: log, BackupProvider: &reopeningProvider{BackupProviderLocal: bp}, Encrypter: encrypter})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path.Join(dir, "file"), []byte("precious"), 0600))
+
+	object := store.ObjectName("dir/file")
+
+	err = store.Upload(ctx, path.Join(dir, "file"), object)
+	require.NoError(t, err)
+
+	err = store.Download(ctx, object, path.Join(dir, "restored"))
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path.Join(dir, "restored"))
+	require.NoError(t, err)
+	assert.Equal(t, "precious", string(content))
+}
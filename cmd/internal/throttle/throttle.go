@@ -0,0 +1,99 @@
+package throttle
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxBurst is the maximum amount of bytes which are transferred at once, which keeps the throughput smooth for high limits
+	maxBurst = 1024 * 1024
+)
+
+// Limiter limits the throughput of readers and writers to a number of bytes per second.
+// a limiter can be shared by multiple readers and writers, the limit then applies to all of them together.
+// a nil limiter does not limit the throughput.
+type Limiter struct {
+	limiter *rate.Limiter
+	burst   int
+}
+
+// New returns a limiter for the given number of bytes per second, the limiter is nil if the limit is not positive
+func New(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := int(min(bytesPerSecond, maxBurst))
+
+	return &Limiter{
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+		burst:   burst,
+	}
+}
+
+// Reader returns a reader which reads from r with the throughput of the limiter
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, l: l}
+}
+
+// Writer returns a writer which writes to w with the throughput of the limiter
+func (l *Limiter) Writer(ctx context.Context, w io.Writer) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, l: l}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.l.burst {
+		p = p[:r.l.burst]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+type writer struct {
+	ctx context.Context
+	w   io.Writer
+	l   *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.l.burst)]
+
+		if err := w.l.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		limit   = int64(4096)
+		content = strings.Repeat("x", 6144)
+	)
+
+	t.Run("reader", func(t *testing.T) {
+		start := time.Now()
+
+		data, err := io.ReadAll(New(limit).Reader(ctx, strings.NewReader(content)))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+
+		// the first second is covered by the burst, the rest of the data takes half a second
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("writer", func(t *testing.T) {
+		var (
+			buf   bytes.Buffer
+			start = time.Now()
+		)
+
+		n, err := New(limit).Writer(ctx, &buf).Write([]byte(content))
+		require.NoError(t, err)
+		assert.Equal(t, len(content), n)
+		assert.Equal(t, content, buf.String())
+
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := io.ReadAll(New(limit).Reader(ctx, strings.NewReader(content)))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		var l *Limiter
+		require.Nil(t, New(0))
+
+		r := strings.NewReader(content)
+		assert.Same(t, r, l.Reader(ctx, r))
+	})
+}
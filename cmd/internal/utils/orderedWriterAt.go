@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// OrderedWriterAt is a wrapper of io.Writer, which allows parts of a stream to be written concurrently at arbitrary offsets.
+// parts which are not yet next in line are buffered in memory until all previous parts were written to the underlying writer.
+// the buffered parts are bounded by the window, writes beyond it block until the stream caught up.
+type OrderedWriterAt struct {
+	mu      sync.Mutex
+	caught  *sync.Cond
+	w       io.Writer
+	offset  int64
+	window  int64
+	pending map[int64][]byte
+	err     error
+}
+
+// NewOrderedWriterAt returns new OrderedWriterAt, which buffers parts up to window bytes ahead of the written stream.
+// a window of zero does not limit the buffered parts.
+func NewOrderedWriterAt(w io.Writer, window int64) *OrderedWriterAt {
+	o := &OrderedWriterAt{
+		w:       w,
+		window:  window,
+		pending: map[int64][]byte{},
+	}
+	o.caught = sync.NewCond(&o.mu)
+	return o
+}
+
+// WriteAt writes the given part to the underlying writer as soon as all data before the offset was written.
+// parts which were written already, e.g. by a retried request, are skipped.
+func (o *OrderedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(p)
+
+	for o.err == nil && o.window > 0 && off > o.offset && off+int64(len(p))-o.offset > o.window {
+		o.caught.Wait()
+	}
+
+	if o.err != nil {
+		return 0, o.err
+	}
+
+	if off < o.offset {
+		written := o.offset - off
+		if written >= int64(len(p)) {
+			return n, nil
+		}
+		p = p[written:]
+		off = o.offset
+	}
+
+	if off > o.offset {
+		if existing, ok := o.pending[off]; !ok || len(existing) < len(p) {
+			o.pending[off] = append([]byte(nil), p...)
+		}
+		return n, nil
+	}
+
+	err := o.write(p)
+	if err != nil {
+		return n, err
+	}
+
+	for {
+		o.dropWritten()
+
+		next, ok := o.pending[o.offset]
+		if !ok {
+			return n, nil
+		}
+		delete(o.pending, o.offset)
+
+		err := o.write(next)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func (o *OrderedWriterAt) write(p []byte) error {
+	written, err := o.w.Write(p)
+	o.offset += int64(written)
+	o.caught.Broadcast()
+	if err != nil {
+		o.err = err
+	}
+	return err
+}
+
+// dropWritten removes the pending parts which overlap with the written stream
+func (o *OrderedWriterAt) dropWritten() {
+	for off, p := range o.pending {
+		if off >= o.offset {
+			continue
+		}
+
+		delete(o.pending, off)
+
+		if rest := off + int64(len(p)) - o.offset; rest > 0 {
+			if existing, ok := o.pending[o.offset]; !ok || int64(len(existing)) < rest {
+				o.pending[o.offset] = p[int64(len(p))-rest:]
+			}
+		}
+	}
+}
+
+// Abort releases the writes waiting for the stream to catch up, all further writes return the given error
+func (o *OrderedWriterAt) Abort(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.err == nil {
+		o.err = err
+	}
+	o.caught.Broadcast()
+}
+
+// Close returns an error if there are parts left which could not be written because of a gap in the stream
+func (o *OrderedWriterAt) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.pending) > 0 {
+		return fmt.Errorf("%d parts were not written, stream is incomplete at offset %d", len(o.pending), o.offset)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (o *OrderedWriterAt) buffered() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var n int
+	for _, p := range o.pending {
+		n += len(p)
+	}
+	return n
+}
+
+func TestOrderedWriterAt_StalledPartBoundsBuffer(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		content = []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		part    = 6
+		window  = int64(3 * part)
+		o       = NewOrderedWriterAt(&buf, window)
+		wg      sync.WaitGroup
+	)
+
+	// all parts except for the first one are written while the first one is stalled
+	for off := part; off < len(content); off += part {
+		wg.Go(func() {
+			_, err := o.WriteAt(content[off:min(off+part, len(content))], int64(off))
+			assert.NoError(t, err)
+		})
+	}
+
+	assert.Eventually(t, func() bool { return o.buffered() == 2*part }, time.Second, time.Millisecond)
+	assert.Never(t, func() bool { return int64(o.buffered()) > window }, 50*time.Millisecond, time.Millisecond)
+
+	_, err := o.WriteAt(content[:part], 0)
+	require.NoError(t, err)
+
+	wg.Wait()
+
+	require.NoError(t, o.Close())
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestOrderedWriterAt_RetriedPartIsSkipped(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		o   = NewOrderedWriterAt(&buf, 0)
+	)
+
+	for _, w := range []struct {
+		p   string
+		off int64
+	}{
+		{p: "cde", off: 2},
+		{p: "ab", off: 0},
+		// the second part is requested again after reading its body failed
+		{p: "cd", off: 2},
+		{p: "cdef", off: 2},
+		{p: "gh", off: 6},
+	} {
+		n, err := o.WriteAt([]byte(w.p), w.off)
+		require.NoError(t, err)
+		require.Equal(t, len(w.p), n)
+	}
+
+	require.NoError(t, o.Close())
+	assert.Equal(t, "abcdefgh", buf.String())
+}
+
+func TestOrderedWriterAt_AbortReleasesWaitingWrites(t *testing.T) {
+	var (
+		o       = NewOrderedWriterAt(&bytes.Buffer{}, 2)
+		errPart = errors.New("part failed")
+		done    = make(chan error)
+	)
+
+	go func() {
+		_, err := o.WriteAt([]byte("cd"), 2)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("write beyond the window did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	o.Abort(errPart)
+
+	require.ErrorIs(t, <-done, errPart)
+
+	_, err := o.WriteAt([]byte("ab"), 0)
+	require.ErrorIs(t, err, errPart)
+}
@@ -0,0 +1,344 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/objectstore"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
+)
+
+const (
+	// objectPrefix is the prefix of the archived files in the object store of the backup provider
+	objectPrefix = "wal/"
+
+	partialSuffix = providers.PartialObjectSuffix
+	historySuffix = ".history"
+
+	// segmentNameLength is the length of a segment name, the timeline followed by the log and the segment number in hex
+	segmentNameLength = 24
+	timelineLength    = 8
+
+	shipInterval    = 10 * time.Second
+	cleanupInterval = time.Hour
+)
+
+// ArchiveConfig provides configuration for the Archive
+type ArchiveConfig struct {
+	Log *slog.Logger
+	// BackupProvider stores the archived files, it needs to implement the object store
+	BackupProvider providers.BackupProvider
+	// Encrypter encrypts the archived files, nil stores them unencrypted
+	Encrypter *encryption.Encrypter
+	// PartialInterval is the interval in which the segment which is currently written is archived,
+	// which bounds the amount of lost writes if the database is lost. zero only archives completed segments.
+	PartialInterval time.Duration
+	// UploadLimiter and DownloadLimiter limit the bandwidth to the backup provider, nil does not limit it
+	UploadLimiter   *throttle.Limiter
+	DownloadLimiter *throttle.Limiter
+}
+
+// Archive ships the write-ahead log of a postgres database to the backup provider and restores it for a point-in-time recovery
+type Archive struct {
+	log             *slog.Logger
+	bp              providers.BackupProvider
+	store           *objectstore.Store
+	partialInterval time.Duration
+
+	// shipped contains the modification times of the files which were archived already
+	shipped     map[string]time.Time
+	lastPartial time.Time
+}
+
+// New returns a new archive
+func New(config *ArchiveConfig) (*Archive, error) {
+	if config == nil {
+		return nil, errors.New("wal archive requires a config")
+	}
+
+	if config.PartialInterval < 0 {
+		return nil, errors.New("partial segment interval must not be negative")
+	}
+
+	store, err := objectstore.New(&objectstore.StoreConfig{
+		Log:             config.Log,
+		BackupProvider:  config.BackupProvider,
+		Encrypter:       config.Encrypter,
+		UploadLimiter:   config.UploadLimiter,
+		DownloadLimiter: config.DownloadLimiter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Archive{
+		log:             config.Log,
+		bp:              config.BackupProvider,
+		store:           store,
+		partialInterval: config.PartialInterval,
+		shipped:         map[string]time.Time{},
+	}, nil
+}
+
+// Run periodically ships the files written to dir and deletes the archived segments which are not needed anymore
+// until the context is canceled
+func (a *Archive) Run(ctx context.Context, dir string) error {
+	ticker := time.NewTicker(shipInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+
+	for {
+		err := a.Ship(ctx, dir)
+		if err != nil {
+			a.log.Error("error archiving wal segments", "error", err)
+		}
+
+		if time.Since(lastCleanup) >= cleanupInterval {
+			err := a.Cleanup(ctx)
+			if err != nil {
+				a.log.Error("error cleaning up archived wal segments", "error", err)
+			} else {
+				lastCleanup = time.Now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ship uploads the completed segments and timeline history files written to dir by pg_receivewal,
+// as well as the partial segment if the partial interval passed.
+// the completed segments except for the newest one are removed afterwards, pg_receivewal continues streaming after the newest one.
+func (a *Archive) Ship(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		segments    []string
+		shipped     = map[string]time.Time{}
+		shipPartial = a.partialInterval > 0 && time.Since(a.lastPartial) >= a.partialInterval
+	)
+
+	for _, e := range entries {
+		name := e.Name()
+
+		switch {
+		case isSegment(name):
+			segments = append(segments, name)
+		case isHistory(name):
+		case isPartial(name):
+			if !shipPartial {
+				continue
+			}
+		default:
+			continue
+		}
+
+		info, err := e.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			// partial segments are renamed once they are complete
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if modTime, ok := a.shipped[name]; ok && modTime.Equal(info.ModTime()) {
+			shipped[name] = modTime
+			continue
+		}
+
+		err = a.store.Upload(ctx, path.Join(dir, name), a.objectName(name))
+		if err != nil {
+			a.shipped = shipped
+			return err
+		}
+
+		a.log.Debug("archived wal file", "name", name)
+
+		shipped[name] = info.ModTime()
+
+		if isSegment(name) && a.partialInterval > 0 {
+			// the partial segment which was archived before is superseded by the completed segment
+			err = a.store.Delete(ctx, a.objectName(name+partialSuffix))
+			if err != nil {
+				a.log.Error("unable to delete archived partial wal segment", "name", name, "error", err)
+			}
+		}
+	}
+
+	a.shipped = shipped
+
+	if shipPartial {
+		a.lastPartial = time.Now()
+	}
+
+	slices.Sort(segments)
+
+	for _, name := range segments[:max(len(segments)-1, 0)] {
+		err := os.Remove(path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("unable to remove archived wal segment: %w", err)
+		}
+
+		delete(a.shipped, name)
+	}
+
+	return nil
+}
+
+// objectName returns the name of the archived file in the object store
+func (a *Archive) objectName(name string) string {
+	return a.store.ObjectName(objectPrefix + name)
+}
+
+// fileName returns the name of the file which is archived under the given object name
+func (a *Archive) fileName(object string) string {
+	return strings.TrimPrefix(a.store.FileName(object), objectPrefix)
+}
+
+// Restore downloads the archived segments which are required for a recovery starting at the given segment
+// and all timeline history files to dir. it returns the number of downloaded files.
+// partial segments are restored under the name of the completed segment, if the completed segment was not archived.
+func (a *Archive) Restore(ctx context.Context, dir, start string) (int, error) {
+	if !isSegment(start) {
+		return 0, fmt.Errorf("invalid wal segment name: %q", start)
+	}
+
+	objects, err := a.store.List(ctx, objectPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list archived wal files: %w", err)
+	}
+
+	var (
+		downloads = map[string]string{}
+		partials  = map[string]string{}
+	)
+
+	for _, o := range objects {
+		name := a.fileName(o.Name)
+
+		switch {
+		case isHistory(name):
+			downloads[name] = o.Name
+		case isSegment(name) && name[timelineLength:] >= start[timelineLength:]:
+			downloads[name] = o.Name
+		case isPartial(name) && name[timelineLength:segmentNameLength] >= start[timelineLength:]:
+			partials[strings.TrimSuffix(name, partialSuffix)] = o.Name
+		}
+	}
+
+	for name, object := range partials {
+		if _, ok := downloads[name]; !ok {
+			downloads[name] = object
+		}
+	}
+
+	for name, object := range downloads {
+		err := a.store.Download(ctx, object, path.Join(dir, name))
+		if err != nil {
+			return 0, err
+		}
+
+		a.log.Debug("restored archived wal file", "name", name)
+	}
+
+	return len(downloads), nil
+}
+
+// Cleanup deletes the archived segments which were archived before the oldest backup was taken,
+// these are not required for a recovery anymore. pinned backups are not considered.
+func (a *Archive) Cleanup(ctx context.Context) error {
+	versions, err := a.bp.ListBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	backups := common.Unpinned(versions.List())
+	if len(backups) == 0 {
+		return nil
+	}
+
+	var (
+		oldest = backups[len(backups)-1]
+		before = oldest.Date
+	)
+
+	// the date of the manifest is the time the backup was started, which is earlier than the date of the uploaded backup
+	manifest, err := a.bp.DownloadManifest(ctx, oldest)
+	if err != nil && !errors.Is(err, providers.ErrManifestNotFound) {
+		return err
+	}
+	if err == nil && !manifest.Date.IsZero() {
+		before = manifest.Date
+	}
+
+	objects, err := a.store.List(ctx, objectPrefix)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, o := range objects {
+		// history files are tiny and required to follow the timelines
+		if isHistory(a.fileName(o.Name)) || !o.Date.Before(before) {
+			continue
+		}
+
+		a.log.Debug("deleting expired archived wal file", "name", o.Name, "date", o.Date.String())
+
+		err := a.store.Delete(ctx, o.Name)
+		if errors.Is(err, providers.ErrObjectLocked) {
+			a.log.Debug("archived wal file is still locked, deleting it later", "name", o.Name)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isSegment returns true if the given name is the name of a completed segment, e.g. 000000010000000000000001
+func isSegment(name string) bool {
+	return len(name) == segmentNameLength && isHex(name)
+}
+
+// isPartial returns true if the given name is the name of a segment which is still written by pg_receivewal
+func isPartial(name string) bool {
+	segment, found := strings.CutSuffix(name, partialSuffix)
+	return found && isSegment(segment)
+}
+
+// isHistory returns true if the given name is the name of a timeline history file, e.g. 00000002.history
+func isHistory(name string) bool {
+	timeline, found := strings.CutSuffix(name, historySuffix)
+	return found && len(timeline) == timelineLength && isHex(timeline)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,207 @@
+package wal
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/encryption"
+)
+
+func Test_Archive(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	for _, encrypted := range []bool{false, true} {
+		t.Run("encrypted "+map[bool]string{false: "no", true: "yes"}[encrypted], func(t *testing.T) {
+			bp, err := local.New(log, &local.BackupProviderConfigLocal{
+				FS:     afero.NewMemMapFs(),
+				Suffix: ".tar.gz",
+			})
+			require.NoError(t, err)
+
+			config := &ArchiveConfig{
+				Log:             log,
+				BackupProvider:  bp,
+				PartialInterval: time.Nanosecond,
+			}
+			if encrypted {
+				config.Encrypter, err = encryption.New(log, &encryption.EncrypterConfig{Key: "01234567891234560123456789123456"})
+				require.NoError(t, err)
+			}
+
+			a, err := New(config)
+			require.NoError(t, err)
+
+			dir := t.TempDir()
+			for _, name := range []string{
+				"000000010000000000000001",
+				"000000010000000000000002",
+				"000000010000000000000003",
+				"00000002.history",
+				"000000020000000000000004.partial",
+				"unrelated",
+			} {
+				require.NoError(t, os.WriteFile(path.Join(dir, name), []byte("content of "+name), 0600))
+			}
+
+			err = a.Ship(ctx, dir)
+			require.NoError(t, err)
+
+			objects, err := bp.ListObjects(ctx, objectPrefix)
+			require.NoError(t, err)
+			assert.Len(t, objects, 5)
+
+			// pg_receivewal continues after the newest completed segment
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			var remaining []string
+			for _, e := range entries {
+				remaining = append(remaining, e.Name())
+			}
+			assert.ElementsMatch(t, []string{"000000010000000000000003", "00000002.history", "000000020000000000000004.partial", "unrelated"}, remaining)
+
+			// the completed segment supersedes the archived partial segment
+			require.NoError(t, os.Remove(path.Join(dir, "000000020000000000000004.partial")))
+			require.NoError(t, os.WriteFile(path.Join(dir, "000000020000000000000004"), []byte("content of 000000020000000000000004"), 0600))
+
+			err = a.Ship(ctx, dir)
+			require.NoError(t, err)
+
+			objects, err = bp.ListObjects(ctx, objectPrefix)
+			require.NoError(t, err)
+			assert.Len(t, objects, 5)
+			for _, o := range objects {
+				assert.NotContains(t, o.Name, partialSuffix)
+			}
+
+			restoreDir := t.TempDir()
+
+			n, err := a.Restore(ctx, restoreDir, "000000010000000000000002")
+			require.NoError(t, err)
+			assert.Equal(t, 4, n)
+
+			for _, name := range []string{"000000010000000000000002", "000000010000000000000003", "00000002.history", "000000020000000000000004"} {
+				content, err := os.ReadFile(path.Join(restoreDir, name))
+				require.NoError(t, err)
+				assert.Equal(t, "content of "+name, string(content))
+			}
+
+			_, err = os.Stat(path.Join(restoreDir, "000000010000000000000001"))
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+func Test_ArchiveRestorePartial(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+
+	a, err := New(&ArchiveConfig{Log: log, BackupProvider: bp, PartialInterval: time.Minute})
+	require.NoError(t, err)
+
+	require.NoError(t, bp.PutObject(ctx, "wal/000000010000000000000001", strings.NewReader("segment")))
+	require.NoError(t, bp.PutObject(ctx, "wal/000000010000000000000002.partial", strings.NewReader("partial segment")))
+
+	dir := t.TempDir()
+
+	n, err := a.Restore(ctx, dir, "000000010000000000000001")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	content, err := os.ReadFile(path.Join(dir, "000000010000000000000002"))
+	require.NoError(t, err)
+	assert.Equal(t, "partial segment", string(content))
+
+	_, err = a.Restore(ctx, dir, "invalid")
+	require.ErrorContains(t, err, "invalid wal segment name")
+}
+
+func Test_ArchiveCleanup(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	bp, err := local.New(log, &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+
+	a, err := New(&ArchiveConfig{Log: log, BackupProvider: bp})
+	require.NoError(t, err)
+
+	for _, name := range []string{"wal/000000010000000000000001", "wal/00000002.history"} {
+		require.NoError(t, bp.PutObject(ctx, name, strings.NewReader(name)))
+	}
+
+	// without backups the archived segments are required to recover
+	err = a.Cleanup(ctx)
+	require.NoError(t, err)
+
+	objects, err := bp.ListObjects(ctx, objectPrefix)
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	err = bp.UploadBackup(ctx, strings.NewReader("backup"), &providers.Manifest{Date: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	err = a.Cleanup(ctx)
+	require.NoError(t, err)
+
+	objects, err = bp.ListObjects(ctx, objectPrefix)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "wal/00000002.history", objects[0].Name)
+}
+
+// lockedProvider reports objects as locked instead of deleting them
+type lockedProvider struct {
+	*local.BackupProviderLocal
+}
+
+func (p *lockedProvider) DeleteObject(_ context.Context, _ string) error {
+	return providers.ErrObjectLocked
+}
+
+func Test_ArchiveCleanupLocked(t *testing.T) {
+	var (
+		ctx = context.Background()
+		log = slog.Default()
+	)
+
+	lp, err := local.New(log, &local.BackupProviderConfigLocal{FS: afero.NewMemMapFs()})
+	require.NoError(t, err)
+	bp := &lockedProvider{BackupProviderLocal: lp}
+
+	a, err := New(&ArchiveConfig{Log: log, BackupProvider: bp})
+	require.NoError(t, err)
+
+	require.NoError(t, bp.PutObject(ctx, "wal/000000010000000000000001", strings.NewReader("segment")))
+
+	err = bp.UploadBackup(ctx, strings.NewReader("backup"), &providers.Manifest{Date: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	// locked segments are deleted by a later cleanup once their retention period ended
+	err = a.Cleanup(ctx)
+	require.NoError(t, err)
+
+	objects, err := bp.ListObjects(ctx, objectPrefix)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+}
@@ -4,25 +4,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	v1 "github.com/metal-stack/backup-restore-sidecar/api/v1"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/azure"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/common"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/gcp"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/local"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/multi"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/retry"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/s3"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/backup/providers/sftp"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/compress"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/copier"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/etcd"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/localfs"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/mongodb"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/mysql"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/postgres"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/redis"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/database/rethinkdb"
@@ -30,8 +44,10 @@ import (
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/initializer"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/metrics"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/probe"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/throttle"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/utils"
 	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/wait"
+	"github.com/metal-stack/backup-restore-sidecar/cmd/internal/wal"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/client"
 	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
 	"github.com/metal-stack/v"
@@ -55,10 +71,24 @@ const (
 	preExecCommandsFlg  = "pre-exec-cmds"
 	postExecCommandsFlg = "post-exec-cmds"
 
-	postgresUserFlg     = "postgres-user"
-	postgresHostFlg     = "postgres-host"
-	postgresPasswordFlg = "postgres-password"
-	postgresPortFlg     = "postgres-port"
+	postgresUserFlg            = "postgres-user"
+	postgresHostFlg            = "postgres-host"
+	postgresPasswordFlg        = "postgres-password"
+	postgresPortFlg            = "postgres-port"
+	postgresBackupModeFlg      = "postgres-backup-mode"
+	postgresDumpJobsFlg        = "postgres-dump-jobs"
+	postgresRestoreDatabaseFlg = "postgres-restore-database"
+
+	postgresFullBackupIntervalFlg = "postgres-full-backup-interval"
+	postgresWALArchivingFlg       = "postgres-wal-archiving"
+	postgresWALPartialIntervalFlg = "postgres-wal-partial-interval"
+
+	mysqlUserFlg     = "mysql-user"
+	mysqlHostFlg     = "mysql-host"
+	mysqlPasswordFlg = "mysql-password"
+	mysqlPortFlg     = "mysql-port"
+
+	mongodbURIFlg = "mongodb-uri"
 
 	redisAddrFlg     = "redis-addr"
 	redisPasswordFlg = "redis-password"
@@ -73,18 +103,50 @@ const (
 	etcdName      = "etcd-name"
 
 	backupProviderFlg     = "backup-provider"
+	fallbackToleranceFlg  = "backup-provider-fallback-tolerance"
 	backupCronScheduleFlg = "backup-cron-schedule"
 
 	objectsToKeepFlg    = "object-max-keep"
 	objectDaysToKeepFlg = "object-days-max-keep"
 	objectPrefixFlg     = "object-prefix"
 
+	retentionHourlyFlg  = "retention-hourly"
+	retentionDailyFlg   = "retention-daily"
+	retentionWeeklyFlg  = "retention-weekly"
+	retentionMonthlyFlg = "retention-monthly"
+	retentionYearlyFlg  = "retention-yearly"
+
+	retryAttemptsFlg = "retry-attempts"
+	retryDelayFlg    = "retry-delay"
+	retryMaxDelayFlg = "retry-max-delay"
+	retrySpoolFlg    = "retry-spool-uploads"
+
+	streamRestoreFlg = "stream-restore"
+
+	uploadRateLimitFlg   = "upload-rate-limit"
+	downloadRateLimitFlg = "download-rate-limit"
+	archiveRateLimitFlg  = "archive-rate-limit"
+
 	localBackupPathFlg = "local-provider-backup-path"
 
 	gcpBucketNameFlg     = "gcp-bucket-name"
 	gcpBucketLocationFlg = "gcp-bucket-location"
 	gcpProjectFlg        = "gcp-project"
 
+	azureContainerNameFlg = "azure-container-name"
+	azureAccountNameFlg   = "azure-account-name"
+	azureAccountKeyFlg    = "azure-account-key"
+	azureEndpointFlg      = "azure-endpoint"
+
+	sftpHostFlg                 = "sftp-host"
+	sftpUserFlg                 = "sftp-user"
+	sftpPasswordFlg             = "sftp-password"
+	sftpPrivateKeyFlg           = "sftp-private-key"
+	sftpPrivateKeyPassphraseFlg = "sftp-private-key-passphrase"
+	sftpHostKeyFlg              = "sftp-host-key"
+	sftpInsecureIgnoreHostKey   = "sftp-insecure-ignore-host-key"
+	sftpBasePathFlg             = "sftp-base-path"
+
 	s3BucketNameFlg = "s3-bucket-name"
 	s3RegionFlg     = "s3-region"
 	s3EndpointFlg   = "s3-endpoint"
@@ -94,12 +156,39 @@ const (
 	s3InsecureSkipVerify         = "s3-insecure-skip-verify"
 	s3TrustedCaCert              = "s3-trusted-ca-cert"
 	s3RequestChecksumCalculation = "s3-request-checksum-calculation"
+	s3DisableVersioning          = "s3-disable-versioning"
+	s3DownloadConcurrency        = "s3-download-concurrency"
+	s3CredentialsMode            = "s3-credentials-mode"
+	s3RoleARN                    = "s3-role-arn"
+	s3WebIdentityTokenFile       = "s3-web-identity-token-file"
+	s3CredentialsFile            = "s3-credentials-file"
+	s3Profile                    = "s3-profile"
+	s3SSEMode                    = "s3-sse-mode"
+	s3SSEKMSKeyID                = "s3-sse-kms-key-id"
+	s3SSECustomerKeyFile         = "s3-sse-customer-key-file"
+	s3ObjectLockMode             = "s3-object-lock-mode"
+	s3ObjectLockRetentionDays    = "s3-object-lock-retention-days"
+	s3DownloadPartSize           = "s3-download-part-size"
 
 	compressionMethod = "compression-method"
 
 	encryptionKeyFlg = "encryption-key"
 
+	podNameFlg      = "pod-name"
+	podNamespaceFlg = "pod-namespace"
+
 	downloadOutputFlg = "output"
+
+	copyFromConfigFlg = "from-config"
+	copyToConfigFlg   = "to-config"
+
+	listFromFlg     = "from"
+	listToFlg       = "to"
+	listPageSizeFlg = "page-size"
+
+	recoveryTargetTimeFlg = "recovery-target-time"
+	recoveryTargetLSNFlg  = "recovery-target-lsn"
+	recoveryTargetNameFlg = "recovery-target-name"
 )
 
 var (
@@ -110,6 +199,9 @@ var (
 	encrypter  *encryption.Encrypter
 	compressor *compress.Compressor
 	stop       context.Context
+
+	uploadLimiter   *throttle.Limiter
+	downloadLimiter *throttle.Limiter
 )
 
 var rootCmd = &cobra.Command{
@@ -136,10 +228,14 @@ var startCmd = &cobra.Command{
 		if err := initEncrypter(); err != nil {
 			return err
 		}
+		initLimiters()
 		if err := initCompressor(); err != nil {
 			return err
 		}
-		return initBackupProvider()
+		if err := initBackupProvider(); err != nil {
+			return err
+		}
+		return initPostgres()
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		for _, cmd := range viper.GetStringSlice(preExecCommandsFlg) {
@@ -160,17 +256,28 @@ var startCmd = &cobra.Command{
 		metrics := metrics.New()
 		metrics.Start(logger.WithGroup("metrics"))
 
+		podName, podNamespace := podIdentity()
+
 		backuper := backup.New(&backup.BackuperConfig{
 			Log:            logger.WithGroup("backup"),
 			BackupSchedule: viper.GetString(backupCronScheduleFlg),
+			DatabaseType:   viper.GetString(databaseFlg),
 			DatabaseProber: db,
 			BackupProvider: bp,
 			Metrics:        metrics,
 			Compressor:     compressor,
 			Encrypter:      encrypter,
+			PodName:        podName,
+			PodNamespace:   podNamespace,
+			UploadLimiter:  uploadLimiter,
 		})
 
-		if err := initializer.New(logger.WithGroup("initializer"), addr, db, bp, compressor, metrics, viper.GetString(databaseDatadirFlg), encrypter).Start(stop, backuper); err != nil {
+		i := initializer.New(logger.WithGroup("initializer"), addr, db, bp, compressor, metrics, viper.GetString(databaseDatadirFlg), encrypter, downloadLimiter)
+		if viper.GetBool(streamRestoreFlg) {
+			i.SetSpoolDir("")
+		}
+
+		if err := i.Start(stop, backuper); err != nil {
 			return err
 		}
 
@@ -178,7 +285,22 @@ var startCmd = &cobra.Command{
 			return err
 		}
 
-		return backuper.Start(stop)
+		pg, ok := db.(*postgres.Postgres)
+		if !ok {
+			return backuper.Start(stop)
+		}
+
+		g, ctx := errgroup.WithContext(stop)
+
+		g.Go(func() error {
+			return pg.ArchiveWAL(ctx)
+		})
+
+		g.Go(func() error {
+			return backuper.Start(ctx)
+		})
+
+		return g.Wait()
 	},
 }
 
@@ -215,13 +337,111 @@ var restoreCmd = &cobra.Command{
 			return fmt.Errorf("error creating client: %w", err)
 		}
 
-		_, err = c.BackupServiceClient().RestoreBackup(cmd.Context(), &v1.RestoreBackupRequest{
+		req := &v1.RestoreBackupRequest{
+			Version: args[0],
+		}
+		if viper.IsSet(recoveryTargetTimeFlg) || viper.IsSet(recoveryTargetLSNFlg) || viper.IsSet(recoveryTargetNameFlg) {
+			req.RecoveryTarget = &v1.RecoveryTarget{
+				Time: viper.GetString(recoveryTargetTimeFlg),
+				Lsn:  viper.GetString(recoveryTargetLSNFlg),
+				Name: viper.GetString(recoveryTargetNameFlg),
+			}
+		}
+
+		_, err = c.BackupServiceClient().RestoreBackup(cmd.Context(), req)
+		return err
+	},
+}
+
+var deleteBackupCmd = &cobra.Command{
+	Use:   "delete <version>",
+	Short: "deletes a specific backup",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("no version argument given")
+		}
+
+		c, err := client.New(cmd.Context(), viper.GetString(serverAddrFlg))
+		if err != nil {
+			return fmt.Errorf("error creating client: %w", err)
+		}
+
+		_, err = c.BackupServiceClient().DeleteBackup(cmd.Context(), &v1.DeleteBackupRequest{
 			Version: args[0],
 		})
 		return err
 	},
 }
 
+var pinBackupCmd = &cobra.Command{
+	Use:   "pin <version>",
+	Short: "pins a specific backup such that it is never removed by the retention",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("no version argument given")
+		}
+
+		c, err := client.New(cmd.Context(), viper.GetString(serverAddrFlg))
+		if err != nil {
+			return fmt.Errorf("error creating client: %w", err)
+		}
+
+		resp, err := c.BackupServiceClient().PinBackup(cmd.Context(), &v1.PinBackupRequest{
+			Version: args[0],
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("pinned backup as version %s\n", resp.GetBackup().GetVersion())
+
+		return nil
+	},
+}
+
+var copyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "copies all backups from one backup provider to another",
+	Long:  "copies the backups together with their manifests from the backup provider configured in --from-config to the one configured in --to-config, either side defaults to the configuration of the sidecar. the objects referenced by the backups, like the base backups of postgres backup chains and the archived write-ahead log, are copied as well. backups which are already present at the destination are skipped. the providers are accessed directly, so no running sidecar is required.",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		initSignalHandlers()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from := viper.GetString(copyFromConfigFlg)
+		to := viper.GetString(copyToConfigFlg)
+		if from == "" && to == "" {
+			return fmt.Errorf("at least one of --%s and --%s must be given", copyFromConfigFlg, copyToConfigFlg)
+		}
+
+		fromConfig, err := providerConfig(from)
+		if err != nil {
+			return err
+		}
+		toConfig, err := providerConfig(to)
+		if err != nil {
+			return err
+		}
+
+		// the suffix is only used for uploads, the destination is initialized with the suffix of every copied backup
+		source, err := newBackupProviders(fromConfig, "")
+		if err != nil {
+			return err
+		}
+
+		c, err := copier.New(logger.WithGroup("copy"), &copier.CopierConfig{
+			Source: source,
+			Destination: func(suffix string) (providers.BackupProvider, error) {
+				return newBackupProviders(toConfig, suffix)
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Copy(stop)
+	},
+}
+
 var restoreListCmd = &cobra.Command{
 	Use:     "list-versions",
 	Aliases: []string{"ls"},
@@ -232,18 +452,70 @@ var restoreListCmd = &cobra.Command{
 			return fmt.Errorf("error creating client: %w", err)
 		}
 
-		backups, err := c.BackupServiceClient().ListBackups(cmd.Context(), &v1.ListBackupsRequest{})
-		if err != nil {
-			return fmt.Errorf("error listing backups: %w", err)
+		req := &v1.ListBackupsRequest{
+			PageSize: viper.GetInt32(listPageSizeFlg),
+		}
+		if from := viper.GetString(listFromFlg); from != "" {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				return fmt.Errorf("unable to parse %s: %w", listFromFlg, err)
+			}
+			req.From = timestamppb.New(t)
+		}
+		if to := viper.GetString(listToFlg); to != "" {
+			t, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				return fmt.Errorf("unable to parse %s: %w", listToFlg, err)
+			}
+			req.To = timestamppb.New(t)
+		}
+
+		var backups []*v1.Backup
+		for {
+			resp, err := c.BackupServiceClient().ListBackups(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("error listing backups: %w", err)
+			}
+
+			backups = append(backups, resp.GetBackups()...)
+
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
 		}
 
+		// the backups are listed oldest first with the pinned copies at the end, the newest backups are shown first
+		slices.SortStableFunc(backups, func(a, b *v1.Backup) int {
+			return b.GetTimestamp().AsTime().Compare(a.GetTimestamp().AsTime())
+		})
+
 		var data [][]string
-		for _, b := range backups.GetBackups() {
-			data = append(data, []string{b.GetTimestamp().AsTime().String(), b.GetName(), b.GetVersion()})
+		for _, b := range backups {
+			var (
+				m   = b.GetManifest()
+				row = []string{b.GetTimestamp().AsTime().String(), b.GetName(), b.GetVersion()}
+			)
+			if m == nil {
+				// backups of former versions have no manifest
+				data = append(data, append(row, "", "", "", "", "", "", "", ""))
+				continue
+			}
+
+			data = append(data, append(row,
+				strings.TrimSpace(m.GetDatabaseType()+" "+m.GetDatabaseVersion()),
+				m.GetCompressionMethod(),
+				strconv.FormatInt(m.GetCompressedSize(), 10),
+				strconv.FormatInt(m.GetUncompressedSize(), 10),
+				m.GetEncryptionKeyFingerprint(),
+				m.GetSha256(),
+				m.GetSidecarVersion(),
+				strings.Trim(m.GetNamespace()+"/"+m.GetPod(), "/"),
+			))
 		}
 
 		p := utils.NewTablePrinter()
-		err = p.Print([]string{"Date", "Name", "Version"}, data)
+		err = p.Print([]string{"Date", "Name", "Version", "Database", "Compression", "Size", "Uncompressed Size", "Key", "SHA256", "Sidecar", "Pod"}, data)
 		return err
 	},
 }
@@ -301,28 +573,58 @@ var downloadBackupCmd = &cobra.Command{
 
 		output := viper.GetString(downloadOutputFlg)
 
-		outputPath := filepath.Join(output, backup.GetBackup().GetName())
-		outputFile, err := os.Open(outputPath)
+		version := &providers.BackupVersion{
+			Name:    backup.GetBackup().GetName(),
+			Version: backup.GetBackup().GetVersion(),
+			Date:    backup.GetBackup().GetTimestamp().AsTime(),
+		}
+
+		decrypt := encrypter != nil && encryption.IsEncrypted(version.Name)
+		if encrypter != nil && !decrypt {
+			logger.Info("downloading unencrypted backup with configured encryption - skipping decryption...")
+		}
+
+		outputPath := filepath.Join(output, filepath.Base(version.Name))
+		if decrypt {
+			outputPath = strings.TrimSuffix(outputPath, encrypter.Extension())
+		}
+
+		outputFile, err := os.Create(outputPath)
 		if err != nil {
 			return fmt.Errorf("failed opening output file: %w", err)
 		}
+		defer func() {
+			_ = outputFile.Close()
+		}()
 
-		err = bp.DownloadBackup(cmd.Context(), &providers.BackupVersion{Name: backup.GetBackup().GetName()}, outputFile)
+		if !decrypt {
+			err = bp.DownloadBackup(cmd.Context(), version, outputFile)
+			if err != nil {
+				return fmt.Errorf("failed downloading backup: %w", err)
+			}
+			return nil
+		}
 
+		pr, pw := io.Pipe()
+		go func() {
+			_ = pw.CloseWithError(bp.DownloadBackup(cmd.Context(), version, pw))
+		}()
+
+		decrypted, err := encrypter.Decrypt(pr, output)
 		if err != nil {
-			return fmt.Errorf("failed downloading backup: %w", err)
+			_ = pr.CloseWithError(err)
+			return fmt.Errorf("unable to decrypt backup: %w", err)
 		}
+		defer func() {
+			_ = decrypted.Close()
+		}()
 
-		if encrypter != nil {
-			if encryption.IsEncrypted(outputPath) {
-				_, err = encrypter.Decrypt(outputPath)
-				if err != nil {
-					return fmt.Errorf("unable to decrypt backup: %w", err)
-				}
-			} else {
-				logger.Info("downloading unencrypted backup with configured encryption - skipping decryption...")
-			}
+		_, err = io.Copy(outputFile, decrypted)
+		if err != nil {
+			_ = pr.CloseWithError(err)
+			return fmt.Errorf("failed downloading backup: %w", err)
 		}
+
 		return nil
 	},
 }
@@ -338,10 +640,10 @@ func main() {
 }
 
 func init() {
-	rootCmd.AddCommand(startCmd, waitCmd, restoreCmd, createBackupCmd, downloadBackupCmd)
+	rootCmd.AddCommand(startCmd, waitCmd, restoreCmd, createBackupCmd, downloadBackupCmd, deleteBackupCmd, pinBackupCmd, copyCmd)
 
 	rootCmd.PersistentFlags().StringP(logLevelFlg, "", "info", "sets the application log level")
-	rootCmd.PersistentFlags().StringP(databaseFlg, "", "", "the kind of the database [postgres|rethinkdb|etcd|redis|keydb|valkey|localfs]")
+	rootCmd.PersistentFlags().StringP(databaseFlg, "", "", "the kind of the database [postgres|mysql|mariadb|mongodb|rethinkdb|etcd|redis|keydb|valkey|localfs]")
 	rootCmd.PersistentFlags().StringP(databaseDatadirFlg, "", "", "the directory where the database stores its data in")
 
 	err := viper.BindPFlags(rootCmd.PersistentFlags())
@@ -359,6 +661,19 @@ func init() {
 	startCmd.Flags().StringP(postgresHostFlg, "", "127.0.0.1", "the postgres database address (will be used when db is postgres)")
 	startCmd.Flags().IntP(postgresPortFlg, "", 5432, "the postgres database port (will be used when db is postgres)")
 	startCmd.Flags().StringP(postgresPasswordFlg, "", "", "the postgres database password (will be used when db is postgres)")
+	startCmd.Flags().StringP(postgresBackupModeFlg, "", postgres.BackupModePhysical, "the kind of postgres backups, physical base backups or logical dumps which can be restored into other major versions (physical|logical)")
+	startCmd.Flags().IntP(postgresDumpJobsFlg, "", 1, "the number of tables which are dumped and restored in parallel in logical postgres backup mode")
+	startCmd.Flags().StringP(postgresRestoreDatabaseFlg, "", "", "if set, only the global objects and this database are restored from a logical postgres backup")
+	startCmd.Flags().DurationP(postgresFullBackupIntervalFlg, "", 0, "the interval in which a full base backup is taken, the backups in between are incremental, requires postgres 17 with summarize_wal enabled, 0 only takes full backups")
+	startCmd.Flags().BoolP(postgresWALArchivingFlg, "", false, "continuously archives the write-ahead log to the backup provider and replays it on recovery, requires the physical postgres backup mode")
+	startCmd.Flags().DurationP(postgresWALPartialIntervalFlg, "", time.Minute, "the interval in which the write-ahead log segment which is currently written is archived, 0 only archives completed segments")
+
+	startCmd.Flags().StringP(mysqlUserFlg, "", "root", "the mysql database user (will be used when db is mysql or mariadb)")
+	startCmd.Flags().StringP(mysqlHostFlg, "", "127.0.0.1", "the mysql database address (will be used when db is mysql or mariadb)")
+	startCmd.Flags().IntP(mysqlPortFlg, "", 3306, "the mysql database port (will be used when db is mysql or mariadb)")
+	startCmd.Flags().StringP(mysqlPasswordFlg, "", "", "the mysql database password (will be used when db is mysql or mariadb)")
+
+	startCmd.Flags().StringP(mongodbURIFlg, "", "mongodb://127.0.0.1:27017/?directConnection=true", "the mongodb connection string including the credentials (will be used when db is mongodb)")
 
 	startCmd.Flags().StringP(rethinkDBURLFlg, "", "localhost:28015", "the rethinkdb database url (will be used when db is rethinkdb)")
 	startCmd.Flags().StringP(rethinkDBPasswordFileFlg, "", "", "the rethinkdb database password file path (will be used when db is rethinkdb)")
@@ -369,27 +684,75 @@ func init() {
 	startCmd.Flags().StringP(etcdEndpoints, "", "http://localhost:2379", "URL to connect to ETCD with V3 protocol (optional)")
 	startCmd.Flags().StringP(etcdName, "", "", "name of the ETCD to connect to (optional)")
 
-	startCmd.Flags().StringP(backupProviderFlg, "", "", "the name of the backup provider [gcp|s3|local]")
+	startCmd.Flags().StringP(backupProviderFlg, "", "", "the name of the backup provider [gcp|s3|azure|sftp|local], multiple providers can be given comma-separated to replicate backups, e.g. s3,gcp")
+	startCmd.Flags().DurationP(fallbackToleranceFlg, "", multi.DefaultFallbackTolerance, "the maximum difference between the dates of corresponding backups at multiple backup providers, a restore only falls back to a backup of the next provider within this tolerance")
 	startCmd.Flags().StringP(backupCronScheduleFlg, "", "*/3 * * * *", "cron schedule for taking backups periodically")
 
 	startCmd.Flags().IntP(objectsToKeepFlg, "", constants.DefaultObjectsToKeep, "the number of objects to keep at the cloud provider bucket")
 	startCmd.Flags().StringP(objectPrefixFlg, "", "", "the prefix to store the object in the cloud provider bucket")
 
+	startCmd.Flags().IntP(retentionHourlyFlg, "", 0, "the number of hours for which the newest backup is kept, enables the tiered retention instead of object-max-keep")
+	startCmd.Flags().IntP(retentionDailyFlg, "", 0, "the number of days for which the newest backup is kept, enables the tiered retention instead of object-max-keep")
+	startCmd.Flags().IntP(retentionWeeklyFlg, "", 0, "the number of weeks for which the newest backup is kept, enables the tiered retention instead of object-max-keep")
+	startCmd.Flags().IntP(retentionMonthlyFlg, "", 0, "the number of months for which the newest backup is kept, enables the tiered retention instead of object-max-keep")
+	startCmd.Flags().IntP(retentionYearlyFlg, "", 0, "the number of years for which the newest backup is kept, enables the tiered retention instead of object-max-keep")
+
+	startCmd.Flags().UintP(retryAttemptsFlg, "", 3, "the maximum number of attempts of a transiently failing download or listing at the backup provider, 1 disables retries")
+	startCmd.Flags().DurationP(retryDelayFlg, "", time.Second, "the delay before the first retry of a failed backup provider operation, which is doubled for every further retry")
+	startCmd.Flags().DurationP(retryMaxDelayFlg, "", 30*time.Second, "the maximum delay between two retries of a failed backup provider operation")
+	startCmd.Flags().BoolP(retrySpoolFlg, "", false, "buffers the compressed archive on the backup volume while it is uploaded such that a failed upload can be retried as a whole, requires disk space for the whole archive")
+
+	startCmd.Flags().BoolP(streamRestoreFlg, "", false, "decrypts and uncompresses a backup while it is downloaded instead of verifying its checksum first, which saves the disk space for the compressed backup, but unpacks a corrupt backup before its checksum is verified")
+
+	startCmd.Flags().StringP(uploadRateLimitFlg, "", "", "the maximum bandwidth per second for uploading backups to the backup provider, e.g. 10mb, unlimited if not set")
+	startCmd.Flags().StringP(downloadRateLimitFlg, "", "", "the maximum bandwidth per second for downloading backups from the backup provider, e.g. 10mb, unlimited if not set")
+	startCmd.Flags().StringP(archiveRateLimitFlg, "", "", "the maximum throughput per second for reading the files to archive and writing the restored files, e.g. 50mb, unlimited if not set")
+
 	startCmd.Flags().StringP(gcpBucketNameFlg, "", "", "the name of the gcp backup bucket")
 	startCmd.Flags().StringP(gcpBucketLocationFlg, "", "", "the location of the gcp backup bucket")
 	startCmd.Flags().StringP(gcpProjectFlg, "", "", "the project id to place the gcp backup bucket in")
 
+	startCmd.Flags().StringP(azureContainerNameFlg, "", "", "the name of the azure blob storage container")
+	startCmd.Flags().StringP(azureAccountNameFlg, "", "", "the name of the azure storage account")
+	startCmd.Flags().StringP(azureAccountKeyFlg, "", "", "the access key of the azure storage account")
+	startCmd.Flags().StringP(azureEndpointFlg, "", "", "the url to the azure blob storage endpoint, defaults to https://<account-name>.blob.core.windows.net/")
+
+	startCmd.Flags().StringP(sftpHostFlg, "", "", "the address of the sftp host, the port defaults to 22")
+	startCmd.Flags().StringP(sftpUserFlg, "", "", "the user to log in to the sftp host")
+	startCmd.Flags().StringP(sftpPasswordFlg, "", "", "the password to log in to the sftp host")
+	startCmd.Flags().StringP(sftpPrivateKeyFlg, "", "", "the pem encoded private key to log in to the sftp host")
+	startCmd.Flags().StringP(sftpPrivateKeyPassphraseFlg, "", "", "the passphrase of the sftp private key (optional)")
+	startCmd.Flags().StringP(sftpHostKeyFlg, "", "", "the public key of the sftp host in authorized_keys format, connections to hosts with other keys are refused")
+	startCmd.Flags().BoolP(sftpInsecureIgnoreHostKey, "", false, "skips the verification of the sftp host key, only use this for testing")
+	startCmd.Flags().StringP(sftpBasePathFlg, "", "", "the directory on the sftp host in which the backups are stored")
+
 	startCmd.Flags().StringP(s3BucketNameFlg, "", "", "the name of the s3 backup bucket")
 	startCmd.Flags().StringP(s3RegionFlg, "", "", "the region of the s3 backup bucket")
 	startCmd.Flags().StringP(s3EndpointFlg, "", "", "the url to the s3 endpoint")
 	startCmd.Flags().StringP(s3AccessKeyFlg, "", "", "the s3 access-key-id")
 	startCmd.Flags().StringP(s3SecretKeyFlg, "", "", "the s3 secret-key-id")
+	startCmd.Flags().StringP(s3CredentialsMode, "", s3.CredentialsModeStatic, "the way s3 credentials are obtained (static|default-chain|web-identity|file)")
+	startCmd.Flags().StringP(s3RoleARN, "", "", "the arn of the role to assume with credentials mode web-identity, defaults to AWS_ROLE_ARN")
+	startCmd.Flags().StringP(s3WebIdentityTokenFile, "", "", "the path to the web identity token with credentials mode web-identity, defaults to AWS_WEB_IDENTITY_TOKEN_FILE")
+	startCmd.Flags().StringP(s3CredentialsFile, "", "", "the path to the shared credentials file with credentials mode file")
+	startCmd.Flags().StringP(s3Profile, "", "", "the profile of the shared credentials file with credentials mode file, defaults to default")
 	startCmd.Flags().StringP(s3RequestChecksumCalculation, "", "", "the s3 request checksum calculation (when_required|when_supported)")
+	startCmd.Flags().StringP(s3SSEMode, "", "", "enables server-side encryption of backups at s3 (sse-s3|sse-kms|sse-c)")
+	startCmd.Flags().StringP(s3SSEKMSKeyID, "", "", "the id of the kms key used with sse-kms, defaults to the s3 managed kms key")
+	startCmd.Flags().StringP(s3SSECustomerKeyFile, "", "", "the path to the 32 byte key used with sse-c, raw or base64 encoded")
+	startCmd.Flags().StringP(s3ObjectLockMode, "", "", "creates the s3 bucket with object lock and protects every backup from deletion (governance|compliance)")
+	startCmd.Flags().Int32P(s3ObjectLockRetentionDays, "", 0, "the number of days a backup is protected from deletion with object lock")
+	startCmd.Flags().IntP(s3DownloadConcurrency, "", 0, "the number of parts of a backup which are downloaded in parallel from s3, defaults to 5")
+	startCmd.Flags().StringP(s3DownloadPartSize, "", "", "the size of a single part of a backup which is downloaded from s3, e.g. 16mb, defaults to 5mb")
+	startCmd.Flags().BoolP(s3DisableVersioning, "", false, "store every backup with a timestamped object key instead of using bucket versioning, for s3 implementations without versioning support")
 
 	startCmd.Flags().StringP(compressionMethod, "", "targz", "the compression method to use to compress the backups (tar|targz|tarlz4)")
 
 	startCmd.Flags().StringP(encryptionKeyFlg, "", "", "the encryption key for aes")
 
+	startCmd.Flags().StringP(podNameFlg, "", "", "the name of the pod recorded in the backup manifests, defaults to the hostname")
+	startCmd.Flags().StringP(podNamespaceFlg, "", "", "the namespace of the pod recorded in the backup manifests, defaults to the namespace of the service account")
+
 	err = viper.BindPFlags(startCmd.Flags())
 	if err != nil {
 		fmt.Printf("unable to construct initializer command: %v", err)
@@ -406,8 +769,34 @@ func init() {
 		os.Exit(1)
 	}
 
+	restoreListCmd.Flags().String(listFromFlg, "", "only lists backups taken at or after this time (RFC3339)")
+	restoreListCmd.Flags().String(listToFlg, "", "only lists backups taken before this time (RFC3339)")
+	restoreListCmd.Flags().Int32(listPageSizeFlg, 100, "the amount of backups fetched from the server with a single request")
+	err = viper.BindPFlags(restoreListCmd.Flags())
+	if err != nil {
+		fmt.Printf("unable to construct list-versions command: %v", err)
+		os.Exit(1)
+	}
+
+	restoreCmd.Flags().String(recoveryTargetTimeFlg, "", "replays the archived write-ahead log up to this timestamp after restoring the backup, e.g. \"2024-01-02 15:04:05+00\"")
+	restoreCmd.Flags().String(recoveryTargetLSNFlg, "", "replays the archived write-ahead log up to this log sequence number after restoring the backup")
+	restoreCmd.Flags().String(recoveryTargetNameFlg, "", "replays the archived write-ahead log up to this named restore point after restoring the backup")
+	err = viper.BindPFlags(restoreCmd.Flags())
+	if err != nil {
+		fmt.Printf("unable to construct restore command: %v", err)
+		os.Exit(1)
+	}
+
 	restoreCmd.AddCommand(restoreListCmd)
 
+	copyCmd.Flags().String(copyFromConfigFlg, "", "the config file of the backup provider the backups are copied from, defaults to the configuration of the sidecar")
+	copyCmd.Flags().String(copyToConfigFlg, "", "the config file of the backup provider the backups are copied to, defaults to the configuration of the sidecar")
+	err = viper.BindPFlags(copyCmd.Flags())
+	if err != nil {
+		fmt.Printf("unable to construct copy command: %v", err)
+		os.Exit(1)
+	}
+
 	downloadBackupCmd.Flags().StringP(downloadOutputFlg, "o", constants.DownloadDir, "the target directory for the downloaded backup")
 	err = viper.BindPFlags(downloadBackupCmd.Flags())
 	if err != nil {
@@ -416,6 +805,25 @@ func init() {
 	}
 }
 
+// podIdentity returns the name and the namespace of the pod the sidecar is running in
+func podIdentity() (string, string) {
+	name := viper.GetString(podNameFlg)
+	if name == "" {
+		// the hostname of a pod is its name
+		name, _ = os.Hostname()
+	}
+
+	namespace := viper.GetString(podNamespaceFlg)
+	if namespace == "" {
+		raw, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+		if err == nil {
+			namespace = strings.TrimSpace(string(raw))
+		}
+	}
+
+	return name, namespace
+}
+
 func initConfig() {
 	viper.SetEnvPrefix("BACKUP_RESTORE_SIDECAR")
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
@@ -449,6 +857,31 @@ func initConfig() {
 	}
 }
 
+// providerConfig reads the configuration of a backup provider from the given config file, which has the same format as the config file of the sidecar.
+// the configuration of the sidecar is returned if no file is given.
+func providerConfig(file string) (*viper.Viper, error) {
+	if file == "" {
+		return viper.GetViper(), nil
+	}
+
+	cfg := viper.New()
+	cfg.SetConfigType(cfgFileType)
+	cfg.SetConfigFile(file)
+
+	// the defaults of the flags apply to the config file as well
+	err := cfg.BindPFlags(startCmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %w", file, err)
+	}
+
+	return cfg, nil
+}
+
 func initLogging() {
 
 	level := slog.LevelInfo
@@ -486,13 +919,35 @@ func initDatabase() error {
 
 	switch dbString {
 	case "postgres":
-		db = postgres.New(
+		pg, err := postgres.New(
 			logger.WithGroup("postgres"),
 			datadir,
 			viper.GetString(postgresHostFlg),
 			viper.GetInt(postgresPortFlg),
 			viper.GetString(postgresUserFlg),
 			viper.GetString(postgresPasswordFlg),
+			viper.GetString(postgresBackupModeFlg),
+			viper.GetInt(postgresDumpJobsFlg),
+		)
+		if err != nil {
+			return err
+		}
+		pg.SetRestoreDatabase(viper.GetString(postgresRestoreDatabaseFlg))
+		db = pg
+	case "mysql", "mariadb":
+		db = mysql.New(
+			logger.WithGroup("mysql"),
+			datadir,
+			viper.GetString(mysqlHostFlg),
+			viper.GetInt(mysqlPortFlg),
+			viper.GetString(mysqlUserFlg),
+			viper.GetString(mysqlPasswordFlg),
+		)
+	case "mongodb":
+		db = mongodb.New(
+			logger.WithGroup("mongodb"),
+			datadir,
+			viper.GetString(mongodbURIFlg),
 		)
 	case "rethinkdb":
 		db = rethinkdb.New(
@@ -560,13 +1015,17 @@ func initCompressor() error {
 	if err != nil {
 		return fmt.Errorf("unable to initialize compressor: %w", err)
 	}
+	compressor.SetLimiter(throttle.New(int64(viper.GetSizeInBytes(archiveRateLimitFlg))))
 	logger.Info("initialized compressor")
 	return nil
 }
 
+func initLimiters() {
+	uploadLimiter = throttle.New(int64(viper.GetSizeInBytes(uploadRateLimitFlg)))
+	downloadLimiter = throttle.New(int64(viper.GetSizeInBytes(downloadRateLimitFlg)))
+}
+
 func initBackupProvider() error {
-	bpString := viper.GetString(backupProviderFlg)
-	var err error
 	suffix := ""
 	if compressor != nil {
 		suffix += compressor.Extension()
@@ -574,59 +1033,236 @@ func initBackupProvider() error {
 	if encrypter != nil {
 		suffix += encrypter.Extension()
 	}
+
+	var err error
+	bp, err = newBackupProviders(viper.GetViper(), suffix)
+	return err
+}
+
+func initPostgres() error {
+	pg, ok := db.(*postgres.Postgres)
+	if !ok {
+		if viper.GetBool(postgresWALArchivingFlg) {
+			return fmt.Errorf("wal archiving is only supported for postgres")
+		}
+		return nil
+	}
+
+	// backups which were taken incrementally can be restored even if incremental backups are disabled now
+	err := pg.SetIncrementalBackups(&postgres.IncrementalConfig{
+		BackupProvider:     bp,
+		Encrypter:          encrypter,
+		UploadLimiter:      uploadLimiter,
+		DownloadLimiter:    downloadLimiter,
+		FullBackupInterval: viper.GetDuration(postgresFullBackupIntervalFlg),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize incremental backups: %w", err)
+	}
+
+	if !viper.GetBool(postgresWALArchivingFlg) {
+		return nil
+	}
+
+	archive, err := wal.New(&wal.ArchiveConfig{
+		Log:             logger.WithGroup("wal"),
+		BackupProvider:  bp,
+		Encrypter:       encrypter,
+		PartialInterval: viper.GetDuration(postgresWALPartialIntervalFlg),
+		UploadLimiter:   uploadLimiter,
+		DownloadLimiter: downloadLimiter,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize wal archive: %w", err)
+	}
+
+	err = pg.SetWALArchive(archive)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("initialized wal archive")
+
+	return nil
+}
+
+// newBackupProviders initializes the backup providers configured in the given configuration,
+// multiple providers are combined such that the backups are replicated to all of them
+func newBackupProviders(cfg *viper.Viper, suffix string) (providers.BackupProvider, error) {
+	bpString := cfg.GetString(backupProviderFlg)
+
+	names := strings.Split(bpString, ",")
+	if len(names) == 1 {
+		bp, err := newBackupProvider(cfg, bpString, suffix)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("initialized backup provider", "type", bpString)
+		return bp, nil
+	}
+
+	var replicas []multi.Provider
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		p, err := newBackupProvider(cfg, name, suffix)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, multi.Provider{Name: name, Provider: p})
+	}
+
+	bp, err := multi.New(logger.WithGroup("backup"), &multi.BackupProviderConfigMulti{
+		Providers:         replicas,
+		FallbackTolerance: cfg.GetDuration(fallbackToleranceFlg),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing backup provider: %w", err)
+	}
+	logger.Info("initialized backup providers", "types", bpString)
+	return bp, nil
+}
+
+// newBackupProvider initializes the backup provider of the given type from the given configuration
+func newBackupProvider(cfg *viper.Viper, bpString, suffix string) (bp providers.BackupProvider, err error) {
+	retention := common.Retention{
+		Hourly:  cfg.GetInt(retentionHourlyFlg),
+		Daily:   cfg.GetInt(retentionDailyFlg),
+		Weekly:  cfg.GetInt(retentionWeeklyFlg),
+		Monthly: cfg.GetInt(retentionMonthlyFlg),
+		Yearly:  cfg.GetInt(retentionYearlyFlg),
+	}
+
 	switch bpString {
 	case "gcp":
 		bp, err = gcp.New(
 			context.Background(),
 			logger.WithGroup("backup"),
 			&gcp.BackupProviderConfigGCP{
-				ObjectPrefix:   viper.GetString(objectPrefixFlg),
-				ObjectsToKeep:  viper.GetInt64(objectsToKeepFlg),
-				ProjectID:      viper.GetString(gcpProjectFlg),
-				BucketName:     viper.GetString(gcpBucketNameFlg),
-				BucketLocation: viper.GetString(gcpBucketLocationFlg),
+				ObjectPrefix:   cfg.GetString(objectPrefixFlg),
+				ObjectsToKeep:  cfg.GetInt64(objectsToKeepFlg),
+				ProjectID:      cfg.GetString(gcpProjectFlg),
+				BucketName:     cfg.GetString(gcpBucketNameFlg),
+				BucketLocation: cfg.GetString(gcpBucketLocationFlg),
 				Suffix:         suffix,
+				Retention:      retention,
 			},
 		)
 	case "s3":
 		bkpConfig := &s3.BackupProviderConfigS3{
-			ObjectPrefix:  viper.GetString(objectPrefixFlg),
-			ObjectsToKeep: viper.GetInt32(objectsToKeepFlg),
-			Region:        viper.GetString(s3RegionFlg),
-			BucketName:    viper.GetString(s3BucketNameFlg),
-			Endpoint:      viper.GetString(s3EndpointFlg),
-			AccessKey:     viper.GetString(s3AccessKeyFlg),
-			SecretKey:     viper.GetString(s3SecretKeyFlg),
+			ObjectPrefix:  cfg.GetString(objectPrefixFlg),
+			ObjectsToKeep: cfg.GetInt32(objectsToKeepFlg),
+			Region:        cfg.GetString(s3RegionFlg),
+			BucketName:    cfg.GetString(s3BucketNameFlg),
+			Endpoint:      cfg.GetString(s3EndpointFlg),
+			AccessKey:     cfg.GetString(s3AccessKeyFlg),
+			SecretKey:     cfg.GetString(s3SecretKeyFlg),
 			Suffix:        suffix,
+			Retention:     retention,
+
+			CredentialsMode:      cfg.GetString(s3CredentialsMode),
+			RoleARN:              cfg.GetString(s3RoleARN),
+			WebIdentityTokenFile: cfg.GetString(s3WebIdentityTokenFile),
+			CredentialsFile:      cfg.GetString(s3CredentialsFile),
+			Profile:              cfg.GetString(s3Profile),
+
+			SSEMode:            cfg.GetString(s3SSEMode),
+			SSEKMSKeyID:        cfg.GetString(s3SSEKMSKeyID),
+			SSECustomerKeyFile: cfg.GetString(s3SSECustomerKeyFile),
+
+			ObjectLockMode:          cfg.GetString(s3ObjectLockMode),
+			ObjectLockRetentionDays: cfg.GetInt32(s3ObjectLockRetentionDays),
 		}
-		if viper.IsSet(s3InsecureSkipVerify) {
-			bkpConfig.InsecureSkipVerify = new(viper.GetBool(s3InsecureSkipVerify))
+		if cfg.IsSet(s3InsecureSkipVerify) {
+			bkpConfig.InsecureSkipVerify = new(cfg.GetBool(s3InsecureSkipVerify))
 		}
-		if viper.IsSet(s3TrustedCaCert) {
-			bkpConfig.TrustedCaCert = new(viper.GetString(s3TrustedCaCert))
+		if cfg.IsSet(s3TrustedCaCert) {
+			bkpConfig.TrustedCaCert = new(cfg.GetString(s3TrustedCaCert))
 		}
-		if viper.IsSet(objectDaysToKeepFlg) {
-			bkpConfig.ObjectDaysToKeep = new(viper.GetInt32(objectDaysToKeepFlg))
+		if cfg.IsSet(objectDaysToKeepFlg) {
+			bkpConfig.ObjectDaysToKeep = new(cfg.GetInt32(objectDaysToKeepFlg))
 		}
-		if viper.IsSet(s3RequestChecksumCalculation) {
-			bkpConfig.RequestChecksumCalculation = new(viper.GetString(s3RequestChecksumCalculation))
+		if cfg.IsSet(s3RequestChecksumCalculation) {
+			bkpConfig.RequestChecksumCalculation = new(cfg.GetString(s3RequestChecksumCalculation))
+		}
+		if cfg.IsSet(s3DownloadConcurrency) {
+			bkpConfig.DownloadConcurrency = cfg.GetInt(s3DownloadConcurrency)
+		}
+		if cfg.IsSet(s3DownloadPartSize) {
+			bkpConfig.DownloadPartSize = int64(cfg.GetSizeInBytes(s3DownloadPartSize))
+		}
+		if cfg.IsSet(s3DisableVersioning) {
+			bkpConfig.DisableVersioning = new(cfg.GetBool(s3DisableVersioning))
 		}
 		bp, err = s3.New(logger.WithGroup("backup"), bkpConfig)
+	case "azure":
+		bkpConfig := &azure.BackupProviderConfigAzure{
+			ObjectPrefix:  cfg.GetString(objectPrefixFlg),
+			ObjectsToKeep: cfg.GetInt64(objectsToKeepFlg),
+			ContainerName: cfg.GetString(azureContainerNameFlg),
+			AccountName:   cfg.GetString(azureAccountNameFlg),
+			AccountKey:    cfg.GetString(azureAccountKeyFlg),
+			Endpoint:      cfg.GetString(azureEndpointFlg),
+			Suffix:        suffix,
+			Retention:     retention,
+		}
+		if cfg.IsSet(objectDaysToKeepFlg) {
+			bkpConfig.ObjectDaysToKeep = new(cfg.GetInt64(objectDaysToKeepFlg))
+		}
+		bp, err = azure.New(logger.WithGroup("backup"), bkpConfig)
+	case "sftp":
+		bkpConfig := &sftp.BackupProviderConfigSFTP{
+			ObjectPrefix:         cfg.GetString(objectPrefixFlg),
+			ObjectsToKeep:        cfg.GetInt64(objectsToKeepFlg),
+			Host:                 cfg.GetString(sftpHostFlg),
+			User:                 cfg.GetString(sftpUserFlg),
+			Password:             cfg.GetString(sftpPasswordFlg),
+			PrivateKey:           cfg.GetString(sftpPrivateKeyFlg),
+			PrivateKeyPassphrase: cfg.GetString(sftpPrivateKeyPassphraseFlg),
+			HostKey:              cfg.GetString(sftpHostKeyFlg),
+			BasePath:             cfg.GetString(sftpBasePathFlg),
+			Suffix:               suffix,
+			Retention:            retention,
+		}
+		if cfg.IsSet(sftpInsecureIgnoreHostKey) {
+			bkpConfig.InsecureIgnoreHostKey = new(cfg.GetBool(sftpInsecureIgnoreHostKey))
+		}
+		if cfg.IsSet(objectDaysToKeepFlg) {
+			bkpConfig.ObjectDaysToKeep = new(cfg.GetInt64(objectDaysToKeepFlg))
+		}
+		bp, err = sftp.New(logger.WithGroup("backup"), bkpConfig)
 	case "local":
-		bp, err = local.New(
-			logger.WithGroup("backup"),
-			&local.BackupProviderConfigLocal{
-				LocalBackupPath: viper.GetString(localBackupPathFlg),
-				ObjectsToKeep:   viper.GetInt64(objectsToKeepFlg),
-				Suffix:          suffix,
-			},
-		)
+		bkpConfig := &local.BackupProviderConfigLocal{
+			LocalBackupPath: cfg.GetString(localBackupPathFlg),
+			ObjectsToKeep:   cfg.GetInt64(objectsToKeepFlg),
+			Suffix:          suffix,
+			Retention:       retention,
+		}
+		if cfg.IsSet(objectDaysToKeepFlg) {
+			bkpConfig.ObjectDaysToKeep = new(cfg.GetInt64(objectDaysToKeepFlg))
+		}
+		bp, err = local.New(logger.WithGroup("backup"), bkpConfig)
 	default:
-		return fmt.Errorf("unsupported backup provider type: %s", bpString)
+		return nil, fmt.Errorf("unsupported backup provider type: %s", bpString)
 	}
 	if err != nil {
-		return fmt.Errorf("error initializing backup provider: %w", err)
+		return nil, fmt.Errorf("error initializing backup provider %s: %w", bpString, err)
 	}
-	logger.Info("initialized backup provider", "type", bpString)
-	return nil
+
+	retryConfig := &retry.BackupProviderConfigRetry{
+		Provider: bp,
+		Attempts: cfg.GetUint(retryAttemptsFlg),
+		Delay:    cfg.GetDuration(retryDelayFlg),
+		MaxDelay: cfg.GetDuration(retryMaxDelayFlg),
+		// the spooled stream of a retried upload is not passed through the limiter of the backuper anymore
+		UploadLimiter: uploadLimiter,
+	}
+	if cfg.GetBool(retrySpoolFlg) {
+		retryConfig.SpoolDir = constants.UploadDir
+	}
+
+	bp, err = retry.New(logger.WithGroup("backup"), retryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing retries of backup provider %s: %w", bpString, err)
+	}
+	return bp, nil
 }
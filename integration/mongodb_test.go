@@ -0,0 +1,110 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/metal-stack/backup-restore-sidecar/pkg/generate/examples/examples"
+)
+
+const (
+	mongodbTestDB         = "backuprestore"
+	mongodbTestCollection = "backuprestore"
+)
+
+func Test_MongoDB_Restore(t *testing.T) {
+	restoreFlow(t, &flowSpec{
+		databaseType:     examples.MongoDB,
+		sts:              examples.MongoDBSts,
+		backingResources: examples.MongoDBBackingResources,
+		addTestData:      addMongoDBTestData,
+		verifyTestData:   verifyMongoDBTestData,
+	})
+}
+
+func Test_MongoDB_RestoreLatestFromMultipleBackups(t *testing.T) {
+	restoreLatestFromMultipleBackupsFlow(t, &flowSpec{
+		databaseType:            examples.MongoDB,
+		sts:                     examples.MongoDBSts,
+		backingResources:        examples.MongoDBBackingResources,
+		addTestDataWithIndex:    addMongoDBTestDataWithIndex,
+		verifyTestDataWithIndex: verifyMongoDBTestDataWithIndex,
+	})
+}
+
+func newMongoDBClient(t *testing.T, ctx context.Context) *mongo.Client {
+	var cli *mongo.Client
+
+	err := retry.Do(func() error {
+		uri := fmt.Sprintf("mongodb://%s:%s@127.0.0.1:27017/?directConnection=true", examples.MongoDBUser, examples.MongoDBPassword)
+
+		var err error
+		cli, err = mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			return err
+		}
+
+		return cli.Ping(ctx, nil)
+	}, retry.Context(ctx))
+	require.NoError(t, err)
+
+	return cli
+}
+
+func addMongoDBTestData(t *testing.T, ctx context.Context) {
+	cli := newMongoDBClient(t, ctx)
+	defer func() {
+		_ = cli.Disconnect(ctx)
+	}()
+
+	_, err := cli.Database(mongodbTestDB).Collection(mongodbTestCollection).InsertOne(ctx, bson.D{{Key: "data", Value: "I am precious"}})
+	require.NoError(t, err)
+}
+
+func verifyMongoDBTestData(t *testing.T, ctx context.Context) {
+	cli := newMongoDBClient(t, ctx)
+	defer func() {
+		_ = cli.Disconnect(ctx)
+	}()
+
+	var doc struct {
+		Data string `bson:"data"`
+	}
+
+	err := cli.Database(mongodbTestDB).Collection(mongodbTestCollection).FindOne(ctx, bson.D{}).Decode(&doc)
+	require.NoError(t, err)
+
+	assert.Equal(t, "I am precious", doc.Data)
+}
+
+func addMongoDBTestDataWithIndex(t *testing.T, ctx context.Context, index int) {
+	cli := newMongoDBClient(t, ctx)
+	defer func() {
+		_ = cli.Disconnect(ctx)
+	}()
+
+	_, err := cli.Database(mongodbTestDB).Collection(mongodbTestCollection).InsertOne(ctx, bson.D{{Key: "data", Value: fmt.Sprintf("idx-%d", index)}})
+	require.NoError(t, err)
+}
+
+func verifyMongoDBTestDataWithIndex(t *testing.T, ctx context.Context, index int) {
+	cli := newMongoDBClient(t, ctx)
+	defer func() {
+		_ = cli.Disconnect(ctx)
+	}()
+
+	count, err := cli.Database(mongodbTestDB).Collection(mongodbTestCollection).CountDocuments(ctx, bson.D{{Key: "data", Value: fmt.Sprintf("idx-%d", index)}})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), count)
+}
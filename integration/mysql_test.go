@@ -0,0 +1,147 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-stack/backup-restore-sidecar/pkg/generate/examples/examples"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func Test_MySQL_Restore(t *testing.T) {
+	restoreFlow(t, &flowSpec{
+		databaseType:     examples.MySQL,
+		sts:              examples.MySQLSts,
+		backingResources: examples.MySQLBackingResources,
+		addTestData:      addMySQLTestData,
+		verifyTestData:   verifyMySQLTestData,
+	})
+}
+
+func Test_MySQL_RestoreLatestFromMultipleBackups(t *testing.T) {
+	restoreLatestFromMultipleBackupsFlow(t, &flowSpec{
+		databaseType:            examples.MySQL,
+		sts:                     examples.MySQLSts,
+		backingResources:        examples.MySQLBackingResources,
+		addTestDataWithIndex:    addMySQLTestDataWithIndex,
+		verifyTestDataWithIndex: verifyMySQLTestDataWithIndex,
+	})
+}
+
+func newMySQLSession(t *testing.T, ctx context.Context) *sql.DB {
+	var db *sql.DB
+	err := retry.Do(func() error {
+		connString := fmt.Sprintf("%s:%s@tcp(127.0.0.1:3306)/%s", examples.MySQLUser, examples.MySQLPassword, examples.MySQLDB)
+
+		var err error
+		db, err = sql.Open("mysql", connString)
+		if err != nil {
+			return err
+		}
+
+		err = db.PingContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}, retry.Context(ctx))
+	require.NoError(t, err)
+
+	return db
+}
+
+func addMySQLTestData(t *testing.T, ctx context.Context) {
+	db := newMySQLSession(t, ctx)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var (
+		createStmt = `CREATE TABLE backuprestore (
+			data text NOT NULL
+		 );`
+		insertStmt = `INSERT INTO backuprestore (data) VALUES ('I am precious');`
+	)
+
+	_, err := db.Exec(createStmt)
+	require.NoError(t, err)
+
+	_, err = db.Exec(insertStmt)
+	require.NoError(t, err)
+}
+
+func addMySQLTestDataWithIndex(t *testing.T, ctx context.Context, index int) {
+	db := newMySQLSession(t, ctx)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var (
+		createStmt = `CREATE TABLE IF NOT EXISTS backuprestore (
+			data text NOT NULL
+		 );`
+		insertStmt = fmt.Sprintf("INSERT INTO backuprestore (data) VALUES ('idx-%d');", index)
+	)
+
+	_, err := db.Exec(createStmt)
+	require.NoError(t, err)
+
+	_, err = db.Exec(insertStmt)
+	require.NoError(t, err)
+}
+
+func verifyMySQLTestDataWithIndex(t *testing.T, ctx context.Context, index int) {
+	db := newMySQLSession(t, ctx)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rows, err := db.Query(fmt.Sprintf("SELECT data FROM backuprestore WHERE data='idx-%d';", index))
+	require.NoError(t, err)
+	require.NoError(t, rows.Err())
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	require.True(t, rows.Next())
+	var data string
+
+	err = rows.Scan(&data)
+	require.NoError(t, err)
+
+	assert.Equal(t, fmt.Sprintf("idx-%d", index), data)
+	assert.False(t, rows.Next())
+}
+
+func verifyMySQLTestData(t *testing.T, ctx context.Context) {
+	db := newMySQLSession(t, ctx)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rows, err := db.Query(`SELECT data FROM backuprestore;`)
+	require.NoError(t, err)
+	require.NoError(t, rows.Err())
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	require.True(t, rows.Next())
+	var data string
+
+	err = rows.Scan(&data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "I am precious", data)
+	assert.False(t, rows.Next())
+}
@@ -0,0 +1,62 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/metal-stack/backup-restore-sidecar/pkg/generate/examples/examples"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	_ "github.com/lib/pq"
+)
+
+func Test_Postgres_LogicalRestore(t *testing.T) {
+	backingResources := examples.PostgresBackingResources(namespaceName(t))
+
+	modified := false
+
+	for _, r := range backingResources {
+		cm, ok := r.(*corev1.ConfigMap)
+		if !ok {
+			continue
+		}
+
+		if cm.Name != "backup-restore-sidecar-config-postgres" {
+			continue
+		}
+
+		cm.Data = map[string]string{
+			"config.yaml": `---
+bind-addr: 0.0.0.0
+db: postgres
+db-data-directory: /data/postgres/
+backup-provider: local
+backup-cron-schedule: "*/1 * * * *"
+object-prefix: postgres-test
+compression-method: tar
+postgres-backup-mode: logical
+postgres-dump-jobs: 2
+encryption-key: "01234567891234560123456789123456"
+post-exec-cmds:
+- docker-entrypoint.sh postgres
+`}
+
+		modified = true
+		break
+	}
+
+	require.True(t, modified)
+
+	restoreFlow(t, &flowSpec{
+		databaseType: examples.Postgres,
+		sts:          examples.PostgresSts,
+		backingResources: func(namespace string) []client.Object {
+			return backingResources
+		},
+		addTestData:    addPostgresTestData,
+		verifyTestData: verifyPostgresTestData,
+	})
+}
@@ -16,4 +16,8 @@ const (
 	RestoreDir = SidecarBaseDir + "/restore/files"
 	// DownloadDir is the path where the backup archive will be downloaded to before it is being unarchived to the restore dir
 	DownloadDir = SidecarBaseDir + "/restore"
+	// WALDir is the directory in the sidecar where the streamed write-ahead log of postgres lives in until it is archived
+	WALDir = SidecarBaseDir + "/wal"
+	// BackupChainDir is the directory in the sidecar where the manifest of the last postgres base backup is kept, the next incremental backup is based on it
+	BackupChainDir = SidecarBaseDir + "/chain"
 )
@@ -29,6 +29,16 @@ func main() {
 			sts:     examples.PostgresSts,
 			backing: examples.PostgresBackingResources,
 		},
+		{
+			db:      examples.MySQL,
+			sts:     examples.MySQLSts,
+			backing: examples.MySQLBackingResources,
+		},
+		{
+			db:      examples.MongoDB,
+			sts:     examples.MongoDBSts,
+			backing: examples.MongoDBBackingResources,
+		},
 		{
 			db:      examples.RethinkDB,
 			sts:     examples.RethinkDbSts,
@@ -0,0 +1,328 @@
+package examples
+
+import (
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	MongoDB = "mongodb"
+
+	MongoDBPassword = "test123"
+	MongoDBUser     = "root"
+
+	mongodbContainerImage = "mongo:8.0"
+)
+
+func MongoDBSts(namespace string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mongodb",
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "mongodb",
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: "mongodb",
+			Replicas:    new(int32(1)),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "mongodb",
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app": "mongodb",
+					},
+				},
+				Spec: corev1.PodSpec{
+					HostNetwork: true,
+					Containers: []corev1.Container{
+						{
+							Name:    "mongodb",
+							Image:   mongodbContainerImage,
+							Command: []string{"backup-restore-sidecar", "wait"},
+							LivenessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"mongosh", "--quiet", "--eval", "db.adminCommand('ping')"},
+									},
+								},
+								InitialDelaySeconds: 30,
+								TimeoutSeconds:      5,
+								PeriodSeconds:       10,
+								SuccessThreshold:    1,
+								FailureThreshold:    6,
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"mongosh", "--quiet", "--eval", "db.adminCommand('ping')"},
+									},
+								},
+								InitialDelaySeconds: 5,
+								TimeoutSeconds:      5,
+								PeriodSeconds:       10,
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "MONGO_INITDB_ROOT_USERNAME",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "mongodb",
+											},
+											Key: "MONGO_INITDB_ROOT_USERNAME",
+										},
+									},
+								},
+								{
+									Name: "MONGO_INITDB_ROOT_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "mongodb",
+											},
+											Key: "MONGO_INITDB_ROOT_PASSWORD",
+										},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: 27017,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "data",
+									MountPath: "/data/db",
+								},
+								{
+									Name:      "bin-provision",
+									SubPath:   "backup-restore-sidecar",
+									MountPath: "/usr/local/bin/backup-restore-sidecar",
+								},
+								{
+									Name:      "backup-restore-sidecar-config",
+									MountPath: "/etc/backup-restore-sidecar",
+								},
+							},
+						},
+						{
+							Name:    "backup-restore-sidecar",
+							Image:   mongodbContainerImage,
+							Command: []string{"backup-restore-sidecar", "start", "--log-level=debug"},
+							Env: []corev1.EnvVar{
+								{
+									Name: "BACKUP_RESTORE_SIDECAR_MONGODB_URI",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "mongodb",
+											},
+											Key: "MONGODB_URI",
+										},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "grpc",
+									ContainerPort: 8000,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "backup",
+									MountPath: constants.SidecarBaseDir,
+								},
+								{
+									Name:      "data",
+									MountPath: "/data/db",
+								},
+								{
+									Name:      "backup-restore-sidecar-config",
+									MountPath: "/etc/backup-restore-sidecar",
+								},
+								{
+									Name:      "bin-provision",
+									SubPath:   "backup-restore-sidecar",
+									MountPath: "/usr/local/bin/backup-restore-sidecar",
+								},
+							},
+						},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:            "backup-restore-sidecar-provider",
+							Image:           backupRestoreSidecarContainerImage,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Command: []string{
+								"cp",
+								"/backup-restore-sidecar",
+								"/bin-provision",
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "bin-provision",
+									MountPath: "/bin-provision",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: "data",
+								},
+							},
+						},
+						{
+							Name: "backup",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: "backup",
+								},
+							},
+						},
+						{
+							Name: "backup-restore-sidecar-config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: "backup-restore-sidecar-config-mongodb",
+									},
+								},
+							},
+						},
+						{
+							Name: "bin-provision",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "data",
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{
+							corev1.ReadWriteOnce,
+						},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse("1Gi"),
+							},
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "backup",
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{
+							corev1.ReadWriteOnce,
+						},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse("1Gi"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func MongoDBBackingResources(namespace string) []client.Object {
+	return []client.Object{
+		&corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "backup-restore-sidecar-config-mongodb",
+				Namespace: namespace,
+			},
+			Data: map[string]string{
+				"config.yaml": `---
+bind-addr: 0.0.0.0
+db: mongodb
+db-data-directory: /data/db/
+backup-provider: local
+backup-cron-schedule: "*/1 * * * *"
+object-prefix: mongodb-test
+encryption-key: "01234567891234560123456789123456"
+post-exec-cmds:
+- docker-entrypoint.sh mongod
+`,
+			},
+		},
+		&corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mongodb",
+				Namespace: namespace,
+			},
+			StringData: map[string]string{
+				"MONGO_INITDB_ROOT_USERNAME": MongoDBUser,
+				"MONGO_INITDB_ROOT_PASSWORD": MongoDBPassword,
+				"MONGODB_URI":                "mongodb://" + MongoDBUser + ":" + MongoDBPassword + "@127.0.0.1:27017/?directConnection=true",
+			},
+		},
+		&corev1.Service{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Service",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mongodb",
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": "mongodb",
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{
+					"app": "mongodb",
+				},
+				Ports: []corev1.ServicePort{
+					{
+						Name:       "27017",
+						Port:       27017,
+						TargetPort: intstr.FromInt32(27017),
+					},
+					{
+						Name:       "metrics",
+						Port:       2112,
+						TargetPort: intstr.FromInt32(2112),
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,328 @@
+package examples
+
+import (
+	"github.com/metal-stack/backup-restore-sidecar/pkg/constants"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	MySQL = "mysql"
+
+	MySQLDB       = "backuprestore"
+	MySQLPassword = "test123!"
+	MySQLUser     = "root"
+
+	mysqlContainerImage = "mariadb:11.4"
+)
+
+func MySQLSts(namespace string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mysql",
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "mysql",
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: "mysql",
+			Replicas:    new(int32(1)),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "mysql",
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app": "mysql",
+					},
+				},
+				Spec: corev1.PodSpec{
+					HostNetwork: true,
+					Containers: []corev1.Container{
+						{
+							Name:    "mysql",
+							Image:   mysqlContainerImage,
+							Command: []string{"backup-restore-sidecar", "wait"},
+							LivenessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"mariadb-admin", "ping", "-h", "127.0.0.1", "-P", "3306"},
+									},
+								},
+								InitialDelaySeconds: 30,
+								TimeoutSeconds:      5,
+								PeriodSeconds:       10,
+								SuccessThreshold:    1,
+								FailureThreshold:    6,
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"mariadb-admin", "ping", "-h", "127.0.0.1", "-P", "3306"},
+									},
+								},
+								InitialDelaySeconds: 5,
+								TimeoutSeconds:      5,
+								PeriodSeconds:       10,
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "MARIADB_DATABASE",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "mysql",
+											},
+											Key: "MARIADB_DATABASE",
+										},
+									},
+								},
+								{
+									Name: "MARIADB_ROOT_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "mysql",
+											},
+											Key: "MARIADB_ROOT_PASSWORD",
+										},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: 3306,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "data",
+									MountPath: "/var/lib/mysql",
+								},
+								{
+									Name:      "bin-provision",
+									SubPath:   "backup-restore-sidecar",
+									MountPath: "/usr/local/bin/backup-restore-sidecar",
+								},
+								{
+									Name:      "backup-restore-sidecar-config",
+									MountPath: "/etc/backup-restore-sidecar",
+								},
+							},
+						},
+						{
+							Name:    "backup-restore-sidecar",
+							Image:   mysqlContainerImage,
+							Command: []string{"backup-restore-sidecar", "start", "--log-level=debug"},
+							Env: []corev1.EnvVar{
+								{
+									Name: "BACKUP_RESTORE_SIDECAR_MYSQL_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "mysql",
+											},
+											Key: "MARIADB_ROOT_PASSWORD",
+										},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "grpc",
+									ContainerPort: 8000,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "backup",
+									MountPath: constants.SidecarBaseDir,
+								},
+								{
+									Name:      "data",
+									MountPath: "/var/lib/mysql",
+								},
+								{
+									Name:      "backup-restore-sidecar-config",
+									MountPath: "/etc/backup-restore-sidecar",
+								},
+								{
+									Name:      "bin-provision",
+									SubPath:   "backup-restore-sidecar",
+									MountPath: "/usr/local/bin/backup-restore-sidecar",
+								},
+							},
+						},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:            "backup-restore-sidecar-provider",
+							Image:           backupRestoreSidecarContainerImage,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Command: []string{
+								"cp",
+								"/backup-restore-sidecar",
+								"/bin-provision",
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "bin-provision",
+									MountPath: "/bin-provision",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: "data",
+								},
+							},
+						},
+						{
+							Name: "backup",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: "backup",
+								},
+							},
+						},
+						{
+							Name: "backup-restore-sidecar-config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: "backup-restore-sidecar-config-mysql",
+									},
+								},
+							},
+						},
+						{
+							Name: "bin-provision",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "data",
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{
+							corev1.ReadWriteOnce,
+						},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse("1Gi"),
+							},
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "backup",
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{
+							corev1.ReadWriteOnce,
+						},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse("1Gi"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func MySQLBackingResources(namespace string) []client.Object {
+	return []client.Object{
+		&corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "backup-restore-sidecar-config-mysql",
+				Namespace: namespace,
+			},
+			Data: map[string]string{
+				"config.yaml": `---
+bind-addr: 0.0.0.0
+db: mysql
+db-data-directory: /var/lib/mysql/
+backup-provider: local
+backup-cron-schedule: "*/1 * * * *"
+object-prefix: mysql-test
+encryption-key: "01234567891234560123456789123456"
+post-exec-cmds:
+- docker-entrypoint.sh mariadbd
+`,
+			},
+		},
+		&corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mysql",
+				Namespace: namespace,
+			},
+			StringData: map[string]string{
+				"MARIADB_DATABASE":      MySQLDB,
+				"MARIADB_ROOT_PASSWORD": MySQLPassword,
+			},
+		},
+		&corev1.Service{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Service",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mysql",
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": "mysql",
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{
+					"app": "mysql",
+				},
+				Ports: []corev1.ServicePort{
+					{
+						Name:       "3306",
+						Port:       3306,
+						TargetPort: intstr.FromInt32(3306),
+					},
+					{
+						Name:       "metrics",
+						Port:       2112,
+						TargetPort: intstr.FromInt32(2112),
+					},
+				},
+			},
+		},
+	}
+}